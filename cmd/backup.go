@@ -15,13 +15,36 @@ import (
 )
 
 func runBackupCommand(command *cobra.Command, cmdName string) error {
-	cfg := task.BackupConfig{Config: task.Config{LogProgress: HasLogFile()}}
+	cfg := task.BackupConfig{Config: task.Config{LogProgress: HasLogFile()}, LogFile: LogFile()}
 	if err := cfg.ParseFromFlags(command.Flags()); err != nil {
 		command.SilenceUsage = false
 		return err
 	}
-	if err := task.RunBackup(GetDefaultContext(), tidbGlue, cmdName, &cfg); err != nil {
+	err := task.RunBackup(GetDefaultContext(), tidbGlue, cmdName, &cfg)
+	printSummary(command, cmdName, &cfg.Config, err)
+	if err != nil {
 		log.Error("failed to backup", zap.Error(err))
+		printRecoveryGuide(command, err, task.RecoveryOptions{Resume: !cfg.SchemaOnly})
+		return err
+	}
+	return nil
+}
+
+func runBackupSchemaCommand(command *cobra.Command, cmdName string) error {
+	cfg := task.BackupConfig{
+		Config:     task.Config{LogProgress: HasLogFile()},
+		SchemaOnly: true,
+		LogFile:    LogFile(),
+	}
+	if err := cfg.ParseFromFlags(command.Flags()); err != nil {
+		command.SilenceUsage = false
+		return err
+	}
+	err := task.RunBackup(GetDefaultContext(), tidbGlue, cmdName, &cfg)
+	printSummary(command, cmdName, &cfg.Config, err)
+	if err != nil {
+		log.Error("failed to backup schemas", zap.Error(err))
+		printRecoveryGuide(command, err, task.RecoveryOptions{})
 		return err
 	}
 	return nil
@@ -33,8 +56,11 @@ func runBackupRawCommand(command *cobra.Command, cmdName string) error {
 		command.SilenceUsage = false
 		return err
 	}
-	if err := task.RunBackupRaw(GetDefaultContext(), gluetikv.Glue{}, cmdName, &cfg); err != nil {
+	err := task.RunBackupRaw(GetDefaultContext(), gluetikv.Glue{}, cmdName, &cfg)
+	printSummary(command, cmdName, &cfg.Config, err)
+	if err != nil {
 		log.Error("failed to backup raw kv", zap.Error(err))
+		printRecoveryGuide(command, err, task.RecoveryOptions{})
 		return err
 	}
 	return nil
@@ -65,6 +91,8 @@ func NewBackupCommand() *cobra.Command {
 		newDBBackupCommand(),
 		newTableBackupCommand(),
 		newRawBackupCommand(),
+		newSchemaOnlyBackupCommand(),
+		newFleetBackupCommand(),
 	)
 
 	task.DefineBackupFlags(command.PersistentFlags())
@@ -102,6 +130,20 @@ func newDBBackupCommand() *cobra.Command {
 	return command
 }
 
+// newSchemaOnlyBackupCommand return a schema only backup subcommand.
+func newSchemaOnlyBackupCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "schema-only",
+		Short: "backup the schemas and statistics of the tables without data",
+		Args:  cobra.NoArgs,
+		RunE: func(command *cobra.Command, _ []string) error {
+			return runBackupSchemaCommand(command, "Schema backup")
+		},
+	}
+	task.DefineFilterFlags(command)
+	return command
+}
+
 // newTableBackupCommand return a table backup subcommand.
 func newTableBackupCommand() *cobra.Command {
 	command := &cobra.Command{
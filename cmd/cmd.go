@@ -4,19 +4,27 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/config"
 	"github.com/pingcap/tidb/util/logutil"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 
+	berrors "github.com/pingcap/br/pkg/errors"
 	"github.com/pingcap/br/pkg/gluetidb"
+	brlogutil "github.com/pingcap/br/pkg/logutil"
 	"github.com/pingcap/br/pkg/summary"
 	"github.com/pingcap/br/pkg/task"
 	"github.com/pingcap/br/pkg/utils"
@@ -26,6 +34,9 @@ var (
 	initOnce        = sync.Once{}
 	defaultContext  context.Context
 	hasLogFile      uint64
+	logFile         string
+	jobTmpDirMu     sync.Mutex
+	jobTmpDir       string
 	tidbGlue        = gluetidb.New()
 	envLogToTermKey = "BR_LOG_TO_TERM"
 )
@@ -41,13 +52,23 @@ const (
 	FlagStatusAddr = "status-addr"
 	// FlagSlowLogFile is the name of slow-log-file flag.
 	FlagSlowLogFile = "slow-log-file"
+	// FlagTmpDir is the name of tmp-dir flag.
+	FlagTmpDir = "tmp-dir"
+	// FlagLogMaxSize is the name of log-max-size flag.
+	FlagLogMaxSize = "log-max-size"
+	// FlagLogMaxDays is the name of log-max-days flag.
+	FlagLogMaxDays = "log-max-days"
+	// FlagLogMaxBackups is the name of log-max-backups flag.
+	FlagLogMaxBackups = "log-max-backups"
+	// FlagRedactLog is the name of redact-log flag.
+	FlagRedactLog = "redact-log"
 
 	flagVersion      = "version"
 	flagVersionShort = "V"
 )
 
-func timestampLogFileName() string {
-	return filepath.Join(os.TempDir(), time.Now().Format("br.log.2006-01-02T15.04.05Z0700"))
+func timestampLogFileName(dir string) string {
+	return filepath.Join(dir, time.Now().Format("br.log.2006-01-02T15.04.05Z0700"))
 }
 
 // AddFlags adds flags to the given cmd.
@@ -58,12 +79,23 @@ func AddFlags(cmd *cobra.Command) {
 
 	cmd.PersistentFlags().StringP(FlagLogLevel, "L", "info",
 		"Set the log level")
-	cmd.PersistentFlags().String(FlagLogFile, timestampLogFileName(),
+	cmd.PersistentFlags().String(FlagLogFile, timestampLogFileName(os.TempDir()),
 		"Set the log file path. If not set, logs will output to temp file")
 	cmd.PersistentFlags().String(FlagLogFormat, "text",
-		"Set the log format")
+		"Set the log format, text or json")
+	cmd.PersistentFlags().Int(FlagLogMaxSize, 0,
+		"Rotate the log file once it reaches the size in MB, 0 means 300MB")
+	cmd.PersistentFlags().Int(FlagLogMaxDays, 0,
+		"Remove the rotated log files older than the days, 0 means they are never removed by age")
+	cmd.PersistentFlags().Int(FlagLogMaxBackups, 0,
+		"Keep at most the number of the rotated log files, 0 means all are kept")
+	cmd.PersistentFlags().Bool(FlagRedactLog, false,
+		"Elide the keys and the values which may contain user data in the log")
 	cmd.PersistentFlags().String(FlagStatusAddr, "",
 		"Set the HTTP listening address for the status report service. Set to empty string to disable")
+	cmd.PersistentFlags().String(FlagTmpDir, os.TempDir(),
+		"Set the directory for temporary files, a directory for the task is created in it and removed on exit, "+
+			"the default log file is put in it too")
 	task.DefineCommonFlags(cmd.PersistentFlags())
 
 	cmd.PersistentFlags().StringP(FlagSlowLogFile, "", "",
@@ -74,6 +106,14 @@ func AddFlags(cmd *cobra.Command) {
 // Init initializes BR cli.
 func Init(cmd *cobra.Command) (err error) {
 	initOnce.Do(func() {
+		// Apply the config file and the environment variables before any
+		// flag is read.
+		unknownConfigs, e := task.ApplyConfig(cmd.Flags(), os.LookupEnv)
+		if e != nil {
+			err = e
+			return
+		}
+
 		// Initialize the logger.
 		conf := new(log.Config)
 		conf.Level, err = cmd.Flags().GetString(FlagLogLevel)
@@ -84,10 +124,37 @@ func Init(cmd *cobra.Command) (err error) {
 		if err != nil {
 			return
 		}
+		tmpDir, e := cmd.Flags().GetString(FlagTmpDir)
+		if e != nil {
+			err = e
+			return
+		}
+		if !cmd.Flags().Changed(FlagLogFile) {
+			// The log outlives the task, so it's put into --tmp-dir rather
+			// than the directory of the task.
+			conf.File.Filename = timestampLogFileName(tmpDir)
+		}
 		conf.Format, err = cmd.Flags().GetString(FlagLogFormat)
 		if err != nil {
 			return
 		}
+		if conf.Format != "text" && conf.Format != "json" {
+			err = errors.Annotatef(berrors.ErrInvalidArgument, "--%s must be text or json, got %s",
+				FlagLogFormat, conf.Format)
+			return
+		}
+		conf.File.MaxSize, err = cmd.Flags().GetInt(FlagLogMaxSize)
+		if err != nil {
+			return
+		}
+		conf.File.MaxDays, err = cmd.Flags().GetInt(FlagLogMaxDays)
+		if err != nil {
+			return
+		}
+		conf.File.MaxBackups, err = cmd.Flags().GetInt(FlagLogMaxBackups)
+		if err != nil {
+			return
+		}
 		_, outputLogToTerm := os.LookupEnv(envLogToTermKey)
 		if outputLogToTerm {
 			// Log to term if env `BR_LOG_TO_TERM` is set.
@@ -95,6 +162,7 @@ func Init(cmd *cobra.Command) (err error) {
 		}
 		if len(conf.File.Filename) != 0 {
 			atomic.StoreUint64(&hasLogFile, 1)
+			logFile = conf.File.Filename
 			summary.InitCollector(true)
 			// cmd.PrintErr prints to stderr, but PrintErrf prints to stdout.
 			cmd.PrintErr(fmt.Sprintf("Detail BR log in %s \n", conf.File.Filename))
@@ -105,6 +173,15 @@ func Init(cmd *cobra.Command) (err error) {
 			return
 		}
 		log.ReplaceGlobals(lg, p)
+		redactLog, e := cmd.Flags().GetBool(FlagRedactLog)
+		if e != nil {
+			err = e
+			return
+		}
+		brlogutil.InitRedact(redactLog)
+		if len(unknownConfigs) != 0 {
+			log.Warn("the configs aren't the flags of the command, ignored", zap.Strings("configs", unknownConfigs))
+		}
 
 		slowLogFilename, e := cmd.Flags().GetString(FlagSlowLogFile)
 		if e != nil {
@@ -127,12 +204,39 @@ func Init(cmd *cobra.Command) (err error) {
 			return
 		}
 
+		// Put the temporary files, e.g. the spilled data of TiDB, into a
+		// directory of this task, so they can be removed on exit.
+		dir, e := ioutil.TempDir(tmpDir, "br-")
+		if e != nil {
+			err = e
+			return
+		}
+		jobTmpDirMu.Lock()
+		jobTmpDir = dir
+		jobTmpDirMu.Unlock()
+		config.UpdateGlobal(func(conf *config.Config) {
+			conf.TempStoragePath = dir
+		})
+		// The temporary files created by os.TempDir, e.g. the parts staged by
+		// the storage SDKs, go into it too. TMP is read on Windows.
+		for _, env := range []string{"TMPDIR", "TMP"} {
+			if e = os.Setenv(env, dir); e != nil {
+				err = e
+				return
+			}
+		}
+		log.Info("temporary directory created", zap.String("path", dir))
+
 		// Initialize the pprof server.
 		statusAddr, e := cmd.Flags().GetString(FlagStatusAddr)
 		if e != nil {
 			err = e
 			return
 		}
+		utils.SetStatusHandler(utils.LogLevelPath, http.HandlerFunc(utils.LogLevelHandler))
+		if err = task.WatchConfigReload(cmd.Flags()); err != nil {
+			return
+		}
 		if statusAddr != "" {
 			utils.StartPProfListener(statusAddr)
 		} else {
@@ -142,11 +246,41 @@ func Init(cmd *cobra.Command) (err error) {
 	return err
 }
 
+// Cleanup removes the temporary directory of the task,
+// it should be called before BR exits.
+func Cleanup() {
+	jobTmpDirMu.Lock()
+	defer jobTmpDirMu.Unlock()
+	if jobTmpDir == "" {
+		return
+	}
+	var size int64
+	_ = filepath.Walk(jobTmpDir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err := os.RemoveAll(jobTmpDir); err != nil {
+		log.Warn("failed to remove temporary directory",
+			zap.String("path", jobTmpDir), zap.Int64("size", size), zap.Error(err))
+		return
+	}
+	log.Info("temporary directory removed", zap.String("path", jobTmpDir), zap.Int64("size", size))
+	jobTmpDir = ""
+}
+
 // HasLogFile returns whether we set a log file.
 func HasLogFile() bool {
 	return atomic.LoadUint64(&hasLogFile) != uint64(0)
 }
 
+// LogFile returns the path of the log file, empty if the log is written to
+// the terminal.
+func LogFile() string {
+	return logFile
+}
+
 // SetDefaultContext sets the default context for command line usage.
 func SetDefaultContext(ctx context.Context) {
 	defaultContext = ctx
@@ -156,3 +290,23 @@ func SetDefaultContext(ctx context.Context) {
 func GetDefaultContext() context.Context {
 	return defaultContext
 }
+
+// printSummary prints the JSON summary of the task in a single line to stdout,
+// and saves it into the storage if --save-summary is set.
+func printSummary(cmd *cobra.Command, cmdName string, cfg *task.Config, err error) {
+	data, e := json.Marshal(summary.BuildReport(cmdName, err))
+	if e != nil {
+		log.Warn("failed to marshal the summary", zap.Error(e))
+		return
+	}
+	cmd.Println(string(data))
+	if cfg.SaveSummary {
+		task.SaveSummary(GetDefaultContext(), cfg, data)
+	}
+}
+
+// printRecoveryGuide prints the next steps of a failed task to stderr.
+func printRecoveryGuide(cmd *cobra.Command, err error, opts task.RecoveryOptions) {
+	opts.Args = os.Args
+	fmt.Fprint(cmd.ErrOrStderr(), task.RecoveryGuide(cmd.CommandPath(), err, opts))
+}
@@ -23,6 +23,7 @@ import (
 
 	berrors "github.com/pingcap/br/pkg/errors"
 	"github.com/pingcap/br/pkg/logutil"
+	"github.com/pingcap/br/pkg/metautil"
 	"github.com/pingcap/br/pkg/restore"
 	"github.com/pingcap/br/pkg/rtree"
 	"github.com/pingcap/br/pkg/task"
@@ -50,6 +51,7 @@ func NewDebugCommand() *cobra.Command {
 	meta.AddCommand(newBackupMetaCommand())
 	meta.AddCommand(decodeBackupMetaCommand())
 	meta.AddCommand(encodeBackupMetaCommand())
+	meta.AddCommand(newBackupDiffCommand())
 	meta.AddCommand(setPDConfigCommand())
 	meta.Hidden = true
 
@@ -240,9 +242,11 @@ func newBackupMetaCommand() *cobra.Command {
 
 func decodeBackupMetaCommand() *cobra.Command {
 	decodeBackupMetaCmd := &cobra.Command{
-		Use:   "decode",
-		Short: "decode backupmeta to json",
-		Args:  cobra.NoArgs,
+		Use:     "decode",
+		Short:   "decode backupmeta to json",
+		Long:    "decode backupmeta to readable json, the files and schemas in the meta shards are decoded too",
+		Aliases: []string{"decode-backupmeta"},
+		Args:    cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx, cancel := context.WithCancel(GetDefaultContext())
 			defer cancel()
@@ -259,7 +263,7 @@ func decodeBackupMetaCommand() *cobra.Command {
 			fieldName, _ := cmd.Flags().GetString("field")
 			if fieldName == "" {
 				// No field flag, write backupmeta to external storage in JSON format.
-				backupMetaJSON, err := json.Marshal(backupMeta)
+				backupMetaJSON, err := json.MarshalIndent(backupMeta, "", "  ")
 				if err != nil {
 					return errors.Trace(err)
 				}
@@ -303,7 +307,10 @@ func encodeBackupMetaCommand() *cobra.Command {
 	encodeBackupMetaCmd := &cobra.Command{
 		Use:   "encode",
 		Short: "encode backupmeta json file to backupmeta",
-		Args:  cobra.NoArgs,
+		Long: "encode the backupmeta json file decoded and edited, e.g. to remove a corrupted file, " +
+			"to backupmeta with its envelope, or to backupmeta_from_json if backupmeta exists",
+		Aliases: []string{"encode-backupmeta"},
+		Args:    cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx, cancel := context.WithCancel(GetDefaultContext())
 			defer cancel()
@@ -337,16 +344,83 @@ func encodeBackupMetaCommand() *cobra.Command {
 				// Do not overwrite origin meta file
 				fileName += "_from_json"
 			}
+			// The envelope is written first like the backup, the edited
+			// backupmeta would be refused by the envelope of the original.
+			if err = metautil.WriteEnvelope(ctx, s, fileName, backupMeta, nil); err != nil {
+				return err
+			}
 			err = s.Write(ctx, fileName, backupMeta)
 			if err != nil {
 				return errors.Trace(err)
 			}
+			cmd.Printf("backupmeta encoded at %s\n", path.Join(cfg.Storage, fileName))
+			if fileName != utils.MetaFile {
+				cmd.Printf("move it and %s%s to %s to restore with it, the original is kept\n",
+					fileName, metautil.EnvelopeSuffix, utils.MetaFile)
+			}
 			return nil
 		},
 	}
 	return encodeBackupMetaCmd
 }
 
+func newBackupDiffCommand() *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff",
+		Short: "compare the tables of two backups",
+		Long: "compare the tables of two backups, e.g. to verify what an incremental backup captured, " +
+			"the tables added or removed, the size changes and the schema changes are reported",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(GetDefaultContext())
+			defer cancel()
+
+			var cfg task.Config
+			if err := cfg.ParseFromFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			metas := make([]*backup.BackupMeta, 0, 2)
+			for _, flag := range []string{"from", "to"} {
+				s, err := cmd.Flags().GetString(flag)
+				if err != nil {
+					return errors.Trace(err)
+				}
+				if s == "" {
+					return errors.Annotatef(berrors.ErrInvalidArgument, "--%s is required", flag)
+				}
+				metaCfg := cfg
+				metaCfg.Storage = s
+				_, _, meta, err := task.ReadBackupMeta(ctx, utils.MetaFile, &metaCfg)
+				if err != nil {
+					return errors.Annotatef(err, "failed to read the backupmeta of %s", s)
+				}
+				metas = append(metas, meta)
+			}
+			diffs, err := task.DiffBackupMeta(metas[0], metas[1])
+			if err != nil {
+				return err
+			}
+			showAll, _ := cmd.Flags().GetBool("all")
+			for _, diff := range diffs {
+				if diff.Change == task.TableUnchanged && !showAll {
+					continue
+				}
+				cmd.Printf("%s %s, size: %d -> %d (%+d), kvs: %d -> %d\n", diff.Name, diff.Change,
+					diff.FromSize, diff.ToSize, diff.SizeDelta(), diff.FromKVs, diff.ToKVs)
+				for _, change := range diff.SchemaChanges {
+					cmd.Printf("\t%s\n", change)
+				}
+			}
+			cmd.Printf("backup ts: %d -> %d, %d tables compared\n", metas[0].EndVersion, metas[1].EndVersion, len(diffs))
+			return nil
+		},
+	}
+	diffCmd.Flags().String("from", "", "the storage of the backup to compare from")
+	diffCmd.Flags().String("to", "", "the storage of the backup to compare to")
+	diffCmd.Flags().Bool("all", false, "report the unchanged tables too")
+	return diffCmd
+}
+
 func setPDConfigCommand() *cobra.Command {
 	pdConfigCmd := &cobra.Command{
 		Use:   "reset-pd-config-as-default",
@@ -0,0 +1,114 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/task"
+)
+
+// newFleetBackupCommand returns a subcommand backing up multiple clusters.
+func newFleetBackupCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "fleet",
+		Short: "backup multiple clusters in the config file",
+		Args:  cobra.NoArgs,
+		RunE: func(command *cobra.Command, _ []string) error {
+			cfg, err := task.ParseFleetConfigFromFlags(command.Flags())
+			if err != nil {
+				command.SilenceUsage = false
+				return err
+			}
+			exe, err := os.Executable()
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if cfg.LogDir == "" {
+				cfg.LogDir = filepath.Dir(LogFile())
+			}
+			results := task.RunFleetBackup(GetDefaultContext(), cfg, func(ctx context.Context, c task.FleetCluster) error {
+				return runClusterBackup(ctx, exe, cfg.LogDir, c)
+			})
+			report, err := task.FleetReport(results)
+			command.Print(report)
+			if err != nil {
+				log.Error("failed to backup fleet", zap.Error(err))
+				return err
+			}
+			return nil
+		},
+	}
+	task.DefineFleetFlags(command)
+	return command
+}
+
+// fleetOutputTailSize is the size of the tail of the output of a failed
+// cluster backup put into its error.
+const fleetOutputTailSize = 1024
+
+// tailWriter keeps the last bytes written to it.
+type tailWriter struct {
+	buf []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > fleetOutputTailSize {
+		w.buf = w.buf[len(w.buf)-fleetOutputTailSize:]
+	}
+	return len(p), nil
+}
+
+// runClusterBackup backs up the cluster by `br backup full` in a process, so
+// the clusters don't share the states, e.g. the summary and the metrics. The
+// output of the process, e.g. the summary and the errors before the log is
+// initialized, is saved next to its log.
+func runClusterBackup(ctx context.Context, exe, logDir string, c task.FleetCluster) error {
+	args := []string{
+		"backup", "full",
+		"--pd", strings.Join(c.PD, ","),
+		"--storage", c.Storage,
+		"--" + FlagLogFile, filepath.Join(logDir, "br-"+c.Name+".log"),
+	}
+	args = append(args, c.Args...)
+	outPath := filepath.Join(logDir, "br-"+c.Name+".out")
+	out, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer out.Close()
+	tail := &tailWriter{}
+	proc := exec.Command(exe, args...)
+	proc.Stdout = io.MultiWriter(out, tail)
+	proc.Stderr = proc.Stdout
+	if err = proc.Start(); err != nil {
+		return errors.Trace(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- proc.Wait() }()
+	select {
+	case err = <-done:
+		if err != nil {
+			return errors.Annotatef(err, "see %s, the output ends with: %s",
+				outPath, strings.TrimSpace(string(tail.buf)))
+		}
+		return nil
+	case <-ctx.Done():
+		// Let the backup clean up, e.g. restore the schedulers.
+		_ = proc.Process.Signal(syscall.SIGTERM)
+		<-done
+		return errors.Trace(ctx.Err())
+	}
+}
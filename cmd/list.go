@@ -0,0 +1,64 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pingcap/br/pkg/task"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// NewListCommand returns a list subcommand, which lists the backups recorded
+// in the catalog of the storage by `backup --catalog`.
+func NewListCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:          "list",
+		Short:        "list the backups and the restore chains recorded in the catalog of the storage",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		PersistentPreRunE: func(c *cobra.Command, args []string) error {
+			if err := Init(c); err != nil {
+				return err
+			}
+			utils.LogBRInfo()
+			task.LogArguments(c)
+			return nil
+		},
+		RunE: func(command *cobra.Command, _ []string) error {
+			ctx, cancel := context.WithCancel(GetDefaultContext())
+			defer cancel()
+
+			var cfg task.ListConfig
+			if err := cfg.ParseFromFlags(command.Flags()); err != nil {
+				command.SilenceUsage = false
+				return err
+			}
+			catalog, err := task.RunList(ctx, &cfg)
+			if err != nil {
+				return err
+			}
+			if cfg.Chains {
+				for i, chain := range catalog.Chains() {
+					storages := make([]string, 0, len(chain))
+					for _, entry := range chain {
+						storages = append(storages, entry.Storage)
+					}
+					command.Printf("chain #%d, restorable to ts %d: %s\n",
+						i, chain[len(chain)-1].BackupTS, strings.Join(storages, " -> "))
+				}
+				return nil
+			}
+			for _, entry := range catalog.Backups {
+				command.Printf("%s\ttype: %s, backup ts: %d, last backup ts: %d, size: %d, status: %s, end time: %s\n",
+					entry.Storage, entry.Type, entry.BackupTS, entry.LastBackupTS, entry.Size, entry.Status, entry.EndTime)
+			}
+			return nil
+		},
+	}
+	task.DefineListFlags(command)
+	return command
+}
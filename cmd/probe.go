@@ -0,0 +1,57 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/pingcap/log"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/task"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// NewProbeCommand returns a probe subcommand, which exits non-zero if the
+// newest complete backup in the storage is too old or broken, so it can be
+// used by the monitoring systems directly.
+func NewProbeCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:          "probe",
+		Short:        "check the newest backup in the storage is fresh and complete",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		PersistentPreRunE: func(c *cobra.Command, args []string) error {
+			if err := Init(c); err != nil {
+				return err
+			}
+			utils.LogBRInfo()
+			task.LogArguments(c)
+			return nil
+		},
+		RunE: func(command *cobra.Command, _ []string) error {
+			ctx, cancel := context.WithCancel(GetDefaultContext())
+			defer cancel()
+
+			var cfg task.ProbeConfig
+			if err := cfg.ParseFromFlags(command.Flags()); err != nil {
+				command.SilenceUsage = false
+				return err
+			}
+			result, err := task.RunProbe(ctx, &cfg)
+			if result != nil {
+				command.Printf("newest backup: %s, backup ts: %d, age: %s, files: %d\n",
+					result.Path, result.BackupTS, result.Age, result.FileCount)
+			}
+			if err != nil {
+				log.Error("probe failed", zap.Error(err))
+				return err
+			}
+			command.Println("probe succeed!")
+			return nil
+		},
+	}
+	task.DefineProbeFlags(command)
+	return command
+}
@@ -19,8 +19,30 @@ func runRestoreCommand(command *cobra.Command, cmdName string) error {
 		command.SilenceUsage = false
 		return err
 	}
-	if err := task.RunRestore(GetDefaultContext(), tidbGlue, cmdName, &cfg); err != nil {
+	err := task.RunRestoreChain(GetDefaultContext(), tidbGlue, cmdName, &cfg)
+	printSummary(command, cmdName, &cfg.Config, err)
+	if err != nil {
 		log.Error("failed to restore", zap.Error(err))
+		printRecoveryGuide(command, err, task.RecoveryOptions{
+			Checkpoint:        !cfg.SchemaOnly,
+			CheckpointStorage: cfg.CheckpointStorage,
+		})
+		return err
+	}
+	return nil
+}
+
+func runRestoreSchemaCommand(command *cobra.Command, cmdName string) error {
+	cfg := task.RestoreConfig{Config: task.Config{LogProgress: HasLogFile()}, SchemaOnly: true}
+	if err := cfg.ParseFromFlags(command.Flags()); err != nil {
+		command.SilenceUsage = false
+		return err
+	}
+	err := task.RunRestore(GetDefaultContext(), tidbGlue, cmdName, &cfg)
+	printSummary(command, cmdName, &cfg.Config, err)
+	if err != nil {
+		log.Error("failed to restore schemas", zap.Error(err))
+		printRecoveryGuide(command, err, task.RecoveryOptions{})
 		return err
 	}
 	return nil
@@ -47,8 +69,11 @@ func runRestoreRawCommand(command *cobra.Command, cmdName string) error {
 		command.SilenceUsage = false
 		return err
 	}
-	if err := task.RunRestoreRaw(GetDefaultContext(), gluetikv.Glue{}, cmdName, &cfg); err != nil {
+	err := task.RunRestoreRaw(GetDefaultContext(), gluetikv.Glue{}, cmdName, &cfg)
+	printSummary(command, cmdName, &cfg.Config, err)
+	if err != nil {
 		log.Error("failed to restore raw kv", zap.Error(err))
+		printRecoveryGuide(command, err, task.RecoveryOptions{})
 		return err
 	}
 	return nil
@@ -89,6 +114,7 @@ func NewRestoreCommand() *cobra.Command {
 		newFullRestoreCommand(),
 		newDBRestoreCommand(),
 		newTableRestoreCommand(),
+		newSchemaOnlyRestoreCommand(),
 		newLogRestoreCommand(),
 		newRawRestoreCommand(),
 		newTiflashReplicaRestoreCommand(),
@@ -134,6 +160,20 @@ func newTableRestoreCommand() *cobra.Command {
 		},
 	}
 	task.DefineTableFlags(command)
+	task.DefineRestoreKeyRangeFlags(command)
+	return command
+}
+
+func newSchemaOnlyRestoreCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "schema-only",
+		Short: "restore the databases, tables, views and sequences without data",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runRestoreSchemaCommand(cmd, "Schema restore")
+		},
+	}
+	task.DefineFilterFlags(command)
 	return command
 }
 
@@ -0,0 +1,54 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pingcap/br/pkg/gluetikv"
+	"github.com/pingcap/br/pkg/task"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// NewVersionCommand returns a version subcommand, which prints the same
+// information as `br --version`. If --pd is given, it also prints the
+// version of every component of the cluster and whether BR works with it.
+func NewVersionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "version",
+		Short:        "print the version information of BR and the components of the cluster given by --pd",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		PersistentPreRunE: func(c *cobra.Command, args []string) error {
+			return Init(c)
+		},
+		RunE: func(command *cobra.Command, _ []string) error {
+			command.Println(utils.BRInfo())
+
+			var cfg task.VersionConfig
+			if err := cfg.ParseFromFlags(command.Flags()); err != nil {
+				command.SilenceUsage = false
+				return err
+			}
+			if !cfg.CheckCluster {
+				return nil
+			}
+			ctx, cancel := context.WithCancel(GetDefaultContext())
+			defer cancel()
+			report, err := task.RunVersionReport(ctx, gluetikv.Glue{}, &cfg)
+			if err != nil {
+				return err
+			}
+			for _, v := range report {
+				command.Printf("%s\t%s\t%s\t%s", v.Component, v.Address, v.Version, v.Verdict)
+				if v.Reason != "" {
+					command.Printf("\t%s", v.Reason)
+				}
+				command.Println()
+			}
+			return nil
+		},
+	}
+}
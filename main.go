@@ -33,7 +33,8 @@ func main() {
 		cancel()
 		fmt.Fprintln(os.Stderr, "gracefully shuting down, press ^C again to force exit")
 		<-sc
-		// Even user use SIGTERM to exit, there isn't any checkpoint for resuming,
+		cmd.Cleanup()
+		// Even user use SIGTERM to exit, the task isn't finished,
 		// hence returning fail exit code.
 		os.Exit(1)
 	}()
@@ -50,12 +51,17 @@ func main() {
 		cmd.NewDebugCommand(),
 		cmd.NewBackupCommand(),
 		cmd.NewRestoreCommand(),
+		cmd.NewProbeCommand(),
+		cmd.NewListCommand(),
+		cmd.NewVersionCommand(),
 	)
 	// Ouputs cmd.Print to stdout.
 	rootCmd.SetOut(os.Stdout)
 
 	rootCmd.SetArgs(os.Args[1:])
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	cmd.Cleanup()
+	if err != nil {
 		log.Error("br failed", zap.Error(err))
 		os.Exit(1)
 	}
@@ -3,33 +3,265 @@
 package backup
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 
-	"github.com/google/btree"
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
 	"github.com/pingcap/log"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
-	"github.com/pingcap/br/pkg/rtree"
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/logutil"
+	"github.com/pingcap/br/pkg/metautil"
+	"github.com/pingcap/br/pkg/storage"
 )
 
-// checkDupFiles checks if there are any files are duplicated.
-func checkDupFiles(rangeTree *rtree.RangeTree) {
-	// Name -> SHA256
-	files := make(map[string][]byte)
-	rangeTree.Ascend(func(i btree.Item) bool {
-		rg := i.(*rtree.Range)
-		for _, f := range rg.Files {
-			old, ok := files[f.Name]
-			if ok {
-				log.Error("dup file",
-					zap.String("Name", f.Name),
-					zap.String("SHA256_1", hex.EncodeToString(old)),
-					zap.String("SHA256_2", hex.EncodeToString(f.Sha256)),
-				)
-			} else {
-				files[f.Name] = f.Sha256
+// FileNameScheme is the scheme of the names of the backup files generated by
+// TiKV. The epoch is the version of the region epoch, and the hash is the hex
+// encoded sha256 of the start key of the file.
+const FileNameScheme = "{store-id}_{region-id}_{epoch}_{hash}_{cf}.sst"
+
+// FileName is the name of a backup file parsed by FileNameScheme.
+type FileName struct {
+	StoreID  uint64
+	RegionID uint64
+	Epoch    uint64
+	Hash     string
+	CF       string
+}
+
+// ParseFileName parses the name of a backup file by FileNameScheme.
+func ParseFileName(name string) (FileName, error) {
+	var fn FileName
+	base := strings.TrimSuffix(path.Base(name), ".sst")
+	parts := strings.Split(base, "_")
+	if base == path.Base(name) || len(parts) != 5 {
+		return fn, errors.Annotatef(berrors.ErrBackupFileNameInvalid,
+			"%s doesn't follow %s", name, FileNameScheme)
+	}
+	ids := make([]uint64, 0, 3)
+	for _, part := range parts[:3] {
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return fn, errors.Annotatef(berrors.ErrBackupFileNameInvalid,
+				"%s doesn't follow %s: %v", name, FileNameScheme, err)
+		}
+		ids = append(ids, id)
+	}
+	if _, err := hex.DecodeString(parts[3]); err != nil || parts[3] == "" || parts[4] == "" {
+		return fn, errors.Annotatef(berrors.ErrBackupFileNameInvalid,
+			"%s doesn't follow %s", name, FileNameScheme)
+	}
+	fn.StoreID, fn.RegionID, fn.Epoch = ids[0], ids[1], ids[2]
+	fn.Hash, fn.CF = parts[3], parts[4]
+	return fn, nil
+}
+
+// CheckFileNames checks whether the names of the files follow FileNameScheme
+// and the column families in the names match the files.
+func CheckFileNames(files []*kvproto.File) error {
+	for _, f := range files {
+		fn, err := ParseFileName(f.GetName())
+		if err != nil {
+			return err
+		}
+		if f.GetCf() != "" && fn.CF != f.GetCf() {
+			return errors.Annotatef(berrors.ErrBackupFileNameInvalid,
+				"%s is of cf %s, but its name says %s", f.GetName(), f.GetCf(), fn.CF)
+		}
+	}
+	return nil
+}
+
+// FileConflict is a pair of backup files conflicting with each other.
+type FileConflict struct {
+	// Reason is "duplicated name", "same region on different stores" or
+	// "overlapping range".
+	Reason string
+	File1  *kvproto.File
+	File2  *kvproto.File
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler.
+func (c FileConflict) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("reason", c.Reason)
+	for i, f := range []*kvproto.File{c.File1, c.File2} {
+		prefix := fmt.Sprintf("file%d.", i+1)
+		enc.AddString(prefix+"name", f.GetName())
+		enc.AddString(prefix+"cf", f.GetCf())
+		enc.AddString(prefix+"startKey", logutil.WrapKey(f.GetStartKey()).String())
+		enc.AddString(prefix+"endKey", logutil.WrapKey(f.GetEndKey()).String())
+		enc.AddString(prefix+"sha256", hex.EncodeToString(f.GetSha256()))
+	}
+	return nil
+}
+
+// FindFileConflicts finds the files of the same name, the files of the same
+// region and start key written by different stores, and the files of the same
+// column family whose ranges overlap, any of them means some data are backed
+// up twice or a file is overwritten. The names not following FileNameScheme
+// are only checked for duplication.
+func FindFileConflicts(files []*kvproto.File) []FileConflict {
+	conflicts := make([]FileConflict, 0)
+	byName := make(map[string]*kvproto.File, len(files))
+	// byRegion is keyed by the name without the store ID and the epoch.
+	byRegion := make(map[string]*kvproto.File, len(files))
+	byCF := make(map[string][]*kvproto.File)
+	for _, f := range files {
+		if old, ok := byName[f.GetName()]; ok {
+			conflicts = append(conflicts, FileConflict{Reason: "duplicated name", File1: old, File2: f})
+			continue
+		}
+		byName[f.GetName()] = f
+		if fn, err := ParseFileName(f.GetName()); err == nil {
+			key := fmt.Sprintf("%d_%s_%s", fn.RegionID, fn.Hash, fn.CF)
+			if old, ok := byRegion[key]; ok {
+				conflicts = append(conflicts, FileConflict{Reason: "same region on different stores", File1: old, File2: f})
+				continue
+			}
+			byRegion[key] = f
+		}
+		byCF[f.GetCf()] = append(byCF[f.GetCf()], f)
+	}
+
+	cfs := make([]string, 0, len(byCF))
+	for cf := range byCF {
+		cfs = append(cfs, cf)
+	}
+	sort.Strings(cfs)
+	for _, cf := range cfs {
+		cfFiles := byCF[cf]
+		sort.Slice(cfFiles, func(i, j int) bool {
+			return bytes.Compare(cfFiles[i].GetStartKey(), cfFiles[j].GetStartKey()) < 0
+		})
+		// last is the file ending last so far, an empty end key means the end
+		// of the key space.
+		var last *kvproto.File
+		for _, f := range cfFiles {
+			if last != nil && (len(last.GetEndKey()) == 0 ||
+				bytes.Compare(f.GetStartKey(), last.GetEndKey()) < 0) {
+				conflicts = append(conflicts, FileConflict{Reason: "overlapping range", File1: last, File2: f})
+			}
+			if last == nil || (len(last.GetEndKey()) != 0 &&
+				(len(f.GetEndKey()) == 0 || bytes.Compare(f.GetEndKey(), last.GetEndKey()) > 0)) {
+				last = f
 			}
 		}
-		return true
+	}
+	return conflicts
+}
+
+// CheckFileConflicts logs the conflicting files found by FindFileConflicts,
+// and returns an error if there is any.
+func CheckFileConflicts(files []*kvproto.File) error {
+	conflicts := FindFileConflicts(files)
+	if len(conflicts) == 0 {
+		return nil
+	}
+	for _, c := range conflicts {
+		log.Error("backup files conflict", zap.Object("conflict", c))
+	}
+	c := conflicts[0]
+	return errors.Annotatef(berrors.ErrBackupFilesConflict,
+		"%d pairs of files conflict, e.g. %s and %s of %s", len(conflicts),
+		c.File1.GetName(), c.File2.GetName(), c.Reason)
+}
+
+// checkFilesTiling checks whether the files of every column family in the
+// response cover the range of the response without any gap, so that the data
+// lost by TiKV are found before the backup is finished.
+func checkFilesTiling(resp *kvproto.BackupResponse) error {
+	filesByCF := make(map[string][]*kvproto.File)
+	for _, f := range resp.GetFiles() {
+		filesByCF[f.GetCf()] = append(filesByCF[f.GetCf()], f)
+	}
+	for cf, files := range filesByCF {
+		sort.Slice(files, func(i, j int) bool {
+			return bytes.Compare(files[i].GetStartKey(), files[j].GetStartKey()) < 0
+		})
+		lastEndKey := resp.GetStartKey()
+		for _, f := range files {
+			if !bytes.Equal(f.GetStartKey(), lastEndKey) {
+				return errors.Annotatef(berrors.ErrBackupFilesIncomplete,
+					"range [%s, %s) of cf %s: file %s starts at %s, but the last file ends at %s",
+					logutil.WrapKey(resp.GetStartKey()), logutil.WrapKey(resp.GetEndKey()), cf,
+					f.GetName(), logutil.WrapKey(f.GetStartKey()), logutil.WrapKey(lastEndKey))
+			}
+			lastEndKey = f.GetEndKey()
+		}
+		if !bytes.Equal(lastEndKey, resp.GetEndKey()) {
+			return errors.Annotatef(berrors.ErrBackupFilesIncomplete,
+				"range [%s, %s) of cf %s: the files end at %s",
+				logutil.WrapKey(resp.GetStartKey()), logutil.WrapKey(resp.GetEndKey()), cf,
+				logutil.WrapKey(lastEndKey))
+		}
+	}
+	return nil
+}
+
+// CheckStorageFiles lists the files in the storage and reconciles them with
+// the files in the backupmeta. The missing files and the files of mismatched
+// sizes fail the check, the SST files not in the backupmeta are reported.
+func CheckStorageFiles(ctx context.Context, s storage.ExternalStorage, reader *metautil.MetaReader) error {
+	// stored are the sizes of the files in the storage, which are
+	// complemented once the files are found in the backupmeta.
+	stored := make(map[string]int64)
+	err := s.WalkDir(ctx, &storage.WalkOption{}, func(p string, size int64) error {
+		stored[path.Clean(p)] = size
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var files, missing, mismatched int
+	var totalSize uint64
+	err = reader.WalkFiles(ctx, func(f *kvproto.File) error {
+		files++
+		name := path.Clean(f.Name)
+		size, ok := stored[name]
+		if !ok {
+			log.Error("backup file missing in storage", zap.String("file", f.Name))
+			missing++
+			return nil
+		}
+		if size < 0 {
+			size = ^size
+		} else {
+			stored[name] = ^size
+		}
+		// The size may be unknown if it's reported by an old TiKV.
+		if f.Size_ != 0 && uint64(size) != f.Size_ {
+			log.Error("backup file size mismatch", zap.String("file", f.Name),
+				zap.Uint64("expected", f.Size_), zap.Int64("stored", size))
+			mismatched++
+		}
+		totalSize += uint64(size)
+		return nil
 	})
+	if err != nil {
+		return err
+	}
+	orphaned := 0
+	for name, size := range stored {
+		if size >= 0 && strings.HasSuffix(name, ".sst") {
+			log.Warn("backup file not in backupmeta", zap.String("file", name))
+			orphaned++
+		}
+	}
+	log.Info("backup files verified", zap.Int("files", files),
+		zap.Uint64("size", totalSize), zap.Int("orphaned", orphaned))
+	if missing != 0 || mismatched != 0 {
+		return errors.Annotatef(berrors.ErrBackupFilesIncomplete,
+			"%d files missing and %d files of mismatched size in the storage", missing, mismatched)
+	}
+	return nil
 }
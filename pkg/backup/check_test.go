@@ -0,0 +1,67 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+)
+
+type testCheckSuite struct{}
+
+var _ = Suite(&testCheckSuite{})
+
+func tilingFile(name, cf, start, end string) *kvproto.File {
+	return &kvproto.File{Name: name, Cf: cf, StartKey: []byte(start), EndKey: []byte(end)}
+}
+
+func (s *testCheckSuite) TestCheckFilesTiling(c *C) {
+	resp := &kvproto.BackupResponse{StartKey: []byte("a"), EndKey: []byte("d")}
+	// No files means the range is empty.
+	c.Assert(checkFilesTiling(resp), IsNil)
+
+	// The files of each cf cover the range, in any order.
+	resp.Files = []*kvproto.File{
+		tilingFile("2_write", "write", "b", "d"),
+		tilingFile("1_write", "write", "a", "b"),
+		tilingFile("1_default", "default", "a", "d"),
+	}
+	c.Assert(checkFilesTiling(resp), IsNil)
+
+	cases := []struct {
+		files []*kvproto.File
+		err   string
+	}{
+		{
+			files: []*kvproto.File{tilingFile("1_write", "write", "a", "b"), tilingFile("2_write", "write", "c", "d")},
+			err:   ".*file 2_write starts at .*, but the last file ends at .*",
+		},
+		{
+			files: []*kvproto.File{tilingFile("1_write", "write", "b", "d")},
+			err:   ".*file 1_write starts at .*, but the last file ends at .*",
+		},
+		{
+			files: []*kvproto.File{tilingFile("1_write", "write", "a", "c")},
+			err:   ".*of cf write: the files end at .*",
+		},
+		// Only the default cf has a gap.
+		{
+			files: []*kvproto.File{tilingFile("1_write", "write", "a", "d"), tilingFile("1_default", "default", "a", "c")},
+			err:   ".*of cf default: the files end at .*",
+		},
+	}
+	for i, cs := range cases {
+		resp.Files = cs.files
+		err := checkFilesTiling(resp)
+		c.Assert(err, ErrorMatches, cs.err, Commentf("case %d", i))
+		c.Assert(berrors.ErrBackupFilesIncomplete.Equal(errors.Cause(err)), IsTrue)
+	}
+
+	// The last range of the cluster has no end key.
+	resp = &kvproto.BackupResponse{StartKey: []byte("a")}
+	resp.Files = []*kvproto.File{tilingFile("1_write", "write", "a", "")}
+	c.Assert(checkFilesTiling(resp), IsNil)
+}
@@ -0,0 +1,367 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/btree"
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/rtree"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// checkpointInterval is the interval to save the checkpoint.
+const checkpointInterval = time.Minute
+
+// Checkpoint is the progress of a backup, i.e. the completed ranges and their files.
+type Checkpoint struct {
+	ClusterID    uint64 `json:"cluster-id"`
+	StartVersion uint64 `json:"start-version"`
+	EndVersion   uint64 `json:"end-version"`
+	// SafePointID is the ID of the service GC safe point of the backup, it's
+	// kept while the checkpoint exists, and the resumed backup reuses it.
+	SafePointID string `json:"safe-point-id"`
+	// Filter is the table filter of the backup, and RequestedRanges are the
+	// ranges it backs up, the resumed backup must back up the same ranges.
+	Filter          []string          `json:"filter"`
+	RequestedRanges []CheckpointRange `json:"requested-ranges"`
+	Ranges          []CheckpointRange `json:"ranges"`
+}
+
+// CheckpointRange is a completed range of a backup, or a requested range
+// without files.
+type CheckpointRange struct {
+	StartKey []byte          `json:"start-key"`
+	EndKey   []byte          `json:"end-key"`
+	Files    []*kvproto.File `json:"files,omitempty"`
+}
+
+// PartialState is saved into the storage when a backup stops before it's
+// finished, e.g. it's interrupted by a signal, so that the files in the
+// storage won't be taken as a complete backup.
+type PartialState struct {
+	Phase           string    `json:"phase"`
+	Error           string    `json:"error"`
+	StopTime        time.Time `json:"stop-time"`
+	CompletedRanges int       `json:"completed-ranges"`
+	// Resumable is whether the backup can be resumed, i.e. its checkpoint
+	// exists and its snapshot is kept from GC until SafePointExpireTime.
+	Resumable           bool      `json:"resumable"`
+	SafePointExpireTime time.Time `json:"safe-point-expire-time,omitempty"`
+}
+
+// checkpointer records the completed ranges and saves them periodically.
+type checkpointer struct {
+	mu        sync.Mutex
+	completed rtree.RangeTree
+	// version increases once a range completes, saved is the version
+	// of the last saved checkpoint.
+	version uint64
+	saved   uint64
+	// exists is whether the checkpoint is in the storage, i.e. it's loaded
+	// or saved.
+	exists bool
+
+	safePointID string
+	filter      []string
+	// safePointExpire is when the safe point kept for resuming expires,
+	// it's zero if the safe point is removed.
+	safePointExpire time.Time
+	// requested are the ranges to back up, they are checked against the
+	// ranges of the loaded checkpoint before being backed up.
+	requested []CheckpointRange
+	loaded    *Checkpoint
+}
+
+func newCheckpointer(cp *Checkpoint) *checkpointer {
+	c := &checkpointer{completed: rtree.NewRangeTree()}
+	if cp != nil {
+		for _, rg := range cp.Ranges {
+			c.completed.Put(rg.StartKey, rg.EndKey, rg.Files)
+		}
+		c.exists = true
+		c.safePointID = cp.SafePointID
+		c.filter = cp.Filter
+		c.loaded = cp
+	}
+	return c
+}
+
+// setRequested sets the ranges to back up, they must be the ranges of the
+// loaded checkpoint if any, otherwise the backup mixes the data of different
+// tables or ranges.
+func (c *checkpointer) setRequested(ranges []rtree.Range) error {
+	requested := make([]CheckpointRange, 0, len(ranges))
+	for _, r := range ranges {
+		requested = append(requested, CheckpointRange{StartKey: r.StartKey, EndKey: r.EndKey})
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The checkpoints saved by older BR don't record the requested ranges.
+	if c.loaded != nil && c.loaded.RequestedRanges != nil && !equalRanges(c.loaded.RequestedRanges, requested) {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"the checkpoint backs up %d ranges, but %d ranges are requested, "+
+				"resume the backup with the same filter, ranges file and lastbackupts",
+			len(c.loaded.RequestedRanges), len(requested))
+	}
+	c.requested = requested
+	return nil
+}
+
+func equalRanges(a, b []CheckpointRange) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i].StartKey, b[i].StartKey) || !bytes.Equal(a[i].EndKey, b[i].EndKey) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *checkpointer) put(startKey, endKey []byte, files []*kvproto.File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.completed.Put(startKey, endKey, files)
+	c.version++
+}
+
+// split splits the range into the completed files and the incomplete ranges.
+func (c *checkpointer) split(rg rtree.Range) ([]*kvproto.File, []rtree.Range) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.completed.Len() == 0 {
+		return nil, []rtree.Range{rg}
+	}
+	files := make([]*kvproto.File, 0)
+	c.completed.AscendGreaterOrEqual(&rtree.Range{StartKey: rg.StartKey}, func(i btree.Item) bool {
+		done := i.(*rtree.Range)
+		if len(rg.EndKey) != 0 && bytes.Compare(done.StartKey, rg.EndKey) >= 0 {
+			return false
+		}
+		// The completed ranges are pieces of the requested ranges,
+		// skip the ones don't belong to the range.
+		if len(rg.EndKey) == 0 || (len(done.EndKey) != 0 && bytes.Compare(done.EndKey, rg.EndKey) <= 0) {
+			files = append(files, done.Files...)
+		}
+		return true
+	})
+	return files, c.completed.GetIncompleteRange(rg.StartKey, rg.EndKey)
+}
+
+// snapshot returns the checkpoint and its version, or nil if it's saved already.
+func (c *checkpointer) snapshot(req *kvproto.BackupRequest) (*Checkpoint, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version == c.saved {
+		return nil, c.version
+	}
+	cp := &Checkpoint{
+		ClusterID:       req.ClusterId,
+		StartVersion:    req.StartVersion,
+		EndVersion:      req.EndVersion,
+		SafePointID:     c.safePointID,
+		Filter:          c.filter,
+		RequestedRanges: c.requested,
+		Ranges:          make([]CheckpointRange, 0, c.completed.Len()),
+	}
+	for _, rg := range c.completed.GetSortedRanges() {
+		cp.Ranges = append(cp.Ranges, CheckpointRange{StartKey: rg.StartKey, EndKey: rg.EndKey, Files: rg.Files})
+	}
+	return cp, c.version
+}
+
+func (c *checkpointer) markSaved(version uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if version > c.saved {
+		c.saved = version
+	}
+	c.exists = true
+}
+
+// EnableCheckpoint saves the progress of backup into the storage periodically,
+// it must be called before SetStorage. If resume is true, the backup continues
+// from the checkpoint in the storage, which should be loaded by LoadCheckpoint.
+// The checkpoint is removed by RemoveCheckpoint once the backup succeeds.
+func (bc *Client) EnableCheckpoint(resume bool) {
+	bc.checkpoint = newCheckpointer(nil)
+	bc.resume = resume
+}
+
+// SetCheckpointOptions sets the ID of the service safe point and the table
+// filter of the backup recorded in the checkpoint. The resumed backup reuses
+// the safe point, and fails if the filter differs.
+func (bc *Client) SetCheckpointOptions(safePointID string, filter []string) error {
+	if bc.checkpoint == nil {
+		return nil
+	}
+	bc.checkpoint.mu.Lock()
+	defer bc.checkpoint.mu.Unlock()
+	// The checkpoints saved by older BR don't record the filter.
+	if loaded := bc.checkpoint.loaded; loaded != nil && loaded.Filter != nil &&
+		strings.Join(loaded.Filter, "\n") != strings.Join(filter, "\n") {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"the checkpoint backs up the tables of filter %q, but the filter is %q, "+
+				"resume the backup with the same filter", loaded.Filter, filter)
+	}
+	bc.checkpoint.safePointID = safePointID
+	bc.checkpoint.filter = filter
+	return nil
+}
+
+// SetSafePointExpireTime records when the service safe point kept for
+// resuming the backup expires, the backup stopped halfway isn't resumable
+// unless the safe point is kept.
+func (bc *Client) SetSafePointExpireTime(expire time.Time) {
+	if bc.checkpoint == nil {
+		return
+	}
+	bc.checkpoint.mu.Lock()
+	bc.checkpoint.safePointExpire = expire
+	bc.checkpoint.mu.Unlock()
+}
+
+// CheckpointExists tells whether the checkpoint of the backup is in the
+// storage, the backup stopped halfway can be resumed from it.
+func (bc *Client) CheckpointExists() bool {
+	if bc.checkpoint == nil {
+		return false
+	}
+	bc.checkpoint.mu.Lock()
+	defer bc.checkpoint.mu.Unlock()
+	return bc.checkpoint.exists
+}
+
+// RemoveCheckpoint removes the checkpoint and the partial state left by the
+// last run once the backup succeeds, they are stale after the backupmeta is
+// saved.
+func (bc *Client) RemoveCheckpoint(ctx context.Context) error {
+	if bc.checkpoint == nil {
+		return nil
+	}
+	for _, name := range []string{utils.PartialStateFile, utils.CheckpointFile} {
+		if err := bc.storage.DeleteFile(ctx, name); err != nil {
+			return errors.Annotatef(err, "failed to remove %s", name)
+		}
+	}
+	bc.checkpoint.mu.Lock()
+	bc.checkpoint.exists = false
+	bc.checkpoint.mu.Unlock()
+	return nil
+}
+
+// LoadCheckpoint loads the checkpoint saved by the last run of the backup.
+func (bc *Client) LoadCheckpoint(ctx context.Context) (*Checkpoint, error) {
+	exist, err := bc.storage.FileExists(ctx, utils.CheckpointFile)
+	if err != nil {
+		return nil, errors.Annotatef(err, "error occurred when checking %s file", utils.CheckpointFile)
+	}
+	if !exist {
+		return nil, errors.Annotate(berrors.ErrInvalidArgument, "no checkpoint to resume from in the storage")
+	}
+	data, err := bc.storage.Read(ctx, utils.CheckpointFile)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	cp := &Checkpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid checkpoint: %v", err)
+	}
+	if cp.ClusterID != bc.clusterID {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+			"the checkpoint is of cluster %d, but the cluster is %d", cp.ClusterID, bc.clusterID)
+	}
+	bc.checkpoint = newCheckpointer(cp)
+	log.Info("checkpoint loaded", zap.Int("ranges", len(cp.Ranges)),
+		zap.Uint64("StartVersion", cp.StartVersion), zap.Uint64("EndVersion", cp.EndVersion))
+	return cp, nil
+}
+
+func (bc *Client) saveCheckpoint(ctx context.Context, req *kvproto.BackupRequest) error {
+	cp, version := bc.checkpoint.snapshot(req)
+	if cp == nil {
+		return nil
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("save checkpoint", zap.Int("ranges", len(cp.Ranges)), zap.Int("size", len(data)))
+	if err = bc.storage.Write(ctx, utils.CheckpointFile, data); err != nil {
+		return errors.Trace(err)
+	}
+	bc.checkpoint.markSaved(version)
+	return nil
+}
+
+// startCheckpointSaver saves the checkpoint periodically until the returned
+// function is called, which saves it for the last time.
+func (bc *Client) startCheckpointSaver(ctx context.Context, req *kvproto.BackupRequest) func() {
+	done := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := bc.saveCheckpoint(ctx, req); err != nil {
+					log.Warn("failed to save checkpoint", zap.Error(err))
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+		if ctx.Err() != nil {
+			log.Warn("context canceled, saving checkpoint with background context")
+			ctx = context.Background()
+		}
+		if err := bc.saveCheckpoint(ctx, req); err != nil {
+			log.Warn("failed to save checkpoint", zap.Error(err))
+		}
+	}
+}
+
+// SavePartialState saves the state of the backup stopped at the phase by the
+// error. The state is removed by RemoveCheckpoint once a resumed backup
+// succeeds.
+func (bc *Client) SavePartialState(ctx context.Context, phase string, cause error) error {
+	state := PartialState{
+		Phase:    phase,
+		Error:    cause.Error(),
+		StopTime: time.Now(),
+	}
+	if bc.checkpoint != nil {
+		bc.checkpoint.mu.Lock()
+		state.CompletedRanges = bc.checkpoint.completed.Len()
+		state.Resumable = bc.checkpoint.exists && !bc.checkpoint.safePointExpire.IsZero()
+		state.SafePointExpireTime = bc.checkpoint.safePointExpire
+		bc.checkpoint.mu.Unlock()
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("save partial state", zap.String("phase", phase),
+		zap.Int("completed ranges", state.CompletedRanges), zap.Bool("resumable", state.Resumable))
+	return errors.Trace(bc.storage.Write(ctx, utils.PartialStateFile, data))
+}
@@ -3,14 +3,17 @@
 package backup
 
 import (
+	"bytes"
 	"context"
-	"encoding/hex"
+	"crypto/ed25519"
 	"encoding/json"
+	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/gogo/protobuf/proto"
 	"github.com/google/btree"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/failpoint"
@@ -21,11 +24,13 @@ import (
 	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
 	"github.com/pingcap/tidb/distsql"
 	"github.com/pingcap/tidb/domain"
+	"github.com/pingcap/tidb/infoschema"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/meta"
 	"github.com/pingcap/tidb/meta/autoid"
 	"github.com/pingcap/tidb/store/tikv"
 	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/pingcap/tidb/tablecodec"
 	"github.com/pingcap/tidb/util"
 	"github.com/pingcap/tidb/util/codec"
 	"github.com/pingcap/tidb/util/ranger"
@@ -39,6 +44,7 @@ import (
 	berrors "github.com/pingcap/br/pkg/errors"
 	"github.com/pingcap/br/pkg/glue"
 	"github.com/pingcap/br/pkg/logutil"
+	"github.com/pingcap/br/pkg/metautil"
 	"github.com/pingcap/br/pkg/rtree"
 	"github.com/pingcap/br/pkg/storage"
 	"github.com/pingcap/br/pkg/summary"
@@ -68,6 +74,17 @@ const (
 	backupRetryTimes            = 5
 )
 
+const (
+	// the number of fine grained backup workers is the number of stores
+	// clamped into [min, max] if the concurrency is not set.
+	minFineGrainedConcurrency = 4
+	maxFineGrainedConcurrency = 64
+)
+
+// retryableErrorSampler aggregates the retryable errors of the backup, which
+// may be a storm, e.g. NotLeader errors during leader transfers.
+var retryableErrorSampler = logutil.NewSampler("backup occur retryable error", logutil.DefaultSampleInterval)
+
 // Client is a client instructs TiKV how to do a backup.
 type Client struct {
 	mgr       ClientMgr
@@ -77,6 +94,41 @@ type Client struct {
 	backend *kvproto.StorageBackend
 
 	gcTTL int64
+	// concurrency is the number of fine grained backup workers,
+	// zero means auto-scaled by the number of stores.
+	concurrency uint
+	// rateLimit overrides the rate limit of requests, it can be tuned at runtime.
+	rateLimit *utils.TunableUint64
+
+	// checkpoint records the completed ranges, nil means checkpoint is disabled.
+	checkpoint *checkpointer
+	resume     bool
+
+	// downStores records the unreachable stores, nil means the backup fails
+	// once a store is unreachable.
+	downStores *downStores
+	// tuner tunes the concurrency and the rate limit by the load of the
+	// stores, nil means they aren't tuned automatically.
+	tuner *loadTuner
+	// limiter limits the number of the ranges backed up concurrently, nil
+	// means the concurrency of BackupRanges limits them.
+	limiter *rangeLimiter
+	// fullRanges are backed up from scratch in an incremental backup, nil
+	// means there is none.
+	fullRanges *rtree.RangeTree
+	// metaVersion is the layout of the backupmeta, see metautil.
+	metaVersion int
+	// metaSignKey signs the backupmeta, nil means it isn't signed.
+	metaSignKey ed25519.PrivateKey
+	// metaWriter writes the files into the meta shards as the ranges
+	// complete, nil means the backupmeta is written at once.
+	metaWriter *metautil.MetaWriter
+	// checkFiles checks the files backed up by BackupRanges, nil means they
+	// aren't checked.
+	checkFiles func(files []*kvproto.File) error
+	// fileChecksums are the checksums of the files backed up by BackupRanges
+	// by the IDs of the tables or partitions they belong to.
+	fileChecksums map[int64]Checksum
 }
 
 // NewBackupClient returns a new backup client.
@@ -90,6 +142,11 @@ func NewBackupClient(ctx context.Context, mgr ClientMgr) (*Client, error) {
 	}, nil
 }
 
+// GetClusterID returns the ID of the cluster to be backed up.
+func (bc *Client) GetClusterID() uint64 {
+	return bc.clusterID
+}
+
 // GetTS returns the latest timestamp.
 func (bc *Client) GetTS(ctx context.Context, duration time.Duration, ts uint64) (uint64, error) {
 	var (
@@ -123,9 +180,10 @@ func (bc *Client) GetTS(ctx context.Context, duration time.Duration, ts uint64)
 	// check backup time do not exceed GCSafePoint
 	err = utils.CheckGCSafePoint(ctx, bc.mgr.GetPDClient(), backupTS)
 	if err != nil {
-		return 0, errors.Trace(err)
+		return 0, errors.Annotate(err, "invalid backup ts, please choose a newer --backupts or a smaller --timeago")
 	}
-	log.Info("backup encode timestamp", zap.Uint64("BackupTS", backupTS))
+	log.Info("backup encode timestamp", zap.Uint64("BackupTS", backupTS),
+		zap.Time("time", oracle.GetTimeFromTS(backupTS)))
 	return backupTS, nil
 }
 
@@ -136,6 +194,23 @@ func (bc *Client) SetLockFile(ctx context.Context) error {
 			"This file exists to remind other backup jobs won't use this path"))
 }
 
+// SetMetaVersion sets the layout version of the backupmeta saved.
+func (bc *Client) SetMetaVersion(version int) {
+	bc.metaVersion = version
+}
+
+// SetFilesCheck sets the check of the files backed up by BackupRanges. The
+// files are checked at once in version 1 of the backupmeta, and range by
+// range in version 2 before they are written into the meta shards.
+func (bc *Client) SetFilesCheck(check func(files []*kvproto.File) error) {
+	bc.checkFiles = check
+}
+
+// SetMetaSignKey sets the key to sign the backupmeta saved.
+func (bc *Client) SetMetaSignKey(key ed25519.PrivateKey) {
+	bc.metaSignKey = key
+}
+
 // SetGCTTL set gcTTL for client.
 func (bc *Client) SetGCTTL(ttl int64) {
 	if ttl <= 0 {
@@ -144,6 +219,63 @@ func (bc *Client) SetGCTTL(ttl int64) {
 	bc.gcTTL = ttl
 }
 
+// SetConcurrency sets the number of workers which back up the ranges
+// pushing down failed to, zero means it's auto-scaled by the number of stores.
+func (bc *Client) SetConcurrency(concurrency uint) {
+	bc.concurrency = concurrency
+}
+
+// SetFullRanges sets the ranges backed up from scratch in an incremental
+// backup, see BuildNewTableRanges.
+func (bc *Client) SetFullRanges(ranges []rtree.Range) {
+	if len(ranges) == 0 {
+		bc.fullRanges = nil
+		return
+	}
+	tree := rtree.NewRangeTree()
+	for _, r := range ranges {
+		tree.Put(r.StartKey, r.EndKey, nil)
+	}
+	bc.fullRanges = &tree
+}
+
+// SetIgnoreStoresDown sets whether to go on when a store is unreachable, the
+// regions of the store are backed up from their new leaders, the backup
+// fails only if all replicas of a region are unreachable.
+func (bc *Client) SetIgnoreStoresDown(ignore bool) {
+	if ignore {
+		bc.downStores = newDownStores()
+	} else {
+		bc.downStores = nil
+	}
+}
+
+// fineGrainedConcurrency returns the number of fine grained backup workers.
+func (bc *Client) fineGrainedConcurrency(storeCount int) int {
+	if bc.concurrency != 0 {
+		return int(bc.concurrency)
+	}
+	return utils.ClampInt(storeCount, minFineGrainedConcurrency, maxFineGrainedConcurrency)
+}
+
+// SetTunableRateLimit sets the rate limit which overrides the one in requests,
+// so that it can be changed while backing up.
+func (bc *Client) SetTunableRateLimit(rateLimit *utils.TunableUint64) {
+	bc.rateLimit = rateLimit
+}
+
+// SetTunableConcurrency sets the number of the ranges backed up concurrently
+// which overrides the concurrency of BackupRanges, so that it can be changed
+// while backing up.
+func (bc *Client) SetTunableConcurrency(concurrency *utils.TunableUint64) {
+	bc.limiter = newRangeLimiter(concurrency)
+}
+
+// GetStorage returns the external storage of the backup.
+func (bc *Client) GetStorage() storage.ExternalStorage {
+	return bc.storage
+}
+
 // GetGCTTL get gcTTL for this backup.
 func (bc *Client) GetGCTTL() int64 {
 	return bc.gcTTL
@@ -164,12 +296,23 @@ func (bc *Client) SetStorage(ctx context.Context, backend *kvproto.StorageBacken
 	if exist {
 		return errors.Annotate(berrors.ErrInvalidArgument, "backup meta exists, may be some backup files in the path already")
 	}
-	exist, err = bc.storage.FileExists(ctx, utils.LockFile)
-	if err != nil {
-		return errors.Annotatef(err, "error occurred when checking %s file", utils.LockFile)
-	}
-	if exist {
-		return errors.Annotate(berrors.ErrInvalidArgument, "backup lock exists, may be some backup files in the path already")
+	// The lock file is left by the backup to be resumed.
+	if !bc.resume {
+		exist, err = bc.storage.FileExists(ctx, utils.LockFile)
+		if err != nil {
+			return errors.Annotatef(err, "error occurred when checking %s file", utils.LockFile)
+		}
+		if exist {
+			stopped, err := bc.storage.FileExists(ctx, utils.PartialStateFile)
+			if err != nil {
+				return errors.Annotatef(err, "error occurred when checking %s file", utils.PartialStateFile)
+			}
+			if stopped {
+				return errors.Annotatef(berrors.ErrInvalidArgument,
+					"a stopped backup is in the path, see %s for its state", utils.PartialStateFile)
+			}
+			return errors.Annotate(berrors.ErrInvalidArgument, "backup lock exists, may be some backup files in the path already")
+		}
 	}
 	bc.backend = backend
 	return nil
@@ -182,6 +325,7 @@ func BuildBackupMeta(
 	rawRanges []*kvproto.RawRange,
 	ddlJobs []*model.Job,
 ) (backupMeta kvproto.BackupMeta, err error) {
+	backupMeta.ClusterId = req.ClusterId
 	backupMeta.StartVersion = req.StartVersion
 	backupMeta.EndVersion = req.EndVersion
 	backupMeta.IsRawKv = req.IsRawKv
@@ -195,16 +339,38 @@ func BuildBackupMeta(
 	return
 }
 
-// SaveBackupMeta saves the current backup meta at the given path.
-func (bc *Client) SaveBackupMeta(ctx context.Context, backupMeta *kvproto.BackupMeta) error {
-	backupMetaData, err := proto.Marshal(backupMeta)
-	if err != nil {
-		return errors.Trace(err)
+// SaveBackupMeta saves the current backup meta at the given path, along with
+// the extension holding the metadata of BR, which may be nil. In version 2,
+// the files backed up by BackupRanges are in the meta shards already, so the
+// backupmeta must hold no files.
+func (bc *Client) SaveBackupMeta(
+	ctx context.Context, backupMeta *kvproto.BackupMeta, ext *metautil.Extension,
+) error {
+	log.Debug("backup meta", logutil.Reflect("meta", backupMeta))
+	w := bc.metaWriter
+	if w == nil {
+		w = metautil.NewMetaWriter(bc.storage, bc.metaVersion)
+		if err := w.AddFiles(ctx, backupMeta.Files...); err != nil {
+			return err
+		}
+	} else if len(backupMeta.Files) != 0 {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"the backupmeta holds %d files, but the files are written into the meta shards", len(backupMeta.Files))
+	}
+	w.SetSignKey(bc.metaSignKey)
+	w.SetExtension(ext)
+	if err := w.AddSchemas(ctx, backupMeta.Schemas...); err != nil {
+		return err
+	}
+	return w.Finish(ctx, backupMeta)
+}
+
+// AbortBackupMeta removes the meta shards written by BackupRanges unless the
+// backupmeta is saved, it's called when the backup fails.
+func (bc *Client) AbortBackupMeta(ctx context.Context) {
+	if bc.metaWriter != nil {
+		bc.metaWriter.Abort(ctx)
 	}
-	log.Debug("backup meta", zap.Reflect("meta", backupMeta))
-	backendURL := storage.FormatBackendURL(bc.backend)
-	log.Info("save backup meta", zap.Stringer("path", &backendURL), zap.Int("size", len(backupMetaData)))
-	return bc.storage.Write(ctx, utils.MetaFile, backupMetaData)
 }
 
 // BuildTableRanges returns the key ranges encompassing the entire table,
@@ -244,13 +410,15 @@ func appendRanges(tbl *model.TableInfo, tblID int64) ([]kv.KeyRange, error) {
 	return kvRanges, nil
 }
 
-// BuildBackupRangeAndSchema gets the range and schema of tables.
+// BuildBackupRangeAndSchema gets the range and schema of tables. The tables of
+// the mysql database are skipped unless includeSysTables is true.
 func BuildBackupRangeAndSchema(
 	dom *domain.Domain,
 	storage kv.Storage,
 	tableFilter filter.Filter,
 	backupTS uint64,
 	ignoreStats bool,
+	includeSysTables bool,
 ) ([]rtree.Range, *Schemas, error) {
 	info, err := dom.GetSnapshotInfoSchema(backupTS)
 	if err != nil {
@@ -263,7 +431,7 @@ func BuildBackupRangeAndSchema(
 	backupSchemas := newBackupSchemas()
 	for _, dbInfo := range info.AllSchemas() {
 		// skip system databases
-		if util.IsMemOrSysDB(dbInfo.Name.L) {
+		if util.IsMemOrSysDB(dbInfo.Name.L) && !(includeSysTables && utils.IsSysDB(dbInfo.Name.L)) {
 			continue
 		}
 
@@ -352,8 +520,15 @@ func BuildBackupRangeAndSchema(
 				Table: tableData,
 				Stats: stats,
 			}
+			if tableInfo.TiFlashReplica != nil {
+				schema.TiflashReplicas = int32(tableInfo.TiFlashReplica.Count)
+			}
 			backupSchemas.pushPending(schema, dbInfo.Name.L, tableInfo.Name.L)
 
+			if tableInfo.IsView() {
+				// A view has no data.
+				continue
+			}
 			tableRanges, err := BuildTableRanges(tableInfo)
 			if err != nil {
 				return nil, nil, err
@@ -374,6 +549,91 @@ func BuildBackupRangeAndSchema(
 	return ranges, backupSchemas, nil
 }
 
+// BuildNewTableRanges returns the ranges of the tables and partitions backed
+// up at backupTS but not at lastBackupTS, e.g. the tables truncated, recovered
+// or renamed into the filter in between. Their data may be committed before
+// lastBackupTS, so an incremental backup must back them up from scratch.
+func BuildNewTableRanges(
+	dom *domain.Domain,
+	tableFilter filter.Filter,
+	lastBackupTS uint64,
+	backupTS uint64,
+	includeSysTables bool,
+) ([]rtree.Range, error) {
+	lastInfo, err := dom.GetSnapshotInfoSchema(lastBackupTS)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	lastIDs := make(map[int64]struct{})
+	forEachBackupTable(lastInfo, tableFilter, includeSysTables, func(_ *model.DBInfo, tbl *model.TableInfo) {
+		for _, id := range physicalIDs(tbl) {
+			lastIDs[id] = struct{}{}
+		}
+	})
+
+	info, err := dom.GetSnapshotInfoSchema(backupTS)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ranges := make([]rtree.Range, 0)
+	forEachBackupTable(info, tableFilter, includeSysTables, func(db *model.DBInfo, tbl *model.TableInfo) {
+		if err != nil {
+			return
+		}
+		for _, id := range physicalIDs(tbl) {
+			if _, ok := lastIDs[id]; ok {
+				continue
+			}
+			log.Info("back up the new table from scratch", zap.Stringer("db", db.Name),
+				zap.Stringer("table", tbl.Name), zap.Int64("physicalID", id))
+			var kvRanges []kv.KeyRange
+			kvRanges, err = appendRanges(tbl, id)
+			if err != nil {
+				return
+			}
+			for _, r := range kvRanges {
+				ranges = append(ranges, rtree.Range{StartKey: r.StartKey, EndKey: r.EndKey})
+			}
+		}
+	})
+	return ranges, err
+}
+
+// forEachBackupTable calls fn for each table with data matched by the filter.
+func forEachBackupTable(
+	info infoschema.InfoSchema,
+	tableFilter filter.Filter,
+	includeSysTables bool,
+	fn func(db *model.DBInfo, tbl *model.TableInfo),
+) {
+	for _, dbInfo := range info.AllSchemas() {
+		if util.IsMemOrSysDB(dbInfo.Name.L) && !(includeSysTables && utils.IsSysDB(dbInfo.Name.L)) {
+			continue
+		}
+		for _, tableInfo := range dbInfo.Tables {
+			if tableInfo.IsView() || tableInfo.IsSequence() ||
+				!tableFilter.MatchTable(dbInfo.Name.O, tableInfo.Name.O) {
+				continue
+			}
+			fn(dbInfo, tableInfo)
+		}
+	}
+}
+
+// physicalIDs returns the IDs of the partitions of the table, or the ID of
+// the table if it's not partitioned.
+func physicalIDs(tbl *model.TableInfo) []int64 {
+	pi := tbl.GetPartitionInfo()
+	if pi == nil {
+		return []int64{tbl.ID}
+	}
+	ids := make([]int64, 0, len(pi.Definitions))
+	for _, def := range pi.Definitions {
+		ids = append(ids, def.ID)
+	}
+	return ids
+}
+
 // GetBackupDDLJobs returns the ddl jobs are done in (lastBackupTS, backupTS].
 func GetBackupDDLJobs(dom *domain.Domain, lastBackupTS, backupTS uint64) ([]*model.Job, error) {
 	snapMeta, err := dom.GetSnapshotMeta(backupTS)
@@ -409,17 +669,31 @@ func GetBackupDDLJobs(dom *domain.Domain, lastBackupTS, backupTS uint64) ([]*mod
 	allJobs = append(allJobs, historyJobs...)
 
 	completedJobs := make([]*model.Job, 0)
+	// A job may be seen in both the queue and the history while it's being
+	// moved, the later one is kept.
+	seen := make(map[int64]int)
 	for _, job := range allJobs {
 		if (job.State == model.JobStateDone || job.State == model.JobStateSynced) &&
 			(job.BinlogInfo != nil && job.BinlogInfo.SchemaVersion > lastSchemaVersion) {
+			if i, ok := seen[job.ID]; ok {
+				completedJobs[i] = job
+				continue
+			}
+			seen[job.ID] = len(completedJobs)
 			completedJobs = append(completedJobs, job)
 		}
 	}
+	// Keep the jobs in the order they are executed, so they can be replayed.
+	sort.Slice(completedJobs, func(i, j int) bool {
+		return completedJobs[i].BinlogInfo.SchemaVersion < completedJobs[j].BinlogInfo.SchemaVersion
+	})
 	log.Debug("get completed jobs", zap.Int("jobs", len(completedJobs)))
 	return completedJobs, nil
 }
 
-// BackupRanges make a backup of the given key ranges.
+// BackupRanges make a backup of the given key ranges. In version 2 of the
+// backupmeta, the files are written into the meta shards as they are backed
+// up instead of being kept, and no file is returned.
 func (bc *Client) BackupRanges(
 	ctx context.Context,
 	ranges []rtree.Range,
@@ -432,35 +706,92 @@ func (bc *Client) BackupRanges(
 	// we collect all files in a single goroutine to avoid thread safety issues.
 	filesCh := make(chan []*kvproto.File, concurrency)
 	allFiles := make([]*kvproto.File, 0, len(ranges))
-	allFilesCollected := make(chan struct{}, 1)
+	defer retryableErrorSampler.Flush()
+	bc.fileChecksums = make(map[int64]Checksum)
+	// The files are written into the meta shards as soon as a shard is full,
+	// so the backupmeta isn't serialized at once at the end.
+	if bc.metaVersion == metautil.MetaV2 {
+		bc.metaWriter = metautil.NewMetaWriter(bc.storage, bc.metaVersion)
+	}
+	var resumedFiles []*kvproto.File
+	if bc.checkpoint != nil {
+		if err := bc.checkpoint.setRequested(ranges); err != nil {
+			return nil, errors.Trace(err)
+		}
+		// Only back up the ranges not completed by the last run.
+		incomplete := make([]rtree.Range, 0, len(ranges))
+		for _, r := range ranges {
+			files, rgs := bc.checkpoint.split(r)
+			resumedFiles = append(resumedFiles, files...)
+			incomplete = append(incomplete, rgs...)
+		}
+		if bc.resume {
+			log.Info("resume backup from checkpoint",
+				zap.Int("files", len(resumedFiles)), zap.Int("incomplete ranges", len(incomplete)))
+		}
+		ranges = incomplete
+		stopSaver := bc.startCheckpointSaver(ctx, &req)
+		defer stopSaver()
+	}
+	allFilesCollected := make(chan error, 1)
 	go func() {
 		init := time.Now()
 		// nolint:ineffassign
 		lastBackupStart, currentBackupStart := init, init
+		collectErr := bc.collectFiles(ctx, &allFiles, resumedFiles)
 		for files := range filesCh {
 			lastBackupStart, currentBackupStart = currentBackupStart, time.Now()
-			allFiles = append(allFiles, files...)
 			summary.CollectSuccessUnit("backup ranges", 1, currentBackupStart.Sub(lastBackupStart))
+			// Keep draining the files to not block the workers.
+			if collectErr == nil {
+				collectErr = bc.collectFiles(ctx, &allFiles, files)
+			}
 		}
 		log.Info("Backup Ranges", zap.Duration("take", currentBackupStart.Sub(init)))
-		allFilesCollected <- struct{}{}
+		if collectErr == nil && bc.metaWriter == nil && bc.checkFiles != nil {
+			collectErr = bc.checkFiles(allFiles)
+		}
+		allFilesCollected <- collectErr
 	}()
 
+	limiter := bc.limiter
+	if limiter != nil {
+		// The limiter bounds the ranges running instead.
+		concurrency = maxTunedConcurrency
+	}
+	if bc.tuner != nil {
+		tunerCtx, stopTuner := context.WithCancel(ctx)
+		defer stopTuner()
+		go bc.tuner.run(tunerCtx)
+	}
 	go func() {
 		defer close(filesCh)
 		workerPool := utils.NewWorkerPool(concurrency, "Ranges")
 		eg, ectx := errgroup.WithContext(ctx)
+		var acquireErr error
 		for _, r := range ranges {
 			sk, ek := r.StartKey, r.EndKey
+			if acquireErr = limiter.acquire(ectx); acquireErr != nil {
+				break
+			}
 			workerPool.ApplyOnErrorGroup(eg, func() error {
+				defer limiter.release()
 				files, err := bc.BackupRange(ectx, sk, ek, req, updateCh)
 				if err == nil {
+					if bc.checkpoint != nil {
+						bc.checkpoint.put(sk, ek, files)
+					}
 					filesCh <- files
 				}
 				return err
 			})
 		}
-		if err := eg.Wait(); err != nil {
+		err := eg.Wait()
+		if err == nil {
+			// The context is canceled while waiting for the limiter.
+			err = acquireErr
+		}
+		if err != nil {
 			errCh <- err
 			return
 		}
@@ -474,13 +805,37 @@ func (bc *Client) BackupRanges(
 	}
 
 	select {
-	case <-allFilesCollected:
+	case err := <-allFilesCollected:
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if bc.metaWriter != nil {
+			return nil, nil
+		}
 		return allFiles, nil
 	case <-ctx.Done():
 		return nil, errors.Trace(ctx.Err())
 	}
 }
 
+// collectFiles collects the files backed up. In version 2 of the backupmeta,
+// the files are checked and written into the meta shards at once instead of
+// being kept. The files of a range tile the range, so the files of different
+// ranges never conflict, and they are checked range by range.
+func (bc *Client) collectFiles(ctx context.Context, allFiles *[]*kvproto.File, files []*kvproto.File) error {
+	addFileChecksums(bc.fileChecksums, files)
+	if bc.metaWriter == nil {
+		*allFiles = append(*allFiles, files...)
+		return nil
+	}
+	if bc.checkFiles != nil {
+		if err := bc.checkFiles(files); err != nil {
+			return err
+		}
+	}
+	return bc.metaWriter.AddFiles(ctx, files...)
+}
+
 // BackupRange make a backup of the given key range.
 // Returns an array of files backed up.
 func (bc *Client) BackupRange(
@@ -489,11 +844,19 @@ func (bc *Client) BackupRange(
 	req kvproto.BackupRequest,
 	updateCh glue.Progress,
 ) (files []*kvproto.File, err error) {
+	if bc.rateLimit != nil {
+		req.RateLimit = bc.rateLimit.Load()
+	}
+	// The range may be a piece of a full range left by the checkpoint.
+	if req.StartVersion != 0 && bc.fullRanges != nil &&
+		bc.fullRanges.Find(&rtree.Range{StartKey: startKey}) != nil {
+		req.StartVersion = 0
+	}
 	start := time.Now()
 	defer func() {
 		elapsed := time.Since(start)
 		log.Info("backup range finished", zap.Duration("take", elapsed))
-		key := "range start:" + hex.EncodeToString(startKey) + " end:" + hex.EncodeToString(endKey)
+		key := "range start:" + logutil.WrapKey(startKey).String() + " end:" + logutil.WrapKey(endKey).String()
 		if err != nil {
 			summary.CollectFailureUnit(key, err)
 		}
@@ -516,6 +879,8 @@ func (bc *Client) BackupRange(
 	req.StorageBackend = bc.backend
 
 	push := newPushDown(bc.mgr, len(allStores))
+	push.downStores = bc.downStores
+	push.busyErrors = bc.busyErrors()
 
 	var results rtree.RangeTree
 	results, err = push.pushBackup(ctx, req, allStores, updateCh)
@@ -528,7 +893,7 @@ func (bc *Client) BackupRange(
 	// TODO: test fine grained backup.
 	err = bc.fineGrainedBackup(
 		ctx, startKey, endKey, req.StartVersion, req.EndVersion, req.CompressionType, req.CompressionLevel,
-		req.RateLimit, req.Concurrency, results, updateCh)
+		req.RateLimit, req.Concurrency, bc.fineGrainedConcurrency(len(allStores)), results, updateCh)
 	if err != nil {
 		return nil, err
 	}
@@ -550,8 +915,6 @@ func (bc *Client) BackupRange(
 		return true
 	})
 
-	// Check if there are duplicated files.
-	checkDupFiles(&results)
 	collectFileInfo(files)
 
 	return files, nil
@@ -562,10 +925,14 @@ func (bc *Client) findRegionLeader(ctx context.Context, key []byte) (*metapb.Pee
 	// in order to find the correct region.
 	key = codec.EncodeBytes([]byte{}, key)
 	for i := 0; i < 5; i++ {
-		// better backoff.
+		// The PD client retries on errors, only wait for the region and its leader here.
 		region, err := bc.mgr.GetPDClient().GetRegion(ctx, key)
-		if err != nil || region == nil {
-			log.Error("find leader failed", zap.Error(err), zap.Reflect("region", region))
+		if err != nil {
+			log.Error("find leader failed", zap.Error(err))
+			return nil, errors.Trace(err)
+		}
+		if region == nil {
+			log.Warn("region not found", zap.Stringer("Key", logutil.WrapKey(key)))
 			time.Sleep(time.Millisecond * time.Duration(100*i))
 			continue
 		}
@@ -574,7 +941,7 @@ func (bc *Client) findRegionLeader(ctx context.Context, key []byte) (*metapb.Pee
 				zap.Reflect("Leader", region.Leader), zap.Stringer("Key", logutil.WrapKey(key)))
 			return region.Leader, nil
 		}
-		log.Warn("no region found", zap.Stringer("Key", logutil.WrapKey(key)))
+		log.Warn("no leader found", zap.Stringer("Key", logutil.WrapKey(key)))
 		time.Sleep(time.Millisecond * time.Duration(100*i))
 		continue
 	}
@@ -590,28 +957,46 @@ func (bc *Client) fineGrainedBackup(
 	compressLevel int32,
 	rateLimit uint64,
 	concurrency uint32,
+	workers int,
 	rangeTree rtree.RangeTree,
 	updateCh glue.Progress,
 ) error {
 	bo := tikv.NewBackoffer(ctx, backupFineGrainedMaxBackoff)
+	// The ranges failed with permanent errors, they are not retried.
+	failed := rtree.NewRangeTree()
+	var failedErr error
+	failRange := func(resp *kvproto.BackupResponse, err error) {
+		log.Error("fine grained range failed", zap.Error(err))
+		summary.CollectFailureUnit(
+			"range start:"+logutil.WrapKey(resp.StartKey).String()+" end:"+logutil.WrapKey(resp.EndKey).String(), err)
+		failed.Put(resp.StartKey, resp.EndKey, nil)
+		if failedErr == nil {
+			failedErr = err
+		}
+	}
 	for {
 		// Step1, check whether there is any incomplete range
 		incomplete := rangeTree.GetIncompleteRange(startKey, endKey)
+		incomplete = excludeRanges(incomplete, failed.GetSortedRanges())
 		if len(incomplete) == 0 {
+			if failedErr != nil {
+				return errors.Annotatef(failedErr, "%d ranges failed in fine grained backup", failed.Len())
+			}
 			return nil
 		}
-		log.Info("start fine grained backup", zap.Int("incomplete", len(incomplete)))
+		log.Info("start fine grained backup",
+			zap.Int("incomplete", len(incomplete)), zap.Int("workers", workers))
 		// Step2, retry backup on incomplete range
-		respCh := make(chan *kvproto.BackupResponse, 4)
-		errCh := make(chan error, 4)
-		retry := make(chan rtree.Range, 4)
+		respCh := make(chan *kvproto.BackupResponse, workers)
+		errCh := make(chan error, workers)
+		retry := make(chan rtree.Range, workers)
 
 		max := &struct {
 			ms int
 			mu sync.Mutex
 		}{}
 		wg := new(sync.WaitGroup)
-		for i := 0; i < 4; i++ {
+		for i := 0; i < workers; i++ {
 			wg.Add(1)
 			fork, _ := bo.Fork()
 			go func(boFork *tikv.Backoffer) {
@@ -657,8 +1042,15 @@ func (bc *Client) fineGrainedBackup(
 					break selectLoop
 				}
 				if resp.Error != nil {
-					log.Panic("unexpected backup error",
-						zap.Reflect("error", resp.Error))
+					// The retryable errors are handled by handleFineGrained,
+					// their ranges are left incomplete and retried in the
+					// next round, only the permanent errors reach here.
+					failRange(resp, backupResponseError(resp))
+					continue
+				}
+				if err := checkFilesTiling(resp); err != nil {
+					failRange(resp, err)
+					continue
 				}
 				log.Info("put fine grained range",
 					zap.Stringer("StartKey", logutil.WrapKey(resp.StartKey)),
@@ -687,14 +1079,95 @@ func (bc *Client) fineGrainedBackup(
 	}
 }
 
+// retryableErrorBackoffMs is the backoff before retrying a range failed
+// with a retryable error.
+const retryableErrorBackoffMs = 1000
+
+// backupErrorRetryable returns whether the error of the backup response is
+// transient, i.e. the range would succeed if it's backed up again.
+func backupErrorRetryable(e *kvproto.Error) bool {
+	switch v := e.Detail.(type) {
+	case *kvproto.Error_KvError:
+		return v.KvError.Locked != nil
+	case *kvproto.Error_RegionError:
+		regionErr := v.RegionError
+		return regionErr.EpochNotMatch != nil ||
+			regionErr.NotLeader != nil ||
+			regionErr.RegionNotFound != nil ||
+			regionErr.ServerIsBusy != nil ||
+			regionErr.StaleCommand != nil ||
+			regionErr.StoreNotMatch != nil
+	}
+	return false
+}
+
+// backupErrorKind returns the kind of the error of the backup response for
+// sampling the logs.
+func backupErrorKind(e *kvproto.Error) string {
+	switch v := e.Detail.(type) {
+	case *kvproto.Error_KvError:
+		if v.KvError.Locked != nil {
+			return "KeyLocked"
+		}
+		return "KvError"
+	case *kvproto.Error_RegionError:
+		return logutil.RegionErrorKind(v.RegionError)
+	}
+	return "Unknown"
+}
+
+// backupResponseError converts the permanent error of the backup response.
+func backupResponseError(resp *kvproto.BackupResponse) error {
+	class := berrors.ErrKVUnknown
+	if resp.Error.GetClusterIdError() != nil {
+		class = berrors.ErrKVClusterIDMismatch
+	}
+	return errors.Annotatef(class, "range [%s, %s): %v",
+		logutil.WrapKey(resp.StartKey), logutil.WrapKey(resp.EndKey), resp.Error)
+}
+
+// excludeRanges removes the parts covered by excluded from ranges,
+// both of them must be sorted.
+func excludeRanges(ranges []rtree.Range, excluded []rtree.Range) []rtree.Range {
+	if len(excluded) == 0 {
+		return ranges
+	}
+	res := make([]rtree.Range, 0, len(ranges))
+	for _, rg := range ranges {
+		start := rg.StartKey
+		toEnd := false
+		for _, ex := range excluded {
+			if len(ex.EndKey) != 0 && bytes.Compare(ex.EndKey, start) <= 0 {
+				continue
+			}
+			if len(rg.EndKey) != 0 && bytes.Compare(ex.StartKey, rg.EndKey) >= 0 {
+				break
+			}
+			if bytes.Compare(ex.StartKey, start) > 0 {
+				res = append(res, rtree.Range{StartKey: start, EndKey: ex.StartKey})
+			}
+			if len(ex.EndKey) == 0 {
+				toEnd = true
+				break
+			}
+			start = ex.EndKey
+		}
+		if !toEnd && (len(rg.EndKey) == 0 || bytes.Compare(start, rg.EndKey) < 0) {
+			res = append(res, rtree.Range{StartKey: start, EndKey: rg.EndKey})
+		}
+	}
+	return res
+}
+
 func onBackupResponse(
 	storeID uint64,
 	bo *tikv.Backoffer,
 	backupTS uint64,
 	lockResolver *tikv.LockResolver,
+	busyErrors *busyErrorCounter,
 	resp *kvproto.BackupResponse,
 ) (*kvproto.BackupResponse, int, error) {
-	log.Debug("onBackupResponse", zap.Reflect("resp", resp))
+	log.Debug("onBackupResponse", logutil.Reflect("resp", resp))
 	if resp.Error == nil {
 		return resp, 0, nil
 	}
@@ -703,7 +1176,8 @@ func onBackupResponse(
 	case *kvproto.Error_KvError:
 		if lockErr := v.KvError.Locked; lockErr != nil {
 			// Try to resolve lock.
-			log.Warn("backup occur kv error", zap.Reflect("error", v))
+			busyErrors.recordRetryableError(resp.Error,
+				logutil.Reflect("error", v), zap.Uint64("storeID", storeID))
 			msBeforeExpired, _, err1 := lockResolver.ResolveLocks(
 				bo, backupTS, []*tikv.Lock{tikv.NewLock(lockErr)})
 			if err1 != nil {
@@ -715,29 +1189,23 @@ func onBackupResponse(
 			return nil, backoffMs, nil
 		}
 		// Backup should not meet error other than KeyLocked.
-		log.Error("unexpect kv error", zap.Reflect("KvError", v.KvError))
+		log.Error("unexpect kv error", logutil.Reflect("KvError", v.KvError))
 		return nil, backoffMs, errors.Annotatef(berrors.ErrKVUnknown, "storeID: %d onBackupResponse error %v", storeID, v)
 
 	case *kvproto.Error_RegionError:
 		regionErr := v.RegionError
-		// Ignore following errors.
-		if !(regionErr.EpochNotMatch != nil ||
-			regionErr.NotLeader != nil ||
-			regionErr.RegionNotFound != nil ||
-			regionErr.ServerIsBusy != nil ||
-			regionErr.StaleCommand != nil ||
-			regionErr.StoreNotMatch != nil) {
-			log.Error("unexpect region error", zap.Reflect("RegionError", regionErr))
+		// Ignore retryable errors.
+		if !backupErrorRetryable(resp.Error) {
+			log.Error("unexpect region error", logutil.Reflect("RegionError", regionErr))
 			return nil, backoffMs, errors.Annotatef(berrors.ErrKVUnknown, "storeID: %d onBackupResponse error %v", storeID, v)
 		}
-		log.Warn("backup occur region error",
-			zap.Reflect("RegionError", regionErr),
-			zap.Uint64("storeID", storeID))
+		busyErrors.recordRetryableError(resp.Error,
+			logutil.Reflect("RegionError", regionErr), zap.Uint64("storeID", storeID))
 		// TODO: a better backoff.
-		backoffMs = 1000 /* 1s */
+		backoffMs = retryableErrorBackoffMs
 		return nil, backoffMs, nil
 	case *kvproto.Error_ClusterIdError:
-		log.Error("backup occur cluster ID error", zap.Reflect("error", v), zap.Uint64("storeID", storeID))
+		log.Error("backup occur cluster ID error", logutil.Reflect("error", v), zap.Uint64("storeID", storeID))
 		return nil, 0, errors.Annotatef(berrors.ErrKVClusterIDMismatch, "%v on storeID: %d", resp.Error, storeID)
 	default:
 		log.Error("backup occur unknown error", zap.String("error", resp.Error.GetMsg()), zap.Uint64("storeID", storeID))
@@ -776,9 +1244,15 @@ func (bc *Client) handleFineGrained(
 		CompressionType:  compressType,
 		CompressionLevel: compressionLevel,
 	}
+	if bc.rateLimit != nil {
+		req.RateLimit = bc.rateLimit.Load()
+	}
 	lockResolver := bc.mgr.GetLockResolver()
 	client, err := bc.mgr.GetBackupClient(ctx, storeID)
 	if err != nil {
+		if bc.downStores != nil && ctx.Err() == nil {
+			return bc.onStoreDown(ctx, rg.StartKey, storeID, err)
+		}
 		log.Error("fail to connect store", zap.Uint64("StoreID", storeID))
 		return 0, errors.Trace(err)
 	}
@@ -787,8 +1261,13 @@ func (bc *Client) handleFineGrained(
 		// Handle responses with the same backoffer.
 		func(resp *kvproto.BackupResponse) error {
 			response, backoffMs, err1 :=
-				onBackupResponse(storeID, bo, backupTS, lockResolver, resp)
+				onBackupResponse(storeID, bo, backupTS, lockResolver, bc.busyErrors(), resp)
 			if err1 != nil {
+				if resp.Error != nil && !backupErrorRetryable(resp.Error) {
+					// Only the range fails, report it and go on with the others.
+					respCh <- resp
+					return nil
+				}
 				return err1
 			}
 			if max < backoffMs {
@@ -804,11 +1283,41 @@ func (bc *Client) handleFineGrained(
 			return bc.mgr.ResetBackupClient(ctx, storeID)
 		})
 	if err != nil {
+		if bc.downStores != nil && ctx.Err() == nil {
+			return bc.onStoreDown(ctx, rg.StartKey, storeID, err)
+		}
 		return 0, err
 	}
 	return max, nil
 }
 
+// storeDownBackoffMs is the backoff before retrying a range whose leader is
+// on an unreachable store, to wait for a new leader to be elected.
+const storeDownBackoffMs = 3000
+
+// onStoreDown records the store of the region leader as unreachable. It
+// returns the backoff to wait for a new leader, or an error if all replicas
+// of the region are on the unreachable stores.
+func (bc *Client) onStoreDown(ctx context.Context, key []byte, storeID uint64, cause error) (int, error) {
+	log.Warn("store is unreachable, wait for a new leader",
+		zap.Uint64("StoreID", storeID), zap.Stringer("Key", logutil.WrapKey(key)), zap.Error(cause))
+	bc.downStores.add(storeID)
+	region, err := bc.mgr.GetPDClient().GetRegion(ctx, codec.EncodeBytes([]byte{}, key))
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if region == nil || region.Meta == nil {
+		return storeDownBackoffMs, nil
+	}
+	for _, peer := range region.Meta.GetPeers() {
+		if !bc.downStores.contains(peer.GetStoreId()) {
+			return storeDownBackoffMs, nil
+		}
+	}
+	return 0, errors.Annotatef(berrors.ErrBackupNoLeader,
+		"all replicas of region %d are on unreachable stores: %v", region.Meta.GetId(), cause)
+}
+
 // SendBackup send backup request to the given store.
 // Stop receiving response if respFn returns error.
 func SendBackup(
@@ -885,12 +1394,14 @@ backupLoop:
 }
 
 // ChecksumMatches tests whether the "local" checksum matches the checksum from TiKV.
+// All mismatched tables are reported in the returned error.
 func ChecksumMatches(backupMeta *kvproto.BackupMeta, local []Checksum) error {
 	if len(local) != len(backupMeta.Schemas) {
 		return errors.Annotatef(berrors.ErrBackupChecksumMismatch,
 			"checksum mismatch, checksum len %d, schema len %d", len(local), len(backupMeta.Schemas))
 	}
 
+	mismatched := make([]string, 0)
 	for i, schema := range backupMeta.Schemas {
 		localChecksum := local[i]
 		dbInfo := &model.DBInfo{}
@@ -915,13 +1426,19 @@ func ChecksumMatches(backupMeta *kvproto.BackupMeta, local []Checksum) error {
 				zap.Uint64("calculated total kvs", localChecksum.TotalKvs),
 				zap.Uint64("origin tidb total bytes", schema.TotalBytes),
 				zap.Uint64("calculated total bytes", localChecksum.TotalBytes))
-			// TODO enhance error
-			return errors.Annotate(berrors.ErrBackupChecksumMismatch, "failed in checksum, and cannot parse table info")
+			mismatched = append(mismatched, fmt.Sprintf("%s.%s",
+				utils.EncloseName(dbInfo.Name.O), utils.EncloseName(tblInfo.Name.O)))
+			continue
 		}
 		log.Info("checksum success",
 			zap.String("database", dbInfo.Name.L),
 			zap.String("table", tblInfo.Name.L))
 	}
+	if len(mismatched) > 0 {
+		return errors.Annotatef(berrors.ErrBackupChecksumMismatch,
+			"the checksum of backup files mismatches the cluster checksum, tables: %s",
+			strings.Join(mismatched, ", "))
+	}
 	return nil
 }
 
@@ -936,21 +1453,48 @@ func collectFileInfo(files []*kvproto.File) {
 // CollectChecksums check data integrity by xor all(sst_checksum) per table
 // it returns the checksum of all local files.
 func CollectChecksums(backupMeta *kvproto.BackupMeta) ([]Checksum, error) {
+	byID := make(map[int64]Checksum)
+	addFileChecksums(byID, backupMeta.Files)
+	return checksumsOfSchemas(backupMeta.Schemas, byID)
+}
+
+// CollectChecksums is CollectChecksums of the files backed up by
+// BackupRanges, which aren't kept in version 2 of the backupmeta.
+func (bc *Client) CollectChecksums(schemas []*kvproto.Schema) ([]Checksum, error) {
+	return checksumsOfSchemas(schemas, bc.fileChecksums)
+}
+
+// addFileChecksums adds the checksums of the files into byID by the IDs of
+// the tables or partitions they belong to.
+func addFileChecksums(byID map[int64]Checksum, files []*kvproto.File) {
+	for _, file := range files {
+		// If the file do not contains any table data, skip it.
+		if !bytes.HasPrefix(file.GetStartKey(), tablecodec.TablePrefix()) &&
+			!bytes.HasPrefix(file.GetEndKey(), tablecodec.TablePrefix()) {
+			continue
+		}
+		id := tablecodec.DecodeTableID(file.GetStartKey())
+		checksum := byID[id]
+		checksum.Crc64Xor ^= file.Crc64Xor
+		checksum.TotalKvs += file.TotalKvs
+		checksum.TotalBytes += file.TotalBytes
+		byID[id] = checksum
+	}
+}
+
+// checksumsOfSchemas returns the checksums of the tables of the schemas, in
+// the order of the schemas, by the checksums of their tables or partitions.
+func checksumsOfSchemas(schemas []*kvproto.Schema, byID map[int64]Checksum) ([]Checksum, error) {
 	start := time.Now()
 	defer func() {
 		elapsed := time.Since(start)
 		summary.CollectDuration("backup fast checksum", elapsed)
 	}()
 
-	dbs, err := utils.LoadBackupTables(backupMeta)
-	if err != nil {
-		return nil, err
-	}
-
-	checksums := make([]Checksum, 0, len(backupMeta.Schemas))
-	for _, schema := range backupMeta.Schemas {
+	checksums := make([]Checksum, 0, len(schemas))
+	for _, schema := range schemas {
 		dbInfo := &model.DBInfo{}
-		err = json.Unmarshal(schema.Db, dbInfo)
+		err := json.Unmarshal(schema.Db, dbInfo)
 		if err != nil {
 			return nil, err
 		}
@@ -959,23 +1503,21 @@ func CollectChecksums(backupMeta *kvproto.BackupMeta) ([]Checksum, error) {
 		if err != nil {
 			return nil, err
 		}
-		tbl := dbs[dbInfo.Name.String()].GetTable(tblInfo.Name.String())
-
-		checksum := uint64(0)
-		totalKvs := uint64(0)
-		totalBytes := uint64(0)
-		for _, file := range tbl.Files {
-			checksum ^= file.Crc64Xor
-			totalKvs += file.TotalKvs
-			totalBytes += file.TotalBytes
+		ids := []int64{tblInfo.ID}
+		if tblInfo.Partition != nil {
+			for _, p := range tblInfo.Partition.Definitions {
+				ids = append(ids, p.ID)
+			}
+		}
+		var localChecksum Checksum
+		for _, id := range ids {
+			checksum := byID[id]
+			localChecksum.Crc64Xor ^= checksum.Crc64Xor
+			localChecksum.TotalKvs += checksum.TotalKvs
+			localChecksum.TotalBytes += checksum.TotalBytes
 		}
 
 		log.Info("fast checksum calculated", zap.Stringer("db", dbInfo.Name), zap.Stringer("table", tblInfo.Name))
-		localChecksum := Checksum{
-			Crc64Xor:   checksum,
-			TotalKvs:   totalKvs,
-			TotalBytes: totalBytes,
-		}
 		checksums = append(checksums, localChecksum)
 	}
 
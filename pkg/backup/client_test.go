@@ -4,11 +4,14 @@ package backup_test
 
 import (
 	"context"
+	"encoding/json"
 	"math"
 	"testing"
 	"time"
 
 	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/mockstore/mocktikv"
@@ -19,7 +22,10 @@ import (
 
 	"github.com/pingcap/br/pkg/backup"
 	"github.com/pingcap/br/pkg/conn"
+	"github.com/pingcap/br/pkg/metautil"
 	"github.com/pingcap/br/pkg/pdutil"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
 )
 
 type testBackup struct {
@@ -27,6 +33,7 @@ type testBackup struct {
 	cancel context.CancelFunc
 
 	mockPDClient pd.Client
+	mockMgr      *conn.Mgr
 	backupClient *backup.Client
 }
 
@@ -46,6 +53,7 @@ func (r *testBackup) SetUpSuite(c *C) {
 	var err error
 	r.backupClient, err = backup.NewBackupClient(r.ctx, mockMgr)
 	c.Assert(err, IsNil)
+	r.mockMgr = mockMgr
 }
 
 func (r *testBackup) TestGetTS(c *C) {
@@ -140,3 +148,210 @@ func (r *testBackup) TestBuildTableRange(c *C) {
 		{StartKey: tablecodec.EncodeRowKey(7, low), EndKey: tablecodec.EncodeRowKey(7, high)},
 	})
 }
+
+func (r *testBackup) TestChecksumMatches(c *C) {
+	dbData, err := json.Marshal(&model.DBInfo{Name: model.NewCIStr("test")})
+	c.Assert(err, IsNil)
+	schemas := make([]*kvproto.Schema, 0, 2)
+	for _, name := range []string{"t1", "t2"} {
+		tblData, err := json.Marshal(&model.TableInfo{Name: model.NewCIStr(name)})
+		c.Assert(err, IsNil)
+		schemas = append(schemas, &kvproto.Schema{
+			Db: dbData, Table: tblData, Crc64Xor: 1, TotalKvs: 2, TotalBytes: 3,
+		})
+	}
+	backupMeta := &kvproto.BackupMeta{Schemas: schemas}
+
+	matched := []backup.Checksum{{1, 2, 3}, {1, 2, 3}}
+	c.Assert(backup.ChecksumMatches(backupMeta, matched), IsNil)
+
+	mismatched := []backup.Checksum{{1, 2, 3}, {1, 2, 4}}
+	err = backup.ChecksumMatches(backupMeta, mismatched)
+	c.Assert(err, ErrorMatches, ".*tables: `test`.`t2`.*")
+
+	err = backup.ChecksumMatches(backupMeta, matched[:1])
+	c.Assert(err, ErrorMatches, ".*checksum len 1, schema len 2.*")
+}
+
+func (r *testBackup) TestCheckStorageFiles(c *C) {
+	for _, version := range []int{metautil.MetaV1, metautil.MetaV2} {
+		local, err := storage.NewLocalStorage(c.MkDir())
+		c.Assert(err, IsNil)
+		c.Assert(local.Write(r.ctx, "1.sst", []byte("file 1")), IsNil)
+		c.Assert(local.Write(r.ctx, "2.sst", []byte("file 2")), IsNil)
+		c.Assert(local.Write(r.ctx, "orphaned.sst", []byte("orphaned")), IsNil)
+		check := func(meta *kvproto.BackupMeta) error {
+			c.Assert(metautil.WriteBackupMeta(r.ctx, local, meta, version, nil), IsNil)
+			reader, e := metautil.NewMetaReader(r.ctx, local, utils.MetaFile, nil)
+			c.Assert(e, IsNil)
+			return backup.CheckStorageFiles(r.ctx, local, reader)
+		}
+
+		meta := &kvproto.BackupMeta{Files: []*kvproto.File{
+			{Name: "1.sst", Size_: 6},
+			// The size reported by old TiKV is zero.
+			{Name: "2.sst"},
+		}}
+		c.Assert(check(meta), IsNil)
+
+		meta.Files[0].Size_ = 7
+		meta.Files = append(meta.Files, &kvproto.File{Name: "3.sst"})
+		err = check(meta)
+		c.Assert(err, ErrorMatches, ".*1 files missing and 1 files of mismatched size.*")
+	}
+}
+
+func (r *testBackup) TestCollectChecksums(c *C) {
+	tblInfo := &model.TableInfo{ID: 1, Name: model.NewCIStr("t"), Partition: &model.PartitionInfo{
+		Definitions: []model.PartitionDefinition{{ID: 2}, {ID: 3}},
+	}}
+	dbInfo := &model.DBInfo{Name: model.NewCIStr("test")}
+	dbData, err := json.Marshal(dbInfo)
+	c.Assert(err, IsNil)
+	tblData, err := json.Marshal(tblInfo)
+	c.Assert(err, IsNil)
+	file := func(tableID int64, crc uint64) *kvproto.File {
+		return &kvproto.File{
+			StartKey: tablecodec.EncodeTablePrefix(tableID),
+			EndKey:   tablecodec.EncodeTablePrefix(tableID + 1),
+			Crc64Xor: crc, TotalKvs: 1, TotalBytes: 10,
+		}
+	}
+	meta := &kvproto.BackupMeta{
+		Files: []*kvproto.File{file(2, 3), file(3, 6), file(4, 4),
+			// The files not holding table data are of no table.
+			{StartKey: []byte("a"), EndKey: []byte("b"), TotalKvs: 1}},
+		Schemas: []*kvproto.Schema{{Db: dbData, Table: tblData}},
+	}
+	checksums, err := backup.CollectChecksums(meta)
+	c.Assert(err, IsNil)
+	c.Assert(checksums, DeepEquals, []backup.Checksum{{Crc64Xor: 5, TotalKvs: 2, TotalBytes: 20}})
+}
+
+func (r *testBackup) TestFindFileConflicts(c *C) {
+	files := []*kvproto.File{
+		{Name: "1_10_5_aa_write.sst", Cf: "write", StartKey: []byte("a"), EndKey: []byte("c")},
+		{Name: "1_10_5_aa_default.sst", Cf: "default", StartKey: []byte("a"), EndKey: []byte("c")},
+		{Name: "1_20_5_cc_write.sst", Cf: "write", StartKey: []byte("c"), EndKey: []byte("e")},
+	}
+	c.Assert(backup.FindFileConflicts(files), HasLen, 0)
+	c.Assert(backup.CheckFileConflicts(files), IsNil)
+
+	files = append(files,
+		&kvproto.File{Name: "1_30_5_dd_write.sst", Cf: "write", StartKey: []byte("d"), EndKey: []byte("f")},
+		&kvproto.File{Name: "1_10_5_aa_write.sst", Cf: "write", StartKey: []byte("x"), EndKey: []byte("y")},
+	)
+	conflicts := backup.FindFileConflicts(files)
+	c.Assert(conflicts, HasLen, 2)
+	c.Assert(conflicts[0].Reason, Equals, "duplicated name")
+	c.Assert(conflicts[1].Reason, Equals, "overlapping range")
+	c.Assert(conflicts[1].File1.Name, Equals, "1_20_5_cc_write.sst")
+	c.Assert(conflicts[1].File2.Name, Equals, "1_30_5_dd_write.sst")
+	c.Assert(backup.CheckFileConflicts(files), ErrorMatches, ".*2 pairs of files conflict.*")
+
+	// The region is backed up by another store after the leader moved.
+	files = append(files[:3:3],
+		&kvproto.File{Name: "2_10_6_aa_write.sst", Cf: "write", StartKey: []byte("a"), EndKey: []byte("b")},
+	)
+	conflicts = backup.FindFileConflicts(files)
+	c.Assert(conflicts[0].Reason, Equals, "same region on different stores")
+	c.Assert(conflicts[0].File1.Name, Equals, "1_10_5_aa_write.sst")
+	c.Assert(conflicts[0].File2.Name, Equals, "2_10_6_aa_write.sst")
+}
+
+func (r *testBackup) TestParseFileName(c *C) {
+	fn, err := backup.ParseFileName("backup/1_2_3_0a1b_write.sst")
+	c.Assert(err, IsNil)
+	c.Assert(fn, DeepEquals, backup.FileName{StoreID: 1, RegionID: 2, Epoch: 3, Hash: "0a1b", CF: "write"})
+
+	for _, name := range []string{"1_write.sst", "1_2_3_0a1b_write", "1_x_3_0a1b_write.sst", "1_2_3_zz_write.sst"} {
+		_, err = backup.ParseFileName(name)
+		c.Assert(err, ErrorMatches, ".*doesn't follow.*", Commentf("%s", name))
+	}
+	files := []*kvproto.File{{Name: "1_2_3_0a1b_write.sst", Cf: "default"}}
+	c.Assert(backup.CheckFileNames(files), ErrorMatches, ".*is of cf default, but its name says write.*")
+	// The conflicts are checked regardless of the names.
+	c.Assert(backup.CheckFileConflicts(files), IsNil)
+}
+
+func (r *testBackup) TestResumeCheckpoint(c *C) {
+	dir := c.MkDir()
+	backend, err := storage.ParseBackend("local://"+dir, nil)
+	c.Assert(err, IsNil)
+	local, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	cp := backup.Checkpoint{
+		ClusterID:   r.backupClient.GetClusterID(),
+		EndVersion:  10,
+		SafePointID: "br-resumed",
+		Filter:      []string{"db.*"},
+	}
+	data, err := json.Marshal(cp)
+	c.Assert(err, IsNil)
+	c.Assert(local.Write(r.ctx, utils.CheckpointFile, data), IsNil)
+
+	client, err := backup.NewBackupClient(r.ctx, r.mockMgr)
+	c.Assert(err, IsNil)
+	client.EnableCheckpoint(true)
+	c.Assert(client.SetStorage(r.ctx, backend, false), IsNil)
+	loaded, err := client.LoadCheckpoint(r.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(loaded.SafePointID, Equals, "br-resumed")
+	c.Assert(client.CheckpointExists(), IsTrue)
+
+	err = client.SetCheckpointOptions(loaded.SafePointID, []string{"*.*"})
+	c.Assert(err, ErrorMatches, ".*resume the backup with the same filter.*")
+	c.Assert(client.SetCheckpointOptions(loaded.SafePointID, []string{"db.*"}), IsNil)
+
+	// The checkpoint is removed once the backup succeeds.
+	c.Assert(client.RemoveCheckpoint(r.ctx), IsNil)
+	c.Assert(client.CheckpointExists(), IsFalse)
+	exist, err := local.FileExists(r.ctx, utils.CheckpointFile)
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+}
+
+func (r *testBackup) TestPartialState(c *C) {
+	dir := c.MkDir()
+	backend, err := storage.ParseBackend("local://"+dir, nil)
+	c.Assert(err, IsNil)
+	local, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	data, err := json.Marshal(backup.Checkpoint{ClusterID: r.backupClient.GetClusterID(), EndVersion: 10})
+	c.Assert(err, IsNil)
+	c.Assert(local.Write(r.ctx, utils.CheckpointFile, data), IsNil)
+
+	client, err := backup.NewBackupClient(r.ctx, r.mockMgr)
+	c.Assert(err, IsNil)
+	client.EnableCheckpoint(true)
+	c.Assert(client.SetStorage(r.ctx, backend, false), IsNil)
+	_, err = client.LoadCheckpoint(r.ctx)
+	c.Assert(err, IsNil)
+	readState := func() backup.PartialState {
+		raw, readErr := local.Read(r.ctx, utils.PartialStateFile)
+		c.Assert(readErr, IsNil)
+		var state backup.PartialState
+		c.Assert(json.Unmarshal(raw, &state), IsNil)
+		return state
+	}
+
+	// The snapshot may be GCed once the safe point is removed.
+	c.Assert(client.SavePartialState(r.ctx, "backup", errors.New("interrupted")), IsNil)
+	state := readState()
+	c.Assert(state.Phase, Equals, "backup")
+	c.Assert(state.Error, Equals, "interrupted")
+	c.Assert(state.Resumable, IsFalse)
+
+	expire := time.Now().Add(time.Hour).Round(time.Second)
+	client.SetSafePointExpireTime(expire)
+	c.Assert(client.SavePartialState(r.ctx, "backup", errors.New("interrupted")), IsNil)
+	state = readState()
+	c.Assert(state.Resumable, IsTrue)
+	c.Assert(state.SafePointExpireTime.Equal(expire), IsTrue)
+
+	// The partial state is removed once the resumed backup succeeds.
+	c.Assert(client.RemoveCheckpoint(r.ctx), IsNil)
+	exist, err := local.FileExists(r.ctx, utils.PartialStateFile)
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup
+
+import (
+	. "github.com/pingcap/check"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/kvproto/pkg/errorpb"
+	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+
+	"github.com/pingcap/br/pkg/rtree"
+)
+
+type testFineGrainedSuite struct{}
+
+var _ = Suite(&testFineGrainedSuite{})
+
+func keyRange(start, end string) rtree.Range {
+	rg := rtree.Range{StartKey: []byte(start)}
+	if end != "" {
+		rg.EndKey = []byte(end)
+	}
+	return rg
+}
+
+func (s *testFineGrainedSuite) TestExcludeRanges(c *C) {
+	cases := []struct {
+		ranges   []rtree.Range
+		excluded []rtree.Range
+		expected []rtree.Range
+	}{
+		{
+			ranges:   []rtree.Range{keyRange("a", "z")},
+			excluded: nil,
+			expected: []rtree.Range{keyRange("a", "z")},
+		},
+		{
+			ranges:   []rtree.Range{keyRange("a", "z")},
+			excluded: []rtree.Range{keyRange("c", "e"), keyRange("g", "h")},
+			expected: []rtree.Range{keyRange("a", "c"), keyRange("e", "g"), keyRange("h", "z")},
+		},
+		// The excluded range covers the start of the range.
+		{
+			ranges:   []rtree.Range{keyRange("b", "z")},
+			excluded: []rtree.Range{keyRange("a", "c")},
+			expected: []rtree.Range{keyRange("c", "z")},
+		},
+		// The excluded range has no end.
+		{
+			ranges:   []rtree.Range{keyRange("a", "z")},
+			excluded: []rtree.Range{keyRange("m", "")},
+			expected: []rtree.Range{keyRange("a", "m")},
+		},
+		// The range has no end.
+		{
+			ranges:   []rtree.Range{keyRange("a", "")},
+			excluded: []rtree.Range{keyRange("c", "e")},
+			expected: []rtree.Range{keyRange("a", "c"), keyRange("e", "")},
+		},
+		// The excluded range overlaps several ranges.
+		{
+			ranges:   []rtree.Range{keyRange("a", "c"), keyRange("d", "f")},
+			excluded: []rtree.Range{keyRange("b", "e")},
+			expected: []rtree.Range{keyRange("a", "b"), keyRange("e", "f")},
+		},
+		// The range is excluded entirely.
+		{
+			ranges:   []rtree.Range{keyRange("c", "d")},
+			excluded: []rtree.Range{keyRange("a", "z")},
+			expected: []rtree.Range{},
+		},
+	}
+	for i, cs := range cases {
+		c.Assert(excludeRanges(cs.ranges, cs.excluded), DeepEquals, cs.expected, Commentf("case %d", i))
+	}
+}
+
+func (s *testFineGrainedSuite) TestBackupErrorRetryable(c *C) {
+	retryable := []*kvproto.Error{
+		{Detail: &kvproto.Error_KvError{KvError: &kvrpcpb.KeyError{Locked: &kvrpcpb.LockInfo{}}}},
+		{Detail: &kvproto.Error_RegionError{RegionError: &errorpb.Error{NotLeader: &errorpb.NotLeader{}}}},
+		{Detail: &kvproto.Error_RegionError{RegionError: &errorpb.Error{ServerIsBusy: &errorpb.ServerIsBusy{}}}},
+	}
+	for _, e := range retryable {
+		c.Assert(backupErrorRetryable(e), IsTrue, Commentf("%v", e))
+	}
+	permanent := []*kvproto.Error{
+		{Detail: &kvproto.Error_KvError{KvError: &kvrpcpb.KeyError{Abort: "aborted"}}},
+		{Detail: &kvproto.Error_RegionError{RegionError: &errorpb.Error{KeyNotInRegion: &errorpb.KeyNotInRegion{}}}},
+		{Detail: &kvproto.Error_ClusterIdError{ClusterIdError: &kvproto.ClusterIDError{}}},
+		{Msg: "unknown"},
+	}
+	for _, e := range permanent {
+		c.Assert(backupErrorRetryable(e), IsFalse, Commentf("%v", e))
+	}
+}
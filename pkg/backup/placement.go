@@ -0,0 +1,51 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup
+
+import (
+	"encoding/hex"
+
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/tikv/pd/server/schedule/placement"
+
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// tiflashRuleGroup is the group of the placement rules of the TiFlash
+// replicas, which are re-created by setting the replicas on restore.
+const tiflashRuleGroup = "tiflash"
+
+// TablePlacementRules returns the placement rules of the tables, i.e. the
+// ones whose start keys are in the tables or their partitions. The default
+// rules of PD are for the whole cluster, and the rules of the TiFlash
+// replicas are managed by TiDB, they are not included.
+func TablePlacementRules(rules []placement.Rule, tables []*utils.Table) []placement.Rule {
+	physicalIDs := make(map[int64]struct{})
+	for _, table := range tables {
+		physicalIDs[table.Info.ID] = struct{}{}
+		if pi := table.Info.GetPartitionInfo(); pi != nil {
+			for _, def := range pi.Definitions {
+				physicalIDs[def.ID] = struct{}{}
+			}
+		}
+	}
+	tableRules := make([]placement.Rule, 0)
+	for _, rule := range rules {
+		if rule.GroupID == tiflashRuleGroup {
+			continue
+		}
+		key, err := hex.DecodeString(rule.StartKeyHex)
+		if err != nil || len(key) == 0 {
+			continue
+		}
+		_, decoded, err := codec.DecodeBytes(key, nil)
+		if err != nil {
+			continue
+		}
+		if _, ok := physicalIDs[tablecodec.DecodeTableID(decoded)]; ok {
+			tableRules = append(tableRules, rule)
+		}
+	}
+	return tableRules
+}
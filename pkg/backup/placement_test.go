@@ -0,0 +1,38 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup_test
+
+import (
+	"encoding/hex"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/tikv/pd/server/schedule/placement"
+
+	"github.com/pingcap/br/pkg/backup"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+var _ = Suite(&testPlacementSuite{})
+
+type testPlacementSuite struct{}
+
+func (s *testPlacementSuite) TestTablePlacementRules(c *C) {
+	ruleOf := func(group string, tableID int64) placement.Rule {
+		key := hex.EncodeToString(codec.EncodeBytes(nil, tablecodec.EncodeTablePrefix(tableID)))
+		return placement.Rule{GroupID: group, ID: "0", StartKeyHex: key}
+	}
+	rules := []placement.Rule{
+		{GroupID: "pd", ID: "default"},
+		ruleOf("TiDB_DDL_10", 10),
+		ruleOf("TiDB_DDL_11", 11),
+		ruleOf("tiflash", 10),
+		ruleOf("TiDB_DDL_20", 20),
+	}
+	tables := []*utils.Table{{Info: &model.TableInfo{ID: 10, Partition: &model.PartitionInfo{
+		Definitions: []model.PartitionDefinition{{ID: 11}},
+	}}}}
+	c.Assert(backup.TablePlacementRules(rules, tables), DeepEquals, []placement.Rule{rules[1], rules[2]})
+}
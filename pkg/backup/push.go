@@ -14,6 +14,7 @@ import (
 
 	berrors "github.com/pingcap/br/pkg/errors"
 	"github.com/pingcap/br/pkg/glue"
+	"github.com/pingcap/br/pkg/logutil"
 	"github.com/pingcap/br/pkg/rtree"
 )
 
@@ -22,6 +23,48 @@ type pushDown struct {
 	mgr    ClientMgr
 	respCh chan *backup.BackupResponse
 	errCh  chan error
+
+	// downStores records the unreachable stores, whose regions are left to
+	// the fine grained backup. nil means failing on unreachable stores.
+	downStores *downStores
+	// busyErrors counts the ServerIsBusy errors, it's nil unless the backup
+	// is tuned.
+	busyErrors *busyErrorCounter
+}
+
+// downStores is the set of the unreachable stores.
+type downStores struct {
+	mu  sync.Mutex
+	ids map[uint64]struct{}
+}
+
+func newDownStores() *downStores {
+	return &downStores{ids: make(map[uint64]struct{})}
+}
+
+func (s *downStores) add(storeID uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[storeID] = struct{}{}
+}
+
+func (s *downStores) contains(storeID uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.ids[storeID]
+	return ok
+}
+
+// skipStore returns whether the backup goes on without the store, and
+// records it as unreachable if so.
+func (push *pushDown) skipStore(ctx context.Context, storeID uint64, err error) bool {
+	if push.downStores == nil || ctx.Err() != nil {
+		return false
+	}
+	log.Warn("skip unreachable store, leave its regions to fine grained backup",
+		zap.Uint64("StoreID", storeID), zap.Error(err))
+	push.downStores.add(storeID)
+	return true
 }
 
 // newPushDown creates a push down backup.
@@ -51,6 +94,9 @@ func (push *pushDown) pushBackup(
 		}
 		client, err := push.mgr.GetBackupClient(ctx, storeID)
 		if err != nil {
+			if push.skipStore(ctx, storeID, err) {
+				continue
+			}
 			log.Error("fail to connect store", zap.Uint64("StoreID", storeID))
 			return res, errors.Trace(err)
 		}
@@ -69,6 +115,9 @@ func (push *pushDown) pushBackup(
 					return push.mgr.ResetBackupClient(ctx, storeID)
 				})
 			if err != nil {
+				if push.skipStore(ctx, storeID, err) {
+					return
+				}
 				push.errCh <- err
 				return
 			}
@@ -89,6 +138,11 @@ func (push *pushDown) pushBackup(
 				return res, nil
 			}
 			if resp.GetError() == nil {
+				if err := checkFilesTiling(resp); err != nil {
+					// Leave the range to fine grained backup.
+					log.Warn("backup files incomplete, retry the range later", zap.Error(err))
+					continue
+				}
 				// None error means range has been backuped successfully.
 				res.Put(
 					resp.GetStartKey(), resp.GetEndKey(), resp.GetFiles())
@@ -99,10 +153,10 @@ func (push *pushDown) pushBackup(
 				errPb := resp.GetError()
 				switch v := errPb.Detail.(type) {
 				case *backup.Error_KvError:
-					log.Warn("backup occur kv error", zap.Reflect("error", v))
+					push.busyErrors.recordRetryableError(errPb, logutil.Reflect("error", v))
 
 				case *backup.Error_RegionError:
-					log.Warn("backup occur region error", zap.Reflect("error", v))
+					push.busyErrors.recordRetryableError(errPb, logutil.Reflect("error", v))
 
 				case *backup.Error_ClusterIdError:
 					log.Error("backup occur cluster ID error", zap.Reflect("error", v))
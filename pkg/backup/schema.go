@@ -135,6 +135,24 @@ func (pending *Schemas) CopyMeta() []*backup.Schema {
 	return schemas
 }
 
+// Filter keeps the schemas of the tables which keep returns true for.
+func (pending *Schemas) Filter(keep func(table *model.TableInfo) (bool, error)) error {
+	for name, schema := range pending.schemas {
+		table := &model.TableInfo{}
+		if err := json.Unmarshal(schema.Table, table); err != nil {
+			return errors.Trace(err)
+		}
+		ok, err := keep(table)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			delete(pending.schemas, name)
+		}
+	}
+	return nil
+}
+
 // Len returns the number of schemas.
 func (pending *Schemas) Len() int {
 	return len(pending.schemas)
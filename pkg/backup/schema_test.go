@@ -4,10 +4,12 @@ package backup_test
 
 import (
 	"context"
+	"encoding/json"
 	"math"
 	"sync/atomic"
 
 	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
 	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
 	"github.com/pingcap/tidb/sessionctx/variable"
 	"github.com/pingcap/tidb/util/testkit"
@@ -61,7 +63,7 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	testFilter, err := filter.Parse([]string{"test.t1"})
 	c.Assert(err, IsNil)
 	_, backupSchemas, err := backup.BuildBackupRangeAndSchema(
-		s.mock.Domain, s.mock.Storage, testFilter, math.MaxUint64, false)
+		s.mock.Domain, s.mock.Storage, testFilter, math.MaxUint64, false, false)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas, IsNil)
 
@@ -69,7 +71,7 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	fooFilter, err := filter.Parse([]string{"foo.t1"})
 	c.Assert(err, IsNil)
 	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(
-		s.mock.Domain, s.mock.Storage, fooFilter, math.MaxUint64, false)
+		s.mock.Domain, s.mock.Storage, fooFilter, math.MaxUint64, false, false)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas, IsNil)
 
@@ -77,7 +79,7 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	noFilter, err := filter.Parse([]string{"*.*"})
 	c.Assert(err, IsNil)
 	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(
-		s.mock.Domain, s.mock.Storage, noFilter, math.MaxUint64, false)
+		s.mock.Domain, s.mock.Storage, noFilter, math.MaxUint64, false, false)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas, IsNil)
 
@@ -87,7 +89,7 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	tk.MustExec("insert into t1 values (10);")
 
 	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(
-		s.mock.Domain, s.mock.Storage, testFilter, math.MaxUint64, false)
+		s.mock.Domain, s.mock.Storage, testFilter, math.MaxUint64, false, false)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas.Len(), Equals, 1)
 	updateCh := new(simpleProgress)
@@ -100,6 +102,14 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	c.Assert(schemas[0].Crc64Xor, Not(Equals), 0, Commentf("%v", schemas[0]))
 	c.Assert(schemas[0].TotalKvs, Not(Equals), 0, Commentf("%v", schemas[0]))
 	c.Assert(schemas[0].TotalBytes, Not(Equals), 0, Commentf("%v", schemas[0]))
+	// The database and table definitions are recorded in the schema.
+	dbInfo := &model.DBInfo{}
+	c.Assert(json.Unmarshal(schemas[0].Db, dbInfo), IsNil)
+	c.Assert(dbInfo.Name.L, Equals, "test")
+	tblInfo := &model.TableInfo{}
+	c.Assert(json.Unmarshal(schemas[0].Table, tblInfo), IsNil)
+	c.Assert(tblInfo.Name.L, Equals, "t1")
+	c.Assert(tblInfo.Columns, HasLen, 1)
 
 	tk.MustExec("drop table if exists t2;")
 	tk.MustExec("create table t2 (a int);")
@@ -107,7 +117,7 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	tk.MustExec("insert into t2 values (11);")
 
 	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(
-		s.mock.Domain, s.mock.Storage, noFilter, math.MaxUint64, false)
+		s.mock.Domain, s.mock.Storage, noFilter, math.MaxUint64, false, false)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas.Len(), Equals, 2)
 	updateCh.reset()
@@ -123,4 +133,100 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	c.Assert(schemas[1].Crc64Xor, Not(Equals), 0, Commentf("%v", schemas[1]))
 	c.Assert(schemas[1].TotalKvs, Not(Equals), 0, Commentf("%v", schemas[1]))
 	c.Assert(schemas[1].TotalBytes, Not(Equals), 0, Commentf("%v", schemas[1]))
+
+	// The tables of mysql are backed up only if they are included.
+	mysqlFilter, err := filter.Parse([]string{"mysql.user"})
+	c.Assert(err, IsNil)
+	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(
+		s.mock.Domain, s.mock.Storage, mysqlFilter, math.MaxUint64, true, false)
+	c.Assert(err, IsNil)
+	c.Assert(backupSchemas, IsNil)
+	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(
+		s.mock.Domain, s.mock.Storage, mysqlFilter, math.MaxUint64, true, true)
+	c.Assert(err, IsNil)
+	c.Assert(backupSchemas.Len(), Equals, 1)
+}
+
+func (s *testBackupSchemaSuite) TestCopyMetaStats(c *C) {
+	c.Assert(s.mock.Start(), IsNil)
+	defer s.mock.Stop()
+
+	tk := testkit.NewTestKit(c, s.mock.Storage)
+	tk.MustExec("use test")
+	tk.MustExec("drop table if exists t1;")
+	tk.MustExec("create table t1 (a int);")
+	tk.MustExec("insert into t1 values (10);")
+	testFilter, err := filter.Parse([]string{"test.t1"})
+	c.Assert(err, IsNil)
+
+	// The schema only backup copies the schemas with the statistics.
+	_, backupSchemas, err := backup.BuildBackupRangeAndSchema(
+		s.mock.Domain, s.mock.Storage, testFilter, math.MaxUint64, false, false)
+	c.Assert(err, IsNil)
+	schemas := backupSchemas.CopyMeta()
+	c.Assert(schemas, HasLen, 1)
+	c.Assert(schemas[0].Stats, NotNil)
+	c.Assert(schemas[0].Table, NotNil)
+
+	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(
+		s.mock.Domain, s.mock.Storage, testFilter, math.MaxUint64, true, false)
+	c.Assert(err, IsNil)
+	schemas = backupSchemas.CopyMeta()
+	c.Assert(schemas, HasLen, 1)
+	c.Assert(schemas[0].Stats, IsNil)
+}
+
+func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchemaOfViews(c *C) {
+	c.Assert(s.mock.Start(), IsNil)
+	defer s.mock.Stop()
+
+	tk := testkit.NewTestKit(c, s.mock.Storage)
+	tk.MustExec("use test")
+	tk.MustExec("drop table if exists t1;")
+	tk.MustExec("drop view if exists v1;")
+	tk.MustExec("create table t1 (a int);")
+	tk.MustExec("create view v1 as select a from t1;")
+	testFilter, err := filter.Parse([]string{"test.*"})
+	c.Assert(err, IsNil)
+
+	// The view is backed up without the ranges, it has no data.
+	ranges, backupSchemas, err := backup.BuildBackupRangeAndSchema(
+		s.mock.Domain, s.mock.Storage, testFilter, math.MaxUint64, false, false)
+	c.Assert(err, IsNil)
+	c.Assert(ranges, HasLen, 1)
+	c.Assert(backupSchemas.Len(), Equals, 2)
+}
+
+func (s *testBackupSchemaSuite) TestBuildNewTableRanges(c *C) {
+	c.Assert(s.mock.Start(), IsNil)
+	defer s.mock.Stop()
+
+	tk := testkit.NewTestKit(c, s.mock.Storage)
+	tk.MustExec("use test")
+	tk.MustExec("drop table if exists t1, t2;")
+	tk.MustExec("create table t1 (a int);")
+	tk.MustExec("create table t2 (a int);")
+	ver, err := s.mock.Storage.CurrentVersion()
+	c.Assert(err, IsNil)
+	lastBackupTS := ver.Ver
+
+	testFilter, err := filter.Parse([]string{"test.*"})
+	c.Assert(err, IsNil)
+	ranges, err := backup.BuildNewTableRanges(s.mock.Domain, testFilter, lastBackupTS, math.MaxUint64, false)
+	c.Assert(err, IsNil)
+	c.Assert(ranges, HasLen, 0)
+
+	// The truncated table has a new ID.
+	tk.MustExec("truncate table t1;")
+	ranges, err = backup.BuildNewTableRanges(s.mock.Domain, testFilter, lastBackupTS, math.MaxUint64, false)
+	c.Assert(err, IsNil)
+	tbl, err := s.mock.Domain.InfoSchema().TableByName(model.NewCIStr("test"), model.NewCIStr("t1"))
+	c.Assert(err, IsNil)
+	tblRanges, err := backup.BuildTableRanges(tbl.Meta())
+	c.Assert(err, IsNil)
+	c.Assert(ranges, HasLen, len(tblRanges))
+	for i, r := range tblRanges {
+		c.Assert(ranges[i].StartKey, DeepEquals, []byte(r.StartKey))
+		c.Assert(ranges[i].EndKey, DeepEquals, []byte(r.EndKey))
+	}
 }
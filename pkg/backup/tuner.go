@@ -0,0 +1,238 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/pdutil"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const (
+	// autoTuneInterval is the interval to check the load of the stores.
+	autoTuneInterval = 10 * time.Second
+	// minAutoTuneRateLimitDivisor bounds the tuned rate limit to
+	// [rate limit / divisor, rate limit], it's also the step to raise it.
+	minAutoTuneRateLimitDivisor = 8
+	// defaultAutoTuneConcurrency is the initial number of the ranges backed
+	// up concurrently.
+	defaultAutoTuneConcurrency = 4
+	// busyCPUUsage is the ratio of the CPU quota used by a busy store.
+	busyCPUUsage = 0.8
+	// maxTunedConcurrency is the number of the workers backing up the ranges
+	// if the concurrency is tunable.
+	maxTunedConcurrency = 256
+)
+
+// busyErrorCounter counts the ServerIsBusy errors returned by TiKV, they
+// tell the stores are overloaded by the backup.
+type busyErrorCounter struct {
+	n uint64
+}
+
+func (c *busyErrorCounter) load() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.n)
+}
+
+// recordRetryableError logs the retryable error of a backup response
+// through the sampler and counts the ServerIsBusy errors, a nil counter
+// counts nothing.
+func (c *busyErrorCounter) recordRetryableError(e *kvproto.Error, fields ...zap.Field) {
+	kind := backupErrorKind(e)
+	if c != nil && kind == "ServerIsBusy" {
+		atomic.AddUint64(&c.n, 1)
+	}
+	retryableErrorSampler.Warn(kind, fields...)
+}
+
+// rangeLimiter limits the number of the ranges backed up concurrently, the
+// limit can be changed while backing up.
+type rangeLimiter struct {
+	mu      sync.Mutex
+	running uint64
+	limit   *utils.TunableUint64
+	// changed is closed once a range is released or the limit is raised.
+	changed chan struct{}
+}
+
+func newRangeLimiter(limit *utils.TunableUint64) *rangeLimiter {
+	l := &rangeLimiter{limit: limit, changed: make(chan struct{})}
+	limit.OnChange(l.wake)
+	return l
+}
+
+// acquire blocks until fewer ranges than the limit are running or the context
+// is done, a nil limiter doesn't limit anything. A zero limit is taken as 1,
+// so the backup isn't stuck.
+func (l *rangeLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		if l.running < l.limit.Load() || l.running == 0 {
+			l.running++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-changed:
+		}
+	}
+}
+
+func (l *rangeLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.running--
+	l.mu.Unlock()
+	l.wake()
+}
+
+// wake wakes up the waiters after a range is released or the limit is changed.
+func (l *rangeLimiter) wake() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// loadTuner tunes the number of the ranges backed up concurrently and the
+// rate limit by the load of the stores. Both are lowered by half once a store
+// is busy, and raised step by step while the stores are idle.
+type loadTuner struct {
+	storeLoads     func(ctx context.Context) ([]pdutil.StoreLoad, error)
+	busyErrors     *busyErrorCounter
+	limiter        *rangeLimiter
+	maxConcurrency uint64
+	// rateLimit is nil if the rate limit isn't tuned.
+	rateLimit    *utils.TunableUint64
+	maxRateLimit uint64
+
+	lastBusyErrors uint64
+}
+
+// EnableAutoTune tunes the number of the ranges backed up concurrently in
+// [1, maxConcurrency] and the rate limit set by SetTunableRateLimit by the
+// load of the stores, storeLoads samples the load of the stores.
+func (bc *Client) EnableAutoTune(
+	storeLoads func(ctx context.Context) ([]pdutil.StoreLoad, error), maxConcurrency uint,
+) {
+	initial := uint64(utils.MinInt(defaultAutoTuneConcurrency, int(maxConcurrency)))
+	if bc.limiter == nil {
+		bc.limiter = newRangeLimiter(utils.NewTunableUint64("concurrency", initial))
+	} else {
+		bc.limiter.limit.Store(initial)
+	}
+	t := &loadTuner{
+		storeLoads:     storeLoads,
+		busyErrors:     &busyErrorCounter{},
+		limiter:        bc.limiter,
+		maxConcurrency: uint64(maxConcurrency),
+	}
+	if bc.rateLimit != nil && bc.rateLimit.Load() != 0 {
+		t.rateLimit = bc.rateLimit
+		t.maxRateLimit = bc.rateLimit.Load()
+	}
+	bc.tuner = t
+}
+
+// busyErrors returns the counter of the ServerIsBusy errors, which is
+// nil unless the backup is tuned.
+func (bc *Client) busyErrors() *busyErrorCounter {
+	if bc.tuner == nil {
+		return nil
+	}
+	return bc.tuner.busyErrors
+}
+
+// busyStores returns the stores whose CPU usage reaches busyCPUUsage, or
+// whose writes are stalled.
+func busyStores(loads []pdutil.StoreLoad) []uint64 {
+	busy := make([]uint64, 0)
+	for _, load := range loads {
+		if load.CPUUsage >= busyCPUUsage || load.WriteStall {
+			busy = append(busy, load.StoreID)
+		}
+	}
+	return busy
+}
+
+// run tunes the parameters periodically until the context is done.
+func (t *loadTuner) run(ctx context.Context) {
+	t.lastBusyErrors = t.busyErrors.load()
+	ticker := time.NewTicker(autoTuneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		loads, err := t.storeLoads(ctx)
+		if err != nil {
+			log.Warn("failed to get the load of the stores, skip tuning", zap.Error(err))
+			continue
+		}
+		busy := busyStores(loads)
+		busyErrors := t.busyErrors.load()
+		t.tune(len(busy) > 0 || busyErrors > t.lastBusyErrors)
+		if len(busy) > 0 {
+			log.Info("stores are busy", zap.Uint64s("stores", busy))
+		}
+		t.lastBusyErrors = busyErrors
+	}
+}
+
+// tune lowers the parameters by half if the stores are busy, or raises them
+// by a step otherwise.
+func (t *loadTuner) tune(busy bool) {
+	concurrency := t.limiter.limit.Load()
+	if busy {
+		if concurrency > 1 {
+			t.limiter.limit.Store(concurrency / 2)
+		}
+	} else if concurrency < t.maxConcurrency {
+		t.limiter.limit.Store(concurrency + 1)
+	}
+
+	if t.rateLimit == nil {
+		return
+	}
+	step := t.maxRateLimit / minAutoTuneRateLimitDivisor
+	if step == 0 {
+		step = 1
+	}
+	rateLimit := t.rateLimit.Load()
+	if busy {
+		if rateLimit/2 >= step {
+			t.rateLimit.Store(rateLimit / 2)
+		} else if rateLimit != step {
+			t.rateLimit.Store(step)
+		}
+	} else if rateLimit < t.maxRateLimit {
+		rateLimit += step
+		if rateLimit > t.maxRateLimit {
+			rateLimit = t.maxRateLimit
+		}
+		t.rateLimit.Store(rateLimit)
+	}
+}
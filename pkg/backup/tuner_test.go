@@ -0,0 +1,95 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/br/pkg/pdutil"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+type testTunerSuite struct{}
+
+var _ = Suite(&testTunerSuite{})
+
+func (s *testTunerSuite) TestBusyStores(c *C) {
+	busy := busyStores([]pdutil.StoreLoad{
+		{StoreID: 1, CPUUsage: 0.5},
+		{StoreID: 2, CPUUsage: 0.9},
+		{StoreID: 3, WriteStall: true},
+	})
+	c.Assert(busy, DeepEquals, []uint64{2, 3})
+}
+
+func (s *testTunerSuite) TestTune(c *C) {
+	t := &loadTuner{
+		limiter:        newRangeLimiter(utils.NewTunableUint64("range concurrency", 4)),
+		maxConcurrency: 6,
+		rateLimit:      utils.NewTunableUint64("ratelimit", 64),
+		maxRateLimit:   64,
+	}
+	// Lowered by half, but not below 1 and the step of the rate limit.
+	for _, expected := range [][2]uint64{{2, 32}, {1, 16}, {1, 8}, {1, 8}} {
+		t.tune(true)
+		c.Assert(t.limiter.limit.Load(), Equals, expected[0])
+		c.Assert(t.rateLimit.Load(), Equals, expected[1])
+	}
+	// Raised step by step, but not above the upper bounds.
+	for i := 0; i < 10; i++ {
+		t.tune(false)
+	}
+	c.Assert(t.limiter.limit.Load(), Equals, uint64(6))
+	c.Assert(t.rateLimit.Load(), Equals, uint64(64))
+
+	// The rate limit isn't tuned if it's unset.
+	t.rateLimit = nil
+	t.tune(true)
+	c.Assert(t.limiter.limit.Load(), Equals, uint64(3))
+}
+
+func (s *testTunerSuite) TestRangeLimiter(c *C) {
+	ctx := context.Background()
+	var l *rangeLimiter
+	c.Assert(l.acquire(ctx), IsNil)
+	l.release()
+
+	l = newRangeLimiter(utils.NewTunableUint64("range concurrency", 1))
+	c.Assert(l.acquire(ctx), IsNil)
+	acquired := make(chan error)
+	go func() {
+		acquired <- l.acquire(ctx)
+	}()
+	select {
+	case <-acquired:
+		c.Fatal("acquired over the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// Raising the limit lets the waiter run.
+	l.limit.Store(2)
+	c.Assert(<-acquired, IsNil)
+
+	// Releasing a range lets the waiter run.
+	go func() {
+		acquired <- l.acquire(ctx)
+	}()
+	l.release()
+	c.Assert(<-acquired, IsNil)
+
+	// A zero limit lets a range run.
+	l.release()
+	l.release()
+	l.limit.Store(0)
+	c.Assert(l.acquire(ctx), IsNil)
+
+	// The waiter gives up once the context is done.
+	cctx, cancel := context.WithCancel(ctx)
+	go func() {
+		acquired <- l.acquire(cctx)
+	}()
+	cancel()
+	c.Assert(<-acquired, ErrorMatches, ".*context canceled.*")
+}
@@ -0,0 +1,284 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+// Package backupreader reads the backups of BR from the external storage
+// without a cluster, e.g. to scan or sample the backed up tables.
+package backupreader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/types"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/metautil"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// Reader reads a backup in the external storage.
+type Reader struct {
+	storage storage.ExternalStorage
+	meta    *backup.BackupMeta
+	tables  []*utils.Table
+}
+
+// Open reads the backupmeta in the storage and returns a reader of the backup.
+// The backupmeta is checked against its envelope, but its signature isn't
+// verified.
+func Open(ctx context.Context, s storage.ExternalStorage) (*Reader, error) {
+	meta, err := metautil.ReadBackupMeta(ctx, s, utils.MetaFile, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(s, meta)
+}
+
+// NewReader returns a reader of the backup with the backupmeta.
+func NewReader(s storage.ExternalStorage, meta *backup.BackupMeta) (*Reader, error) {
+	databases, err := utils.LoadBackupTables(meta)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]*utils.Table, 0, len(meta.Schemas))
+	for _, db := range databases {
+		tables = append(tables, db.Tables...)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].DB.Name.L != tables[j].DB.Name.L {
+			return tables[i].DB.Name.L < tables[j].DB.Name.L
+		}
+		return tables[i].Info.Name.L < tables[j].Info.Name.L
+	})
+	return &Reader{storage: s, meta: meta, tables: tables}, nil
+}
+
+// Meta returns the backupmeta of the backup.
+func (r *Reader) Meta() *backup.BackupMeta {
+	return r.meta
+}
+
+// Tables returns an iterator over the tables in the backup, ordered by the
+// database and table names.
+func (r *Reader) Tables() *TableIterator {
+	return &TableIterator{tables: r.tables, pos: -1}
+}
+
+// Files returns an iterator over all files in the backup.
+func (r *Reader) Files() *FileIterator {
+	return &FileIterator{files: r.meta.Files, pos: -1}
+}
+
+// ReadFile reads the content of the file in the backup, and checks it
+// against the checksum in the backupmeta.
+func (r *Reader) ReadFile(ctx context.Context, file *backup.File) ([]byte, error) {
+	data, err := r.storage.Read(ctx, file.Name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(file.Sha256) != 0 {
+		checksum := sha256.Sum256(data)
+		if !bytes.Equal(checksum[:], file.Sha256) {
+			return nil, errors.Annotatef(berrors.ErrBackupChecksumMismatch,
+				"checksum mismatch of file %s", file.Name)
+		}
+	}
+	return data, nil
+}
+
+// TableIterator iterates over the tables in a backup.
+type TableIterator struct {
+	tables []*utils.Table
+	pos    int
+}
+
+// Next moves to the next table, it returns false if there are no more tables.
+func (it *TableIterator) Next() bool {
+	if it.pos+1 >= len(it.tables) {
+		return false
+	}
+	it.pos++
+	return true
+}
+
+// Table returns the current table, including its schema and files.
+func (it *TableIterator) Table() *utils.Table {
+	return it.tables[it.pos]
+}
+
+// FileIterator iterates over the files in a backup.
+type FileIterator struct {
+	files []*backup.File
+	pos   int
+}
+
+// Next moves to the next file, it returns false if there are no more files.
+func (it *FileIterator) Next() bool {
+	if it.pos+1 >= len(it.files) {
+		return false
+	}
+	it.pos++
+	return true
+}
+
+// File returns the current file.
+func (it *FileIterator) File() *backup.File {
+	return it.files[it.pos]
+}
+
+// KVIterator iterates over the key-value pairs in a backup file, the keys are
+// without the MVCC encoding and the values are the row values.
+type KVIterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Err() error
+	Close() error
+}
+
+// KVOpener opens the content of a backup file. The files are SST files of
+// RocksDB, there is no Go reader of them in BR, so reading the key-value
+// pairs out of them is left to the callers.
+type KVOpener func(file *backup.File, data []byte) (KVIterator, error)
+
+// Rows returns an iterator over the rows of the table in its files, the
+// index entries are skipped.
+func (r *Reader) Rows(ctx context.Context, table *utils.Table, open KVOpener, loc *time.Location) *RowIterator {
+	prefixes := [][]byte{tablecodec.GenTableRecordPrefix(table.Info.ID)}
+	if pi := table.Info.GetPartitionInfo(); pi != nil {
+		for _, def := range pi.Definitions {
+			prefixes = append(prefixes, tablecodec.GenTableRecordPrefix(def.ID))
+		}
+	}
+	return &RowIterator{
+		ctx:      ctx,
+		reader:   r,
+		table:    table.Info,
+		files:    table.Files,
+		open:     open,
+		loc:      loc,
+		prefixes: prefixes,
+		pos:      -1,
+	}
+}
+
+// RowIterator iterates over the rows of a table in a backup.
+type RowIterator struct {
+	ctx      context.Context
+	reader   *Reader
+	table    *model.TableInfo
+	files    []*backup.File
+	open     KVOpener
+	loc      *time.Location
+	prefixes [][]byte
+	pos      int
+
+	kvs    KVIterator
+	handle kv.Handle
+	row    map[int64]types.Datum
+	err    error
+}
+
+// Next moves to the next row, it returns false if there are no more rows or
+// an error occurs, which is returned by Err.
+func (it *RowIterator) Next() bool {
+	for it.err == nil {
+		if it.kvs == nil && !it.openNextFile() {
+			return false
+		}
+		if !it.kvs.Next() {
+			it.err = it.kvs.Err()
+			if err := it.kvs.Close(); it.err == nil {
+				it.err = errors.Trace(err)
+			}
+			it.kvs = nil
+			continue
+		}
+		if !it.isRecord(it.kvs.Key()) {
+			continue
+		}
+		it.handle, it.row, it.err = DecodeRow(it.table, it.kvs.Key(), it.kvs.Value(), it.loc)
+		return it.err == nil
+	}
+	return false
+}
+
+func (it *RowIterator) openNextFile() bool {
+	if it.pos+1 >= len(it.files) {
+		return false
+	}
+	it.pos++
+	file := it.files[it.pos]
+	data, err := it.reader.ReadFile(it.ctx, file)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if it.kvs, err = it.open(file, data); err != nil {
+		it.err = errors.Annotatef(err, "open file %s", file.Name)
+		return false
+	}
+	return true
+}
+
+func (it *RowIterator) isRecord(key []byte) bool {
+	for _, prefix := range it.prefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle returns the handle of the current row.
+func (it *RowIterator) Handle() kv.Handle {
+	return it.handle
+}
+
+// Row returns the columns of the current row keyed by ID.
+func (it *RowIterator) Row() map[int64]types.Datum {
+	return it.row
+}
+
+// Err returns the error stopping the iteration.
+func (it *RowIterator) Err() error {
+	return it.err
+}
+
+// Close closes the file being iterated.
+func (it *RowIterator) Close() error {
+	if it.kvs == nil {
+		return nil
+	}
+	err := it.kvs.Close()
+	it.kvs = nil
+	return errors.Trace(err)
+}
+
+// DecodeRow decodes a record of the table, key is the record key without
+// the MVCC encoding, value is the row value. The columns are keyed by ID.
+func DecodeRow(
+	table *model.TableInfo, key, value []byte, loc *time.Location,
+) (kv.Handle, map[int64]types.Datum, error) {
+	handle, err := tablecodec.DecodeRowKey(key)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	cols := make(map[int64]*types.FieldType, len(table.Columns))
+	for _, col := range table.Columns {
+		cols[col.ID] = &col.FieldType
+	}
+	row, err := tablecodec.DecodeRowToDatumMap(value, cols, loc)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	return handle, row, nil
+}
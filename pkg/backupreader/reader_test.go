@@ -0,0 +1,207 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backupreader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/sessionctx/stmtctx"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/types"
+	"github.com/pingcap/tidb/util/rowcodec"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testReaderSuite struct{}
+
+var _ = Suite(&testReaderSuite{})
+
+func mockSchema(c *C, db *model.DBInfo, tbl *model.TableInfo) *backup.Schema {
+	dbBytes, err := json.Marshal(db)
+	c.Assert(err, IsNil)
+	tblBytes, err := json.Marshal(tbl)
+	c.Assert(err, IsNil)
+	return &backup.Schema{Db: dbBytes, Table: tblBytes}
+}
+
+func (s *testReaderSuite) TestReader(c *C) {
+	ctx := context.Background()
+	local, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	content := []byte("sst content")
+	c.Assert(local.Write(ctx, "1.sst", content), IsNil)
+	c.Assert(local.Write(ctx, "2.sst", content), IsNil)
+	checksum := sha256.Sum256(content)
+
+	db := &model.DBInfo{ID: 1, Name: model.NewCIStr("test")}
+	t1 := &model.TableInfo{ID: 11, Name: model.NewCIStr("t1")}
+	t2 := &model.TableInfo{ID: 12, Name: model.NewCIStr("t2")}
+	meta := &backup.BackupMeta{
+		Schemas: []*backup.Schema{mockSchema(c, db, t2), mockSchema(c, db, t1)},
+		Files: []*backup.File{
+			{
+				Name:     "1.sst",
+				StartKey: tablecodec.EncodeRowKey(t1.ID, []byte("a")),
+				EndKey:   tablecodec.EncodeRowKey(t1.ID, []byte("b")),
+				Sha256:   checksum[:],
+			},
+			{
+				Name:     "2.sst",
+				StartKey: tablecodec.EncodeRowKey(t2.ID, []byte("a")),
+				EndKey:   tablecodec.EncodeRowKey(t2.ID, []byte("b")),
+				Sha256:   []byte("mismatch"),
+			},
+		},
+	}
+	reader, err := NewReader(local, meta)
+	c.Assert(err, IsNil)
+
+	names := make([]string, 0)
+	for it := reader.Tables(); it.Next(); {
+		table := it.Table()
+		c.Assert(table.Files, HasLen, 1)
+		names = append(names, table.Info.Name.O)
+	}
+	c.Assert(names, DeepEquals, []string{"t1", "t2"})
+
+	files := make([]*backup.File, 0)
+	for it := reader.Files(); it.Next(); {
+		files = append(files, it.File())
+	}
+	c.Assert(files, HasLen, 2)
+
+	data, err := reader.ReadFile(ctx, files[0])
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, content)
+	_, err = reader.ReadFile(ctx, files[1])
+	c.Assert(err, ErrorMatches, ".*checksum mismatch of file 2.sst.*")
+}
+
+func rowTable() *model.TableInfo {
+	return &model.TableInfo{
+		ID:   11,
+		Name: model.NewCIStr("t1"),
+		Columns: []*model.ColumnInfo{
+			{ID: 1, Name: model.NewCIStr("a"), FieldType: *types.NewFieldType(mysql.TypeLonglong)},
+			{ID: 2, Name: model.NewCIStr("b"), FieldType: *types.NewFieldType(mysql.TypeVarchar)},
+		},
+	}
+}
+
+func encodeRow(c *C, tableID, handle, a int64, b string) (key, value []byte) {
+	key = tablecodec.EncodeRowKeyWithHandle(tableID, kv.IntHandle(handle))
+	value, err := tablecodec.EncodeRow(&stmtctx.StatementContext{TimeZone: time.UTC},
+		[]types.Datum{types.NewIntDatum(a), types.NewStringDatum(b)}, []int64{1, 2}, nil, nil, &rowcodec.Encoder{})
+	c.Assert(err, IsNil)
+	return key, value
+}
+
+func (s *testReaderSuite) TestDecodeRow(c *C) {
+	table := rowTable()
+	key, value := encodeRow(c, table.ID, 5, 42, "row")
+	handle, row, err := DecodeRow(table, key, value, time.UTC)
+	c.Assert(err, IsNil)
+	c.Assert(handle.IntValue(), Equals, int64(5))
+	c.Assert(row, HasLen, 2)
+	c.Assert(row[1].GetInt64(), Equals, int64(42))
+	c.Assert(row[2].GetString(), Equals, "row")
+
+	_, _, err = DecodeRow(table, tablecodec.EncodeTablePrefix(table.ID), value, time.UTC)
+	c.Assert(err, NotNil)
+}
+
+type kvPair struct {
+	key, value []byte
+}
+
+// sliceKVs iterates over the key-value pairs in a slice.
+type sliceKVs struct {
+	kvs    []kvPair
+	pos    int
+	closed *int
+}
+
+func (it *sliceKVs) Next() bool {
+	it.pos++
+	return it.pos < len(it.kvs)
+}
+
+func (it *sliceKVs) Key() []byte {
+	return it.kvs[it.pos].key
+}
+
+func (it *sliceKVs) Value() []byte {
+	return it.kvs[it.pos].value
+}
+
+func (it *sliceKVs) Err() error {
+	return nil
+}
+
+func (it *sliceKVs) Close() error {
+	*it.closed++
+	return nil
+}
+
+func (s *testReaderSuite) TestRows(c *C) {
+	ctx := context.Background()
+	local, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	table := rowTable()
+	files := []*backup.File{{Name: "1.sst"}, {Name: "2.sst"}, {Name: "3.sst"}}
+	for _, file := range files {
+		c.Assert(local.Write(ctx, file.Name, []byte(file.Name)), IsNil)
+	}
+	key1, value1 := encodeRow(c, table.ID, 1, 10, "a")
+	key2, value2 := encodeRow(c, table.ID, 2, 20, "b")
+	contents := map[string][]kvPair{
+		// The index entries are skipped.
+		"1.sst": {{tablecodec.EncodeIndexSeekKey(table.ID, 1, []byte("a")), []byte("1")}, {key1, value1}},
+		"2.sst": nil,
+		"3.sst": {{key2, value2}},
+	}
+	closed := 0
+	open := func(file *backup.File, data []byte) (KVIterator, error) {
+		c.Assert(string(data), Equals, file.Name)
+		return &sliceKVs{kvs: contents[file.Name], pos: -1, closed: &closed}, nil
+	}
+
+	reader, err := NewReader(local, &backup.BackupMeta{})
+	c.Assert(err, IsNil)
+	it := reader.Rows(ctx, &utils.Table{Info: table, Files: files}, open, time.UTC)
+	handles := make([]int64, 0)
+	values := make([]int64, 0)
+	for it.Next() {
+		handles = append(handles, it.Handle().IntValue())
+		values = append(values, it.Row()[1].GetInt64())
+	}
+	c.Assert(it.Err(), IsNil)
+	c.Assert(it.Close(), IsNil)
+	c.Assert(handles, DeepEquals, []int64{1, 2})
+	c.Assert(values, DeepEquals, []int64{10, 20})
+	c.Assert(closed, Equals, 3)
+
+	// The error of opening a file stops the iteration.
+	failOpen := func(file *backup.File, data []byte) (KVIterator, error) {
+		return nil, errors.New("not an sst file")
+	}
+	it = reader.Rows(ctx, &utils.Table{Info: table, Files: files}, failOpen, time.UTC)
+	c.Assert(it.Next(), IsFalse)
+	c.Assert(it.Err(), ErrorMatches, "open file 1.sst: not an sst file")
+}
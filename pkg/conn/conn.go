@@ -47,6 +47,7 @@ type Mgr struct {
 		clis map[uint64]*grpc.ClientConn
 	}
 	keepalive   keepalive.ClientParameters
+	dialOpts    []grpc.DialOption
 	ownsStorage bool
 }
 
@@ -104,7 +105,8 @@ skipStore:
 	return stores[:j], nil
 }
 
-// NewMgr creates a new Mgr.
+// NewMgr creates a new Mgr, dialOpts are appended to the options dialing
+// PD and TiKV, e.g. to add interceptors.
 func NewMgr(
 	ctx context.Context,
 	g glue.Glue,
@@ -115,8 +117,9 @@ func NewMgr(
 	keepalive keepalive.ClientParameters,
 	storeBehavior StoreBehavior,
 	checkRequirements bool,
+	dialOpts ...grpc.DialOption,
 ) (*Mgr, error) {
-	controller, err := pdutil.NewPdController(ctx, pdAddrs, tlsConf, securityOption)
+	controller, err := pdutil.NewPdController(ctx, pdAddrs, tlsConf, securityOption, dialOpts...)
 	if err != nil {
 		log.Error("fail to create pd controller", zap.Error(err))
 		return nil, err
@@ -164,6 +167,7 @@ func NewMgr(
 	}
 	mgr.grpcClis.clis = make(map[uint64]*grpc.ClientConn)
 	mgr.keepalive = keepalive
+	mgr.dialOpts = dialOpts
 	return mgr, nil
 }
 
@@ -183,14 +187,13 @@ func (mgr *Mgr) getGrpcConnLocked(ctx context.Context, storeID uint64) (*grpc.Cl
 	if addr == "" {
 		addr = store.GetAddress()
 	}
-	conn, err := grpc.DialContext(
-		ctx,
-		addr,
+	opts := append([]grpc.DialOption{
 		opt,
 		grpc.WithBlock(),
 		grpc.WithConnectParams(grpc.ConnectParams{Backoff: bfConf}),
 		grpc.WithKeepaliveParams(mgr.keepalive),
-	)
+	}, mgr.dialOpts...)
+	conn, err := grpc.DialContext(ctx, addr, opts...)
 	cancel()
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -262,6 +265,11 @@ func (mgr *Mgr) GetTLSConfig() *tls.Config {
 	return mgr.tlsConf
 }
 
+// GetDialOptions returns the extra options dialing PD and TiKV.
+func (mgr *Mgr) GetDialOptions() []grpc.DialOption {
+	return mgr.dialOpts
+}
+
 // GetLockResolver gets the LockResolver.
 func (mgr *Mgr) GetLockResolver() *tikv.LockResolver {
 	return mgr.storage.GetLockResolver()
@@ -11,6 +11,7 @@ var (
 	ErrUnknown         = errors.Normalize("internal error", errors.RFCCodeText("BR:Common:ErrUnknown"))
 	ErrInvalidArgument = errors.Normalize("invalid argument", errors.RFCCodeText("BR:Common:ErrInvalidArgument"))
 	ErrVersionMismatch = errors.Normalize("version mismatch", errors.RFCCodeText("BR:Common:ErrVersionMismatch"))
+	ErrTaskConflict    = errors.Normalize("another task is running against the cluster", errors.RFCCodeText("BR:Common:ErrTaskConflict"))
 
 	ErrPDUpdateFailed    = errors.Normalize("failed to update PD", errors.RFCCodeText("BR:PD:ErrPDUpdateFailed"))
 	ErrPDLeaderNotFound  = errors.Normalize("PD leader not found", errors.RFCCodeText("BR:PD:ErrPDLeaderNotFound"))
@@ -20,19 +21,30 @@ var (
 	ErrBackupInvalidRange        = errors.Normalize("backup range invalid", errors.RFCCodeText("BR:Backup:ErrBackupInvalidRange"))
 	ErrBackupNoLeader            = errors.Normalize("backup no leader", errors.RFCCodeText("BR:Backup:ErrBackupNoLeader"))
 	ErrBackupGCSafepointExceeded = errors.Normalize("backup GC safepoint exceeded", errors.RFCCodeText("BR:Backup:ErrBackupGCSafepointExceeded"))
+	ErrBackupWindowExceeded      = errors.Normalize("backup window exceeded", errors.RFCCodeText("BR:Backup:ErrBackupWindowExceeded"))
+	ErrBackupFilesIncomplete     = errors.Normalize("backup files incomplete", errors.RFCCodeText("BR:Backup:ErrBackupFilesIncomplete"))
+	ErrBackupFilesConflict       = errors.Normalize("backup files conflict", errors.RFCCodeText("BR:Backup:ErrBackupFilesConflict"))
+	ErrBackupFileNameInvalid     = errors.Normalize("backup file name invalid", errors.RFCCodeText("BR:Backup:ErrBackupFileNameInvalid"))
+	ErrBackupStale               = errors.Normalize("backup stale", errors.RFCCodeText("BR:Backup:ErrBackupStale"))
+	ErrBackupFleetFailed         = errors.Normalize("backup fleet failed", errors.RFCCodeText("BR:Backup:ErrBackupFleetFailed"))
 
-	ErrRestoreModeMismatch     = errors.Normalize("restore mode mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreModeMismatch"))
-	ErrRestoreRangeMismatch    = errors.Normalize("restore range mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreRangeMismatch"))
-	ErrRestoreChecksumMismatch = errors.Normalize("restore checksum mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreChecksumMismatch"))
-	ErrRestoreTableIDMismatch  = errors.Normalize("restore table ID mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreTableIDMismatch"))
-	ErrRestoreRejectStore      = errors.Normalize("failed to restore remove rejected store", errors.RFCCodeText("BR:Restore:ErrRestoreRejectStore"))
-	ErrRestoreNoPeer           = errors.Normalize("region does not have peer", errors.RFCCodeText("BR:Restore:ErrRestoreNoPeer"))
-	ErrRestoreSplitFailed      = errors.Normalize("fail to split region", errors.RFCCodeText("BR:Restore:ErrRestoreSplitFailed"))
-	ErrRestoreInvalidRewrite   = errors.Normalize("invalid rewrite rule", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidRewrite"))
-	ErrRestoreInvalidBackup    = errors.Normalize("invalid backup", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidBackup"))
-	ErrRestoreInvalidRange     = errors.Normalize("invalid restore range", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidRange"))
-	ErrRestoreWriteAndIngest   = errors.Normalize("failed to write and ingest", errors.RFCCodeText("BR:Restore:ErrRestoreWriteAndIngest"))
-	ErrRestoreSchemaNotExists  = errors.Normalize("schema not exists", errors.RFCCodeText("BR:Restore:ErrRestoreSchemaNotExists"))
+	ErrRestoreModeMismatch       = errors.Normalize("restore mode mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreModeMismatch"))
+	ErrRestoreRangeMismatch      = errors.Normalize("restore range mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreRangeMismatch"))
+	ErrRestoreChecksumMismatch   = errors.Normalize("restore checksum mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreChecksumMismatch"))
+	ErrRestoreTableIDMismatch    = errors.Normalize("restore table ID mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreTableIDMismatch"))
+	ErrRestoreRejectStore        = errors.Normalize("failed to restore remove rejected store", errors.RFCCodeText("BR:Restore:ErrRestoreRejectStore"))
+	ErrRestoreNoPeer             = errors.Normalize("region does not have peer", errors.RFCCodeText("BR:Restore:ErrRestoreNoPeer"))
+	ErrRestoreSplitFailed        = errors.Normalize("fail to split region", errors.RFCCodeText("BR:Restore:ErrRestoreSplitFailed"))
+	ErrRestoreInvalidRewrite     = errors.Normalize("invalid rewrite rule", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidRewrite"))
+	ErrRestoreInvalidBackup      = errors.Normalize("invalid backup", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidBackup"))
+	ErrRestoreInvalidRange       = errors.Normalize("invalid restore range", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidRange"))
+	ErrRestoreWriteAndIngest     = errors.Normalize("failed to write and ingest", errors.RFCCodeText("BR:Restore:ErrRestoreWriteAndIngest"))
+	ErrRestoreSchemaNotExists    = errors.Normalize("schema not exists", errors.RFCCodeText("BR:Restore:ErrRestoreSchemaNotExists"))
+	ErrRestoreSameCluster        = errors.Normalize("restore into the backup source cluster", errors.RFCCodeText("BR:Restore:ErrRestoreSameCluster"))
+	ErrRestoreTableNotEmpty      = errors.Normalize("restore into non-empty table", errors.RFCCodeText("BR:Restore:ErrRestoreTableNotEmpty"))
+	ErrRestoreCollationMismatch  = errors.Normalize("restore between clusters with different collations", errors.RFCCodeText("BR:Restore:ErrRestoreCollationMismatch"))
+	ErrRestoreMetaTampered       = errors.Normalize("backupmeta tampered or truncated", errors.RFCCodeText("BR:Restore:ErrRestoreMetaTampered"))
+	ErrRestoreSchemaIncompatible = errors.Normalize("restore incompatible schema", errors.RFCCodeText("BR:Restore:ErrRestoreSchemaIncompatible"))
 
 	// TODO maybe it belongs to PiTR
 	ErrRestoreRTsConstrain = errors.Normalize("resolved ts constrain violation", errors.RFCCodeText("BR:Restore:ErrRestoreResolvedTsConstrain"))
@@ -51,7 +63,7 @@ var (
 	// not match". This error is retryable.
 	ErrKVEpochNotMatch = errors.Normalize("epoch not match", errors.RFCCodeText("BR:KV:ErrKVEpochNotMatch"))
 	// ErrKVKeyNotInRegion is the error raised when ingestion failed with "key not
-	// in region". This error cannot be retried.
+	// in region". This error is retryable.
 	ErrKVKeyNotInRegion = errors.Normalize("key not in region", errors.RFCCodeText("BR:KV:ErrKVKeyNotInRegion"))
 	// ErrKVRewriteRuleNotFound is the error raised when download failed with
 	// "rewrite rule not found". This error cannot be retried
@@ -100,8 +100,12 @@ func (fs files) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
 	return nil
 }
 
-// WrapKey wrap a key as a Stringer that can print proper upper hex format.
+// WrapKey wrap a key as a Stringer that can print proper upper hex format,
+// or "?" if the logs are redacted.
 func WrapKey(key []byte) fmt.Stringer {
+	if NeedRedact() {
+		return redactedKey{}
+	}
 	return kv.Key(key)
 }
 
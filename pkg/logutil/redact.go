@@ -0,0 +1,52 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logutil
+
+import (
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// redactLog is 1 if the user data, e.g. the keys and the values, are redacted
+// in the logs.
+var redactLog int32
+
+// InitRedact sets whether the user data are redacted in the logs, it's set
+// before the task starts.
+func InitRedact(redact bool) {
+	var v int32
+	if redact {
+		v = 1
+	}
+	atomic.StoreInt32(&redactLog, v)
+}
+
+// NeedRedact returns whether the user data are redacted in the logs.
+func NeedRedact() bool {
+	return atomic.LoadInt32(&redactLog) == 1
+}
+
+// redactedKey elides the key. The keys are short and structured, so even
+// their hashes could be reversed by guessing.
+type redactedKey struct{}
+
+func (redactedKey) String() string {
+	return "?"
+}
+
+// Key makes the zap field of a key, which is redacted if needed.
+func Key(name string, key []byte) zapcore.Field {
+	return zap.Stringer(name, WrapKey(key))
+}
+
+// Reflect makes the zap field of a value which may contain the user data,
+// e.g. the protobuf messages of the regions or the backup responses. It's
+// elided if the logs are redacted.
+func Reflect(name string, v interface{}) zapcore.Field {
+	if NeedRedact() {
+		return zap.String(name, "?")
+	}
+	return zap.Reflect(name, v)
+}
@@ -0,0 +1,22 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logutil
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type testRedactSuite struct{}
+
+var _ = Suite(&testRedactSuite{})
+
+func (*testRedactSuite) TestRedactKey(c *C) {
+	key := []byte("user data")
+	plain := WrapKey(key).String()
+	c.Assert(plain, Matches, `(?i)757365722064617461`)
+
+	InitRedact(true)
+	defer InitRedact(false)
+	c.Assert(WrapKey(key).String(), Equals, "?")
+	c.Assert(Reflect("meta", key).String, Equals, "?")
+}
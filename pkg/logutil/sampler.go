@@ -0,0 +1,134 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logutil
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/errorpb"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultSampleInterval is the interval a Sampler aggregates the warnings in.
+const DefaultSampleInterval = time.Minute
+
+type sampledKind struct {
+	count    int
+	exemplar []zap.Field
+}
+
+// Sampler aggregates high-churn warnings, e.g. the NotLeader errors and the
+// lock retries, which may produce gigabytes of logs on large jobs.
+// The first occurrence of each kind in an interval is logged at once, the
+// others are only counted, and the counts are logged per kind with the first
+// occurrence as an exemplar once the interval elapses.
+type Sampler struct {
+	msg      string
+	interval time.Duration
+	logger   func() *zap.Logger
+	now      func() time.Time
+
+	mu        sync.Mutex
+	kinds     map[string]*sampledKind
+	lastFlush time.Time
+}
+
+// NewSampler creates a Sampler logging the warnings with the message.
+func NewSampler(msg string, interval time.Duration) *Sampler {
+	return &Sampler{
+		msg:       msg,
+		interval:  interval,
+		logger:    log.L,
+		now:       time.Now,
+		kinds:     make(map[string]*sampledKind),
+		lastFlush: time.Now(),
+	}
+}
+
+// Warn records a warning of the kind.
+func (s *Sampler) Warn(kind string, fields ...zap.Field) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.now().Sub(s.lastFlush) >= s.interval {
+		s.flushLocked()
+	}
+	k, ok := s.kinds[kind]
+	if !ok {
+		k = &sampledKind{exemplar: fields}
+		s.kinds[kind] = k
+		s.logger().Warn(s.msg, append([]zap.Field{zap.String("kind", kind)}, fields...)...)
+	}
+	k.count++
+}
+
+// Flush logs the counts of the warnings recorded since the last flush.
+func (s *Sampler) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked()
+}
+
+func (s *Sampler) flushLocked() {
+	now := s.now()
+	kinds := make([]string, 0, len(s.kinds))
+	for kind := range s.kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		k := s.kinds[kind]
+		// The first one has been logged.
+		if k.count <= 1 {
+			continue
+		}
+		fields := []zap.Field{
+			zap.String("kind", kind),
+			zap.Int("count", k.count),
+			zap.Duration("in", now.Sub(s.lastFlush)),
+			zap.Object("exemplar", exemplar(k.exemplar)),
+		}
+		s.logger().Warn(s.msg+" (sampled)", fields...)
+	}
+	s.kinds = make(map[string]*sampledKind)
+	s.lastFlush = now
+}
+
+type exemplar []zap.Field
+
+// MarshalLogObject implements zapcore.ObjectMarshaler.
+func (e exemplar) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, f := range e {
+		f.AddTo(enc)
+	}
+	return nil
+}
+
+// RegionErrorKind returns the kind of the region error for sampling.
+func RegionErrorKind(err *errorpb.Error) string {
+	switch {
+	case err == nil:
+		return "Unknown"
+	case err.NotLeader != nil:
+		return "NotLeader"
+	case err.RegionNotFound != nil:
+		return "RegionNotFound"
+	case err.KeyNotInRegion != nil:
+		return "KeyNotInRegion"
+	case err.EpochNotMatch != nil:
+		return "EpochNotMatch"
+	case err.ServerIsBusy != nil:
+		return "ServerIsBusy"
+	case err.StaleCommand != nil:
+		return "StaleCommand"
+	case err.StoreNotMatch != nil:
+		return "StoreNotMatch"
+	case err.RaftEntryTooLarge != nil:
+		return "RaftEntryTooLarge"
+	default:
+		return "Other"
+	}
+}
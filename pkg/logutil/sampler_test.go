@@ -0,0 +1,62 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package logutil
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/errorpb"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testSamplerSuite struct{}
+
+var _ = Suite(&testSamplerSuite{})
+
+func (*testSamplerSuite) TestSampler(c *C) {
+	core, logs := observer.New(zap.WarnLevel)
+	logger := zap.New(core)
+	now := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	s := NewSampler("retry", time.Minute)
+	s.logger = func() *zap.Logger { return logger }
+	s.now = func() time.Time { return now }
+	s.lastFlush = now
+
+	for i := 0; i < 100; i++ {
+		s.Warn("NotLeader", zap.Int("i", i))
+	}
+	s.Warn("KeyLocked")
+	// Only the first one of each kind is logged.
+	c.Assert(logs.Len(), Equals, 2)
+
+	now = now.Add(time.Minute)
+	s.Warn("NotLeader", zap.Int("i", 100))
+	entries := logs.TakeAll()
+	c.Assert(entries, HasLen, 4)
+	sampled := entries[2]
+	c.Assert(sampled.Message, Equals, "retry (sampled)")
+	c.Assert(sampled.ContextMap()["kind"], Equals, "NotLeader")
+	c.Assert(sampled.ContextMap()["count"], Equals, int64(100))
+	c.Assert(sampled.ContextMap()["exemplar"], DeepEquals, map[string]interface{}{"i": int64(0)})
+	// The new interval logs the first one again.
+	c.Assert(entries[3].ContextMap()["i"], Equals, int64(100))
+
+	s.Warn("NotLeader")
+	s.Flush()
+	c.Assert(logs.FilterMessage("retry (sampled)").Len(), Equals, 1)
+	s.Flush()
+	c.Assert(logs.Len(), Equals, 1)
+}
+
+func (*testSamplerSuite) TestRegionErrorKind(c *C) {
+	c.Assert(RegionErrorKind(&errorpb.Error{NotLeader: &errorpb.NotLeader{}}), Equals, "NotLeader")
+	c.Assert(RegionErrorKind(&errorpb.Error{ServerIsBusy: &errorpb.ServerIsBusy{}}), Equals, "ServerIsBusy")
+	c.Assert(RegionErrorKind(&errorpb.Error{Message: "unknown"}), Equals, "Other")
+}
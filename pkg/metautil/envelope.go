@@ -0,0 +1,146 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package metautil
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/storage"
+)
+
+// EnvelopeSuffix is appended to the name of a backupmeta to name its
+// envelope.
+const EnvelopeSuffix = ".envelope"
+
+// Envelope is stored alongside a backupmeta to detect the tampering or the
+// truncation of it before its files are trusted. The shards of a version 2
+// layout are covered by the checksums in the root.
+type Envelope struct {
+	// SHA256 is the hex encoded sha256 of the serialized backupmeta.
+	SHA256 string `json:"sha256"`
+	// Signature is the base64 encoded ed25519 signature of the serialized
+	// backupmeta, it's empty if the backupmeta isn't signed.
+	Signature string `json:"signature,omitempty"`
+}
+
+func newEnvelope(data []byte, signKey ed25519.PrivateKey) *Envelope {
+	sum := sha256.Sum256(data)
+	envelope := &Envelope{SHA256: hex.EncodeToString(sum[:])}
+	if signKey != nil {
+		envelope.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(signKey, data))
+	}
+	return envelope
+}
+
+// WriteEnvelope writes the envelope of the serialized backupmeta of the name,
+// it's signed if the key isn't nil.
+func WriteEnvelope(ctx context.Context, s storage.ExternalStorage, name string, data []byte, signKey ed25519.PrivateKey) error {
+	envelope, err := json.Marshal(newEnvelope(data, signKey))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.Write(ctx, name+EnvelopeSuffix, envelope))
+}
+
+// verifyEnvelope checks the backupmeta against its envelope, the signature
+// is verified if the key is given. The backups taken by older BR don't have
+// the envelope, they are only accepted if no key is given.
+func verifyEnvelope(ctx context.Context, s storage.ExternalStorage, name string, data []byte, verifyKey ed25519.PublicKey) error {
+	exists, err := s.FileExists(ctx, name+EnvelopeSuffix)
+	if err != nil {
+		return errors.Annotatef(err, "error occurred when checking %s file", name+EnvelopeSuffix)
+	}
+	if !exists {
+		if verifyKey != nil {
+			return errors.Annotatef(berrors.ErrRestoreMetaTampered, "%s isn't signed", name)
+		}
+		log.Warn("the backupmeta has no envelope, skip checking its integrity", zap.String("name", name))
+		return nil
+	}
+	raw, err := s.Read(ctx, name+EnvelopeSuffix)
+	if err != nil {
+		return errors.Annotatef(err, "load %s failed", name+EnvelopeSuffix)
+	}
+	envelope := &Envelope{}
+	if err = json.Unmarshal(raw, envelope); err != nil {
+		return errors.Annotatef(berrors.ErrRestoreMetaTampered, "invalid %s: %v", name+EnvelopeSuffix, err)
+	}
+	sum := sha256.Sum256(data)
+	if envelope.SHA256 != hex.EncodeToString(sum[:]) {
+		return errors.Annotatef(berrors.ErrRestoreMetaTampered,
+			"the sha256 of %s is %x, but %s is recorded", name, sum, envelope.SHA256)
+	}
+	if verifyKey == nil {
+		return nil
+	}
+	if envelope.Signature == "" {
+		return errors.Annotatef(berrors.ErrRestoreMetaTampered, "%s isn't signed", name)
+	}
+	signature, err := base64.StdEncoding.DecodeString(envelope.Signature)
+	if err != nil || !ed25519.Verify(verifyKey, data, signature) {
+		return errors.Annotatef(berrors.ErrRestoreMetaTampered, "the signature of %s is invalid", name)
+	}
+	log.Info("the signature of the backupmeta is verified", zap.String("name", name))
+	return nil
+}
+
+// LoadSignKey loads the ed25519 private key in a PKCS #8 PEM file to sign the
+// backupmeta.
+func LoadSignKey(path string) (ed25519.PrivateKey, error) {
+	der, err := loadPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid private key %s: %v", path, err)
+	}
+	signKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "%s isn't an ed25519 private key", path)
+	}
+	return signKey, nil
+}
+
+// LoadVerifyKey loads the ed25519 public key in a PKIX PEM file to verify the
+// signature of the backupmeta.
+func LoadVerifyKey(path string) (ed25519.PublicKey, error) {
+	der, err := loadPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid public key %s: %v", path, err)
+	}
+	verifyKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "%s isn't an ed25519 public key", path)
+	}
+	return verifyKey, nil
+}
+
+func loadPEM(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "%s isn't a PEM file", path)
+	}
+	return block.Bytes, nil
+}
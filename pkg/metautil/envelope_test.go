@@ -0,0 +1,92 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package metautil
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+type testEnvelopeSuite struct{}
+
+var _ = Suite(&testEnvelopeSuite{})
+
+func (s *testEnvelopeSuite) TestChecksum(c *C) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(WriteBackupMeta(ctx, store, mockBackupMeta(3, 1), MetaV1, nil), IsNil)
+	_, err = ReadBackupMeta(ctx, store, utils.MetaFile, nil)
+	c.Assert(err, IsNil)
+
+	// The truncated backupmeta may still be parsed.
+	data, err := store.Read(ctx, utils.MetaFile)
+	c.Assert(err, IsNil)
+	c.Assert(store.Write(ctx, utils.MetaFile, data[:len(data)-1]), IsNil)
+	_, err = ReadBackupMeta(ctx, store, utils.MetaFile, nil)
+	c.Assert(err, ErrorMatches, ".*the sha256 of backupmeta is .*backupmeta tampered or truncated.*")
+
+	// The backups taken by older BR have no envelope.
+	store, err = storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(store.Write(ctx, utils.MetaFile, data), IsNil)
+	_, err = ReadBackupMeta(ctx, store, utils.MetaFile, nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *testEnvelopeSuite) TestSignature(c *C) {
+	ctx := context.Background()
+	dir := c.MkDir()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, IsNil)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	c.Assert(err, IsNil)
+	privatePath := filepath.Join(dir, "private.pem")
+	c.Assert(ioutil.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600), IsNil)
+	der, err = x509.MarshalPKIXPublicKey(publicKey)
+	c.Assert(err, IsNil)
+	publicPath := filepath.Join(dir, "public.pem")
+	c.Assert(ioutil.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644), IsNil)
+
+	signKey, err := LoadSignKey(privatePath)
+	c.Assert(err, IsNil)
+	verifyKey, err := LoadVerifyKey(publicPath)
+	c.Assert(err, IsNil)
+	_, err = LoadVerifyKey(privatePath)
+	c.Assert(err, ErrorMatches, ".*invalid public key.*")
+
+	signed, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(WriteBackupMeta(ctx, signed, mockBackupMeta(3, 1), MetaV2, signKey), IsNil)
+	root, err := ReadBackupMeta(ctx, signed, utils.MetaFile, verifyKey)
+	c.Assert(err, IsNil)
+	c.Assert(root.Files, HasLen, 3)
+
+	unsigned, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(WriteBackupMeta(ctx, unsigned, mockBackupMeta(3, 1), MetaV2, nil), IsNil)
+	_, err = ReadBackupMeta(ctx, unsigned, utils.MetaFile, verifyKey)
+	c.Assert(err, ErrorMatches, ".*backupmeta isn't signed.*")
+
+	// Both the backupmeta and its checksum are replaced, but it can't be
+	// signed without the private key.
+	data, err := unsigned.Read(ctx, utils.MetaFile)
+	c.Assert(err, IsNil)
+	envelope, err := unsigned.Read(ctx, utils.MetaFile+EnvelopeSuffix)
+	c.Assert(err, IsNil)
+	c.Assert(signed.Write(ctx, utils.MetaFile, data), IsNil)
+	c.Assert(signed.Write(ctx, utils.MetaFile+EnvelopeSuffix,
+		append(envelope[:len(envelope)-1], []byte(`,"signature":"AAAA"}`)...)), IsNil)
+	_, err = ReadBackupMeta(ctx, signed, utils.MetaFile, verifyKey)
+	c.Assert(err, ErrorMatches, ".*the signature of backupmeta is invalid.*")
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package metautil
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+)
+
+const (
+	// extensionField is the number of the protobuf field holding the
+	// Extension in the serialized backupmeta. The backupmeta of kvproto
+	// doesn't define it, so older BR skip it as an unknown field.
+	extensionField = 1000
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// v2DdlsPlaceholder replaces the DDL jobs of the root backupmeta of version 2,
+// they are moved into the Extension. Older BR fail to parse it as the DDL
+// jobs, rather than restoring the root holding no files as an empty backup.
+var v2DdlsPlaceholder = []byte(`{"backupmeta-version":2}`)
+
+// Extension is the metadata of BR which the backupmeta of kvproto has no
+// fields for. It's appended to the serialized backupmeta, so it's covered by
+// the envelope like the other fields.
+type Extension struct {
+	// Version is the layout of the backupmeta.
+	Version int `json:"version"`
+	// FileShards and SchemaShards reference the shards of version 2, which
+	// hold the files and the schemas of the backup.
+	FileShards   []ShardRef `json:"file-shards,omitempty"`
+	SchemaShards []ShardRef `json:"schema-shards,omitempty"`
+	// Ddls are the DDL jobs of the backup of version 2.
+	Ddls json.RawMessage `json:"ddls,omitempty"`
+	// PlacementRules are the placement rules of PD for the backed up tables,
+	// which are re-created for the restored tables.
+	PlacementRules json.RawMessage `json:"placement-rules,omitempty"`
+	// NewCollationsEnabled is whether the new collation framework is enabled
+	// in the backed up cluster, the index keys of the strings are encoded
+	// differently with it. It isn't recorded for the raw backups.
+	NewCollationsEnabled *bool `json:"new-collations-enabled,omitempty"`
+	// FileNaming is the scheme of the names of the backup files, it's empty
+	// if some names don't follow the scheme.
+	FileNaming string `json:"file-naming,omitempty"`
+	// SchemaVersion is the version of the serialization of the schemas, see
+	// utils.SchemaVersion. It isn't recorded for the raw backups.
+	SchemaVersion int `json:"schema-version,omitempty"`
+	// Source is the cluster the backup was taken from, it isn't recorded by
+	// older BR.
+	Source *SourceCluster `json:"source,omitempty"`
+}
+
+// SourceCluster is the settings of the cluster the backup was taken from,
+// which the restore depends on but the backupmeta of kvproto doesn't record.
+// It also records how the backup was taken, so the backup can be audited
+// later.
+type SourceCluster struct {
+	BRVersion      string    `json:"br-version,omitempty"`
+	BRGitHash      string    `json:"br-git-hash,omitempty"`
+	Args           []string  `json:"args,omitempty"`
+	ClusterID      uint64    `json:"cluster-id,omitempty"`
+	ClusterVersion string    `json:"cluster-version,omitempty"`
+	TiDBVersions   []string  `json:"tidb-versions,omitempty"`
+	TiKVVersions   []string  `json:"tikv-versions,omitempty"`
+	StartTime      time.Time `json:"start-time"`
+	EndTime        time.Time `json:"end-time"`
+}
+
+// ShardRef references a shard of the backupmeta of version 2.
+type ShardRef struct {
+	Name    string `json:"name"`
+	SHA256  []byte `json:"sha256"`
+	Size    uint64 `json:"size"`
+	Entries int    `json:"entries"`
+}
+
+// marshalBackupMeta serializes the backupmeta with the extension.
+func marshalBackupMeta(meta *backup.BackupMeta, ext *Extension) ([]byte, error) {
+	data, err := proto.Marshal(meta)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	raw, err := json.Marshal(ext)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	data = append(data, proto.EncodeVarint(extensionField<<3|wireBytes)...)
+	data = append(data, proto.EncodeVarint(uint64(len(raw)))...)
+	return append(data, raw...), nil
+}
+
+// unmarshalBackupMeta parses the serialized backupmeta and its extension, the
+// backupmeta written by older BR has no extension and is of version 1.
+func unmarshalBackupMeta(data []byte) (*backup.BackupMeta, *Extension, error) {
+	meta := &backup.BackupMeta{}
+	if err := proto.Unmarshal(data, meta); err != nil {
+		return nil, nil, errors.Annotate(err, "parse backupmeta failed")
+	}
+	raw, err := findExtension(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	ext := &Extension{Version: MetaV1}
+	if raw != nil {
+		if err = json.Unmarshal(raw, ext); err != nil {
+			return nil, nil, errors.Annotatef(berrors.ErrRestoreInvalidBackup, "invalid backupmeta extension: %v", err)
+		}
+	}
+	if ext.Version != MetaV1 && ext.Version != MetaV2 {
+		return nil, nil, errors.Annotatef(berrors.ErrRestoreInvalidBackup,
+			"the backupmeta of version %d isn't supported, please upgrade BR", ext.Version)
+	}
+	if ext.Version == MetaV2 {
+		meta.Ddls = ext.Ddls
+	}
+	return meta, ext, nil
+}
+
+// findExtension scans the fields of the serialized backupmeta for the
+// extension, the last one wins like a protobuf field. It returns nil if
+// there is no extension.
+func findExtension(data []byte) ([]byte, error) {
+	var ext []byte
+	for len(data) > 0 {
+		key, n := proto.DecodeVarint(data)
+		if n == 0 {
+			return nil, errors.Annotate(berrors.ErrRestoreInvalidBackup, "truncated backupmeta")
+		}
+		data = data[n:]
+		var size uint64
+		switch key & 7 {
+		case wireVarint:
+			_, n = proto.DecodeVarint(data)
+			if n == 0 {
+				return nil, errors.Annotate(berrors.ErrRestoreInvalidBackup, "truncated backupmeta")
+			}
+			size = uint64(n)
+		case wireFixed64:
+			size = 8
+		case wireFixed32:
+			size = 4
+		case wireBytes:
+			size, n = proto.DecodeVarint(data)
+			if n == 0 {
+				return nil, errors.Annotate(berrors.ErrRestoreInvalidBackup, "truncated backupmeta")
+			}
+			data = data[n:]
+		default:
+			return nil, errors.Annotatef(berrors.ErrRestoreInvalidBackup, "unexpected wire type %d in backupmeta", key&7)
+		}
+		if uint64(len(data)) < size {
+			return nil, errors.Annotate(berrors.ErrRestoreInvalidBackup, "truncated backupmeta")
+		}
+		if key>>3 == extensionField && key&7 == wireBytes {
+			ext = data[:size]
+		}
+		data = data[size:]
+	}
+	return ext, nil
+}
@@ -0,0 +1,459 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+// Package metautil reads and writes the backupmeta in the external storage.
+//
+// A backupmeta of version 1 is a single protobuf message holding all files and
+// schemas of the backup, which takes gigabytes for millions of files. In
+// version 2, the files and the schemas are written into sharded meta files,
+// the root backupmeta holds none of them, and its Extension references the
+// shards, so both of them are read and written one shard at a time.
+package metautil
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// The versions of the backupmeta layout.
+const (
+	MetaV1 = 1
+	MetaV2 = 2
+)
+
+const (
+	metaFilesPrefix   = "backupmeta.files."
+	metaSchemasPrefix = "backupmeta.schemas."
+
+	defaultFilesPerShard   = 65536
+	defaultSchemasPerShard = 1024
+)
+
+// MetaWriter writes the backupmeta into the storage. In version 2, the files
+// and schemas added are written into a shard as soon as the shard is full, so
+// at most a shard of them is in memory.
+//
+// The shards are named by the run of the writer, the shards left by a failed
+// or resumed run in the same storage are never referenced by this run, and
+// they are removed by Finish once the root is written.
+type MetaWriter struct {
+	storage storage.ExternalStorage
+	version int
+	signKey ed25519.PrivateKey
+	run     string
+	// finished is set once the root is written, the shards are referenced
+	// by it since then.
+	finished bool
+
+	filesPerShard   int
+	schemasPerShard int
+
+	files   []*backup.File
+	schemas []*backup.Schema
+	// fileShards and schemaShards are the references to the shards written.
+	fileShards   []ShardRef
+	schemaShards []ShardRef
+	// ext is the extension set by the caller, the fields of the layout are
+	// filled by Finish.
+	ext Extension
+}
+
+// NewMetaWriter creates a MetaWriter writing the backupmeta of the version,
+// zero means version 1.
+func NewMetaWriter(s storage.ExternalStorage, version int) *MetaWriter {
+	if version == 0 {
+		version = MetaV1
+	}
+	return &MetaWriter{
+		storage:         s,
+		version:         version,
+		run:             fmt.Sprintf("%x", time.Now().UnixNano()),
+		filesPerShard:   defaultFilesPerShard,
+		schemasPerShard: defaultSchemasPerShard,
+	}
+}
+
+// SetSignKey sets the key to sign the root backupmeta, it's not signed if the
+// key is nil.
+func (w *MetaWriter) SetSignKey(key ed25519.PrivateKey) {
+	w.signKey = key
+}
+
+// SetExtension sets the extension of the backupmeta, its version, shards and
+// DDL jobs are overwritten by Finish.
+func (w *MetaWriter) SetExtension(ext *Extension) {
+	if ext != nil {
+		w.ext = *ext
+	}
+}
+
+// AddFiles adds the files of the backup.
+func (w *MetaWriter) AddFiles(ctx context.Context, files ...*backup.File) error {
+	w.files = append(w.files, files...)
+	for w.version == MetaV2 && len(w.files) >= w.filesPerShard {
+		if err := w.flushFiles(ctx, w.filesPerShard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddSchemas adds the schemas of the backup.
+func (w *MetaWriter) AddSchemas(ctx context.Context, schemas ...*backup.Schema) error {
+	w.schemas = append(w.schemas, schemas...)
+	for w.version == MetaV2 && len(w.schemas) >= w.schemasPerShard {
+		if err := w.flushSchemas(ctx, w.schemasPerShard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *MetaWriter) flushFiles(ctx context.Context, n int) error {
+	shard := &backup.BackupMeta{Files: w.files[:n]}
+	ref, err := w.writeShard(ctx, metaFilesPrefix, len(w.fileShards)+1, shard, n)
+	if err != nil {
+		return err
+	}
+	w.fileShards = append(w.fileShards, ref)
+	w.files = w.files[n:]
+	return nil
+}
+
+func (w *MetaWriter) flushSchemas(ctx context.Context, n int) error {
+	shard := &backup.BackupMeta{Schemas: w.schemas[:n]}
+	ref, err := w.writeShard(ctx, metaSchemasPrefix, len(w.schemaShards)+1, shard, n)
+	if err != nil {
+		return err
+	}
+	w.schemaShards = append(w.schemaShards, ref)
+	w.schemas = w.schemas[n:]
+	return nil
+}
+
+func (w *MetaWriter) writeShard(ctx context.Context, prefix string, seq int, shard *backup.BackupMeta, n int) (ShardRef, error) {
+	data, err := proto.Marshal(shard)
+	if err != nil {
+		return ShardRef{}, errors.Trace(err)
+	}
+	name := fmt.Sprintf("%s%s.%06d", prefix, w.run, seq)
+	if err = w.storage.Write(ctx, name, data); err != nil {
+		return ShardRef{}, errors.Trace(err)
+	}
+	sum := sha256.Sum256(data)
+	log.Debug("backupmeta shard written", zap.String("name", name), zap.Int("entries", n))
+	return ShardRef{Name: name, SHA256: sum[:], Size: uint64(len(data)), Entries: n}, nil
+}
+
+// Finish writes the rest of the files and schemas, and then the root
+// backupmeta, whose files and schemas are overwritten by the ones added.
+// The root is written at last, its existence means the backup is complete,
+// and its envelope is written just before it. The shards of the other runs
+// are removed at the end.
+func (w *MetaWriter) Finish(ctx context.Context, root *backup.BackupMeta) error {
+	meta := *root
+	meta.Files, meta.Schemas = w.files, w.schemas
+	ext := w.ext
+	ext.Version, ext.FileShards, ext.SchemaShards, ext.Ddls = w.version, nil, nil, nil
+	if w.version == MetaV2 {
+		if len(w.files) > 0 {
+			if err := w.flushFiles(ctx, len(w.files)); err != nil {
+				return err
+			}
+		}
+		if len(w.schemas) > 0 {
+			if err := w.flushSchemas(ctx, len(w.schemas)); err != nil {
+				return err
+			}
+		}
+		meta.Files, meta.Schemas = nil, nil
+		ext.FileShards, ext.SchemaShards = w.fileShards, w.schemaShards
+		ext.Ddls, meta.Ddls = meta.Ddls, v2DdlsPlaceholder
+	}
+	data, err := marshalBackupMeta(&meta, &ext)
+	if err != nil {
+		return err
+	}
+	log.Info("save backup meta", zap.String("path", w.storage.URI()), zap.Int("version", w.version),
+		zap.Int("file shards", len(w.fileShards)), zap.Int("schema shards", len(w.schemaShards)),
+		zap.Int("size", len(data)), zap.Bool("signed", w.signKey != nil))
+	if err = WriteEnvelope(ctx, w.storage, utils.MetaFile, data, w.signKey); err != nil {
+		return err
+	}
+	if err = w.storage.Write(ctx, utils.MetaFile, data); err != nil {
+		return errors.Trace(err)
+	}
+	w.finished = true
+	w.removeStaleShards(ctx)
+	return nil
+}
+
+// Abort removes the shards written if the root isn't written, when the
+// backup fails. The failures are only logged, the shards left aren't
+// referenced, and they are removed once a backup in the storage finishes.
+func (w *MetaWriter) Abort(ctx context.Context) {
+	if w.finished {
+		return
+	}
+	for _, refs := range [][]ShardRef{w.fileShards, w.schemaShards} {
+		for _, ref := range refs {
+			if err := w.storage.DeleteFile(ctx, ref.Name); err != nil {
+				log.Warn("failed to remove the backupmeta shard", zap.String("name", ref.Name), zap.Error(err))
+			}
+		}
+	}
+	w.files, w.schemas = nil, nil
+	w.fileShards, w.schemaShards = nil, nil
+}
+
+// removeStaleShards removes the shards in the storage not referenced by the
+// root written, which are left by the failed or resumed runs.
+func (w *MetaWriter) removeStaleShards(ctx context.Context) {
+	referenced := make(map[string]struct{}, len(w.fileShards)+len(w.schemaShards))
+	for _, refs := range [][]ShardRef{w.fileShards, w.schemaShards} {
+		for _, ref := range refs {
+			referenced[ref.Name] = struct{}{}
+		}
+	}
+	stale := make([]string, 0)
+	err := w.storage.WalkDir(ctx, &storage.WalkOption{}, func(p string, _ int64) error {
+		name := path.Clean(p)
+		if !strings.HasPrefix(name, metaFilesPrefix) && !strings.HasPrefix(name, metaSchemasPrefix) {
+			return nil
+		}
+		if _, ok := referenced[name]; !ok {
+			stale = append(stale, name)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warn("failed to list the stale backupmeta shards", zap.Error(err))
+		return
+	}
+	for _, name := range stale {
+		if err = w.storage.DeleteFile(ctx, name); err != nil {
+			log.Warn("failed to remove the stale backupmeta shard", zap.String("name", name), zap.Error(err))
+		}
+	}
+	if len(stale) > 0 {
+		log.Info("stale backupmeta shards removed", zap.Int("shards", len(stale)))
+	}
+}
+
+// WriteBackupMeta writes the whole backupmeta into the storage in the layout
+// of the version, it's signed if the key isn't nil.
+func WriteBackupMeta(
+	ctx context.Context,
+	s storage.ExternalStorage,
+	meta *backup.BackupMeta,
+	version int,
+	signKey ed25519.PrivateKey,
+) error {
+	w := NewMetaWriter(s, version)
+	w.SetSignKey(signKey)
+	if err := w.AddFiles(ctx, meta.Files...); err != nil {
+		return err
+	}
+	if err := w.AddSchemas(ctx, meta.Schemas...); err != nil {
+		return err
+	}
+	return w.Finish(ctx, meta)
+}
+
+// MetaReader reads the backupmeta in the storage. The files and schemas of
+// version 2 are read one shard at a time, they are never in memory at once.
+type MetaReader struct {
+	storage storage.ExternalStorage
+	// dir is the directory of the root, the shards are in it.
+	dir  string
+	meta *backup.BackupMeta
+	ext  *Extension
+}
+
+// NewMetaReader reads the root backupmeta of the name in the storage. It's
+// checked against its envelope before parsing, and its signature is verified
+// if the key isn't nil.
+func NewMetaReader(
+	ctx context.Context,
+	s storage.ExternalStorage,
+	name string,
+	verifyKey ed25519.PublicKey,
+) (*MetaReader, error) {
+	data, err := s.Read(ctx, name)
+	if err != nil {
+		return nil, errors.Annotate(err, "load backupmeta failed")
+	}
+	if err = verifyEnvelope(ctx, s, name, data, verifyKey); err != nil {
+		return nil, err
+	}
+	meta, ext, err := unmarshalBackupMeta(data)
+	if err != nil {
+		return nil, err
+	}
+	return &MetaReader{storage: s, dir: path.Dir(name), meta: meta, ext: ext}, nil
+}
+
+// Meta returns the root backupmeta. In version 2, it holds no files nor
+// schemas, they are read by WalkFiles and WalkSchemas.
+func (r *MetaReader) Meta() *backup.BackupMeta {
+	return r.meta
+}
+
+// Extension returns the extension of the backupmeta.
+func (r *MetaReader) Extension() *Extension {
+	return r.ext
+}
+
+// Version returns the layout of the backupmeta.
+func (r *MetaReader) Version() int {
+	return r.ext.Version
+}
+
+// FileCount returns the number of the files of the backup.
+func (r *MetaReader) FileCount() int {
+	if r.ext.Version != MetaV2 {
+		return len(r.meta.Files)
+	}
+	count := 0
+	for _, ref := range r.ext.FileShards {
+		count += ref.Entries
+	}
+	return count
+}
+
+// WalkFiles calls fn with every file of the backup in order.
+func (r *MetaReader) WalkFiles(ctx context.Context, fn func(*backup.File) error) error {
+	if r.ext.Version != MetaV2 {
+		for _, f := range r.meta.Files {
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return r.walkShards(ctx, r.ext.FileShards, func(shard *backup.BackupMeta) error {
+		for _, f := range shard.Files {
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WalkSchemas calls fn with every schema of the backup in order.
+func (r *MetaReader) WalkSchemas(ctx context.Context, fn func(*backup.Schema) error) error {
+	if r.ext.Version != MetaV2 {
+		for _, schema := range r.meta.Schemas {
+			if err := fn(schema); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return r.walkShards(ctx, r.ext.SchemaShards, func(shard *backup.BackupMeta) error {
+		for _, schema := range shard.Schemas {
+			if err := fn(schema); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ArchiveSize returns the total size of the backup archive, including the
+// backupmeta and its shards.
+func (r *MetaReader) ArchiveSize(ctx context.Context) (uint64, error) {
+	total := uint64(r.meta.Size())
+	for _, refs := range [][]ShardRef{r.ext.FileShards, r.ext.SchemaShards} {
+		for _, ref := range refs {
+			total += ref.Size
+		}
+	}
+	err := r.WalkFiles(ctx, func(f *backup.File) error {
+		total += f.GetSize_()
+		return nil
+	})
+	return total, err
+}
+
+// walkShards reads the shards one by one, and calls fn with every shard.
+func (r *MetaReader) walkShards(ctx context.Context, refs []ShardRef, fn func(shard *backup.BackupMeta) error) error {
+	for _, ref := range refs {
+		name := path.Join(r.dir, ref.Name)
+		data, err := r.storage.Read(ctx, name)
+		if err != nil {
+			return errors.Annotatef(err, "load backupmeta shard %s failed", name)
+		}
+		sum := sha256.Sum256(data)
+		if !bytes.Equal(sum[:], ref.SHA256) {
+			return errors.Annotatef(berrors.ErrRestoreInvalidBackup,
+				"the checksum of backupmeta shard %s mismatches", name)
+		}
+		shard := &backup.BackupMeta{}
+		if err = proto.Unmarshal(data, shard); err != nil {
+			return errors.Annotatef(err, "parse backupmeta shard %s failed", name)
+		}
+		if err = fn(shard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadBackupMeta reads the whole backupmeta of the name in the storage, the
+// shards of version 2 are read into it. It's only for the tools inspecting
+// the backupmeta, restore reads it by MetaReader instead, which doesn't keep
+// all the shards in memory.
+func ReadBackupMeta(
+	ctx context.Context,
+	s storage.ExternalStorage,
+	name string,
+	verifyKey ed25519.PublicKey,
+) (*backup.BackupMeta, error) {
+	r, err := NewMetaReader(ctx, s, name, verifyKey)
+	if err != nil {
+		return nil, err
+	}
+	return r.ReadAll(ctx)
+}
+
+// ReadAll reads the whole backupmeta, the shards of version 2 are read into
+// the root backupmeta, unless they are read already.
+func (r *MetaReader) ReadAll(ctx context.Context) (*backup.BackupMeta, error) {
+	meta := r.Meta()
+	// The root of version 2 holds no files nor schemas.
+	if r.Version() != MetaV2 || len(meta.Files) > 0 || len(meta.Schemas) > 0 {
+		return meta, nil
+	}
+	err := r.WalkFiles(ctx, func(f *backup.File) error {
+		meta.Files = append(meta.Files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.WalkSchemas(ctx, func(schema *backup.Schema) error {
+		meta.Schemas = append(meta.Schemas, schema)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
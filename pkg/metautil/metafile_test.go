@@ -0,0 +1,243 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package metautil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testMetaFileSuite struct{}
+
+var _ = Suite(&testMetaFileSuite{})
+
+func mockBackupMeta(files, schemas int) *backup.BackupMeta {
+	meta := &backup.BackupMeta{EndVersion: 42}
+	for i := 0; i < files; i++ {
+		meta.Files = append(meta.Files, &backup.File{Name: fmt.Sprintf("%d.sst", i), Cf: "default"})
+	}
+	for i := 0; i < schemas; i++ {
+		meta.Schemas = append(meta.Schemas, &backup.Schema{Db: []byte("db"), Table: []byte(fmt.Sprint(i))})
+	}
+	return meta
+}
+
+func (s *testMetaFileSuite) TestWriteAndReadBackupMeta(c *C) {
+	ctx := context.Background()
+	for _, version := range []int{MetaV1, MetaV2} {
+		store, err := storage.NewLocalStorage(c.MkDir())
+		c.Assert(err, IsNil)
+		meta := mockBackupMeta(10, 5)
+
+		w := NewMetaWriter(store, version)
+		w.filesPerShard, w.schemasPerShard = 4, 2
+		c.Assert(w.AddFiles(ctx, meta.Files...), IsNil)
+		c.Assert(w.AddSchemas(ctx, meta.Schemas...), IsNil)
+		c.Assert(w.Finish(ctx, meta), IsNil)
+
+		root, err := ReadBackupMeta(ctx, store, utils.MetaFile, nil)
+		c.Assert(err, IsNil)
+		c.Assert(root.EndVersion, Equals, uint64(42))
+		c.Assert(root.Files, HasLen, 10)
+		c.Assert(root.Schemas, HasLen, 5)
+		for i, f := range root.Files {
+			c.Assert(f.Name, Equals, fmt.Sprintf("%d.sst", i))
+		}
+		for i, schema := range root.Schemas {
+			c.Assert(string(schema.Table), Equals, fmt.Sprint(i))
+		}
+		if version == MetaV1 {
+			c.Assert(w.fileShards, HasLen, 0)
+			c.Assert(w.schemaShards, HasLen, 0)
+			continue
+		}
+		// 3 shards of files and 3 shards of schemas.
+		c.Assert(w.fileShards, HasLen, 3)
+		c.Assert(w.schemaShards, HasLen, 3)
+		exists, err := store.FileExists(ctx, w.fileShards[0].Name)
+		c.Assert(err, IsNil)
+		c.Assert(exists, IsTrue)
+	}
+}
+
+func (s *testMetaFileSuite) TestMetaReader(c *C) {
+	ctx := context.Background()
+	for _, version := range []int{MetaV1, MetaV2} {
+		store, err := storage.NewLocalStorage(c.MkDir())
+		c.Assert(err, IsNil)
+		meta := mockBackupMeta(10, 5)
+		meta.Ddls = []byte(`[{"id":1}]`)
+		w := NewMetaWriter(store, version)
+		w.filesPerShard, w.schemasPerShard = 4, 2
+		// The fields of the layout are filled by the writer.
+		w.SetExtension(&Extension{
+			Version:        3,
+			PlacementRules: []byte(`[{"group_id":"g"}]`),
+			SchemaVersion:  1,
+			Source:         &SourceCluster{BRVersion: "v4.0.9", ClusterID: 7},
+		})
+		c.Assert(w.AddFiles(ctx, meta.Files...), IsNil)
+		c.Assert(w.AddSchemas(ctx, meta.Schemas...), IsNil)
+		c.Assert(w.Finish(ctx, meta), IsNil)
+
+		r, err := NewMetaReader(ctx, store, utils.MetaFile, nil)
+		c.Assert(err, IsNil)
+		c.Assert(r.Version(), Equals, version)
+		c.Assert(string(r.Meta().Ddls), Equals, `[{"id":1}]`)
+		c.Assert(string(r.Extension().PlacementRules), Equals, `[{"group_id":"g"}]`)
+		c.Assert(r.Extension().SchemaVersion, Equals, 1)
+		c.Assert(r.Extension().Source.BRVersion, Equals, "v4.0.9")
+		c.Assert(r.Extension().Source.ClusterID, Equals, uint64(7))
+		if version == MetaV2 {
+			c.Assert(r.Meta().Files, HasLen, 0)
+			c.Assert(r.Meta().Schemas, HasLen, 0)
+			c.Assert(r.Extension().FileShards, HasLen, 3)
+		}
+		var files, schemas int
+		c.Assert(r.WalkFiles(ctx, func(f *backup.File) error {
+			c.Assert(f.Name, Equals, fmt.Sprintf("%d.sst", files))
+			files++
+			return nil
+		}), IsNil)
+		c.Assert(r.WalkSchemas(ctx, func(schema *backup.Schema) error {
+			c.Assert(string(schema.Table), Equals, fmt.Sprint(schemas))
+			schemas++
+			return nil
+		}), IsNil)
+		c.Assert(files, Equals, 10)
+		c.Assert(schemas, Equals, 5)
+	}
+}
+
+func (s *testMetaFileSuite) TestOldBRReadsMetaV2(c *C) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	meta := mockBackupMeta(3, 1)
+	meta.Ddls = []byte("[]")
+	c.Assert(WriteBackupMeta(ctx, store, meta, MetaV2, nil), IsNil)
+
+	// An older BR skips the extension, and fails to parse the DDL jobs
+	// instead of restoring the root as an empty backup.
+	data, err := store.Read(ctx, utils.MetaFile)
+	c.Assert(err, IsNil)
+	old := &backup.BackupMeta{}
+	c.Assert(proto.Unmarshal(data, old), IsNil)
+	c.Assert(old.EndVersion, Equals, uint64(42))
+	c.Assert(old.Files, HasLen, 0)
+	var jobs []map[string]interface{}
+	c.Assert(json.Unmarshal(old.Ddls, &jobs), NotNil)
+}
+
+func (s *testMetaFileSuite) TestExtension(c *C) {
+	meta := &backup.BackupMeta{EndVersion: 42, Files: []*backup.File{{Name: "1.sst"}}}
+	data, err := marshalBackupMeta(meta, &Extension{Version: MetaV1})
+	c.Assert(err, IsNil)
+	parsed, ext, err := unmarshalBackupMeta(data)
+	c.Assert(err, IsNil)
+	c.Assert(ext.Version, Equals, MetaV1)
+	c.Assert(parsed.Files, HasLen, 1)
+
+	// The backupmeta written by older BR has no extension.
+	data, err = proto.Marshal(meta)
+	c.Assert(err, IsNil)
+	_, ext, err = unmarshalBackupMeta(data)
+	c.Assert(err, IsNil)
+	c.Assert(ext.Version, Equals, MetaV1)
+
+	data, err = marshalBackupMeta(meta, &Extension{Version: 3})
+	c.Assert(err, IsNil)
+	_, _, err = unmarshalBackupMeta(data)
+	c.Assert(err, ErrorMatches, ".*version 3 isn't supported.*")
+
+	_, err = findExtension(data[:len(data)-1])
+	c.Assert(err, ErrorMatches, ".*truncated backupmeta.*")
+}
+
+func (s *testMetaFileSuite) TestReadCorruptedShard(c *C) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(WriteBackupMeta(ctx, store, mockBackupMeta(3, 1), MetaV2, nil), IsNil)
+
+	r, err := NewMetaReader(ctx, store, utils.MetaFile, nil)
+	c.Assert(err, IsNil)
+	root, err := r.ReadAll(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(root.Files, HasLen, 3)
+
+	name := r.Extension().FileShards[0].Name
+	c.Assert(store.Write(ctx, name, []byte("corrupted")), IsNil)
+	_, err = ReadBackupMeta(ctx, store, utils.MetaFile, nil)
+	c.Assert(err, ErrorMatches, ".*checksum of backupmeta shard "+name+" mismatches.*")
+}
+
+func listShards(c *C, store storage.ExternalStorage) []string {
+	names := make([]string, 0)
+	c.Assert(store.WalkDir(context.Background(), &storage.WalkOption{}, func(p string, _ int64) error {
+		if strings.HasPrefix(p, metaFilesPrefix) || strings.HasPrefix(p, metaSchemasPrefix) {
+			names = append(names, p)
+		}
+		return nil
+	}), IsNil)
+	sort.Strings(names)
+	return names
+}
+
+func (s *testMetaFileSuite) TestShardsOfRuns(c *C) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	meta := mockBackupMeta(10, 5)
+
+	// The failed run removes its shards.
+	failed := NewMetaWriter(store, MetaV2)
+	failed.filesPerShard = 4
+	c.Assert(failed.AddFiles(ctx, meta.Files...), IsNil)
+	c.Assert(listShards(c, store), HasLen, 2)
+	failed.Abort(ctx)
+	c.Assert(listShards(c, store), HasLen, 0)
+
+	// The interrupted run leaves more shards than the next run writes.
+	interrupted := NewMetaWriter(store, MetaV2)
+	interrupted.filesPerShard = 2
+	c.Assert(interrupted.AddFiles(ctx, meta.Files...), IsNil)
+	c.Assert(listShards(c, store), HasLen, 5)
+
+	w := NewMetaWriter(store, MetaV2)
+	w.run = interrupted.run + "0"
+	w.filesPerShard = 4
+	c.Assert(w.AddFiles(ctx, meta.Files[:6]...), IsNil)
+	c.Assert(w.AddSchemas(ctx, meta.Schemas...), IsNil)
+	c.Assert(w.Finish(ctx, meta), IsNil)
+	// Only the shards of the finished run are kept, and aborting it
+	// afterwards doesn't remove them.
+	w.Abort(ctx)
+	expected := make([]string, 0)
+	for _, refs := range [][]ShardRef{w.fileShards, w.schemaShards} {
+		for _, ref := range refs {
+			expected = append(expected, ref.Name)
+		}
+	}
+	sort.Strings(expected)
+	c.Assert(listShards(c, store), DeepEquals, expected)
+
+	r, err := NewMetaReader(ctx, store, utils.MetaFile, nil)
+	c.Assert(err, IsNil)
+	c.Assert(r.FileCount(), Equals, 6)
+}
@@ -0,0 +1,217 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package pdutil
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/kvproto/pkg/pdpb"
+	"github.com/pingcap/log"
+	pd "github.com/tikv/pd/client"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const (
+	pdCmdRetryTimes      = 5
+	pdCmdWaitInterval    = 100 * time.Millisecond
+	pdCmdMaxWaitInterval = 3 * time.Second
+	// slowPDCmdThreshold is the duration of a PD command to be logged as slow.
+	slowPDCmdThreshold = time.Second
+)
+
+type pdCmdBackoffer struct {
+	attempt      int
+	delayTime    time.Duration
+	maxDelayTime time.Duration
+}
+
+func newPDCmdBackoffer() utils.Backoffer {
+	return &pdCmdBackoffer{
+		attempt:      pdCmdRetryTimes,
+		delayTime:    pdCmdWaitInterval,
+		maxDelayTime: pdCmdMaxWaitInterval,
+	}
+}
+
+func (bo *pdCmdBackoffer) NextBackoff(err error) time.Duration {
+	if !isRetryablePDError(err) {
+		bo.delayTime = 0
+		bo.attempt = 0
+		return 0
+	}
+	bo.delayTime = 2 * bo.delayTime
+	bo.attempt--
+	if bo.delayTime > bo.maxDelayTime {
+		return bo.maxDelayTime
+	}
+	return bo.delayTime
+}
+
+func (bo *pdCmdBackoffer) Attempt() int {
+	return bo.attempt
+}
+
+// isRetryablePDError returns false for the errors which retrying doesn't fix:
+// the canceled commands, the invalid arguments and the regions not found.
+func isRetryablePDError(err error) bool {
+	cause := errors.Cause(err)
+	switch cause {
+	case context.Canceled, context.DeadlineExceeded:
+		return false
+	}
+	if status.Code(cause) == codes.InvalidArgument {
+		return false
+	}
+	// PD client reports the errors in the response headers by their types.
+	return !strings.Contains(err.Error(), pdpb.ErrorType_REGION_NOT_FOUND.String())
+}
+
+// instrumentedClient retries the commands of PD client, records their
+// latencies and logs the slow ones. Other commands are passed through.
+type instrumentedClient struct {
+	pd.Client
+}
+
+// NewInstrumentedClient wraps the PD client with consistent retry, metrics
+// and slow command logging.
+func NewInstrumentedClient(client pd.Client) pd.Client {
+	if _, ok := client.(*instrumentedClient); ok {
+		return client
+	}
+	return &instrumentedClient{Client: client}
+}
+
+// call runs the command until it succeeds or runs out of retries, it returns
+// the error of the last attempt.
+func (c *instrumentedClient) call(ctx context.Context, cmd string, fn func() error) error {
+	retry := 0
+	var lastErr error
+	err := utils.WithRetry(ctx, func() error {
+		if retry > 0 {
+			pdCmdRetryCounter.WithLabelValues(cmd).Inc()
+		}
+		start := time.Now()
+		err := fn()
+		elapsed := time.Since(start)
+		result := "ok"
+		if err != nil {
+			result = "err"
+			log.Warn("pd command failed", zap.String("cmd", cmd),
+				zap.Int("retry", retry), zap.Duration("take", elapsed), zap.Error(err))
+		} else if elapsed > slowPDCmdThreshold {
+			log.Warn("slow pd command", zap.String("cmd", cmd),
+				zap.Int("retry", retry), zap.Duration("take", elapsed))
+		}
+		pdCmdHistogram.WithLabelValues(cmd, result).Observe(elapsed.Seconds())
+		retry++
+		lastErr = err
+		return err
+	}, newPDCmdBackoffer())
+	if err != nil {
+		return lastErr
+	}
+	return nil
+}
+
+func (c *instrumentedClient) GetTS(ctx context.Context) (physical int64, logical int64, err error) {
+	err = c.call(ctx, "get_ts", func() error {
+		var e error
+		physical, logical, e = c.Client.GetTS(ctx)
+		return e
+	})
+	return physical, logical, err
+}
+
+func (c *instrumentedClient) GetRegion(ctx context.Context, key []byte) (region *pd.Region, err error) {
+	err = c.call(ctx, "get_region", func() error {
+		var e error
+		region, e = c.Client.GetRegion(ctx, key)
+		return e
+	})
+	return region, err
+}
+
+func (c *instrumentedClient) GetRegionByID(ctx context.Context, regionID uint64) (region *pd.Region, err error) {
+	err = c.call(ctx, "get_region_by_id", func() error {
+		var e error
+		region, e = c.Client.GetRegionByID(ctx, regionID)
+		return e
+	})
+	return region, err
+}
+
+func (c *instrumentedClient) ScanRegions(
+	ctx context.Context, key, endKey []byte, limit int,
+) (regions []*pd.Region, err error) {
+	err = c.call(ctx, "scan_regions", func() error {
+		var e error
+		regions, e = c.Client.ScanRegions(ctx, key, endKey, limit)
+		return e
+	})
+	return regions, err
+}
+
+func (c *instrumentedClient) GetStore(ctx context.Context, storeID uint64) (store *metapb.Store, err error) {
+	err = c.call(ctx, "get_store", func() error {
+		var e error
+		store, e = c.Client.GetStore(ctx, storeID)
+		return e
+	})
+	return store, err
+}
+
+func (c *instrumentedClient) GetAllStores(
+	ctx context.Context, opts ...pd.GetStoreOption,
+) (stores []*metapb.Store, err error) {
+	err = c.call(ctx, "get_all_stores", func() error {
+		var e error
+		stores, e = c.Client.GetAllStores(ctx, opts...)
+		return e
+	})
+	return stores, err
+}
+
+func (c *instrumentedClient) ScatterRegion(ctx context.Context, regionID uint64) error {
+	return c.call(ctx, "scatter_region", func() error {
+		return c.Client.ScatterRegion(ctx, regionID)
+	})
+}
+
+func (c *instrumentedClient) GetOperator(
+	ctx context.Context, regionID uint64,
+) (resp *pdpb.GetOperatorResponse, err error) {
+	err = c.call(ctx, "get_operator", func() error {
+		var e error
+		resp, e = c.Client.GetOperator(ctx, regionID)
+		return e
+	})
+	return resp, err
+}
+
+func (c *instrumentedClient) UpdateGCSafePoint(ctx context.Context, safePoint uint64) (newSafePoint uint64, err error) {
+	err = c.call(ctx, "update_gc_safe_point", func() error {
+		var e error
+		newSafePoint, e = c.Client.UpdateGCSafePoint(ctx, safePoint)
+		return e
+	})
+	return newSafePoint, err
+}
+
+func (c *instrumentedClient) UpdateServiceGCSafePoint(
+	ctx context.Context, serviceID string, ttl int64, safePoint uint64,
+) (minSafePoint uint64, err error) {
+	err = c.call(ctx, "update_service_gc_safe_point", func() error {
+		var e error
+		minSafePoint, e = c.Client.UpdateServiceGCSafePoint(ctx, serviceID, ttl, safePoint)
+		return e
+	})
+	return minSafePoint, err
+}
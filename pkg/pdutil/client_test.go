@@ -0,0 +1,67 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package pdutil
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/pingcap/check"
+	pd "github.com/tikv/pd/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testInstrumentedClientSuite struct{}
+
+var _ = Suite(&testInstrumentedClientSuite{})
+
+type flakyPDClient struct {
+	pd.Client
+	failures int
+	calls    int
+	err      error
+}
+
+func (c *flakyPDClient) GetTS(ctx context.Context) (int64, int64, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return 0, 0, c.err
+	}
+	return 42, 1, nil
+}
+
+func (s *testInstrumentedClientSuite) TestRetry(c *C) {
+	ctx := context.Background()
+	flaky := &flakyPDClient{failures: 2, err: errors.New("pd unavailable")}
+	client := NewInstrumentedClient(flaky)
+	c.Assert(NewInstrumentedClient(client), Equals, client)
+
+	physical, logical, err := client.GetTS(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(physical, Equals, int64(42))
+	c.Assert(logical, Equals, int64(1))
+	c.Assert(flaky.calls, Equals, 3)
+
+	// Don't retry once the context is canceled.
+	flaky = &flakyPDClient{failures: 1, err: context.Canceled}
+	_, _, err = NewInstrumentedClient(flaky).GetTS(ctx)
+	c.Assert(err, NotNil)
+	c.Assert(flaky.calls, Equals, 1)
+
+	// Don't retry the invalid arguments and the regions not found.
+	flaky = &flakyPDClient{failures: 1, err: status.Error(codes.InvalidArgument, "bad key")}
+	_, _, err = NewInstrumentedClient(flaky).GetTS(ctx)
+	c.Assert(status.Code(err), Equals, codes.InvalidArgument)
+	c.Assert(flaky.calls, Equals, 1)
+	flaky = &flakyPDClient{failures: 1, err: errors.New("scatter region 1 failed: type:REGION_NOT_FOUND")}
+	_, _, err = NewInstrumentedClient(flaky).GetTS(ctx)
+	c.Assert(err, NotNil)
+	c.Assert(flaky.calls, Equals, 1)
+
+	// The error of the last attempt is returned rather than all of them.
+	flaky = &flakyPDClient{failures: pdCmdRetryTimes, err: errors.New("pd unavailable")}
+	_, _, err = NewInstrumentedClient(flaky).GetTS(ctx)
+	c.Assert(err, Equals, flaky.err)
+	c.Assert(flaky.calls, Equals, pdCmdRetryTimes)
+}
@@ -0,0 +1,31 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package pdutil
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	pdCmdHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "br",
+			Subsystem: "pd",
+			Name:      "cmd_seconds",
+			Help:      "PD client command latency distributions.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+		}, []string{"cmd", "result"})
+
+	pdCmdRetryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "br",
+			Subsystem: "pd",
+			Name:      "cmd_retry_total",
+			Help:      "PD client command retry statistic.",
+		}, []string{"cmd"})
+)
+
+func init() { // nolint:gochecknoinits
+	prometheus.MustRegister(pdCmdHistogram)
+	prometheus.MustRegister(pdCmdRetryCounter)
+}
@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pingcap/failpoint"
@@ -33,6 +35,9 @@ import (
 const (
 	clusterVersionPrefix = "pd/api/v1/config/cluster-version"
 	regionCountPrefix    = "pd/api/v1/stats/region"
+	regionsByKeyPrefix   = "pd/api/v1/regions/key"
+	operatorsPrefix      = "pd/api/v1/operators"
+	storesPrefix         = "pd/api/v1/stores"
 	schedulerPrefix      = "pd/api/v1/schedulers"
 	maxMsgSize           = int(128 * utils.MB) // pd.ScanRegion may return a large response
 	scheduleConfigPrefix = "pd/api/v1/config/schedule"
@@ -50,6 +55,8 @@ const (
 	pauseConfigMulStoresCount
 	// pauseConfigSetFalse sets the config to "false".
 	pauseConfigSetFalse
+	// pauseConfigTighten divides the existing value by 4, at least 1.
+	pauseConfigTighten
 )
 
 var (
@@ -95,6 +102,24 @@ var (
 		"enable-location-replacement": pauseConfigSetFalse,
 	}
 
+	// OnlineSchedulers are the schedulers paused by an online restore. The
+	// leaders are still balanced, which is cheap and keeps serving balanced.
+	OnlineSchedulers = map[string]struct{}{
+		"balance-hot-region-scheduler": {},
+		"balance-region-scheduler":     {},
+
+		"shuffle-leader-scheduler":     {},
+		"shuffle-region-scheduler":     {},
+		"shuffle-hot-region-scheduler": {},
+	}
+	// onlinePDCfg are the configs changed by an online restore, the regions
+	// aren't merged and fewer regions are scheduled while ingesting.
+	onlinePDCfg = map[string]pauseConfigExpectation{
+		"max-merge-region-keys": pauseConfigSetZero,
+		"max-merge-region-size": pauseConfigSetZero,
+		"region-schedule-limit": pauseConfigTighten,
+	}
+
 	// defaultPDCfg find by https://github.com/tikv/pd/blob/master/conf/config.toml.
 	defaultPDCfg = map[string]interface{}{
 		"max-merge-region-keys":       200000,
@@ -142,7 +167,10 @@ func pdRequest(
 
 // PdController manage get/update config from pd.
 type PdController struct {
+	// addrsMu guards addrs, which are replaced once PD is rediscovered.
+	addrsMu  sync.RWMutex
 	addrs    []string
+	useTLS   bool
 	cli      *http.Client
 	pdClient pd.Client
 	version  *semver.Version
@@ -151,12 +179,14 @@ type PdController struct {
 	schedulerPauseCh chan struct{}
 }
 
-// NewPdController creates a new PdController.
+// NewPdController creates a new PdController, dialOpts are appended to
+// the options dialing PD.
 func NewPdController(
 	ctx context.Context,
 	pdAddrs string,
 	tlsConf *tls.Config,
 	securityOption pd.SecurityOption,
+	dialOpts ...grpc.DialOption,
 ) (*PdController, error) {
 	cli := &http.Client{Timeout: 30 * time.Second}
 	if tlsConf != nil {
@@ -170,13 +200,7 @@ func NewPdController(
 	var failure error
 	var versionBytes []byte
 	for _, addr := range addrs {
-		if addr != "" && !strings.HasPrefix("http", addr) {
-			if tlsConf != nil {
-				addr = "https://" + addr
-			} else {
-				addr = "http://" + addr
-			}
-		}
+		addr = withHTTPScheme(addr, tlsConf != nil)
 		processedAddrs = append(processedAddrs, addr)
 		versionBytes, failure = pdRequest(ctx, addr, clusterVersionPrefix, cli, http.MethodGet, nil)
 		if failure == nil {
@@ -205,7 +229,7 @@ func NewPdController(
 	}
 	pdClient, err := pd.NewClientWithContext(
 		ctx, addrs, securityOption,
-		pd.WithGRPCDialOptions(maxCallMsgSize...),
+		pd.WithGRPCDialOptions(append(maxCallMsgSize, dialOpts...)...),
 		pd.WithCustomTimeoutOption(10*time.Second),
 	)
 	if err != nil {
@@ -215,8 +239,9 @@ func NewPdController(
 
 	return &PdController{
 		addrs:    processedAddrs,
+		useTLS:   tlsConf != nil,
 		cli:      cli,
-		pdClient: pdClient,
+		pdClient: NewInstrumentedClient(pdClient),
 		version:  version,
 		// We should make a buffered channel here otherwise when context canceled,
 		// gracefully shutdown will stick at resuming schedulers.
@@ -228,9 +253,40 @@ func (p *PdController) isPauseConfigEnabled() bool {
 	return p.version.Compare(pauseConfigVersion) >= 0
 }
 
+// withHTTPScheme prefixes the PD address with the scheme of its HTTP API.
+func withHTTPScheme(addr string, useTLS bool) string {
+	if addr == "" || strings.HasPrefix(addr, "http") {
+		return addr
+	}
+	if useTLS {
+		return "https://" + addr
+	}
+	return "http://" + addr
+}
+
+func (p *PdController) getAddrs() []string {
+	p.addrsMu.RLock()
+	defer p.addrsMu.RUnlock()
+	return p.addrs
+}
+
+// SetAddrs replaces the addresses of the HTTP API of PD, e.g. after PD is
+// rediscovered by DNS. The PD client follows the members of PD by itself.
+func (p *PdController) SetAddrs(addrs []string) {
+	processed := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		processed = append(processed, withHTTPScheme(addr, p.useTLS))
+	}
+	p.addrsMu.Lock()
+	defer p.addrsMu.Unlock()
+	p.addrs = processed
+}
+
 // SetHTTP set pd addrs and cli for test.
 func (p *PdController) SetHTTP(addrs []string, cli *http.Client) {
+	p.addrsMu.Lock()
 	p.addrs = addrs
+	p.addrsMu.Unlock()
 	p.cli = cli
 }
 
@@ -251,7 +307,7 @@ func (p *PdController) GetClusterVersion(ctx context.Context) (string, error) {
 
 func (p *PdController) getClusterVersionWith(ctx context.Context, get pdHTTPRequest) (string, error) {
 	var err error
-	for _, addr := range p.addrs {
+	for _, addr := range p.getAddrs() {
 		v, e := get(ctx, addr, clusterVersionPrefix, p.cli, http.MethodGet, nil)
 		if e != nil {
 			err = e
@@ -278,7 +334,7 @@ func (p *PdController) getRegionCountWith(
 		end = url.QueryEscape(string(codec.EncodeBytes(nil, endKey)))
 	}
 	var err error
-	for _, addr := range p.addrs {
+	for _, addr := range p.getAddrs() {
 		query := fmt.Sprintf(
 			"%s?start_key=%s&end_key=%s",
 			regionCountPrefix, start, end)
@@ -297,6 +353,103 @@ func (p *PdController) getRegionCountWith(
 	return 0, err
 }
 
+// scanRegionsLimit is the count of regions to scan in a PD request.
+const scanRegionsLimit = 1024
+
+// regionSize is the part of the region info returned by PD HTTP API.
+type regionSize struct {
+	ID       uint64 `json:"id"`
+	StartKey string `json:"start_key"`
+	EndKey   string `json:"end_key"`
+	// ApproximateSize is in MiB.
+	ApproximateSize int64 `json:"approximate_size"`
+}
+
+type regionsSize struct {
+	Count   int          `json:"count"`
+	Regions []regionSize `json:"regions"`
+}
+
+// GetLargeRegions returns the IDs of the regions in the specified range
+// whose approximate size is larger than sizeMB.
+func (p *PdController) GetLargeRegions(ctx context.Context, startKey, endKey []byte, sizeMB uint64) ([]uint64, error) {
+	return p.getLargeRegionsWith(ctx, pdRequest, startKey, endKey, sizeMB)
+}
+
+func (p *PdController) getLargeRegionsWith(
+	ctx context.Context, get pdHTTPRequest, startKey, endKey []byte, sizeMB uint64,
+) ([]uint64, error) {
+	// TiKV reports region start/end keys to PD in memcomparable-format.
+	key := codec.EncodeBytes(nil, startKey)
+	var end []byte
+	if len(endKey) != 0 { // Empty end key means the max.
+		end = codec.EncodeBytes(nil, endKey)
+	}
+	large := make([]uint64, 0)
+	for {
+		query := fmt.Sprintf("%s?key=%s&limit=%d", regionsByKeyPrefix, url.QueryEscape(string(key)), scanRegionsLimit)
+		var v []byte
+		var err error
+		for _, addr := range p.getAddrs() {
+			v, err = get(ctx, addr, query, p.cli, http.MethodGet, nil)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		regions := regionsSize{}
+		if err = json.Unmarshal(v, &regions); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if len(regions.Regions) == 0 {
+			return large, nil
+		}
+		for _, r := range regions.Regions {
+			start, err := hex.DecodeString(r.StartKey)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if len(end) != 0 && bytes.Compare(start, end) >= 0 {
+				return large, nil
+			}
+			if r.ApproximateSize > int64(sizeMB) {
+				large = append(large, r.ID)
+			}
+			if key, err = hex.DecodeString(r.EndKey); err != nil {
+				return nil, errors.Trace(err)
+			}
+			if len(key) == 0 {
+				return large, nil
+			}
+		}
+	}
+}
+
+// SplitRegionByHalf asks PD to split the region into two by its approximate size.
+func (p *PdController) SplitRegionByHalf(ctx context.Context, regionID uint64) error {
+	return p.splitRegionByHalfWith(ctx, pdRequest, regionID)
+}
+
+func (p *PdController) splitRegionByHalfWith(ctx context.Context, post pdHTTPRequest, regionID uint64) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"name":      "split-region",
+		"region_id": regionID,
+		"policy":    "approximate",
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, addr := range p.getAddrs() {
+		_, err = post(ctx, addr, operatorsPrefix, p.cli, http.MethodPost, bytes.NewBuffer(body))
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.Trace(err)
+}
+
 func (p *PdController) doPauseSchedulers(ctx context.Context, schedulers []string, post pdHTTPRequest) ([]string, error) {
 	// pause this scheduler with 300 seconds
 	body, err := json.Marshal(pauseSchedulerBody{Delay: int64(pauseTimeout)})
@@ -307,7 +460,7 @@ func (p *PdController) doPauseSchedulers(ctx context.Context, schedulers []strin
 	removedSchedulers := make([]string, 0, len(schedulers))
 	for _, scheduler := range schedulers {
 		prefix := fmt.Sprintf("%s/%s", schedulerPrefix, scheduler)
-		for _, addr := range p.addrs {
+		for _, addr := range p.getAddrs() {
 			_, err = post(ctx, addr, prefix, p.cli, http.MethodPost, bytes.NewBuffer(body))
 			if err == nil {
 				removedSchedulers = append(removedSchedulers, scheduler)
@@ -390,7 +543,7 @@ func (p *PdController) resumeSchedulerWith(ctx context.Context, schedulers []str
 	}
 	for _, scheduler := range schedulers {
 		prefix := fmt.Sprintf("%s/%s", schedulerPrefix, scheduler)
-		for _, addr := range p.addrs {
+		for _, addr := range p.getAddrs() {
 			_, err = post(ctx, addr, prefix, p.cli, http.MethodPost, bytes.NewBuffer(body))
 			if err == nil {
 				break
@@ -414,7 +567,7 @@ func (p *PdController) ListSchedulers(ctx context.Context) ([]string, error) {
 
 func (p *PdController) listSchedulersWith(ctx context.Context, get pdHTTPRequest) ([]string, error) {
 	var err error
-	for _, addr := range p.addrs {
+	for _, addr := range p.getAddrs() {
 		v, e := get(ctx, addr, schedulerPrefix, p.cli, http.MethodGet, nil)
 		if e != nil {
 			err = e
@@ -436,7 +589,7 @@ func (p *PdController) GetPDScheduleConfig(
 	ctx context.Context,
 ) (map[string]interface{}, error) {
 	var err error
-	for _, addr := range p.addrs {
+	for _, addr := range p.getAddrs() {
 		v, e := pdRequest(
 			ctx, addr, scheduleConfigPrefix, p.cli, http.MethodGet, nil)
 		if e != nil {
@@ -465,7 +618,7 @@ func (p *PdController) doUpdatePDScheduleConfig(
 	if len(prefixs) != 0 {
 		prefix = prefixs[0]
 	}
-	for _, addr := range p.addrs {
+	for _, addr := range p.getAddrs() {
 		reqData, err := json.Marshal(cfg)
 		if err != nil {
 			return err
@@ -522,6 +675,21 @@ func (p *PdController) makeUndoFunctionByConfig(config clusterConfig) utils.Undo
 
 // RemoveSchedulers removes the schedulers that may slow down BR speed.
 func (p *PdController) RemoveSchedulers(ctx context.Context) (undo utils.UndoFunc, err error) {
+	return p.removeSchedulersWith(ctx, Schedulers, expectPDCfg)
+}
+
+// RemoveSchedulersForOnline pauses the schedulers moving regions and tightens
+// the region schedule limit, so an online restore doesn't fight the scheduler
+// while keeping the cluster serving.
+func (p *PdController) RemoveSchedulersForOnline(ctx context.Context) (undo utils.UndoFunc, err error) {
+	return p.removeSchedulersWith(ctx, OnlineSchedulers, onlinePDCfg)
+}
+
+func (p *PdController) removeSchedulersWith(
+	ctx context.Context,
+	schedulers map[string]struct{},
+	expectCfg map[string]pauseConfigExpectation,
+) (undo utils.UndoFunc, err error) {
 	undo = utils.Nop
 	stores, err := p.pdClient.GetAllStores(ctx)
 	if err != nil {
@@ -532,7 +700,7 @@ func (p *PdController) RemoveSchedulers(ctx context.Context) (undo utils.UndoFun
 		return
 	}
 	disablePDCfg := make(map[string]interface{})
-	for cfgKey, cfgVal := range expectPDCfg {
+	for cfgKey, cfgVal := range expectCfg {
 		value, ok := scheduleCfg[cfgKey]
 		if !ok {
 			// Ignore non-exist config.
@@ -548,6 +716,8 @@ func (p *PdController) RemoveSchedulers(ctx context.Context) (undo utils.UndoFun
 		case pauseConfigMulStoresCount:
 			limit := int(value.(float64))
 			disablePDCfg[cfgKey] = math.Min(40, float64(limit*len(stores)))
+		case pauseConfigTighten:
+			disablePDCfg[cfgKey] = math.Max(1, math.Floor(value.(float64)/4))
 		}
 	}
 	undo = p.makeUndoFunctionByConfig(clusterConfig{scheduleCfg: scheduleCfg})
@@ -560,7 +730,7 @@ func (p *PdController) RemoveSchedulers(ctx context.Context) (undo utils.UndoFun
 	}
 	needRemoveSchedulers := make([]string, 0, len(existSchedulers))
 	for _, s := range existSchedulers {
-		if _, ok := Schedulers[s]; ok {
+		if _, ok := schedulers[s]; ok {
 			needRemoveSchedulers = append(needRemoveSchedulers, s)
 		}
 	}
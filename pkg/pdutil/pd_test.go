@@ -11,7 +11,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/pingcap/check"
 	"github.com/pingcap/kvproto/pkg/metapb"
@@ -157,3 +159,101 @@ func (s *testPDControllerSuite) TestRegionCount(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(resp, Equals, 2)
 }
+
+func (s *testPDControllerSuite) TestGetLargeRegions(c *C) {
+	regions := core.NewRegionsInfo()
+	sizes := []int64{96, 10240, 4096, 20480}
+	for i, size := range sizes {
+		regions.SetRegion(core.NewRegionInfo(&metapb.Region{
+			Id:          uint64(i + 1),
+			StartKey:    codec.EncodeBytes(nil, []byte{byte(i)}),
+			EndKey:      codec.EncodeBytes(nil, []byte{byte(i + 1)}),
+			RegionEpoch: &metapb.RegionEpoch{},
+		}, nil, core.SetApproximateSize(size)))
+	}
+
+	mock := func(
+		_ context.Context, addr string, prefix string, _ *http.Client, _ string, _ io.Reader,
+	) ([]byte, error) {
+		u, e := url.Parse(fmt.Sprintf("%s/%s", addr, prefix))
+		c.Assert(e, IsNil)
+		// Return one region at a time to check the pagination.
+		scanRegions := regions.ScanRange([]byte(u.Query().Get("key")), nil, 1)
+		ret := regionsSize{Count: len(scanRegions)}
+		for _, r := range scanRegions {
+			ret.Regions = append(ret.Regions, regionSize{
+				ID:              r.GetID(),
+				StartKey:        strings.ToUpper(hex.EncodeToString(r.GetStartKey())),
+				EndKey:          strings.ToUpper(hex.EncodeToString(r.GetEndKey())),
+				ApproximateSize: r.GetApproximateSize(),
+			})
+		}
+		return json.Marshal(ret)
+	}
+
+	pdController := &PdController{addrs: []string{"http://mock"}}
+	ctx := context.Background()
+	large, err := pdController.getLargeRegionsWith(ctx, mock, []byte{}, []byte{}, 1024)
+	c.Assert(err, IsNil)
+	c.Assert(large, DeepEquals, []uint64{2, 3, 4})
+
+	large, err = pdController.getLargeRegionsWith(ctx, mock, []byte{0}, []byte{2}, 8192)
+	c.Assert(err, IsNil)
+	c.Assert(large, DeepEquals, []uint64{2})
+}
+
+func (s *testPDControllerSuite) TestStoreLoadSampler(c *C) {
+	metrics := map[string]string{
+		"http://tikv1:20180": `# HELP process_cpu_seconds_total Total user and system CPU time spent in seconds.
+process_cpu_seconds_total %d
+tikv_server_cpu_cores_quota 4
+tikv_engine_write_stall{db="kv",type="write_stall_max"} 0
+tikv_engine_write_stall{db="kv",type="write_stall_average"} 0`,
+		"http://tikv2:20180": `process_cpu_seconds_total 10
+tikv_engine_write_stall{db="kv",type="write_stall_max"} 1500
+tikv_engine_write_stall{db="raft",type="write_stall_max"} 0`,
+	}
+	cpuSeconds := 100
+	mock := func(_ context.Context, addr string, prefix string, _ *http.Client, _ string, _ io.Reader) ([]byte, error) {
+		c.Assert(prefix, Equals, storeMetricsPrefix)
+		data, ok := metrics[addr]
+		if !ok {
+			return nil, errors.New("unavailable")
+		}
+		if strings.Contains(data, "%d") {
+			data = fmt.Sprintf(data, cpuSeconds)
+		}
+		return []byte(data), nil
+	}
+	stores := []*metapb.Store{
+		{Id: 1, StatusAddress: "tikv1:20180"},
+		{Id: 2, StatusAddress: "tikv2:20180"},
+		{Id: 3, StatusAddress: "tikv3:20180"},
+		{Id: 4, StatusAddress: "tiflash:20292", Labels: []*metapb.StoreLabel{{Key: "engine", Value: "tiflash"}}},
+	}
+	sampler := (&PdController{addrs: []string{"http://mock"}}).NewStoreLoadSampler()
+	now := time.Now()
+	loads := sampler.sampleWith(context.Background(), stores, mock, now)
+	c.Assert(loads, DeepEquals, []StoreLoad{{StoreID: 1}, {StoreID: 2, WriteStall: true}})
+
+	// 30 seconds of 4 cores in 10 seconds.
+	cpuSeconds += 30
+	loads = sampler.sampleWith(context.Background(), stores, mock, now.Add(10*time.Second))
+	c.Assert(loads, HasLen, 2)
+	c.Assert(loads[0].CPUUsage, Equals, 0.75)
+	// The CPU usage is unknown without the quota.
+	c.Assert(loads[1].CPUUsage, Equals, 0.0)
+
+	pdController := &PdController{useTLS: true}
+	c.Assert(pdController.statusURL("tikv1:20180"), Equals, "https://tikv1:20180")
+}
+
+func (s *testPDControllerSuite) TestSetAddrs(c *C) {
+	pdController := &PdController{addrs: []string{"http://pd0:2379"}}
+	pdController.SetAddrs([]string{"pd1:2379", "http://pd2:2379"})
+	c.Assert(pdController.getAddrs(), DeepEquals, []string{"http://pd1:2379", "http://pd2:2379"})
+
+	pdController = &PdController{useTLS: true}
+	pdController.SetAddrs([]string{"pd1:2379"})
+	c.Assert(pdController.getAddrs(), DeepEquals, []string{"https://pd1:2379"})
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package pdutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/log"
+	pd "github.com/tikv/pd/client"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const (
+	storeMetricsPrefix = "metrics"
+
+	// cpuSecondsMetric is the CPU time used by the TiKV process.
+	cpuSecondsMetric = "process_cpu_seconds_total"
+	// cpuQuotaMetric is the number of the cores TiKV may use.
+	cpuQuotaMetric = "tikv_server_cpu_cores_quota"
+	// writeStallMetric is the duration of the writes stalled by RocksDB, which
+	// is behind on flushing and compacting, i.e. the disk is overloaded.
+	writeStallMetric = "tikv_engine_write_stall"
+	writeStallLabel  = `type="write_stall_max"`
+)
+
+// StoreLoad is the load of a TiKV store, sampled from its metrics.
+type StoreLoad struct {
+	StoreID uint64
+	// CPUUsage is the ratio of the CPU quota used since the last sample, it's
+	// 0 for the first sample.
+	CPUUsage float64
+	// WriteStall is whether RocksDB stalls the writes.
+	WriteStall bool
+}
+
+type cpuSample struct {
+	seconds float64
+	at      time.Time
+}
+
+// StoreLoadSampler samples the load of the TiKV stores from the metrics on
+// their status addresses.
+type StoreLoadSampler struct {
+	p *PdController
+
+	mu   sync.Mutex
+	last map[uint64]cpuSample
+}
+
+// NewStoreLoadSampler returns a sampler of the load of the TiKV stores.
+func (p *PdController) NewStoreLoadSampler() *StoreLoadSampler {
+	return &StoreLoadSampler{p: p, last: make(map[uint64]cpuSample)}
+}
+
+// Sample returns the load of the TiKV stores, the stores whose metrics are
+// unavailable are skipped.
+func (s *StoreLoadSampler) Sample(ctx context.Context) ([]StoreLoad, error) {
+	stores, err := s.p.pdClient.GetAllStores(ctx, pd.WithExcludeTombstone())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return s.sampleWith(ctx, stores, pdRequest, time.Now()), nil
+}
+
+func (s *StoreLoadSampler) sampleWith(
+	ctx context.Context, stores []*metapb.Store, get pdHTTPRequest, now time.Time,
+) []StoreLoad {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loads := make([]StoreLoad, 0, len(stores))
+	for _, store := range stores {
+		if utils.IsTiFlash(store) || store.StatusAddress == "" {
+			continue
+		}
+		data, err := get(ctx, s.p.statusURL(store.StatusAddress), storeMetricsPrefix, s.p.cli, http.MethodGet, nil)
+		if err != nil {
+			log.Warn("failed to get the metrics of the store",
+				zap.Uint64("store", store.Id), zap.Error(err))
+			continue
+		}
+		metrics := parseStoreMetrics(data)
+		load := StoreLoad{StoreID: store.Id, WriteStall: metrics.writeStall > 0}
+		last, ok := s.last[store.Id]
+		if ok && metrics.cpuQuota > 0 && now.After(last.at) {
+			load.CPUUsage = (metrics.cpuSeconds - last.seconds) / now.Sub(last.at).Seconds() / metrics.cpuQuota
+		}
+		s.last[store.Id] = cpuSample{seconds: metrics.cpuSeconds, at: now}
+		loads = append(loads, load)
+	}
+	return loads
+}
+
+// statusURL returns the URL of the status address of a store, which uses
+// HTTPS if PD does.
+func (p *PdController) statusURL(addr string) string {
+	return withHTTPScheme(addr, p.useTLS)
+}
+
+type storeMetrics struct {
+	cpuSeconds float64
+	cpuQuota   float64
+	writeStall float64
+}
+
+// parseStoreMetrics picks the metrics of the load from the metrics of TiKV in
+// the text format of Prometheus.
+func parseStoreMetrics(data []byte) storeMetrics {
+	var m storeMetrics
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			continue
+		}
+		name := fields[0]
+		labels := ""
+		if i := strings.IndexByte(name, '{'); i >= 0 {
+			name, labels = name[:i], name[i:]
+		}
+		switch name {
+		case cpuSecondsMetric:
+			m.cpuSeconds = value
+		case cpuQuotaMetric:
+			m.cpuQuota = value
+		case writeStallMetric:
+			if strings.Contains(labels, writeStallLabel) && value > m.writeStall {
+				m.writeStall = value
+			}
+		}
+	}
+	return m
+}
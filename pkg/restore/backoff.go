@@ -54,7 +54,8 @@ func newDownloadSSTBackoffer() utils.Backoffer {
 
 func (bo *importerBackoffer) NextBackoff(err error) time.Duration {
 	switch errors.Cause(err) {
-	case berrors.ErrKVEpochNotMatch, berrors.ErrKVDownloadFailed, berrors.ErrKVIngestFailed:
+	case berrors.ErrKVEpochNotMatch, berrors.ErrKVNotLeader, berrors.ErrKVKeyNotInRegion,
+		berrors.ErrKVDownloadFailed, berrors.ErrKVIngestFailed:
 		bo.delayTime = 2 * bo.delayTime
 		bo.attempt--
 	case berrors.ErrKVRangeIsEmpty, berrors.ErrKVRewriteRuleNotFound:
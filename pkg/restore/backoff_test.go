@@ -115,3 +115,22 @@ func (s *testBackofferSuite) TestBackoffWithRetryableError(c *C) {
 		berrors.ErrKVEpochNotMatch,
 	})
 }
+
+func (s *testBackofferSuite) TestBackoffWithRegionChanged(c *C) {
+	var counter int
+	backoffer := restore.NewBackoffer(10, time.Nanosecond, time.Nanosecond)
+	err := utils.WithRetry(context.Background(), func() error {
+		defer func() { counter++ }()
+		switch counter {
+		case 0:
+			return berrors.ErrKVNotLeader
+		case 1:
+			return berrors.ErrKVKeyNotInRegion
+		case 2:
+			return berrors.ErrKVEpochNotMatch
+		}
+		return nil
+	}, backoffer)
+	c.Assert(counter, Equals, 4)
+	c.Assert(err, IsNil)
+}
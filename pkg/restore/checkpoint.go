@@ -0,0 +1,333 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// checkpointInterval is the interval to save the checkpoint.
+const checkpointInterval = time.Minute
+
+// The phases of restoring a table, in order.
+const (
+	// TablePhaseCreated means the table is created.
+	TablePhaseCreated = "created"
+	// TablePhaseIngested means all files of the table are ingested.
+	TablePhaseIngested = "ingested"
+	// TablePhaseDone means the table is checksummed, or the checksum is skipped.
+	TablePhaseDone = "done"
+)
+
+// CheckpointKey identifies the checkpoint of a restore. The restores of the
+// same backup into different clusters, or with different options, don't
+// share the checkpoint.
+type CheckpointKey struct {
+	ClusterID uint64   `json:"cluster-id"`
+	Storage   string   `json:"storage"`
+	Filter    []string `json:"filter"`
+	DBPrefix  string   `json:"db-prefix"`
+	DBSuffix  string   `json:"db-suffix"`
+	Rename    []string `json:"rename"`
+}
+
+// fileName returns the name of the checkpoint file of the key.
+func (k *CheckpointKey) fileName() string {
+	// It never fails to marshal the struct.
+	data, _ := json.Marshal(k)
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%s.%d.%x", utils.RestoreCheckpointFile, k.ClusterID, sum[:8])
+}
+
+// Checkpoint is the progress of a restore, i.e. the files ingested into the
+// cluster and the phases of the tables.
+type Checkpoint struct {
+	Key      CheckpointKey `json:"key"`
+	BackupTS uint64        `json:"backup-ts"`
+	Files    []string      `json:"files"`
+	// Tables are keyed by the names of the restored tables, in the form of
+	// `db.table`.
+	Tables map[string]TableState `json:"tables"`
+}
+
+// TableState is the progress of restoring a table.
+type TableState struct {
+	Phase         string `json:"phase"`
+	Files         int    `json:"files"`
+	IngestedFiles int    `json:"ingested-files"`
+}
+
+type tableProgress struct {
+	phase string
+	// files is nil if the table isn't restored by this run.
+	files []*backup.File
+	state TableState
+}
+
+// checkpointer records the ingested files and the phases of the tables, and
+// saves them periodically.
+type checkpointer struct {
+	storage storage.ExternalStorage
+	key     CheckpointKey
+
+	mu       sync.Mutex
+	ingested map[string]struct{}
+	tables   map[string]*tableProgress
+	// version increases once a file is ingested, saved is the version
+	// of the last saved checkpoint.
+	version uint64
+	saved   uint64
+	// removed is set once the restore succeeds, the checkpoint isn't saved
+	// any more.
+	removed bool
+}
+
+func newCheckpointer(s storage.ExternalStorage, key CheckpointKey) *checkpointer {
+	return &checkpointer{
+		storage:  s,
+		key:      key,
+		ingested: make(map[string]struct{}),
+		tables:   make(map[string]*tableProgress),
+	}
+}
+
+// load restores the progress of the checkpoint saved by the last run.
+func (c *checkpointer) load(cp *Checkpoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range cp.Files {
+		c.ingested[name] = struct{}{}
+	}
+	for name, state := range cp.Tables {
+		c.tables[name] = &tableProgress{phase: state.Phase, state: state}
+	}
+}
+
+func checkpointTableName(table *utils.Table) string {
+	return table.DB.Name.O + "." + table.Info.Name.O
+}
+
+func (c *checkpointer) setTablePhase(table *utils.Table, phase string) {
+	name := checkpointTableName(table)
+	log.Info("table restore phase", zap.String("table", name), zap.String("phase", phase))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tables[name] = &tableProgress{phase: phase, files: table.Files}
+	c.version++
+}
+
+func (c *checkpointer) tablePhase(table *utils.Table) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.tables[checkpointTableName(table)]; ok {
+		return t.phase
+	}
+	return ""
+}
+
+func (c *checkpointer) put(file *backup.File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ingested[file.GetName()] = struct{}{}
+	c.version++
+}
+
+func (c *checkpointer) has(file *backup.File) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.ingested[file.GetName()]
+	return ok
+}
+
+// snapshot returns the checkpoint and its version, or nil if it's saved
+// already or removed.
+func (c *checkpointer) snapshot(backupTS uint64) (*Checkpoint, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version == c.saved || c.removed {
+		return nil, c.version
+	}
+	cp := &Checkpoint{
+		Key:      c.key,
+		BackupTS: backupTS,
+		Files:    make([]string, 0, len(c.ingested)),
+		Tables:   make(map[string]TableState, len(c.tables)),
+	}
+	for name := range c.ingested {
+		cp.Files = append(cp.Files, name)
+	}
+	sort.Strings(cp.Files)
+	for name, t := range c.tables {
+		if t.files == nil {
+			// Keep the state of the last run.
+			cp.Tables[name] = t.state
+			continue
+		}
+		state := TableState{Phase: t.phase, Files: len(t.files)}
+		for _, f := range t.files {
+			if _, ok := c.ingested[f.GetName()]; ok {
+				state.IngestedFiles++
+			}
+		}
+		cp.Tables[name] = state
+	}
+	return cp, c.version
+}
+
+func (c *checkpointer) markSaved(version uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if version > c.saved {
+		c.saved = version
+	}
+}
+
+// EnableCheckpoint saves the ingested files and the phases of the tables into
+// the checkpoint storage periodically, so a restore interrupted halfway can
+// be run again without ingesting them or restoring the finished tables
+// again. The checkpoint is saved in the file of the key, it's loaded by
+// LoadCheckpoint, and removed by RemoveCheckpoint once the restore succeeds.
+func (rc *Client) EnableCheckpoint(s storage.ExternalStorage, key CheckpointKey) {
+	rc.checkpoint = newCheckpointer(s, key)
+}
+
+// LoadCheckpoint loads the checkpoint saved by the last run of the restore,
+// it must be called after InitBackupMeta and EnableCheckpoint. It returns nil
+// if there is no checkpoint, i.e. the last run didn't ingest any file.
+func (rc *Client) LoadCheckpoint(ctx context.Context) (*Checkpoint, error) {
+	if rc.checkpoint == nil {
+		return nil, errors.Annotate(berrors.ErrInvalidArgument, "the restore checkpoint isn't enabled")
+	}
+	name := rc.checkpoint.key.fileName()
+	exist, err := rc.checkpoint.storage.FileExists(ctx, name)
+	if err != nil {
+		return nil, errors.Annotatef(err, "error occurred when checking %s file", name)
+	}
+	if !exist {
+		log.Info("no restore checkpoint found, restore all files", zap.String("checkpoint", name))
+		return nil, nil
+	}
+	data, err := rc.checkpoint.storage.Read(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	cp := &Checkpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid restore checkpoint: %v", err)
+	}
+	if cp.Key.ClusterID != rc.checkpoint.key.ClusterID {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+			"the restore checkpoint is of cluster %d, but the cluster is %d", cp.Key.ClusterID, rc.checkpoint.key.ClusterID)
+	}
+	if cp.BackupTS != rc.backupMeta.GetEndVersion() {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+			"the restore checkpoint is of backup %d, but the backup is %d", cp.BackupTS, rc.backupMeta.GetEndVersion())
+	}
+	rc.checkpoint.load(cp)
+	log.Info("restore checkpoint loaded", zap.String("checkpoint", name), zap.Int("files", len(cp.Files)),
+		zap.Int("tables", len(cp.Tables)), zap.Uint64("BackupTS", cp.BackupTS))
+	return cp, nil
+}
+
+// RemoveCheckpoint removes the checkpoint once the restore succeeds, it's not
+// saved any more.
+func (rc *Client) RemoveCheckpoint(ctx context.Context) error {
+	if rc.checkpoint == nil {
+		return nil
+	}
+	rc.checkpoint.mu.Lock()
+	rc.checkpoint.removed = true
+	rc.checkpoint.mu.Unlock()
+	name := rc.checkpoint.key.fileName()
+	return errors.Annotatef(rc.checkpoint.storage.DeleteFile(ctx, name), "failed to remove %s", name)
+}
+
+// IsFileIngested returns whether the file is ingested according to the
+// checkpoint.
+func (rc *Client) IsFileIngested(file *backup.File) bool {
+	return rc.checkpoint != nil && rc.checkpoint.has(file)
+}
+
+// SetTablePhase records the phase of restoring the table into the checkpoint.
+func (rc *Client) SetTablePhase(table *utils.Table, phase string) {
+	if rc.checkpoint != nil {
+		rc.checkpoint.setTablePhase(table, phase)
+	}
+}
+
+// IsTableRestored returns whether the table is restored according to the
+// checkpoint.
+func (rc *Client) IsTableRestored(table *utils.Table) bool {
+	return rc.checkpoint != nil && rc.checkpoint.tablePhase(table) == TablePhaseDone
+}
+
+func (rc *Client) saveCheckpoint(ctx context.Context) error {
+	cp, version := rc.checkpoint.snapshot(rc.backupMeta.GetEndVersion())
+	if cp == nil {
+		return nil
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("save restore checkpoint", zap.Int("files", len(cp.Files)), zap.Int("tables", len(cp.Tables)),
+		zap.Int("size", len(data)))
+	if err = rc.checkpoint.storage.Write(ctx, rc.checkpoint.key.fileName(), data); err != nil {
+		return errors.Trace(err)
+	}
+	rc.checkpoint.markSaved(version)
+	return nil
+}
+
+// StartCheckpointSaver saves the checkpoint periodically until the returned
+// function is called, which saves it for the last time. It does nothing if
+// the checkpoint isn't enabled.
+func (rc *Client) StartCheckpointSaver(ctx context.Context) func() {
+	if rc.checkpoint == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := rc.saveCheckpoint(ctx); err != nil {
+					log.Warn("failed to save restore checkpoint", zap.Error(err))
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+		if ctx.Err() != nil {
+			log.Warn("context canceled, saving restore checkpoint with background context")
+			ctx = context.Background()
+		}
+		if err := rc.saveCheckpoint(ctx); err != nil {
+			log.Warn("failed to save restore checkpoint", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/util/testleak"
+
+	"github.com/pingcap/br/pkg/gluetidb"
+	"github.com/pingcap/br/pkg/mock"
+	"github.com/pingcap/br/pkg/restore"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+var _ = Suite(&testCheckpointSuite{})
+
+type testCheckpointSuite struct {
+	mock *mock.Cluster
+}
+
+func (s *testCheckpointSuite) SetUpTest(c *C) {
+	var err error
+	s.mock, err = mock.NewCluster()
+	c.Assert(err, IsNil)
+	c.Assert(s.mock.Start(), IsNil)
+}
+
+func (s *testCheckpointSuite) TearDownTest(c *C) {
+	s.mock.Stop()
+	testleak.AfterTest(c)()
+}
+
+func (s *testCheckpointSuite) newClient(c *C, store storage.ExternalStorage, key restore.CheckpointKey) *restore.Client {
+	client, err := restore.NewRestoreClient(gluetidb.New(), s.mock.PDClient, s.mock.Storage, nil, defaultKeepaliveCfg)
+	c.Assert(err, IsNil)
+	meta := &backup.BackupMeta{EndVersion: 10, Ddls: []byte("[]")}
+	c.Assert(client.InitBackupMeta(meta, &backup.StorageBackend{}), IsNil)
+	client.EnableCheckpoint(store, key)
+	return client
+}
+
+func checkpointFiles(c *C, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), utils.RestoreCheckpointFile) {
+			names = append(names, info.Name())
+		}
+	}
+	return names
+}
+
+func (s *testCheckpointSuite) TestTablePhases(c *C) {
+	ctx := context.Background()
+	dir := c.MkDir()
+	store, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	key := restore.CheckpointKey{ClusterID: s.mock.PDClient.GetClusterID(ctx), Storage: "local:///backup"}
+	db := &model.DBInfo{Name: model.NewCIStr("test")}
+	t1 := &utils.Table{DB: db, Info: &model.TableInfo{Name: model.NewCIStr("t1")},
+		Files: []*backup.File{{Name: "1.sst"}, {Name: "2.sst"}}}
+	t2 := &utils.Table{DB: db, Info: &model.TableInfo{Name: model.NewCIStr("t2")},
+		Files: []*backup.File{{Name: "3.sst"}}}
+
+	client := s.newClient(c, store, key)
+	cp, err := client.LoadCheckpoint(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(cp, IsNil)
+	stopSaver := client.StartCheckpointSaver(ctx)
+	client.SetTablePhase(t1, restore.TablePhaseCreated)
+	client.SetTablePhase(t1, restore.TablePhaseIngested)
+	client.SetTablePhase(t1, restore.TablePhaseDone)
+	client.SetTablePhase(t2, restore.TablePhaseCreated)
+	stopSaver()
+
+	names := checkpointFiles(c, dir)
+	c.Assert(names, HasLen, 1)
+	data, err := store.Read(ctx, names[0])
+	c.Assert(err, IsNil)
+	cp = &restore.Checkpoint{}
+	c.Assert(json.Unmarshal(data, cp), IsNil)
+	c.Assert(cp.Key, DeepEquals, key)
+	c.Assert(cp.BackupTS, Equals, uint64(10))
+	c.Assert(cp.Tables, DeepEquals, map[string]restore.TableState{
+		"test.t1": {Phase: restore.TablePhaseDone, Files: 2},
+		"test.t2": {Phase: restore.TablePhaseCreated, Files: 1},
+	})
+
+	// The interrupted run has ingested a file of t2.
+	cp.Files = []string{"3.sst"}
+	data, err = json.Marshal(cp)
+	c.Assert(err, IsNil)
+	c.Assert(store.Write(ctx, names[0], data), IsNil)
+
+	client = s.newClient(c, store, key)
+	_, err = client.LoadCheckpoint(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(client.IsTableRestored(t1), IsTrue)
+	c.Assert(client.IsTableRestored(t2), IsFalse)
+	c.Assert(client.IsFileIngested(t2.Files[0]), IsTrue)
+	c.Assert(client.IsFileIngested(t1.Files[0]), IsFalse)
+	// The state of t1 is kept though it isn't restored by this run.
+	stopSaver = client.StartCheckpointSaver(ctx)
+	client.SetTablePhase(t2, restore.TablePhaseIngested)
+	stopSaver()
+	data, err = store.Read(ctx, names[0])
+	c.Assert(err, IsNil)
+	c.Assert(json.Unmarshal(data, cp), IsNil)
+	c.Assert(cp.Tables, DeepEquals, map[string]restore.TableState{
+		"test.t1": {Phase: restore.TablePhaseDone, Files: 2},
+		"test.t2": {Phase: restore.TablePhaseIngested, Files: 1, IngestedFiles: 1},
+	})
+
+	// The restore with other options doesn't share the checkpoint.
+	other := key
+	other.DBPrefix = "dr_"
+	cp, err = s.newClient(c, store, other).LoadCheckpoint(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(cp, IsNil)
+
+	// The checkpoint is removed once the restore succeeds, and isn't saved again.
+	stopSaver = client.StartCheckpointSaver(ctx)
+	client.SetTablePhase(t2, restore.TablePhaseDone)
+	c.Assert(client.RemoveCheckpoint(ctx), IsNil)
+	stopSaver()
+	c.Assert(checkpointFiles(c, dir), HasLen, 0)
+}
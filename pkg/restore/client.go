@@ -11,6 +11,8 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pingcap/errors"
@@ -39,6 +41,7 @@ import (
 	berrors "github.com/pingcap/br/pkg/errors"
 	"github.com/pingcap/br/pkg/glue"
 	"github.com/pingcap/br/pkg/logutil"
+	"github.com/pingcap/br/pkg/metautil"
 	"github.com/pingcap/br/pkg/storage"
 	"github.com/pingcap/br/pkg/summary"
 	"github.com/pingcap/br/pkg/utils"
@@ -56,6 +59,7 @@ type Client struct {
 	workerPool    *utils.WorkerPool
 	tlsConf       *tls.Config
 	keepaliveConf keepalive.ClientParameters
+	dialOpts      []grpc.DialOption
 
 	databases  map[string]*utils.Database
 	ddlJobs    []*model.Job
@@ -71,11 +75,24 @@ type Client struct {
 	// this probably isn't as easy as it seems like (however, not hard, too :D)
 	db              *DB
 	rateLimit       uint64
+	ingestLimiter   *utils.TokenBucket
+	timeline        *RegionTimeline
+	checkpoint      *checkpointer
 	isOnline        bool
 	noSchema        bool
+	speedLimitMu    sync.Mutex
 	hasSpeedLimited bool
 
 	restoreStores []uint64
+	// placementRules are the placement rules of the tables in the backup,
+	// which are re-created for the restored tables, see RestorePlacementRules.
+	placementRules  []placement.Rule
+	placementLabels PlacementLabelMap
+	// startKey and endKey restrict the restored keys, see SetKeyRange.
+	startKey []byte
+	endKey   []byte
+	// replaceTables are the existing tables to drop before creating them.
+	replaceTables map[*utils.Table]struct{}
 
 	storage            storage.ExternalStorage
 	backend            *backup.StorageBackend
@@ -129,6 +146,24 @@ func (rc *Client) SetRateLimit(rateLimit uint64) {
 	rc.rateLimit = rateLimit
 }
 
+// SetIngestLimiter sets the token bucket to pace the bytes ingested.
+func (rc *Client) SetIngestLimiter(limiter *utils.TokenBucket) {
+	rc.ingestLimiter = limiter
+}
+
+// SetKeyRange restricts the restored data to the keys in [startKey, endKey)
+// of the restored tables, the keys out of the range are left untouched.
+func (rc *Client) SetKeyRange(startKey, endKey []byte) {
+	rc.startKey = startKey
+	rc.endKey = endKey
+}
+
+// SetRegionTimeline sets the timeline to record the steps of restoring
+// every region, it must be set before InitBackupMeta.
+func (rc *Client) SetRegionTimeline(timeline *RegionTimeline) {
+	rc.timeline = timeline
+}
+
 // SetStorage set ExternalStorage for client.
 func (rc *Client) SetStorage(ctx context.Context, backend *backup.StorageBackend, sendCreds bool) error {
 	var err error
@@ -172,9 +207,54 @@ func (rc *Client) InitBackupMeta(backupMeta *backup.BackupMeta, backend *backup.
 			return errors.Trace(err)
 		}
 		rc.databases = databases
+	}
+	return rc.initBackupMeta(backupMeta, backend)
+}
+
+// InitBackupMetaReader is InitBackupMeta reading the files and schemas by the
+// reader, the shards of version 2 are read one at a time, so the backupmeta
+// isn't in memory at once. The root backupmeta of the reader is kept, the
+// files are only kept in the tables, except for the raw backup.
+func (rc *Client) InitBackupMetaReader(
+	ctx context.Context, reader *metautil.MetaReader, backend *backup.StorageBackend,
+) error {
+	backupMeta := reader.Meta()
+	if backupMeta.IsRawKv {
+		// The raw files are searched by the ranges to restore.
+		if reader.Version() == metautil.MetaV2 {
+			err := reader.WalkFiles(ctx, func(f *backup.File) error {
+				backupMeta.Files = append(backupMeta.Files, f)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return rc.initBackupMeta(backupMeta, backend)
+	}
+	if err := utils.CheckSchemaVersion(reader.Extension().SchemaVersion); err != nil {
+		return err
+	}
+	loader := utils.NewBackupTablesLoader()
+	err := reader.WalkFiles(ctx, func(f *backup.File) error {
+		loader.AddFiles(f)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = reader.WalkSchemas(ctx, loader.AddSchema); err != nil {
+		return err
+	}
+	loader.WarnUnknownFields()
+	rc.databases = loader.Databases()
+	return rc.initBackupMeta(backupMeta, backend)
+}
 
+func (rc *Client) initBackupMeta(backupMeta *backup.BackupMeta, backend *backup.StorageBackend) error {
+	if !backupMeta.IsRawKv {
 		var ddlJobs []*model.Job
-		err = json.Unmarshal(backupMeta.GetDdls(), &ddlJobs)
+		err := json.Unmarshal(backupMeta.GetDdls(), &ddlJobs)
 		if err != nil {
 			return errors.Trace(err)
 		}
@@ -183,9 +263,11 @@ func (rc *Client) InitBackupMeta(backupMeta *backup.BackupMeta, backend *backup.
 	rc.backupMeta = backupMeta
 	log.Info("load backupmeta", zap.Int("databases", len(rc.databases)), zap.Int("jobs", len(rc.ddlJobs)))
 
-	metaClient := NewSplitClient(rc.pdClient, rc.tlsConf)
-	importCli := NewImportClient(metaClient, rc.tlsConf, rc.keepaliveConf)
-	rc.fileImporter = NewFileImporter(metaClient, importCli, backend, rc.backupMeta.IsRawKv, rc.rateLimit)
+	metaClient := NewSplitClient(rc.pdClient, rc.tlsConf, rc.dialOpts...)
+	importCli := NewImportClient(metaClient, rc.tlsConf, rc.keepaliveConf, rc.dialOpts...)
+	rc.fileImporter = NewFileImporter(metaClient, importCli, backend, rc.backupMeta.IsRawKv)
+	rc.fileImporter.timeline = rc.timeline
+	rc.fileImporter.setKeyRange(rc.startKey, rc.endKey)
 
 	return nil
 }
@@ -263,6 +345,13 @@ func (rc *Client) GetTLSConfig() *tls.Config {
 	return rc.tlsConf
 }
 
+// SetDialOptions sets the extra options dialing TiKV, it must be called
+// before InitBackupMeta.
+func (rc *Client) SetDialOptions(opts []grpc.DialOption) {
+	rc.dialOpts = opts
+	rc.toolClient = NewSplitClient(rc.pdClient, rc.tlsConf, opts...)
+}
+
 // GetTS gets a new timestamp from PD.
 func (rc *Client) GetTS(ctx context.Context) (uint64, error) {
 	p, l, err := rc.pdClient.GetTS(ctx)
@@ -389,6 +478,16 @@ func (rc *Client) createTable(
 	if rc.IsSkipCreateSQL() {
 		log.Info("skip create table and alter autoIncID", zap.Stringer("table", table.Info.Name))
 	} else {
+		// TiFlash would sync the data while it's being ingested, the
+		// replicas are recovered after the restore by RecoverTiFlashReplicas.
+		table.Info.TiFlashReplica = nil
+		// The table is dropped as late as possible, so that it's kept if the
+		// restore fails before.
+		if _, ok := rc.replaceTables[table]; ok {
+			if err := db.DropTable(ctx, table); err != nil {
+				return CreatedTable{}, err
+			}
+		}
 		// don't use rc.ctx here...
 		// remove the ctx field of Client would be a great work,
 		// we just take a small step here :<
@@ -401,7 +500,11 @@ func (rc *Client) createTable(
 	if err != nil {
 		return CreatedTable{}, err
 	}
+	if err = CheckPartitions(newTableInfo, table.Info); err != nil {
+		return CreatedTable{}, err
+	}
 	rules := GetRewriteRules(newTableInfo, table.Info, newTS)
+	rc.SetTablePhase(table, TablePhaseCreated)
 	et := CreatedTable{
 		RewriteRule: rules,
 		Table:       newTableInfo,
@@ -449,10 +552,22 @@ func (rc *Client) GoCreateTables(
 		defer close(outCh)
 		defer log.Debug("all tables are created")
 		var err error
-		if len(dbPool) > 0 {
-			err = rc.createTablesWithDBPool(ctx, createOneTable, tables, dbPool)
-		} else {
-			err = rc.createTablesWithSoleDB(ctx, createOneTable, tables)
+		sequences, baseTables, views := SplitTablesByDependency(tables)
+		// The tables may use the sequences as their default values, so the
+		// sequences are created first.
+		for _, batch := range [][]*utils.Table{sequences, baseTables} {
+			if len(dbPool) > 0 {
+				err = rc.createTablesWithDBPool(ctx, createOneTable, batch, dbPool)
+			} else {
+				err = rc.createTablesWithSoleDB(ctx, createOneTable, batch)
+			}
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			// The views may depend on the tables and the other views.
+			err = rc.createTablesWithSoleDB(ctx, createOneTable, views)
 		}
 		if err != nil {
 			errCh <- err
@@ -461,6 +576,27 @@ func (rc *Client) GoCreateTables(
 	return outCh
 }
 
+// SplitTablesByDependency splits the sequences and the views out of the
+// tables, the views are sorted in the order they were created, so a view is
+// created after the views it depends on.
+func SplitTablesByDependency(tables []*utils.Table) (sequences, baseTables, views []*utils.Table) {
+	baseTables = make([]*utils.Table, 0, len(tables))
+	for _, t := range tables {
+		switch {
+		case t.Info.IsView():
+			views = append(views, t)
+		case t.Info.IsSequence():
+			sequences = append(sequences, t)
+		default:
+			baseTables = append(baseTables, t)
+		}
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Info.ID < views[j].Info.ID
+	})
+	return sequences, baseTables, views
+}
+
 func (rc *Client) createTablesWithSoleDB(ctx context.Context,
 	createOneTable func(ctx context.Context, db *DB, t *utils.Table) error,
 	tables []*utils.Table) error {
@@ -508,29 +644,123 @@ func (rc *Client) ExecDDLs(ctx context.Context, ddlJobs []*model.Job) error {
 }
 
 func (rc *Client) setSpeedLimit(ctx context.Context) error {
+	rc.speedLimitMu.Lock()
+	defer rc.speedLimitMu.Unlock()
 	if !rc.hasSpeedLimited && rc.rateLimit != 0 {
-		stores, err := conn.GetAllTiKVStores(ctx, rc.pdClient, conn.SkipTiFlash)
-		if err != nil {
+		if err := rc.setStoresSpeedLimit(ctx, rc.rateLimit); err != nil {
 			return err
 		}
-		for _, store := range stores {
-			err = rc.fileImporter.setDownloadSpeedLimit(ctx, store.GetId())
-			if err != nil {
-				return err
-			}
-		}
 		rc.hasSpeedLimited = true
 	}
 	return nil
 }
 
-// RestoreFiles tries to restore the files.
+// ResetSpeedLimit sets the download speed limit of the stores limited by the
+// restore to limit, TiKV keeps the limit of the restore until it's set again.
+// The stores not limited by the restore are left alone, zero means unlimited.
+func (rc *Client) ResetSpeedLimit(ctx context.Context, limit uint64) error {
+	rc.speedLimitMu.Lock()
+	defer rc.speedLimitMu.Unlock()
+	if !rc.hasSpeedLimited {
+		return nil
+	}
+	if err := rc.setStoresSpeedLimit(ctx, limit); err != nil {
+		return err
+	}
+	rc.hasSpeedLimited = false
+	return nil
+}
+
+func (rc *Client) setStoresSpeedLimit(ctx context.Context, limit uint64) error {
+	stores, err := conn.GetAllTiKVStores(ctx, rc.pdClient, conn.SkipTiFlash)
+	if err != nil {
+		return err
+	}
+	for _, store := range stores {
+		err = rc.fileImporter.setDownloadSpeedLimit(ctx, store.GetId(), limit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreFiles downloads and ingests the files.
 func (rc *Client) RestoreFiles(
 	ctx context.Context,
 	files []*backup.File,
 	rewriteRules *RewriteRules,
 	updateCh glue.Progress,
+) error {
+	downloaded, err := rc.DownloadFiles(ctx, files, rewriteRules)
+	if err != nil {
+		return err
+	}
+	return rc.IngestFiles(ctx, downloaded, updateCh)
+}
+
+// DownloadedFiles are the files downloaded into the regions by DownloadFiles,
+// which wait for being ingested by IngestFiles.
+type DownloadedFiles struct {
+	rewriteRules *RewriteRules
+	files        []*backup.File
+	// ssts are the ssts downloaded of the files by their indexes, the files
+	// ingested by the last run aren't downloaded.
+	ssts [][]downloadedSST
+}
+
+// DownloadFiles downloads the files into the regions covering them without
+// ingesting them, so the files of a batch can be downloaded while the files
+// of another batch are ingested.
+func (rc *Client) DownloadFiles(
+	ctx context.Context,
+	files []*backup.File,
+	rewriteRules *RewriteRules,
+) (*DownloadedFiles, error) {
+	start := time.Now()
+	log.Debug("start to download files",
+		zap.Int("files", len(files)),
+	)
+	if err := rc.setSpeedLimit(ctx); err != nil {
+		return nil, err
+	}
+	downloaded := &DownloadedFiles{
+		rewriteRules: rewriteRules,
+		files:        files,
+		ssts:         make([][]downloadedSST, len(files)),
+	}
+	eg, ectx := errgroup.WithContext(ctx)
+	for i, file := range files {
+		i, fileReplica := i, file
+		if rc.IsFileIngested(fileReplica) {
+			continue
+		}
+		rc.workerPool.ApplyOnErrorGroup(eg,
+			func() error {
+				ssts, err := rc.fileImporter.Download(ectx, fileReplica, rewriteRules)
+				if err != nil {
+					return err
+				}
+				downloaded.ssts[i] = ssts
+				return nil
+			})
+	}
+	if err := eg.Wait(); err != nil {
+		summary.CollectFailureUnit("file", err)
+		log.Error("download files failed", zap.Error(err))
+		return nil, err
+	}
+	log.Info("Download files", zap.Duration("take", time.Since(start)), logutil.Files(files))
+	return downloaded, nil
+}
+
+// IngestFiles ingests the files downloaded by DownloadFiles.
+func (rc *Client) IngestFiles(
+	ctx context.Context,
+	downloaded *DownloadedFiles,
+	updateCh glue.Progress,
 ) (err error) {
+	files := downloaded.files
 	start := time.Now()
 	defer func() {
 		elapsed := time.Since(start)
@@ -542,26 +772,34 @@ func (rc *Client) RestoreFiles(
 		}
 	}()
 
-	log.Debug("start to restore files",
-		zap.Int("files", len(files)),
-	)
 	eg, ectx := errgroup.WithContext(ctx)
-	err = rc.setSpeedLimit(ctx)
-	if err != nil {
-		return err
-	}
-
-	for _, file := range files {
-		fileReplica := file
+	for i, file := range files {
+		ssts, fileReplica := downloaded.ssts[i], file
+		if rc.IsFileIngested(fileReplica) {
+			log.Info("skip the file ingested by the last run", logutil.File(fileReplica))
+			updateCh.Inc()
+			continue
+		}
 		rc.workerPool.ApplyOnErrorGroup(eg,
 			func() error {
+				if rc.ingestLimiter != nil {
+					if err := rc.ingestLimiter.Wait(ectx, fileReplica.GetSize_()); err != nil {
+						return errors.Trace(err)
+					}
+				}
 				fileStart := time.Now()
 				defer func() {
 					log.Info("import file done", logutil.File(fileReplica),
 						zap.Duration("take", time.Since(fileStart)))
 					updateCh.Inc()
 				}()
-				return rc.fileImporter.Import(ectx, fileReplica, rewriteRules)
+				if err := rc.fileImporter.Ingest(ectx, fileReplica, downloaded.rewriteRules, ssts); err != nil {
+					return err
+				}
+				if rc.checkpoint != nil {
+					rc.checkpoint.put(fileReplica)
+				}
+				return nil
 			})
 	}
 	if err := eg.Wait(); err != nil {
@@ -583,8 +821,8 @@ func (rc *Client) RestoreRaw(
 	defer func() {
 		elapsed := time.Since(start)
 		log.Info("Restore Raw",
-			zap.String("startKey", hex.EncodeToString(startKey)),
-			zap.String("endKey", hex.EncodeToString(endKey)),
+			logutil.Key("startKey", startKey),
+			logutil.Key("endKey", endKey),
 			zap.Duration("take", elapsed))
 	}()
 	errCh := make(chan error, len(files))
@@ -595,6 +833,9 @@ func (rc *Client) RestoreRaw(
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if err = rc.setSpeedLimit(ctx); err != nil {
+		return err
+	}
 
 	for _, file := range files {
 		fileReplica := file
@@ -607,16 +848,16 @@ func (rc *Client) RestoreRaw(
 	if err := eg.Wait(); err != nil {
 		log.Error(
 			"restore raw range failed",
-			zap.String("startKey", hex.EncodeToString(startKey)),
-			zap.String("endKey", hex.EncodeToString(endKey)),
+			logutil.Key("startKey", startKey),
+			logutil.Key("endKey", endKey),
 			zap.Error(err),
 		)
 		return err
 	}
 	log.Info(
 		"finish to restore raw range",
-		zap.String("startKey", hex.EncodeToString(startKey)),
-		zap.String("endKey", hex.EncodeToString(endKey)),
+		logutil.Key("startKey", startKey),
+		logutil.Key("endKey", endKey),
 	)
 	return nil
 }
@@ -673,14 +914,13 @@ func (rc *Client) switchTiKVMode(ctx context.Context, mode import_sstpb.SwitchMo
 			opt = grpc.WithTransportCredentials(credentials.NewTLS(rc.tlsConf))
 		}
 		gctx, cancel := context.WithTimeout(ctx, time.Second*5)
-		conn, err := grpc.DialContext(
-			gctx,
-			store.GetAddress(),
+		opts := append([]grpc.DialOption{
 			opt,
 			grpc.WithConnectParams(grpc.ConnectParams{Backoff: bfConf}),
 			// we don't need to set keepalive timeout here, because the connection lives
 			// at most 5s. (shorter than minimal value for keepalive time!)
-		)
+		}, rc.dialOpts...)
+		conn, err := grpc.DialContext(gctx, store.GetAddress(), opts...)
 		cancel()
 		if err != nil {
 			return errors.Trace(err)
@@ -714,6 +954,10 @@ func (rc *Client) GoValidateChecksum(
 	log.Info("Start to validate checksum")
 	outCh := make(chan struct{}, 1)
 	workers := utils.NewWorkerPool(defaultChecksumConcurrency, "RestoreChecksum")
+	// The tables mismatched don't stop the checksum of the others, so all of
+	// them are reported.
+	var mismatchedMu sync.Mutex
+	mismatched := make([]string, 0)
 	go func() {
 		start := time.Now()
 		wg, ectx := errgroup.WithContext(ctx)
@@ -721,6 +965,10 @@ func (rc *Client) GoValidateChecksum(
 			log.Info("all checksum ended")
 			if err := wg.Wait(); err != nil {
 				errCh <- err
+			} else if len(mismatched) > 0 {
+				sort.Strings(mismatched)
+				errCh <- errors.Annotatef(berrors.ErrRestoreChecksumMismatch,
+					"%d tables mismatch: %s", len(mismatched), strings.Join(mismatched, ", "))
 			}
 			elapsed := time.Since(start)
 			summary.CollectDuration("restore checksum", elapsed)
@@ -738,9 +986,21 @@ func (rc *Client) GoValidateChecksum(
 					return
 				}
 				workers.ApplyOnErrorGroup(wg, func() error {
+					checksumStart := time.Now()
 					err := rc.execChecksum(ectx, tbl, kvClient, concurrency)
-					if err != nil {
+					rc.timeline.Record(TimelineEvent{
+						Table: utils.EncloseName(tbl.OldTable.DB.Name.O) + "." + utils.EncloseName(tbl.OldTable.Info.Name.O),
+						Step:  TimelineStepChecksum,
+					}, checksumStart, err)
+					if berrors.ErrRestoreChecksumMismatch.Equal(errors.Cause(err)) {
+						mismatchedMu.Lock()
+						mismatched = append(mismatched, utils.EncloseName(tbl.OldTable.DB.Name.O)+"."+
+							utils.EncloseName(tbl.OldTable.Info.Name.O))
+						mismatchedMu.Unlock()
+					} else if err != nil {
 						return err
+					} else {
+						rc.SetTablePhase(tbl.OldTable, TablePhaseDone)
 					}
 					updateCh.Inc()
 					return nil
@@ -792,7 +1052,8 @@ func (rc *Client) execChecksum(ctx context.Context, tbl CreatedTable, kvClient k
 			zap.Uint64("origin tidb total bytes", table.TotalBytes),
 			zap.Uint64("calculated total bytes", checksumResp.TotalBytes),
 		)
-		return errors.Annotate(berrors.ErrRestoreChecksumMismatch, "failed to validate checksum")
+		return errors.Annotatef(berrors.ErrRestoreChecksumMismatch, "failed to validate checksum of %s.%s",
+			table.DB.Name.O, table.Info.Name.O)
 	}
 	if table.Stats != nil {
 		log.Info("start loads analyze after validate checksum",
@@ -972,6 +1233,15 @@ func (rc *Client) EnableSkipCreateSQL() {
 	rc.noSchema = true
 }
 
+// SetReplaceTables sets the existing tables which are dropped right before
+// they are created.
+func (rc *Client) SetReplaceTables(tables []*utils.Table) {
+	rc.replaceTables = make(map[*utils.Table]struct{}, len(tables))
+	for _, table := range tables {
+		rc.replaceTables[table] = struct{}{}
+	}
+}
+
 // IsSkipCreateSQL returns whether we need skip create schema and tables in restore.
 func (rc *Client) IsSkipCreateSQL() bool {
 	return rc.noSchema
@@ -110,3 +110,44 @@ func (s *testRestoreClientSuite) TestIsOnline(c *C) {
 	client.EnableOnline()
 	c.Assert(client.IsOnline(), IsTrue)
 }
+
+func (s *testRestoreClientSuite) TestSplitTablesByDependency(c *C) {
+	newTable := func(id int64) *utils.Table {
+		return &utils.Table{Info: &model.TableInfo{ID: id}}
+	}
+	newSequence := func(id int64) *utils.Table {
+		t := newTable(id)
+		t.Info.Sequence = &model.SequenceInfo{}
+		return t
+	}
+	ids := func(tables []*utils.Table) []int64 {
+		res := make([]int64, 0, len(tables))
+		for _, t := range tables {
+			res = append(res, t.Info.ID)
+		}
+		return res
+	}
+
+	sequences, baseTables, views := restore.SplitTablesByDependency(
+		[]*utils.Table{newTable(3), newSequence(5), newTable(1), newSequence(2)})
+	c.Assert(ids(sequences), DeepEquals, []int64{5, 2})
+	c.Assert(ids(baseTables), DeepEquals, []int64{3, 1})
+	c.Assert(views, HasLen, 0)
+}
+
+func (s *testRestoreClientSuite) TestSplitTablesByDependencyOfViews(c *C) {
+	newView := func(id int64) *utils.Table {
+		return &utils.Table{Info: &model.TableInfo{ID: id, View: &model.ViewInfo{}}}
+	}
+	base := &utils.Table{Info: &model.TableInfo{ID: 1}}
+
+	// The views are sorted in the order they were created.
+	sequences, baseTables, views := restore.SplitTablesByDependency(
+		[]*utils.Table{newView(7), base, newView(3), newView(5)})
+	c.Assert(sequences, HasLen, 0)
+	c.Assert(baseTables, DeepEquals, []*utils.Table{base})
+	c.Assert(views, HasLen, 3)
+	for i, id := range []int64{3, 5, 7} {
+		c.Assert(views[i].Info.ID, Equals, id)
+	}
+}
@@ -96,6 +96,21 @@ func (db *DB) CreateDatabase(ctx context.Context, schema *model.DBInfo) error {
 	return errors.Trace(err)
 }
 
+// DropTable executes a DROP TABLE SQL.
+func (db *DB) DropTable(ctx context.Context, table *utils.Table) error {
+	query := fmt.Sprintf("DROP TABLE IF EXISTS %s.%s",
+		utils.EncloseName(table.DB.Name.O), utils.EncloseName(table.Info.Name.O))
+	log.Info("drop the existing table to replace it", zap.String("query", query))
+	err := db.se.Execute(ctx, query)
+	if err != nil {
+		log.Error("drop table failed",
+			zap.Stringer("db", table.DB.Name),
+			zap.Stringer("table", table.Info.Name),
+			zap.Error(err))
+	}
+	return errors.Trace(err)
+}
+
 // CreateTable executes a CREATE TABLE SQL.
 func (db *DB) CreateTable(ctx context.Context, table *utils.Table) error {
 	err := db.se.CreateTable(ctx, table.DB.Name, table.Info)
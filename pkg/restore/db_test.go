@@ -117,6 +117,9 @@ func (s *testRestoreSchemaSuite) TestFilterDDLJobs(c *C) {
 	c.Assert(err, IsNil, Commentf("Error get ts: %s", err))
 	allDDLJobs, err := backup.GetBackupDDLJobs(s.mock.Domain, lastTS, ts)
 	c.Assert(err, IsNil, Commentf("Error get ddl jobs: %s", err))
+	for i := 1; i < len(allDDLJobs); i++ {
+		c.Assert(allDDLJobs[i-1].BinlogInfo.SchemaVersion, Less, allDDLJobs[i].BinlogInfo.SchemaVersion)
+	}
 	infoSchema, err := s.mock.Domain.GetSnapshotInfoSchema(ts)
 	c.Assert(err, IsNil, Commentf("Error get snapshot info schema: %s", err))
 	dbInfo, ok := infoSchema.SchemaByName(model.NewCIStr("test_db"))
@@ -14,6 +14,7 @@ import (
 	"github.com/pingcap/kvproto/pkg/backup"
 	"github.com/pingcap/kvproto/pkg/import_sstpb"
 	"github.com/pingcap/kvproto/pkg/kvrpcpb"
+	"github.com/pingcap/kvproto/pkg/metapb"
 	"github.com/pingcap/log"
 	"github.com/tikv/pd/pkg/codec"
 	"go.uber.org/multierr"
@@ -33,6 +34,9 @@ const (
 	importScanRegionTime      = 10 * time.Second
 	scanRegionPaginationLimit = int(128)
 	gRPCBackOffMaxDelay       = 3 * time.Second
+	// ingestNotLeaderRetryTimes is the times to follow the new leader of a
+	// region, the region is refreshed from PD after that.
+	ingestNotLeaderRetryTimes = 3
 )
 
 // ImporterClient is used to import a file to TiKV.
@@ -66,16 +70,24 @@ type importClient struct {
 	metaClient SplitClient
 	clients    map[uint64]import_sstpb.ImportSSTClient
 	tlsConf    *tls.Config
+	dialOpts   []grpc.DialOption
 
 	keepaliveConf keepalive.ClientParameters
 }
 
-// NewImportClient returns a new ImporterClient.
-func NewImportClient(metaClient SplitClient, tlsConf *tls.Config, keepaliveConf keepalive.ClientParameters) ImporterClient {
+// NewImportClient returns a new ImporterClient, dialOpts are appended to
+// the options dialing TiKV.
+func NewImportClient(
+	metaClient SplitClient,
+	tlsConf *tls.Config,
+	keepaliveConf keepalive.ClientParameters,
+	dialOpts ...grpc.DialOption,
+) ImporterClient {
 	return &importClient{
 		metaClient:    metaClient,
 		clients:       make(map[uint64]import_sstpb.ImportSSTClient),
 		tlsConf:       tlsConf,
+		dialOpts:      dialOpts,
 		keepaliveConf: keepaliveConf,
 	}
 }
@@ -140,13 +152,12 @@ func (ic *importClient) GetImportClient(
 	}
 	bfConf := backoff.DefaultConfig
 	bfConf.MaxDelay = gRPCBackOffMaxDelay
-	conn, err := grpc.DialContext(
-		ctx,
-		addr,
+	opts := append([]grpc.DialOption{
 		opt,
 		grpc.WithConnectParams(grpc.ConnectParams{Backoff: bfConf}),
 		grpc.WithKeepaliveParams(ic.keepaliveConf),
-	)
+	}, ic.dialOpts...)
+	conn, err := grpc.DialContext(ctx, addr, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -160,11 +171,16 @@ type FileImporter struct {
 	metaClient   SplitClient
 	importClient ImporterClient
 	backend      *backup.StorageBackend
-	rateLimit    uint64
 
 	isRawKvMode bool
 	rawStartKey []byte
 	rawEndKey   []byte
+
+	timeline *RegionTimeline
+	// startKey and endKey are the encoded range of the keys to restore in
+	// txn kv mode, the empty keys mean unbounded.
+	startKey []byte
+	endKey   []byte
 }
 
 // NewFileImporter returns a new file importClient.
@@ -173,14 +189,23 @@ func NewFileImporter(
 	importClient ImporterClient,
 	backend *backup.StorageBackend,
 	isRawKvMode bool,
-	rateLimit uint64,
 ) FileImporter {
 	return FileImporter{
 		metaClient:   metaClient,
 		backend:      backend,
 		importClient: importClient,
 		isRawKvMode:  isRawKvMode,
-		rateLimit:    rateLimit,
+	}
+}
+
+// setKeyRange sets the range of the rewritten keys to be restored in txn kv
+// mode.
+func (importer *FileImporter) setKeyRange(startKey, endKey []byte) {
+	if len(startKey) > 0 {
+		importer.startKey = codec.EncodeBytes(startKey)
+	}
+	if len(endKey) > 0 {
+		importer.endKey = codec.EncodeBytes(endKey)
 	}
 }
 
@@ -202,9 +227,116 @@ func (importer *FileImporter) Import(
 	rewriteRules *RewriteRules,
 ) error {
 	log.Debug("import file", logutil.File(file))
+	startKey, endKey, ok, err := importer.fileKeyRange(file, rewriteRules)
+	if err != nil || !ok {
+		return err
+	}
+
+	// The regions before scanStartKey are imported, they aren't imported
+	// again when the regions are changed by split, merge or leader transfer.
+	scanStartKey := startKey
+	err = utils.WithRetry(ctx, func() error {
+		regionInfos, errScan := importer.scanRegions(ctx, file, scanStartKey, endKey)
+		if errScan != nil {
+			return errScan
+		}
+		// Try to download and ingest the file in every region
+		for _, info := range regionInfos {
+			if !importer.isRawKvMode {
+				if errSplit := importer.splitMergedRegion(ctx, info, startKey, rewriteRules); errSplit != nil {
+					return errSplit
+				}
+			}
+			downloadMeta, errDownload := importer.downloadRegion(ctx, file, info, rewriteRules)
+			if errDownload != nil {
+				return errDownload
+			}
+			if downloadMeta != nil {
+				if errIngest := importer.ingestRegion(ctx, file, info, downloadMeta); errIngest != nil {
+					return errIngest
+				}
+			}
+			scanStartKey = nextScanStartKey(scanStartKey, info)
+		}
+		summary.CollectSuccessUnit(summary.TotalKV, 1, file.TotalKvs)
+		summary.CollectSuccessUnit(summary.TotalBytes, 1, file.TotalBytes)
+		return nil
+	}, newImportSSTBackoffer())
+	return err
+}
+
+// downloadedSST is an sst downloaded into a region, which waits for being
+// ingested.
+type downloadedSST struct {
+	region *RegionInfo
+	meta   *import_sstpb.SSTMeta
+}
+
+// Download downloads the file into the regions covering it without ingesting
+// it, so the file can be ingested by Ingest later.
+func (importer *FileImporter) Download(
+	ctx context.Context,
+	file *backup.File,
+	rewriteRules *RewriteRules,
+) ([]downloadedSST, error) {
+	log.Debug("download file", logutil.File(file))
+	startKey, endKey, ok, err := importer.fileKeyRange(file, rewriteRules)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var ssts []downloadedSST
+	err = utils.WithRetry(ctx, func() error {
+		ssts = ssts[:0]
+		regionInfos, errScan := importer.scanRegions(ctx, file, startKey, endKey)
+		if errScan != nil {
+			return errScan
+		}
+		for _, info := range regionInfos {
+			if !importer.isRawKvMode {
+				if errSplit := importer.splitMergedRegion(ctx, info, startKey, rewriteRules); errSplit != nil {
+					return errSplit
+				}
+			}
+			downloadMeta, errDownload := importer.downloadRegion(ctx, file, info, rewriteRules)
+			if errDownload != nil {
+				return errDownload
+			}
+			if downloadMeta != nil {
+				ssts = append(ssts, downloadedSST{region: info, meta: downloadMeta})
+			}
+		}
+		return nil
+	}, newImportSSTBackoffer())
+	return ssts, err
+}
+
+// Ingest ingests the ssts of the file downloaded by Download. If the regions
+// are changed since the ssts are downloaded, the file is imported again.
+func (importer *FileImporter) Ingest(
+	ctx context.Context,
+	file *backup.File,
+	rewriteRules *RewriteRules,
+	ssts []downloadedSST,
+) error {
+	for _, sst := range ssts {
+		if err := importer.ingestRegion(ctx, file, sst.region, sst.meta); err != nil {
+			log.Warn("ingest the downloaded file failed, import it again",
+				logutil.File(file), logutil.ShortError(err))
+			return importer.Import(ctx, file, rewriteRules)
+		}
+	}
+	summary.CollectSuccessUnit(summary.TotalKV, 1, file.TotalKvs)
+	summary.CollectSuccessUnit(summary.TotalBytes, 1, file.TotalBytes)
+	return nil
+}
+
+// fileKeyRange returns the range of the regions to import the file into, it
+// returns false if the file is out of the range to restore.
+func (importer *FileImporter) fileKeyRange(
+	file *backup.File,
+	rewriteRules *RewriteRules,
+) (startKey, endKey []byte, ok bool, err error) {
 	// Rewrite the start key and end key of file to scan regions
-	var startKey, endKey []byte
-	var err error
 	if importer.isRawKvMode {
 		startKey = file.StartKey
 		endKey = file.EndKey
@@ -216,137 +348,247 @@ func (importer *FileImporter) Import(
 		// endKey = truncateRowKey(endKey)
 	}
 	if err != nil {
-		return err
+		return nil, nil, false, err
+	}
+	if !importer.isRawKvMode && (len(importer.startKey) > 0 || len(importer.endKey) > 0) {
+		// Only scan the regions in the range to restore.
+		if bytes.Compare(importer.startKey, startKey) > 0 {
+			startKey = importer.startKey
+		}
+		if len(importer.endKey) > 0 && bytes.Compare(importer.endKey, endKey) < 0 {
+			endKey = importer.endKey
+		}
+		if bytes.Compare(startKey, endKey) >= 0 {
+			log.Debug("skip the file out of the key range", logutil.File(file))
+			return nil, nil, false, nil
+		}
 	}
 	log.Debug("rewrite file keys",
 		logutil.File(file),
 		zap.Stringer("startKey", logutil.WrapKey(startKey)),
 		zap.Stringer("endKey", logutil.WrapKey(endKey)))
+	return startKey, endKey, true, nil
+}
 
-	err = utils.WithRetry(ctx, func() error {
-		tctx, cancel := context.WithTimeout(ctx, importScanRegionTime)
-		defer cancel()
-		// Scan regions covered by the file range
-		regionInfos, errScanRegion := PaginateScanRegion(
-			tctx, importer.metaClient, startKey, endKey, scanRegionPaginationLimit)
-		if errScanRegion != nil {
-			return errors.Trace(errScanRegion)
+// scanRegions scans the regions covered by the range of the file.
+func (importer *FileImporter) scanRegions(
+	ctx context.Context,
+	file *backup.File,
+	startKey, endKey []byte,
+) ([]*RegionInfo, error) {
+	tctx, cancel := context.WithTimeout(ctx, importScanRegionTime)
+	defer cancel()
+	regionInfos, err := PaginateScanRegion(
+		tctx, importer.metaClient, startKey, endKey, scanRegionPaginationLimit)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	log.Debug("scan regions", logutil.File(file), zap.Int("count", len(regionInfos)))
+	return regionInfos, nil
+}
+
+// downloadRegion downloads the file into the region, it returns nil if the
+// region doesn't need the file.
+func (importer *FileImporter) downloadRegion(
+	ctx context.Context,
+	file *backup.File,
+	info *RegionInfo,
+	rewriteRules *RewriteRules,
+) (*import_sstpb.SSTMeta, error) {
+	var downloadMeta *import_sstpb.SSTMeta
+	downloadStart, downloadAttempts := time.Now(), 0
+	errDownload := utils.WithRetry(ctx, func() error {
+		downloadAttempts++
+		var e error
+		if importer.isRawKvMode {
+			downloadMeta, e = importer.downloadRawKVSST(ctx, info, file)
+		} else {
+			downloadMeta, e = importer.downloadSST(ctx, info, file, rewriteRules)
+		}
+		return e
+	}, newDownloadSSTBackoffer())
+	importer.timeline.Record(TimelineEvent{
+		RegionID: info.Region.GetId(),
+		StoreID:  info.Leader.GetStoreId(),
+		File:     file.GetName(),
+		Step:     TimelineStepDownload,
+		Retries:  downloadAttempts - 1,
+	}, downloadStart, errDownload)
+	if errDownload == nil {
+		return downloadMeta, nil
+	}
+	for _, e := range multierr.Errors(errDownload) {
+		switch errors.Cause(e) {
+		case berrors.ErrKVRewriteRuleNotFound, berrors.ErrKVRangeIsEmpty:
+			// Skip this region
+			log.Warn("download file skipped",
+				logutil.File(file),
+				logutil.Region(info.Region),
+				logutil.ShortError(e))
+			return nil, nil
 		}
+	}
+	log.Error("download file failed",
+		logutil.File(file),
+		logutil.Region(info.Region),
+		logutil.ShortError(errDownload))
+	return nil, errDownload
+}
 
-		log.Debug("scan regions", logutil.File(file), zap.Int("count", len(regionInfos)))
-		// Try to download and ingest the file in every region
-	regionLoop:
-		for _, regionInfo := range regionInfos {
-			info := regionInfo
-			// Try to download file.
-			var downloadMeta *import_sstpb.SSTMeta
-			errDownload := utils.WithRetry(ctx, func() error {
-				var e error
-				if importer.isRawKvMode {
-					downloadMeta, e = importer.downloadRawKVSST(ctx, info, file)
-				} else {
-					downloadMeta, e = importer.downloadSST(ctx, info, file, rewriteRules)
-				}
-				return e
-			}, newDownloadSSTBackoffer())
-			if errDownload != nil {
-				for _, e := range multierr.Errors(errDownload) {
-					switch errors.Cause(e) {
-					case berrors.ErrKVRewriteRuleNotFound, berrors.ErrKVRangeIsEmpty:
-						// Skip this region
-						log.Warn("download file skipped",
-							logutil.File(file),
-							logutil.Region(info.Region),
-							zap.Stringer("startKey", logutil.WrapKey(startKey)),
-							zap.Stringer("endKey", logutil.WrapKey(endKey)),
-							logutil.ShortError(e))
-						continue regionLoop
-					}
-				}
-				log.Error("download file failed",
-					logutil.File(file),
-					logutil.Region(info.Region),
-					zap.Stringer("startKey", logutil.WrapKey(startKey)),
-					zap.Stringer("endKey", logutil.WrapKey(endKey)),
-					logutil.ShortError(errDownload))
-				return errDownload
+// ingestRegion ingests the sst downloaded into the region, the NotLeader
+// errors are retried with the new leader.
+func (importer *FileImporter) ingestRegion(
+	ctx context.Context,
+	file *backup.File,
+	info *RegionInfo,
+	downloadMeta *import_sstpb.SSTMeta,
+) error {
+	ingestStart, ingestRetries := time.Now(), 0
+	ingestResp, errIngest := importer.ingestSST(ctx, downloadMeta, info)
+ingestRetry:
+	for errIngest == nil {
+		errPb := ingestResp.GetError()
+		if errPb == nil {
+			// Ingest success
+			break ingestRetry
+		}
+		switch {
+		case errPb.NotLeader != nil:
+			// If error is `NotLeader`, update the region info and retry
+			var newInfo *RegionInfo
+			newInfo, errIngest = importer.newLeaderInfo(ctx, info, errPb.GetNotLeader().GetLeader())
+			if errIngest != nil {
+				break ingestRetry
 			}
+			log.Debug("ingest sst returns not leader error, retry it",
+				logutil.Region(info.Region),
+				zap.Stringer("newLeader", newInfo.Leader))
 
-			ingestResp, errIngest := importer.ingestSST(ctx, downloadMeta, info)
-		ingestRetry:
-			for errIngest == nil {
-				errPb := ingestResp.GetError()
-				if errPb == nil {
-					// Ingest success
-					break ingestRetry
-				}
-				switch {
-				case errPb.NotLeader != nil:
-					// If error is `NotLeader`, update the region info and retry
-					var newInfo *RegionInfo
-					if newLeader := errPb.GetNotLeader().GetLeader(); newLeader != nil {
-						newInfo = &RegionInfo{
-							Leader: newLeader,
-							Region: info.Region,
-						}
-					} else {
-						// Slow path, get region from PD
-						newInfo, errIngest = importer.metaClient.GetRegion(
-							ctx, info.Region.GetStartKey())
-						if errIngest != nil {
-							break ingestRetry
-						}
-						// do not get region info, wait a second and continue
-						if newInfo == nil {
-							log.Warn("get region by key return nil", zap.Reflect("region", info.Region))
-							time.Sleep(time.Second)
-							continue
-						}
-					}
-					log.Debug("ingest sst returns not leader error, retry it",
-						logutil.Region(info.Region),
-						zap.Stringer("newLeader", newInfo.Leader))
-
-					if !checkRegionEpoch(newInfo, info) {
-						errIngest = errors.Trace(berrors.ErrKVEpochNotMatch)
-						break ingestRetry
-					}
-					ingestResp, errIngest = importer.ingestSST(ctx, downloadMeta, newInfo)
-				case errPb.EpochNotMatch != nil:
-					// TODO handle epoch not match error
-					//      1. retry download if needed
-					//      2. retry ingest
-					errIngest = errors.Trace(berrors.ErrKVEpochNotMatch)
-					break ingestRetry
-				case errPb.KeyNotInRegion != nil:
-					errIngest = errors.Trace(berrors.ErrKVKeyNotInRegion)
-					break ingestRetry
-				default:
-					// Other errors like `ServerIsBusy`, `RegionNotFound`, etc. should be retryable
-					errIngest = errors.Annotatef(berrors.ErrKVIngestFailed, "ingest error %s", errPb)
-					break ingestRetry
-				}
+			if !checkRegionEpoch(newInfo, info) {
+				errIngest = errors.Trace(berrors.ErrKVEpochNotMatch)
+				break ingestRetry
 			}
-
-			if errIngest != nil {
-				log.Error("ingest file failed",
-					logutil.File(file),
-					zap.Stringer("range", downloadMeta.GetRange()),
-					logutil.Region(info.Region),
-					zap.Error(errIngest))
-				return errIngest
+			if ingestRetries >= ingestNotLeaderRetryTimes {
+				errIngest = errors.Annotatef(berrors.ErrKVNotLeader, "region %d", info.Region.GetId())
+				break ingestRetry
 			}
+			ingestRetries++
+			ingestResp, errIngest = importer.ingestSST(ctx, downloadMeta, newInfo)
+		case errPb.EpochNotMatch != nil:
+			// The region is split or merged, the sst is downloaded
+			// for the old epoch, so it's downloaded again for the
+			// regions scanned again from PD.
+			log.Info("ingest sst returns epoch not match error, retry it",
+				logutil.Region(info.Region),
+				zap.Int("current regions", len(errPb.GetEpochNotMatch().GetCurrentRegions())))
+			errIngest = errors.Trace(berrors.ErrKVEpochNotMatch)
+			break ingestRetry
+		case errPb.KeyNotInRegion != nil:
+			// Same as above, the region doesn't cover the sst anymore.
+			errIngest = errors.Trace(berrors.ErrKVKeyNotInRegion)
+			break ingestRetry
+		default:
+			// Other errors like `ServerIsBusy`, `RegionNotFound`, etc. should be retryable
+			errIngest = errors.Annotatef(berrors.ErrKVIngestFailed, "ingest error %s", errPb)
+			break ingestRetry
 		}
-		summary.CollectSuccessUnit(summary.TotalKV, 1, file.TotalKvs)
-		summary.CollectSuccessUnit(summary.TotalBytes, 1, file.TotalBytes)
+	}
+
+	importer.timeline.Record(TimelineEvent{
+		RegionID: info.Region.GetId(),
+		StoreID:  info.Leader.GetStoreId(),
+		File:     file.GetName(),
+		Step:     TimelineStepIngest,
+		Retries:  ingestRetries,
+	}, ingestStart, errIngest)
+	if errIngest != nil {
+		log.Error("ingest file failed",
+			logutil.File(file),
+			logutil.Key("startKey", downloadMeta.GetRange().GetStart()),
+			logutil.Key("endKey", downloadMeta.GetRange().GetEnd()),
+			logutil.Region(info.Region),
+			zap.Error(errIngest))
+		return errIngest
+	}
+	return nil
+}
+
+// newLeaderInfo returns the region with the new leader, the region is got
+// from PD if the new leader is unknown.
+func (importer *FileImporter) newLeaderInfo(
+	ctx context.Context,
+	info *RegionInfo,
+	newLeader *metapb.Peer,
+) (*RegionInfo, error) {
+	if newLeader != nil {
+		return &RegionInfo{
+			Leader: newLeader,
+			Region: info.Region,
+		}, nil
+	}
+	// Slow path, get region from PD
+	newInfo, err := importer.metaClient.GetRegion(ctx, info.Region.GetStartKey())
+	if err != nil {
+		return nil, err
+	}
+	// The region may be merged, scan the regions again.
+	if newInfo == nil {
+		log.Warn("get region by key return nil", logutil.Region(info.Region))
+		return nil, errors.Annotatef(berrors.ErrKVNotLeader, "region %d not found", info.Region.GetId())
+	}
+	return newInfo, nil
+}
+
+// nextScanStartKey returns the key to scan the regions from after the region
+// is imported.
+func nextScanStartKey(scanStartKey []byte, info *RegionInfo) []byte {
+	endKey := info.Region.GetEndKey()
+	if len(endKey) == 0 || bytes.Compare(endKey, scanStartKey) <= 0 {
+		return scanStartKey
+	}
+	return endKey
+}
+
+// splitMergedRegion splits the region at the start key of the file, if the
+// region is merged with the one before the file after splitting and it can't
+// be rewritten by the rule matching the start key of the region. Otherwise
+// the file would be downloaded with the wrong rewrite rule or skipped.
+func (importer *FileImporter) splitMergedRegion(
+	ctx context.Context,
+	info *RegionInfo,
+	startKey []byte,
+	rewriteRules *RewriteRules,
+) error {
+	if bytes.Compare(info.Region.GetStartKey(), startKey) >= 0 {
 		return nil
-	}, newImportSSTBackoffer())
-	return err
+	}
+	_, fileKey, err := codec.DecodeBytes(startKey)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(info.Region.GetStartKey()) > 0 {
+		_, regionKey, err2 := codec.DecodeBytes(info.Region.GetStartKey())
+		if err2 != nil {
+			return errors.Trace(err2)
+		}
+		if rule := matchNewPrefix(regionKey, rewriteRules); rule != nil &&
+			bytes.HasPrefix(fileKey, rule.GetNewKeyPrefix()) {
+			return nil
+		}
+	}
+	log.Info("split the region merged after splitting",
+		logutil.Region(info.Region), zap.Stringer("key", logutil.WrapKey(startKey)))
+	if _, err = importer.metaClient.SplitRegion(ctx, info, fileKey); err != nil {
+		// The region may be changed again, retry it with the new one.
+		return errors.Annotatef(berrors.ErrKVEpochNotMatch, "split region %d failed: %v", info.Region.GetId(), err)
+	}
+	// Scan the split regions again.
+	return errors.Annotatef(berrors.ErrKVEpochNotMatch, "region %d is split", info.Region.GetId())
 }
 
-func (importer *FileImporter) setDownloadSpeedLimit(ctx context.Context, storeID uint64) error {
+func (importer *FileImporter) setDownloadSpeedLimit(ctx context.Context, storeID, rateLimit uint64) error {
 	req := &import_sstpb.SetDownloadSpeedLimitRequest{
-		SpeedLimit: importer.rateLimit,
+		SpeedLimit: rateLimit,
 	}
 	_, err := importer.importClient.SetDownloadSpeedLimit(ctx, storeID, req)
 	return err
@@ -375,6 +617,18 @@ func (importer *FileImporter) downloadSST(
 	}
 	sstMeta := GetSSTMetaFromFile(id, file, regionInfo.Region, &rule)
 
+	// Cut the SST file's range to fit in the restoring range.
+	if bytes.Compare(importer.startKey, sstMeta.Range.GetStart()) > 0 {
+		sstMeta.Range.Start = importer.startKey
+	}
+	if len(importer.endKey) > 0 && bytes.Compare(importer.endKey, sstMeta.Range.GetEnd()) <= 0 {
+		sstMeta.Range.End = importer.endKey
+		sstMeta.EndKeyExclusive = true
+	}
+	if bytes.Compare(sstMeta.Range.GetStart(), sstMeta.Range.GetEnd()) > 0 {
+		return nil, errors.Trace(berrors.ErrKVRangeIsEmpty)
+	}
+
 	req := &import_sstpb.DownloadRequest{
 		Sst:            sstMeta,
 		StorageBackend: importer.backend,
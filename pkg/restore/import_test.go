@@ -0,0 +1,234 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/kvproto/pkg/errorpb"
+	"github.com/pingcap/kvproto/pkg/import_sstpb"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/util/codec"
+
+	"github.com/pingcap/br/pkg/restore"
+)
+
+type testImportSuite struct{}
+
+var _ = Suite(&testImportSuite{})
+
+// regionsClient is a SplitClient of the regions sorted by their keys.
+type regionsClient struct {
+	restore.SplitClient
+
+	mu      sync.Mutex
+	regions []*restore.RegionInfo
+	nextID  uint64
+	splits  [][]byte
+}
+
+func newRegionsClient(keys ...[]byte) *regionsClient {
+	client := &regionsClient{nextID: 1}
+	for i := 0; i+1 < len(keys); i++ {
+		client.regions = append(client.regions, client.newRegion(keys[i], keys[i+1], 1))
+	}
+	return client
+}
+
+func (c *regionsClient) newRegion(start, end []byte, version uint64) *restore.RegionInfo {
+	peers := []*metapb.Peer{{Id: c.nextID*10 + 1, StoreId: 1}, {Id: c.nextID*10 + 2, StoreId: 2}}
+	region := &restore.RegionInfo{
+		Region: &metapb.Region{
+			Id:          c.nextID,
+			StartKey:    start,
+			EndKey:      end,
+			RegionEpoch: &metapb.RegionEpoch{Version: version, ConfVer: 1},
+			Peers:       peers,
+		},
+		Leader: peers[0],
+	}
+	c.nextID++
+	return region
+}
+
+func (c *regionsClient) ScanRegions(_ context.Context, key, endKey []byte, limit int) ([]*restore.RegionInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var regions []*restore.RegionInfo
+	for _, r := range c.regions {
+		if (len(endKey) == 0 || bytes.Compare(r.Region.StartKey, endKey) < 0) &&
+			(len(r.Region.EndKey) == 0 || bytes.Compare(r.Region.EndKey, key) > 0) && len(regions) < limit {
+			regions = append(regions, r)
+		}
+	}
+	return regions, nil
+}
+
+func (c *regionsClient) GetRegion(_ context.Context, key []byte) (*restore.RegionInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range c.regions {
+		if r.ContainsInterior(key) || bytes.Equal(r.Region.StartKey, key) {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *regionsClient) SplitRegion(_ context.Context, _ *restore.RegionInfo, key []byte) (*restore.RegionInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	splitKey := codec.EncodeBytes(nil, key)
+	c.splits = append(c.splits, key)
+	for i, r := range c.regions {
+		if !r.ContainsInterior(splitKey) {
+			continue
+		}
+		version := r.Region.RegionEpoch.Version + 1
+		left := c.newRegion(r.Region.StartKey, splitKey, version)
+		right := c.newRegion(splitKey, r.Region.EndKey, version)
+		c.regions = append(c.regions[:i], append([]*restore.RegionInfo{left, right}, c.regions[i+1:]...)...)
+		return left, nil
+	}
+	return nil, errors.New("region not found")
+}
+
+// regionImporter downloads the files into the regions, the ingests return
+// the errors in order.
+type regionImporter struct {
+	restore.ImporterClient
+
+	mu         sync.Mutex
+	downloads  []uint64
+	rules      []import_sstpb.RewriteRule
+	ingests    []uint64
+	ingestErrs []*errorpb.Error
+}
+
+func (i *regionImporter) DownloadSST(
+	_ context.Context, storeID uint64, req *import_sstpb.DownloadRequest,
+) (*import_sstpb.DownloadResponse, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	// Each region is downloaded into all its peers, the first one is on store 1.
+	if storeID == 1 {
+		i.downloads = append(i.downloads, req.Sst.RegionId)
+		i.rules = append(i.rules, req.RewriteRule)
+	}
+	return &import_sstpb.DownloadResponse{Range: *req.Sst.Range}, nil
+}
+
+func (i *regionImporter) IngestSST(
+	_ context.Context, _ uint64, req *import_sstpb.IngestRequest,
+) (*import_sstpb.IngestResponse, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.ingests = append(i.ingests, req.Sst.RegionId)
+	resp := &import_sstpb.IngestResponse{}
+	if len(i.ingestErrs) > 0 {
+		resp.Error, i.ingestErrs = i.ingestErrs[0], i.ingestErrs[1:]
+	}
+	return resp, nil
+}
+
+func rowKey(tableID, handle int64) []byte {
+	return append(tablecodec.GenTableRecordPrefix(tableID), codec.EncodeInt(nil, handle)...)
+}
+
+func encoded(key []byte) []byte {
+	return codec.EncodeBytes(nil, key)
+}
+
+// importRules rewrite table 1 into table 2.
+func importRules() *restore.RewriteRules {
+	return &restore.RewriteRules{
+		Table: []*import_sstpb.RewriteRule{{
+			OldKeyPrefix: tablecodec.EncodeTablePrefix(1),
+			NewKeyPrefix: tablecodec.EncodeTablePrefix(2),
+		}},
+		Data: []*import_sstpb.RewriteRule{{
+			OldKeyPrefix: tablecodec.GenTableRecordPrefix(1),
+			NewKeyPrefix: tablecodec.GenTableRecordPrefix(2),
+		}},
+	}
+}
+
+func importFile() *backup.File {
+	return &backup.File{Name: "1_write.sst", StartKey: rowKey(1, 10), EndKey: rowKey(1, 100)}
+}
+
+func (s *testImportSuite) TestImportFirstFileOfTable(c *C) {
+	ctx := context.Background()
+	// The regions are split at the prefixes of the table and its records,
+	// the region holding the first file starts before it.
+	client := newRegionsClient(nil, encoded(tablecodec.EncodeTablePrefix(2)),
+		encoded(tablecodec.GenTableRecordPrefix(2)), encoded(rowKey(2, 50)), nil)
+	importer := &regionImporter{}
+	fileImporter := restore.NewFileImporter(client, importer, &backup.StorageBackend{}, false)
+	c.Assert(fileImporter.Import(ctx, importFile(), importRules()), IsNil)
+	c.Assert(client.splits, HasLen, 0)
+	c.Assert(importer.downloads, DeepEquals, []uint64{3, 4})
+
+	// The empty region of the table prefix is merged, the region starting
+	// at the prefix of the table is rewritten by the rule of the table.
+	client = newRegionsClient(nil, encoded(tablecodec.EncodeTablePrefix(2)), encoded(rowKey(2, 50)), nil)
+	importer = &regionImporter{}
+	fileImporter = restore.NewFileImporter(client, importer, &backup.StorageBackend{}, false)
+	c.Assert(fileImporter.Import(ctx, importFile(), importRules()), IsNil)
+	c.Assert(client.splits, HasLen, 0)
+	c.Assert(importer.downloads, DeepEquals, []uint64{2, 3})
+}
+
+func (s *testImportSuite) TestImportMergedRegion(c *C) {
+	ctx := context.Background()
+	// The region of the file is merged with the one of table 1, which has no
+	// rule to rewrite the file.
+	client := newRegionsClient(nil, encoded(rowKey(1, 1000)), encoded(rowKey(2, 50)), nil)
+	importer := &regionImporter{}
+	fileImporter := restore.NewFileImporter(client, importer, &backup.StorageBackend{}, false)
+	c.Assert(fileImporter.Import(ctx, importFile(), importRules()), IsNil)
+	c.Assert(client.splits, DeepEquals, [][]byte{rowKey(2, 10)})
+	// Only the region split from the file start is downloaded.
+	c.Assert(importer.downloads, DeepEquals, []uint64{5, 3})
+	c.Assert(importer.rules[0].NewKeyPrefix, DeepEquals, importer.rules[1].NewKeyPrefix)
+}
+
+func (s *testImportSuite) TestImportRegionChanged(c *C) {
+	ctx := context.Background()
+	client := newRegionsClient(encoded(tablecodec.GenTableRecordPrefix(2)), encoded(rowKey(2, 50)), nil)
+	importer := &regionImporter{
+		ingestErrs: []*errorpb.Error{
+			// Region 1 follows the new leader.
+			{NotLeader: &errorpb.NotLeader{RegionId: 1, Leader: &metapb.Peer{Id: 12, StoreId: 2}}},
+			nil,
+			// Region 2 doesn't cover the file, it's downloaded again.
+			{KeyNotInRegion: &errorpb.KeyNotInRegion{}},
+		},
+	}
+	fileImporter := restore.NewFileImporter(client, importer, &backup.StorageBackend{}, false)
+	c.Assert(fileImporter.Import(ctx, importFile(), importRules()), IsNil)
+	c.Assert(client.splits, HasLen, 0)
+	// The imported region 1 isn't imported again.
+	c.Assert(importer.downloads, DeepEquals, []uint64{1, 2, 2})
+	c.Assert(importer.ingests, DeepEquals, []uint64{1, 1, 2, 2})
+}
+
+func (s *testImportSuite) TestImportNotLeaderExhausted(c *C) {
+	ctx := context.Background()
+	client := newRegionsClient(encoded(tablecodec.GenTableRecordPrefix(2)), nil)
+	notLeader := &errorpb.Error{NotLeader: &errorpb.NotLeader{RegionId: 1, Leader: &metapb.Peer{Id: 12, StoreId: 2}}}
+	importer := &regionImporter{
+		ingestErrs: []*errorpb.Error{notLeader, notLeader, notLeader, notLeader},
+	}
+	fileImporter := restore.NewFileImporter(client, importer, &backup.StorageBackend{}, false)
+	// The region is scanned again once following the leader doesn't help.
+	c.Assert(fileImporter.Import(ctx, importFile(), importRules()), IsNil)
+	c.Assert(importer.downloads, DeepEquals, []uint64{1, 1})
+	c.Assert(importer.ingests, HasLen, 5)
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/pingcap/br/pkg/cdclog"
 	berrors "github.com/pingcap/br/pkg/errors"
 	"github.com/pingcap/br/pkg/kv"
+	"github.com/pingcap/br/pkg/logutil"
 	"github.com/pingcap/br/pkg/storage"
 	"github.com/pingcap/br/pkg/utils"
 )
@@ -112,8 +113,9 @@ func NewLogRestoreClient(
 		}
 	}
 
-	splitClient := NewSplitClient(restoreClient.GetPDClient(), restoreClient.GetTLSConfig())
-	importClient := NewImportClient(splitClient, restoreClient.tlsConf, restoreClient.keepaliveConf)
+	splitClient := NewSplitClient(restoreClient.GetPDClient(), restoreClient.GetTLSConfig(), restoreClient.dialOpts...)
+	importClient := NewImportClient(splitClient, restoreClient.tlsConf, restoreClient.keepaliveConf,
+		restoreClient.dialOpts...)
 
 	cfg := concurrencyCfg{
 		Concurrency:       concurrency,
@@ -475,12 +477,12 @@ func (l *LogClient) writeToTiKV(ctx context.Context, kvs kv.Pairs, region *Regio
 			return nil, closeErr
 		} else if leaderID == region.Region.Peers[i].GetId() {
 			leaderPeerMetas = resp.Metas
-			log.Debug("get metas after write kv stream to tikv", zap.Reflect("metas", leaderPeerMetas))
+			log.Debug("get metas after write kv stream to tikv", logutil.Reflect("metas", leaderPeerMetas))
 		}
 	}
 
-	log.Debug("write to kv", zap.Reflect("region", region), zap.Uint64("leader", leaderID),
-		zap.Reflect("meta", meta), zap.Reflect("return metas", leaderPeerMetas),
+	log.Debug("write to kv", logutil.Reflect("region", region), zap.Uint64("leader", leaderID),
+		logutil.Reflect("meta", meta), logutil.Reflect("return metas", leaderPeerMetas),
 		zap.Int("kv_pairs", totalCount), zap.Int64("total_bytes", size),
 		zap.Int64("buf_size", bytesBuf.TotalSize()))
 
@@ -550,11 +552,11 @@ func (l *LogClient) doWriteAndIngest(ctx context.Context, kvs kv.Pairs, region *
 
 	for _, meta := range metas {
 		for i := 0; i < maxRetryTimes; i++ {
-			log.Debug("ingest meta", zap.Reflect("meta", meta))
+			log.Debug("ingest meta", logutil.Reflect("meta", meta))
 			resp, err := l.Ingest(ctx, meta, region)
 			if err != nil {
-				log.Warn("ingest failed", zap.Error(err), zap.Reflect("meta", meta),
-					zap.Reflect("region", region))
+				log.Warn("ingest failed", zap.Error(err), logutil.Reflect("meta", meta),
+					logutil.Reflect("region", region))
 				continue
 			}
 			needRetry, newRegion, errIngest := isIngestRetryable(resp, region, meta)
@@ -563,8 +565,8 @@ func (l *LogClient) doWriteAndIngest(ctx context.Context, kvs kv.Pairs, region *
 				break
 			}
 			if !needRetry {
-				log.Warn("ingest failed noretry", zap.Error(errIngest), zap.Reflect("meta", meta),
-					zap.Reflect("region", region))
+				log.Warn("ingest failed noretry", zap.Error(errIngest), logutil.Reflect("meta", meta),
+					logutil.Reflect("region", region))
 				// met non-retryable error retry whole Write procedure
 				return errIngest
 			}
@@ -573,8 +575,8 @@ func (l *LogClient) doWriteAndIngest(ctx context.Context, kvs kv.Pairs, region *
 				region = newRegion
 			} else {
 				log.Warn("retry ingest due to",
-					zap.Reflect("meta", meta), zap.Reflect("region", region),
-					zap.Reflect("new region", newRegion), zap.Error(errIngest))
+					logutil.Reflect("meta", meta), logutil.Reflect("region", region),
+					logutil.Reflect("new region", newRegion), zap.Error(errIngest))
 				return errIngest
 			}
 		}
@@ -614,10 +616,10 @@ WriteAndIngest:
 		shouldWait := false
 		eg, ectx := errgroup.WithContext(ctx)
 		for _, region := range regions {
-			log.Debug("get region", zap.Int("retry", retry), zap.Binary("startKey", startKey),
-				zap.Binary("endKey", endKey), zap.Uint64("id", region.Region.GetId()),
-				zap.Stringer("epoch", region.Region.GetRegionEpoch()), zap.Binary("start", region.Region.GetStartKey()),
-				zap.Binary("end", region.Region.GetEndKey()), zap.Reflect("peers", region.Region.GetPeers()))
+			log.Debug("get region", zap.Int("retry", retry), logutil.Key("startKey", startKey),
+				logutil.Key("endKey", endKey), zap.Uint64("id", region.Region.GetId()),
+				zap.Stringer("epoch", region.Region.GetRegionEpoch()), logutil.Key("start", region.Region.GetStartKey()),
+				logutil.Key("end", region.Region.GetEndKey()), logutil.Reflect("peers", region.Region.GetPeers()))
 
 			// generate new uuid for concurrent write to tikv
 			if len(regions) == 1 {
@@ -931,7 +933,7 @@ func (l *LogClient) RestoreLogData(ctx context.Context, dom *domain.Domain) erro
 	if err != nil {
 		return errors.Trace(err)
 	}
-	log.Info("get meta from storage", zap.Binary("data", data))
+	log.Info("get meta from storage", logutil.Reflect("data", data))
 
 	if l.startTS > l.meta.GlobalResolvedTS {
 		return errors.Annotatef(berrors.ErrRestoreRTsConstrain,
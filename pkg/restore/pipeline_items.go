@@ -86,14 +86,21 @@ func (manager *brContextManager) Close(ctx context.Context) {
 
 func (manager *brContextManager) Enter(ctx context.Context, tables []CreatedTable) error {
 	placementRuleTables := make([]*model.TableInfo, 0, len(tables))
+	entered := make([]CreatedTable, 0, len(tables))
 
 	for _, tbl := range tables {
 		if _, ok := manager.hasTable[tbl.Table.ID]; !ok {
 			placementRuleTables = append(placementRuleTables, tbl.Table)
+			entered = append(entered, tbl)
 		}
 		manager.hasTable[tbl.Table.ID] = tbl
 	}
 
+	// The regions are split and scattered by the placement rules of the tables.
+	if err := manager.client.RestorePlacementRules(ctx, entered); err != nil {
+		log.Error("restore placement rules failed", zap.Error(err))
+		return errors.Trace(err)
+	}
 	return splitPrepareWork(ctx, manager.client, placementRuleTables)
 }
 
@@ -175,16 +182,79 @@ type BatchSender interface {
 	Close()
 }
 
-type tikvSender struct {
+// RestoreStages are the stages of restoring a batch in the sender pipeline.
+// The files of a batch are downloaded before they are ingested, so the files
+// of the next batches are downloaded while a batch is ingested.
+type RestoreStages interface {
+	// SplitBatch splits the regions by the ranges of the batch.
+	SplitBatch(ctx context.Context, batch DrainResult) error
+	// DownloadBatch downloads the files of the batch into the regions.
+	DownloadBatch(ctx context.Context, batch DrainResult) (*DownloadedFiles, error)
+	// IngestBatch ingests the files of the batch downloaded.
+	IngestBatch(ctx context.Context, batch DrainResult, downloaded *DownloadedFiles) error
+	// BatchRestored is called in the order of the batches once the files of
+	// a batch are ingested.
+	BatchRestored(batch DrainResult)
+}
+
+// clientStages restores the batches by the client.
+type clientStages struct {
 	client   *Client
 	updateCh glue.Progress
+}
+
+func (s clientStages) SplitBatch(ctx context.Context, batch DrainResult) error {
+	return SplitRanges(ctx, s.client, batch.Ranges, batch.RewriteRules, s.updateCh)
+}
+
+func (s clientStages) DownloadBatch(ctx context.Context, batch DrainResult) (*DownloadedFiles, error) {
+	return s.client.DownloadFiles(ctx, batch.Files(), batch.RewriteRules)
+}
+
+func (s clientStages) IngestBatch(ctx context.Context, _ DrainResult, downloaded *DownloadedFiles) error {
+	return s.client.IngestFiles(ctx, downloaded, s.updateCh)
+}
 
-	sink TableSink
-	inCh chan<- DrainResult
+func (s clientStages) BatchRestored(batch DrainResult) {
+	// All files of the tables are ingested since the batches are emitted in
+	// order.
+	for _, tbl := range batch.BlankTablesAfterSend {
+		s.client.SetTablePhase(tbl.OldTable, TablePhaseIngested)
+	}
+}
 
+type tikvSender struct {
+	stages RestoreStages
+
+	sink    TableSink
+	inCh    chan<- DrainResult
+	cancel  context.CancelFunc
+	errOnce sync.Once
+
+	// wg joins the stages and the goroutines downloading and ingesting the
+	// batches.
 	wg *sync.WaitGroup
 }
 
+// downloadingBatch is a batch whose files are being downloaded, done
+// receives the result once they are downloaded.
+type downloadingBatch struct {
+	result DrainResult
+	done   <-chan downloadResult
+}
+
+type downloadResult struct {
+	downloaded *DownloadedFiles
+	err        error
+}
+
+// ingestingBatch is a batch whose files are being ingested, done receives
+// the result once they are ingested.
+type ingestingBatch struct {
+	result DrainResult
+	done   <-chan error
+}
+
 func (b *tikvSender) PutSink(sink TableSink) {
 	// don't worry about visibility, since we will call this before first call to
 	// RestoreBatch, which is a sync point.
@@ -200,21 +270,50 @@ func NewTiKVSender(
 	ctx context.Context,
 	cli *Client,
 	updateCh glue.Progress,
+	depth uint,
 ) (BatchSender, error) {
+	return NewPipelineSender(ctx, clientStages{client: cli, updateCh: updateCh}, depth), nil
+}
+
+// NewPipelineSender makes a sender restoring the batches by the stages. The
+// batches are split, downloaded, ingested and emitted by a pipeline, at most
+// depth batches are downloaded and depth batches are ingested concurrently.
+// The batches are emitted in order since a table may span several batches.
+// The first failed batch cancels the others.
+func NewPipelineSender(ctx context.Context, stages RestoreStages, depth uint) BatchSender {
+	if depth == 0 {
+		depth = 1
+	}
 	inCh := make(chan DrainResult, defaultChannelSize)
-	midCh := make(chan DrainResult, defaultChannelSize)
+	// The batches are split at most depth batches ahead of downloading.
+	splitCh := make(chan DrainResult, depth)
+	// The next stage holds a batch besides the ones queued.
+	downloadCh := make(chan downloadingBatch, depth-1)
+	ingestCh := make(chan ingestingBatch, depth-1)
 
+	ctx, cancel := context.WithCancel(ctx)
 	sender := &tikvSender{
-		client:   cli,
-		updateCh: updateCh,
-		inCh:     inCh,
-		wg:       new(sync.WaitGroup),
+		stages: stages,
+		inCh:   inCh,
+		cancel: cancel,
+		wg:     new(sync.WaitGroup),
 	}
 
-	sender.wg.Add(2)
-	go sender.splitWorker(ctx, inCh, midCh)
-	go sender.restoreWorker(ctx, midCh)
-	return sender, nil
+	sender.wg.Add(4)
+	go sender.splitWorker(ctx, inCh, splitCh)
+	go sender.downloadWorker(ctx, splitCh, downloadCh)
+	go sender.ingestWorker(ctx, downloadCh, ingestCh)
+	go sender.emitWorker(ctx, ingestCh)
+	return sender
+}
+
+// emitError emits the first error of the batches and cancels the others, the
+// errors of the batches canceled aren't emitted.
+func (b *tikvSender) emitError(err error) {
+	b.errOnce.Do(func() {
+		b.sink.EmitError(err)
+		b.cancel()
+	})
 }
 
 func (b *tikvSender) splitWorker(ctx context.Context, ranges <-chan DrainResult, next chan<- DrainResult) {
@@ -231,24 +330,28 @@ func (b *tikvSender) splitWorker(ctx context.Context, ranges <-chan DrainResult,
 			if !ok {
 				return
 			}
-			if err := SplitRanges(ctx, b.client, result.Ranges, result.RewriteRules, b.updateCh); err != nil {
+			if err := b.stages.SplitBatch(ctx, result); err != nil {
 				log.Error("failed on split range",
-					zap.Any("ranges", ranges),
+					ZapRanges(result.Ranges),
 					zap.Error(err),
 				)
-				b.sink.EmitError(err)
+				b.emitError(err)
+				return
+			}
+			select {
+			case <-ctx.Done():
 				return
+			case next <- result:
 			}
-			next <- result
 		}
 	}
 }
 
-func (b *tikvSender) restoreWorker(ctx context.Context, ranges <-chan DrainResult) {
+func (b *tikvSender) downloadWorker(ctx context.Context, ranges <-chan DrainResult, next chan<- downloadingBatch) {
 	defer func() {
-		log.Debug("restore worker closed")
+		log.Debug("download worker closed")
 		b.wg.Done()
-		b.sink.Close()
+		close(next)
 	}()
 	for {
 		select {
@@ -258,23 +361,109 @@ func (b *tikvSender) restoreWorker(ctx context.Context, ranges <-chan DrainResul
 			if !ok {
 				return
 			}
-			files := result.Files()
-			if err := b.client.RestoreFiles(ctx, files, result.RewriteRules, b.updateCh); err != nil {
-				b.sink.EmitError(err)
+			done := make(chan downloadResult, 1)
+			// It blocks until there are less than depth batches downloading.
+			select {
+			case <-ctx.Done():
+				return
+			case next <- downloadingBatch{result: result, done: done}:
+			}
+			b.wg.Add(1)
+			go func() {
+				defer b.wg.Done()
+				downloaded, err := b.stages.DownloadBatch(ctx, result)
+				if err != nil {
+					// Fail at once rather than after the batches before it.
+					b.emitError(err)
+				}
+				done <- downloadResult{downloaded: downloaded, err: err}
+			}()
+		}
+	}
+}
+
+func (b *tikvSender) ingestWorker(ctx context.Context, batches <-chan downloadingBatch, next chan<- ingestingBatch) {
+	defer func() {
+		log.Debug("ingest worker closed")
+		b.wg.Done()
+		close(next)
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch, ok := <-batches:
+			if !ok {
+				return
+			}
+			var res downloadResult
+			select {
+			case <-ctx.Done():
+				return
+			case res = <-batch.done:
+			}
+			if res.err != nil {
+				return
+			}
+			done := make(chan error, 1)
+			// It blocks until there are less than depth batches ingesting.
+			select {
+			case <-ctx.Done():
+				return
+			case next <- ingestingBatch{result: batch.result, done: done}:
+			}
+			b.wg.Add(1)
+			go func() {
+				defer b.wg.Done()
+				err := b.stages.IngestBatch(ctx, batch.result, res.downloaded)
+				if err != nil {
+					b.emitError(err)
+				}
+				done <- err
+			}()
+		}
+	}
+}
+
+func (b *tikvSender) emitWorker(ctx context.Context, batches <-chan ingestingBatch) {
+	defer func() {
+		log.Debug("emit worker closed")
+		b.wg.Done()
+		b.sink.Close()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch, ok := <-batches:
+			if !ok {
+				return
+			}
+			var err error
+			select {
+			case <-ctx.Done():
+				return
+			case err = <-batch.done:
+			}
+			if err != nil {
 				return
 			}
 
 			log.Info("restore batch done",
-				ZapRanges(result.Ranges),
-				zap.Int("file count", len(files)),
+				ZapRanges(batch.result.Ranges),
+				zap.Int("file count", len(batch.result.Files())),
 			)
-			b.sink.EmitTables(result.BlankTablesAfterSend...)
+			b.stages.BatchRestored(batch.result)
+			b.sink.EmitTables(batch.result.BlankTablesAfterSend...)
 		}
 	}
 }
 
+// Close waits for the batches sent to be restored, or the stages to stop
+// after the first error.
 func (b *tikvSender) Close() {
 	close(b.inCh)
 	b.wg.Wait()
+	b.cancel()
 	log.Debug("tikv sender closed")
 }
@@ -0,0 +1,146 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+
+	"github.com/pingcap/br/pkg/restore"
+)
+
+type testPipelineSuite struct{}
+
+var _ = Suite(&testPipelineSuite{})
+
+// fakeStages restores the batches identified by the IDs of their tables,
+// the downloads take the delays of the batches.
+type fakeStages struct {
+	mu             sync.Mutex
+	delays         map[int64]time.Duration
+	failAt         int64
+	downloading    int
+	maxDownloading int
+	restored       []int64
+}
+
+func batchID(batch restore.DrainResult) int64 {
+	return batch.BlankTablesAfterSend[0].Table.ID
+}
+
+func (s *fakeStages) SplitBatch(context.Context, restore.DrainResult) error {
+	return nil
+}
+
+func (s *fakeStages) DownloadBatch(ctx context.Context, batch restore.DrainResult) (*restore.DownloadedFiles, error) {
+	s.mu.Lock()
+	s.downloading++
+	if s.downloading > s.maxDownloading {
+		s.maxDownloading = s.downloading
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.downloading--
+		s.mu.Unlock()
+	}()
+	if batchID(batch) == s.failAt {
+		return nil, errors.New("download failed")
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(s.delays[batchID(batch)]):
+	}
+	return &restore.DownloadedFiles{}, nil
+}
+
+func (s *fakeStages) IngestBatch(ctx context.Context, _ restore.DrainResult, _ *restore.DownloadedFiles) error {
+	return ctx.Err()
+}
+
+func (s *fakeStages) BatchRestored(batch restore.DrainResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restored = append(s.restored, batchID(batch))
+}
+
+type recordSink struct {
+	mu     sync.Mutex
+	tables []int64
+	errs   []error
+}
+
+func (sink *recordSink) EmitTables(tables ...restore.CreatedTable) {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	for _, tbl := range tables {
+		sink.tables = append(sink.tables, tbl.Table.ID)
+	}
+}
+
+func (sink *recordSink) EmitError(err error) {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.errs = append(sink.errs, err)
+}
+
+func (sink *recordSink) Close() {}
+
+func sendBatches(sender restore.BatchSender, n int) {
+	for i := 1; i <= n; i++ {
+		sender.RestoreBatch(restore.DrainResult{
+			BlankTablesAfterSend: []restore.CreatedTable{{Table: &model.TableInfo{ID: int64(i)}}},
+		})
+	}
+}
+
+func (s *testPipelineSuite) TestPipelineOrderAndDepth(c *C) {
+	// The later batches are downloaded faster.
+	stages := &fakeStages{delays: make(map[int64]time.Duration)}
+	for i := int64(1); i <= 6; i++ {
+		stages.delays[i] = time.Duration(70-10*i) * time.Millisecond
+	}
+	sink := &recordSink{}
+	sender := restore.NewPipelineSender(context.Background(), stages, 3)
+	sender.PutSink(sink)
+	sendBatches(sender, 6)
+	sender.Close()
+
+	c.Assert(sink.errs, HasLen, 0)
+	c.Assert(sink.tables, DeepEquals, []int64{1, 2, 3, 4, 5, 6})
+	c.Assert(stages.restored, DeepEquals, []int64{1, 2, 3, 4, 5, 6})
+	c.Assert(stages.maxDownloading, LessEqual, 3)
+	c.Assert(stages.maxDownloading, Greater, 1)
+
+	// The batches are restored one by one with depth 1.
+	stages = &fakeStages{delays: stages.delays}
+	sender = restore.NewPipelineSender(context.Background(), stages, 1)
+	sender.PutSink(sink)
+	sendBatches(sender, 3)
+	sender.Close()
+	c.Assert(stages.maxDownloading, Equals, 1)
+}
+
+func (s *testPipelineSuite) TestPipelineCancel(c *C) {
+	stages := &fakeStages{delays: map[int64]time.Duration{1: time.Second}, failAt: 2}
+	sink := &recordSink{}
+	sender := restore.NewPipelineSender(context.Background(), stages, 2)
+	sender.PutSink(sink)
+	start := time.Now()
+	sendBatches(sender, 5)
+	sender.Close()
+
+	// The failed batch cancels the others, only its error is emitted.
+	c.Assert(time.Since(start), Less, time.Second)
+	c.Assert(sink.errs, HasLen, 1)
+	c.Assert(sink.errs[0], ErrorMatches, "download failed")
+	c.Assert(sink.tables, HasLen, 0)
+	// The downloads are joined by Close.
+	c.Assert(stages.downloading, Equals, 0)
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/tikv/pd/server/schedule/placement"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+)
+
+// PlacementLabelMap maps the values of the labels in the label constraints of
+// the placement rules, the key is the label key, the value maps the old values
+// to the new ones.
+type PlacementLabelMap map[string]map[string]string
+
+// MapPhysicalIDs maps the IDs of the tables and partitions in the backup to
+// the ones of the restored tables, the partitions are matched by names.
+func MapPhysicalIDs(oldTable, newTable *model.TableInfo) map[int64]int64 {
+	ids := map[int64]int64{oldTable.ID: newTable.ID}
+	if oldTable.Partition == nil || newTable.Partition == nil {
+		return ids
+	}
+	newParts := make(map[string]int64, len(newTable.Partition.Definitions))
+	for _, def := range newTable.Partition.Definitions {
+		newParts[def.Name.L] = def.ID
+	}
+	for _, def := range oldTable.Partition.Definitions {
+		if id, ok := newParts[def.Name.L]; ok {
+			ids[def.ID] = id
+		}
+	}
+	return ids
+}
+
+// RewritePlacementRule rewrites the key range of the placement rule of a
+// table in the backup to the range of the restored table, and maps the
+// labels of its label constraints.
+func RewritePlacementRule(rule placement.Rule, ids map[int64]int64, labels PlacementLabelMap) (placement.Rule, error) {
+	startKey, err := decodeRuleKey(rule.StartKeyHex)
+	if err != nil {
+		return rule, err
+	}
+	oldID := tablecodec.DecodeTableID(startKey)
+	newID, ok := ids[oldID]
+	if !ok {
+		return rule, errors.Annotatef(berrors.ErrRestoreInvalidRewrite,
+			"no restored table for the placement rule %s/%s", rule.GroupID, rule.ID)
+	}
+	endKey, err := decodeRuleKey(rule.EndKeyHex)
+	if err != nil {
+		return rule, err
+	}
+
+	oldPrefix, newPrefix := tablecodec.EncodeTablePrefix(oldID), tablecodec.EncodeTablePrefix(newID)
+	rule.StartKeyHex = encodeRuleKey(replacePrefix(startKey, oldPrefix, newPrefix))
+	switch {
+	case bytes.HasPrefix(endKey, oldPrefix):
+		rule.EndKeyHex = encodeRuleKey(replacePrefix(endKey, oldPrefix, newPrefix))
+	case bytes.Equal(endKey, tablecodec.EncodeTablePrefix(oldID+1)):
+		rule.EndKeyHex = encodeRuleKey(tablecodec.EncodeTablePrefix(newID + 1))
+	default:
+		return rule, errors.Annotatef(berrors.ErrRestoreInvalidRewrite,
+			"the placement rule %s/%s covers more than table %d", rule.GroupID, rule.ID, oldID)
+	}
+	rule.ID = fmt.Sprintf("%s_restored_%d", rule.ID, newID)
+
+	constraints := make([]placement.LabelConstraint, 0, len(rule.LabelConstraints))
+	for _, c := range rule.LabelConstraints {
+		if values, ok := labels[c.Key]; ok {
+			mapped := make([]string, 0, len(c.Values))
+			for _, v := range c.Values {
+				if nv, ok := values[v]; ok {
+					v = nv
+				}
+				mapped = append(mapped, v)
+			}
+			c.Values = mapped
+		}
+		constraints = append(constraints, c)
+	}
+	rule.LabelConstraints = constraints
+	return rule, nil
+}
+
+func replacePrefix(key, oldPrefix, newPrefix []byte) []byte {
+	replaced := make([]byte, 0, len(newPrefix)+len(key)-len(oldPrefix))
+	replaced = append(replaced, newPrefix...)
+	return append(replaced, key[len(oldPrefix):]...)
+}
+
+func decodeRuleKey(keyHex string) ([]byte, error) {
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return nil, errors.Annotatef(berrors.ErrRestoreInvalidRewrite, "invalid placement rule key %s: %v", keyHex, err)
+	}
+	_, decoded, err := codec.DecodeBytes(key, nil)
+	if err != nil {
+		return nil, errors.Annotatef(berrors.ErrRestoreInvalidRewrite, "invalid placement rule key %s: %v", keyHex, err)
+	}
+	return decoded, nil
+}
+
+func encodeRuleKey(key []byte) string {
+	return hex.EncodeToString(codec.EncodeBytes(nil, key))
+}
+
+// SetTablePlacementRules sets the placement rules of the tables in the backup,
+// which are re-created for the restored tables with the labels mapped.
+func (rc *Client) SetTablePlacementRules(rules []placement.Rule, labels PlacementLabelMap) {
+	rc.placementRules = rules
+	rc.placementLabels = labels
+}
+
+// RestorePlacementRules re-creates the placement rules of the tables in the
+// backup for the created tables. It's called before the regions of the tables
+// are split, so the regions are scattered by the rules.
+func (rc *Client) RestorePlacementRules(ctx context.Context, tables []CreatedTable) error {
+	if len(rc.placementRules) == 0 {
+		return nil
+	}
+	ids := make(map[int64]int64)
+	for _, table := range tables {
+		for oldID, newID := range MapPhysicalIDs(table.OldTable.Info, table.Table) {
+			ids[oldID] = newID
+		}
+	}
+	for _, rule := range rc.placementRules {
+		startKey, err := decodeRuleKey(rule.StartKeyHex)
+		if err != nil {
+			return err
+		}
+		// The table is filtered out.
+		if _, ok := ids[tablecodec.DecodeTableID(startKey)]; !ok {
+			continue
+		}
+		newRule, err := RewritePlacementRule(rule, ids, rc.placementLabels)
+		if err != nil {
+			return err
+		}
+		log.Info("restore placement rule", zap.String("group", rule.GroupID), zap.String("id", rule.ID),
+			zap.String("new id", newRule.ID))
+		if err = rc.toolClient.SetPlacementRule(ctx, newRule); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
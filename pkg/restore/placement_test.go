@@ -0,0 +1,72 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore_test
+
+import (
+	"encoding/hex"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/tikv/pd/server/schedule/placement"
+
+	"github.com/pingcap/br/pkg/restore"
+)
+
+var _ = Suite(&testPlacementSuite{})
+
+type testPlacementSuite struct{}
+
+func ruleKey(key []byte) string {
+	return hex.EncodeToString(codec.EncodeBytes(nil, key))
+}
+
+func (s *testPlacementSuite) TestRewritePlacementRule(c *C) {
+	oldTable := &model.TableInfo{ID: 10, Partition: &model.PartitionInfo{Definitions: []model.PartitionDefinition{
+		{ID: 11, Name: model.NewCIStr("p0")},
+		{ID: 12, Name: model.NewCIStr("p1")},
+	}}}
+	newTable := &model.TableInfo{ID: 20, Partition: &model.PartitionInfo{Definitions: []model.PartitionDefinition{
+		{ID: 22, Name: model.NewCIStr("p1")},
+		{ID: 21, Name: model.NewCIStr("p0")},
+	}}}
+	ids := restore.MapPhysicalIDs(oldTable, newTable)
+	c.Assert(ids, DeepEquals, map[int64]int64{10: 20, 11: 21, 12: 22})
+
+	rule := placement.Rule{
+		GroupID:     "TiDB_DDL_12",
+		ID:          "0",
+		StartKeyHex: ruleKey(tablecodec.EncodeTablePrefix(12)),
+		EndKeyHex:   ruleKey(tablecodec.EncodeTablePrefix(13)),
+		LabelConstraints: []placement.LabelConstraint{
+			{Key: "zone", Op: "in", Values: []string{"sh", "bj"}},
+			{Key: "disk", Op: "in", Values: []string{"ssd"}},
+		},
+	}
+	labels := restore.PlacementLabelMap{"zone": {"sh": "hz"}}
+	newRule, err := restore.RewritePlacementRule(rule, ids, labels)
+	c.Assert(err, IsNil)
+	c.Assert(newRule.StartKeyHex, Equals, ruleKey(tablecodec.EncodeTablePrefix(22)))
+	c.Assert(newRule.EndKeyHex, Equals, ruleKey(tablecodec.EncodeTablePrefix(23)))
+	c.Assert(newRule.ID, Equals, "0_restored_22")
+	c.Assert(newRule.LabelConstraints[0].Values, DeepEquals, []string{"hz", "bj"})
+	c.Assert(newRule.LabelConstraints[1].Values, DeepEquals, []string{"ssd"})
+	// The rule in the backup is untouched.
+	c.Assert(rule.LabelConstraints[0].Values, DeepEquals, []string{"sh", "bj"})
+
+	rule.StartKeyHex = ruleKey(tablecodec.GenTableRecordPrefix(10))
+	rule.EndKeyHex = ruleKey(tablecodec.GenTableIndexPrefix(10))
+	newRule, err = restore.RewritePlacementRule(rule, ids, nil)
+	c.Assert(err, IsNil)
+	c.Assert(newRule.StartKeyHex, Equals, ruleKey(tablecodec.GenTableRecordPrefix(20)))
+	c.Assert(newRule.EndKeyHex, Equals, ruleKey(tablecodec.GenTableIndexPrefix(20)))
+
+	rule.EndKeyHex = ruleKey(tablecodec.EncodeTablePrefix(15))
+	_, err = restore.RewritePlacementRule(rule, ids, nil)
+	c.Assert(err, ErrorMatches, ".*covers more than table 10.*")
+
+	rule.StartKeyHex = ruleKey(tablecodec.EncodeTablePrefix(30))
+	_, err = restore.RewritePlacementRule(rule, ids, nil)
+	c.Assert(err, ErrorMatches, ".*no restored table.*")
+}
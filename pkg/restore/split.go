@@ -44,7 +44,8 @@ const (
 
 // RegionSplitter is a executor of region split by rules.
 type RegionSplitter struct {
-	client SplitClient
+	client   SplitClient
+	timeline *RegionTimeline
 }
 
 // NewRegionSplitter returns a new RegionSplitter.
@@ -54,6 +55,11 @@ func NewRegionSplitter(client SplitClient) *RegionSplitter {
 	}
 }
 
+// SetTimeline sets the timeline to record the split of regions.
+func (rs *RegionSplitter) SetTimeline(timeline *RegionTimeline) {
+	rs.timeline = timeline
+}
+
 // OnSplitFunc is called before split a range.
 type OnSplitFunc func(key [][]byte)
 
@@ -71,6 +77,7 @@ func (rs *RegionSplitter) Split(
 	if len(ranges) == 0 {
 		return nil
 	}
+	defer splitErrorSampler.Flush()
 	startTime := time.Now()
 	// Sort the range for getting the min and max key of the ranges
 	sortedRanges, errSplit := SortRanges(ranges, rewriteRules)
@@ -115,7 +122,14 @@ SplitRegions:
 		for regionID, keys := range splitKeyMap {
 			var newRegions []*RegionInfo
 			region := regionMap[regionID]
+			splitStart := time.Now()
 			newRegions, errSplit = rs.splitAndScatterRegions(ctx, region, keys)
+			rs.timeline.Record(TimelineEvent{
+				RegionID: region.Region.GetId(),
+				StoreID:  region.Leader.GetStoreId(),
+				Step:     TimelineStepSplit,
+				Retries:  i,
+			}, splitStart, errSplit)
 			if errSplit != nil {
 				if strings.Contains(errSplit.Error(), "no valid key") {
 					for _, key := range keys {
@@ -150,7 +164,13 @@ SplitRegions:
 	startTime = time.Now()
 	scatterCount := 0
 	for _, region := range scatterRegions {
+		scatterStart := time.Now()
 		rs.waitForScatterRegion(ctx, region)
+		rs.timeline.Record(TimelineEvent{
+			RegionID: region.Region.GetId(),
+			StoreID:  region.Leader.GetStoreId(),
+			Step:     TimelineStepScatter,
+		}, scatterStart, nil)
 		if time.Since(startTime) > ScatterWaitUpperInterval {
 			break
 		}
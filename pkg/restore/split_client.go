@@ -31,12 +31,17 @@ import (
 	"google.golang.org/grpc/credentials"
 
 	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/logutil"
+	"github.com/pingcap/br/pkg/pdutil"
 )
 
 const (
 	splitRegionMaxRetryTime = 4
 )
 
+// splitErrorSampler aggregates the retryable errors of splitting regions.
+var splitErrorSampler = logutil.NewSampler("split region occur retryable error", logutil.DefaultSampleInterval)
+
 // SplitClient is an external client used by RegionSplitter.
 type SplitClient interface {
 	// GetStore gets a store by a store id.
@@ -76,14 +81,18 @@ type pdClient struct {
 	mu         sync.Mutex
 	client     pd.Client
 	tlsConf    *tls.Config
+	dialOpts   []grpc.DialOption
 	storeCache map[uint64]*metapb.Store
 }
 
-// NewSplitClient returns a client used by RegionSplitter.
-func NewSplitClient(client pd.Client, tlsConf *tls.Config) SplitClient {
+// NewSplitClient returns a client used by RegionSplitter, dialOpts are
+// appended to the options dialing TiKV. The commands of PD are retried by the
+// instrumented client, only the split requests sent to TiKV are retried here.
+func NewSplitClient(client pd.Client, tlsConf *tls.Config, dialOpts ...grpc.DialOption) SplitClient {
 	return &pdClient{
-		client:     client,
+		client:     pdutil.NewInstrumentedClient(client),
 		tlsConf:    tlsConf,
+		dialOpts:   dialOpts,
 		storeCache: make(map[uint64]*metapb.Store),
 	}
 }
@@ -146,7 +155,7 @@ func (c *pdClient) SplitRegion(ctx context.Context, regionInfo *RegionInfo, key
 	if err != nil {
 		return nil, err
 	}
-	conn, err := grpc.Dial(store.GetAddress(), grpc.WithInsecure())
+	conn, err := grpc.Dial(store.GetAddress(), append([]grpc.DialOption{grpc.WithInsecure()}, c.dialOpts...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -262,7 +271,7 @@ func (c *pdClient) sendSplitRegionRequest(
 		if c.tlsConf != nil {
 			opt = grpc.WithTransportCredentials(credentials.NewTLS(c.tlsConf))
 		}
-		conn, err := grpc.Dial(store.GetAddress(), opt)
+		conn, err := grpc.Dial(store.GetAddress(), append([]grpc.DialOption{opt}, c.dialOpts...)...)
 		if err != nil {
 			return nil, multierr.Append(splitErrors, err)
 		}
@@ -287,10 +296,10 @@ func (c *pdClient) sendSplitRegionRequest(
 					if !checkRegionEpoch(newRegionInfo, regionInfo) {
 						return nil, multierr.Append(splitErrors, berrors.ErrKVEpochNotMatch)
 					}
-					log.Info("find new leader", zap.Uint64("new leader", newRegionInfo.Leader.Id))
+					log.Debug("find new leader", zap.Uint64("new leader", newRegionInfo.Leader.Id))
 					regionInfo = newRegionInfo
 				}
-				log.Info("split region meet not leader error, retrying",
+				splitErrorSampler.Warn(logutil.RegionErrorKind(resp.RegionError),
 					zap.Int("retry times", i),
 					zap.Uint64("regionID", regionInfo.Region.Id),
 					zap.Any("new leader", regionInfo.Leader),
@@ -302,7 +311,7 @@ func (c *pdClient) sendSplitRegionRequest(
 			// But maybe we can handle them here by some information the error itself provides.
 			if resp.RegionError.ServerIsBusy != nil ||
 				resp.RegionError.StaleCommand != nil {
-				log.Warn("a error occurs on split region",
+				splitErrorSampler.Warn(logutil.RegionErrorKind(resp.RegionError),
 					zap.Int("retry times", i),
 					zap.Uint64("regionID", regionInfo.Region.Id),
 					zap.String("error", resp.RegionError.Message),
@@ -0,0 +1,93 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/mysql"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// sysPrivilegeTables are the system tables which can be restored safely,
+// the others (e.g. mysql.tidb, mysql.gc_delete_range) belong to the cluster.
+var sysPrivilegeTables = map[string]struct{}{
+	"user":          {},
+	"db":            {},
+	"tables_priv":   {},
+	"columns_priv":  {},
+	"global_priv":   {},
+	"role_edges":    {},
+	"default_roles": {},
+	"bind_info":     {},
+}
+
+// IsSysTableRecoverable returns whether the table of the mysql database can
+// be restored.
+func IsSysTableRecoverable(tableLowerName string) bool {
+	_, ok := sysPrivilegeTables[tableLowerName]
+	return ok
+}
+
+// RedirectSysDB renames the system database in the backup to a temporary
+// one, so its tables are restored without touching the live system tables.
+func RedirectSysDB(db *utils.Database) {
+	RenameDatabase(db, utils.TemporaryDBName(db.Info.Name.O))
+}
+
+// RestoreSystemSchemas merges the rows restored into the temporary database
+// into the system tables, then drops the temporary database. The existing
+// rows of the same keys, e.g. the accounts of the target cluster, are kept,
+// or replaced if replace is true.
+func (rc *Client) RestoreSystemSchemas(ctx context.Context, tables []*utils.Table, replace bool) error {
+	tmp := utils.TemporaryDBName(mysql.SystemDB)
+	restored := 0
+	for _, table := range tables {
+		if table.DB.Name.L != tmp.L {
+			continue
+		}
+		columns := make([]string, 0, len(table.Info.Columns))
+		for _, col := range table.Info.Columns {
+			columns = append(columns, utils.EncloseName(col.Name.O))
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		columnList := strings.Join(columns, ", ")
+		var sql string
+		if replace {
+			sql = fmt.Sprintf("REPLACE INTO %s.%s (%s) SELECT %s FROM %s.%s;",
+				utils.EncloseName(mysql.SystemDB), utils.EncloseName(table.Info.Name.O), columnList,
+				columnList, utils.EncloseName(tmp.O), utils.EncloseName(table.Info.Name.O))
+		} else {
+			// Updating a column to itself keeps the existing row.
+			sql = fmt.Sprintf("INSERT INTO %s.%s (%s) SELECT %s FROM %s.%s ON DUPLICATE KEY UPDATE %s = %s.%s.%s;",
+				utils.EncloseName(mysql.SystemDB), utils.EncloseName(table.Info.Name.O), columnList,
+				columnList, utils.EncloseName(tmp.O), utils.EncloseName(table.Info.Name.O),
+				columns[0], utils.EncloseName(mysql.SystemDB), utils.EncloseName(table.Info.Name.O), columns[0])
+		}
+		if err := rc.db.se.Execute(ctx, sql); err != nil {
+			return errors.Annotatef(err,
+				"failed to restore %s.%s, the schema may differ between the clusters, "+
+					"the restored rows are kept in %s", mysql.SystemDB, table.Info.Name.O, tmp.O)
+		}
+		log.Info("system table restored", zap.Stringer("table", table.Info.Name), zap.Bool("replace", replace))
+		restored++
+	}
+	if restored == 0 {
+		return nil
+	}
+	if err := rc.db.se.Execute(ctx, "FLUSH PRIVILEGES;"); err != nil {
+		return errors.Trace(err)
+	}
+	if err := rc.db.se.Execute(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s;", utils.EncloseName(tmp.O))); err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
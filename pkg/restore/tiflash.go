@@ -0,0 +1,85 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/domain"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// tiflashReplicaCheckInterval is the interval to check whether the TiFlash
+// replicas are available.
+const tiflashReplicaCheckInterval = 5 * time.Second
+
+// RecoverTiFlashReplicas sets the TiFlash replicas of the restored tables
+// as they were in the backup. The tables are created without the replicas,
+// so TiFlash doesn't sync the data while it's being ingested. It returns the
+// tables whose replicas are set.
+func (rc *Client) RecoverTiFlashReplicas(ctx context.Context, tables []*utils.Table) []*utils.Table {
+	return rc.db.RecoverTiFlashReplicas(ctx, tables)
+}
+
+// RecoverTiFlashReplicas sets the TiFlash replicas of the tables as they were
+// in the backup, it returns the tables whose replicas are set.
+func (db *DB) RecoverTiFlashReplicas(ctx context.Context, tables []*utils.Table) []*utils.Table {
+	recovered := make([]*utils.Table, 0)
+	for _, table := range tables {
+		if table.TiFlashReplicas <= 0 || utils.IsSysDB(table.DB.Name.L) {
+			continue
+		}
+		// The cluster may have fewer TiFlash stores, the data is restored
+		// anyway, so only warn about it.
+		if err := db.AlterTiflashReplica(ctx, table, table.TiFlashReplicas); err != nil {
+			log.Warn("failed to recover the tiflash replicas, set them manually",
+				zap.Stringer("db", table.DB.Name), zap.Stringer("table", table.Info.Name),
+				zap.Int("replica", table.TiFlashReplicas), zap.Error(err))
+			continue
+		}
+		recovered = append(recovered, table)
+	}
+	return recovered
+}
+
+// WaitTiFlashReplicasAvailable waits until the TiFlash replicas of the tables
+// are available or the timeout expires, it returns the tables whose replicas
+// are still unavailable.
+func WaitTiFlashReplicasAvailable(
+	ctx context.Context,
+	dom *domain.Domain,
+	tables []*utils.Table,
+	timeout time.Duration,
+) ([]*utils.Table, error) {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(tiflashReplicaCheckInterval)
+	defer ticker.Stop()
+	for {
+		pending := tables[:0]
+		info := dom.InfoSchema()
+		for _, table := range tables {
+			tbl, err := info.TableByName(table.DB.Name, table.Info.Name)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if replica := tbl.Meta().TiFlashReplica; replica == nil || !replica.Available {
+				pending = append(pending, table)
+			}
+		}
+		tables = pending
+		if len(tables) == 0 || !time.Now().Before(deadline) {
+			return tables, nil
+		}
+		log.Info("waiting for the tiflash replicas to be available", zap.Int("tables", len(tables)))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
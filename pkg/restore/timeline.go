@@ -0,0 +1,160 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The steps of restoring a region recorded in the timeline.
+const (
+	TimelineStepSplit    = "split"
+	TimelineStepScatter  = "scatter"
+	TimelineStepDownload = "download"
+	TimelineStepIngest   = "ingest"
+	TimelineStepChecksum = "checksum"
+)
+
+// slowestEventsCount is the number of the slowest events kept by the timeline.
+const slowestEventsCount = 10
+
+// TimelineEvent is a step of restoring a region.
+type TimelineEvent struct {
+	RegionID uint64    `json:"region-id"`
+	StoreID  uint64    `json:"store-id,omitempty"`
+	File     string    `json:"file,omitempty"`
+	Table    string    `json:"table,omitempty"`
+	Step     string    `json:"step"`
+	Start    time.Time `json:"start"`
+	// Duration is in milliseconds.
+	Duration int64  `json:"duration"`
+	Retries  int    `json:"retries"`
+	Error    string `json:"error,omitempty"`
+}
+
+// StepStats is the statistics of a step of all regions.
+type StepStats struct {
+	Count   int `json:"count"`
+	Retries int `json:"retries"`
+	Errors  int `json:"errors"`
+	// Duration and MaxDuration are in milliseconds, Duration is the sum of
+	// the steps running concurrently.
+	Duration    int64 `json:"duration"`
+	MaxDuration int64 `json:"max-duration"`
+}
+
+// RegionTimeline records when every region is split, downloaded and ingested,
+// so the slow regions of a restore can be found without tracing.
+// A nil timeline records nothing.
+type RegionTimeline struct {
+	mu         sync.Mutex
+	keepEvents bool
+	events     []TimelineEvent
+	steps      map[string]*StepStats
+	slowest    []TimelineEvent
+}
+
+// NewRegionTimeline creates an empty timeline.
+func NewRegionTimeline() *RegionTimeline {
+	return &RegionTimeline{keepEvents: true, steps: make(map[string]*StepStats)}
+}
+
+// NewRegionTimelineStats creates an empty timeline which only keeps the
+// statistics of the steps and the slowest events, not every event.
+func NewRegionTimelineStats() *RegionTimeline {
+	return &RegionTimeline{steps: make(map[string]*StepStats)}
+}
+
+// Record records a step started at start and finished now.
+func (t *RegionTimeline) Record(ev TimelineEvent, start time.Time, err error) {
+	if t == nil {
+		return
+	}
+	ev.Start = start
+	ev.Duration = time.Since(start).Milliseconds()
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.keepEvents {
+		t.events = append(t.events, ev)
+	}
+
+	stats, ok := t.steps[ev.Step]
+	if !ok {
+		stats = &StepStats{}
+		t.steps[ev.Step] = stats
+	}
+	stats.Count++
+	stats.Retries += ev.Retries
+	if err != nil {
+		stats.Errors++
+	}
+	stats.Duration += ev.Duration
+	if ev.Duration > stats.MaxDuration {
+		stats.MaxDuration = ev.Duration
+	}
+
+	// The checksum isn't a step of a region.
+	if ev.RegionID == 0 {
+		return
+	}
+	if len(t.slowest) < slowestEventsCount {
+		t.slowest = append(t.slowest, ev)
+	} else if ev.Duration > t.slowest[len(t.slowest)-1].Duration {
+		t.slowest[len(t.slowest)-1] = ev
+	} else {
+		return
+	}
+	sort.SliceStable(t.slowest, func(i, j int) bool {
+		return t.slowest[i].Duration > t.slowest[j].Duration
+	})
+}
+
+// Steps returns the statistics of the recorded steps.
+func (t *RegionTimeline) Steps() map[string]StepStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	steps := make(map[string]StepStats, len(t.steps))
+	for step, stats := range t.steps {
+		steps[step] = *stats
+	}
+	return steps
+}
+
+// Slowest returns the slowest events of regions, the slowest first.
+func (t *RegionTimeline) Slowest() []TimelineEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TimelineEvent(nil), t.slowest...)
+}
+
+// Len returns the number of the recorded events.
+func (t *RegionTimeline) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.events)
+}
+
+// Dump writes the events ordered by the start time, one json object per line.
+func (t *RegionTimeline) Dump(w io.Writer) error {
+	t.mu.Lock()
+	events := append([]TimelineEvent(nil), t.events...)
+	t.mu.Unlock()
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+	enc := json.NewEncoder(w)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/br/pkg/restore"
+)
+
+type testTimelineSuite struct{}
+
+var _ = Suite(&testTimelineSuite{})
+
+func (s *testTimelineSuite) TestRegionTimeline(c *C) {
+	var nilTimeline *restore.RegionTimeline
+	nilTimeline.Record(restore.TimelineEvent{RegionID: 1}, time.Now(), nil)
+
+	timeline := restore.NewRegionTimeline()
+	now := time.Now()
+	timeline.Record(restore.TimelineEvent{
+		RegionID: 2, Step: restore.TimelineStepIngest, Retries: 1,
+	}, now, errors.New("not leader"))
+	timeline.Record(restore.TimelineEvent{
+		RegionID: 2, Step: restore.TimelineStepDownload,
+	}, now.Add(-time.Second), nil)
+	c.Assert(timeline.Len(), Equals, 2)
+
+	buf := new(bytes.Buffer)
+	c.Assert(timeline.Dump(buf), IsNil)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	c.Assert(lines, HasLen, 2)
+
+	events := make([]restore.TimelineEvent, 0, len(lines))
+	for _, line := range lines {
+		var ev restore.TimelineEvent
+		c.Assert(json.Unmarshal([]byte(line), &ev), IsNil)
+		events = append(events, ev)
+	}
+	c.Assert(events[0].Step, Equals, restore.TimelineStepDownload)
+	c.Assert(events[0].Duration >= int64(1000), IsTrue)
+	c.Assert(events[1].Step, Equals, restore.TimelineStepIngest)
+	c.Assert(events[1].Retries, Equals, 1)
+	c.Assert(events[1].Error, Equals, "not leader")
+}
+
+func (s *testTimelineSuite) TestRegionTimelineStats(c *C) {
+	timeline := restore.NewRegionTimelineStats()
+	now := time.Now()
+	for i := 1; i <= 12; i++ {
+		timeline.Record(restore.TimelineEvent{
+			RegionID: uint64(i), Step: restore.TimelineStepDownload, Retries: 1,
+		}, now.Add(-time.Duration(i)*time.Second), nil)
+	}
+	timeline.Record(restore.TimelineEvent{
+		RegionID: 20, Step: restore.TimelineStepIngest,
+	}, now, errors.New("epoch not match"))
+	timeline.Record(restore.TimelineEvent{
+		Table: "`test`.`t`", Step: restore.TimelineStepChecksum,
+	}, now.Add(-time.Minute), nil)
+	// The events aren't kept.
+	c.Assert(timeline.Len(), Equals, 0)
+
+	steps := timeline.Steps()
+	c.Assert(steps, HasLen, 3)
+	download := steps[restore.TimelineStepDownload]
+	c.Assert(download.Count, Equals, 12)
+	c.Assert(download.Retries, Equals, 12)
+	c.Assert(download.Errors, Equals, 0)
+	c.Assert(download.Duration >= int64(78000), IsTrue)
+	c.Assert(download.MaxDuration >= int64(12000), IsTrue)
+	c.Assert(steps[restore.TimelineStepIngest].Errors, Equals, 1)
+	c.Assert(steps[restore.TimelineStepChecksum].Count, Equals, 1)
+
+	// The checksum isn't a region, the fastest downloads are dropped.
+	slowest := timeline.Slowest()
+	c.Assert(slowest, HasLen, 10)
+	for i, ev := range slowest {
+		c.Assert(ev.RegionID, Equals, uint64(12-i))
+	}
+}
@@ -5,7 +5,6 @@ package restore
 import (
 	"bytes"
 	"context"
-	"encoding/hex"
 	"fmt"
 	"regexp"
 	"strings"
@@ -34,6 +33,57 @@ import (
 var recordPrefixSep = []byte("_r")
 var quoteRegexp = regexp.MustCompile("`(?:[^`]|``)*`")
 
+// RenameDatabase renames the database in the backup, so it's restored with
+// its tables into the database of the new name.
+func RenameDatabase(db *utils.Database, name model.CIStr) {
+	log.Info("rename database", zap.Stringer("db", db.Info.Name), zap.Stringer("to", name))
+	db.Info.Name = name
+	for _, table := range db.Tables {
+		table.DB.Name = name
+		// The stats are loaded into the table found by the names.
+		if table.Stats != nil && table.Stats.DatabaseName != "" {
+			table.Stats.DatabaseName = name.O
+		}
+	}
+}
+
+// RenameTable renames the table in the backup, so it's restored into the
+// database with the new name.
+func RenameTable(table *utils.Table, db *model.DBInfo, name model.CIStr) {
+	log.Info("rename table", zap.Stringer("db", table.DB.Name), zap.Stringer("table", table.Info.Name),
+		zap.Stringer("to db", db.Name), zap.Stringer("to", name))
+	table.DB = db
+	table.Info.Name = name
+	if table.Stats != nil && table.Stats.TableName != "" {
+		table.Stats.DatabaseName = db.Name.O
+		table.Stats.TableName = name.O
+	}
+}
+
+// CheckPartitions checks every partition of the old table has a partition
+// of the same name in the new table, or the data of the partition can't be
+// rewritten into the new table.
+func CheckPartitions(newTable, oldTable *model.TableInfo) error {
+	if oldTable.Partition == nil {
+		return nil
+	}
+	if newTable.Partition == nil {
+		return errors.Annotatef(berrors.ErrRestoreTableIDMismatch,
+			"table %s is partitioned in the backup but not in the cluster", oldTable.Name)
+	}
+	destParts := make(map[string]struct{}, len(newTable.Partition.Definitions))
+	for _, destPart := range newTable.Partition.Definitions {
+		destParts[destPart.Name.L] = struct{}{}
+	}
+	for _, srcPart := range oldTable.Partition.Definitions {
+		if _, ok := destParts[srcPart.Name.L]; !ok {
+			return errors.Annotatef(berrors.ErrRestoreTableIDMismatch,
+				"partition %s of table %s doesn't exist in the cluster", srcPart.Name, oldTable.Name)
+		}
+	}
+	return nil
+}
+
 // GetRewriteRules returns the rewrite rule of the new table and the old table.
 func GetRewriteRules(
 	newTable *model.TableInfo,
@@ -45,7 +95,7 @@ func GetRewriteRules(
 	if oldTable.Partition != nil {
 		for _, srcPart := range oldTable.Partition.Definitions {
 			for _, destPart := range newTable.Partition.Definitions {
-				if srcPart.Name == destPart.Name {
+				if srcPart.Name.L == destPart.Name.L {
 					tableIDs[srcPart.ID] = destPart.ID
 				}
 			}
@@ -426,7 +476,8 @@ func SplitRanges(
 		elapsed := time.Since(start)
 		summary.CollectDuration("split region", elapsed)
 	}()
-	splitter := NewRegionSplitter(NewSplitClient(client.GetPDClient(), client.GetTLSConfig()))
+	splitter := NewRegionSplitter(NewSplitClient(client.GetPDClient(), client.GetTLSConfig(), client.dialOpts...))
+	splitter.SetTimeline(client.timeline)
 
 	return splitter.Split(ctx, ranges, rewriteRules, func(keys [][]byte) {
 		for range keys {
@@ -480,7 +531,7 @@ func PaginateScanRegion(
 ) ([]*RegionInfo, error) {
 	if len(endKey) != 0 && bytes.Compare(startKey, endKey) >= 0 {
 		return nil, errors.Annotatef(berrors.ErrRestoreInvalidRange, "startKey >= endKey, startKey %s, endkey %s",
-			hex.EncodeToString(startKey), hex.EncodeToString(endKey))
+			logutil.WrapKey(startKey), logutil.WrapKey(endKey))
 	}
 
 	regions := []*RegionInfo{}
@@ -10,6 +10,7 @@ import (
 	"github.com/pingcap/kvproto/pkg/backup"
 	"github.com/pingcap/kvproto/pkg/import_sstpb"
 	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb/tablecodec"
 	"github.com/pingcap/tidb/util/codec"
 
@@ -39,6 +40,34 @@ func (s *testRestoreUtilSuite) TestParseQuoteName(c *C) {
 	c.Assert(table, Equals, ".")
 }
 
+func (s *testRestoreUtilSuite) TestPartitionRewriteRules(c *C) {
+	partitions := func(defs ...model.PartitionDefinition) *model.PartitionInfo {
+		return &model.PartitionInfo{Definitions: defs}
+	}
+	oldTable := &model.TableInfo{ID: 1, Partition: partitions(
+		model.PartitionDefinition{ID: 2, Name: model.NewCIStr("p0")},
+		model.PartitionDefinition{ID: 3, Name: model.NewCIStr("p1")},
+	)}
+	newTable := &model.TableInfo{ID: 11, Partition: partitions(
+		model.PartitionDefinition{ID: 13, Name: model.NewCIStr("P1")},
+		model.PartitionDefinition{ID: 12, Name: model.NewCIStr("P0")},
+	)}
+	c.Assert(restore.CheckPartitions(newTable, oldTable), IsNil)
+	rules := restore.GetRewriteRules(newTable, oldTable, 0)
+	prefixes := make(map[string]string)
+	for _, rule := range rules.Table {
+		prefixes[string(rule.OldKeyPrefix)] = string(rule.NewKeyPrefix)
+	}
+	c.Assert(prefixes, HasLen, 3)
+	c.Assert(prefixes[string(tablecodec.EncodeTablePrefix(2))], Equals, string(tablecodec.EncodeTablePrefix(12)))
+	c.Assert(prefixes[string(tablecodec.EncodeTablePrefix(3))], Equals, string(tablecodec.EncodeTablePrefix(13)))
+
+	newTable.Partition = partitions(model.PartitionDefinition{ID: 12, Name: model.NewCIStr("p0")})
+	c.Assert(restore.CheckPartitions(newTable, oldTable), ErrorMatches, ".*partition p1 of table .* doesn't exist.*")
+	newTable.Partition = nil
+	c.Assert(restore.CheckPartitions(newTable, oldTable), ErrorMatches, ".*partitioned in the backup but not in the cluster.*")
+}
+
 func (s *testRestoreUtilSuite) TestGetSSTMetaFromFile(c *C) {
 	file := &backup.File{
 		Name:     "file_write.sst",
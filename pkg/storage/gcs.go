@@ -124,6 +124,16 @@ func (s *gcsStorage) FileExists(ctx context.Context, name string) (bool, error)
 	return true, nil
 }
 
+// DeleteFile deletes the file, it's not an error if the file doesn't exist.
+func (s *gcsStorage) DeleteFile(ctx context.Context, name string) error {
+	object := s.gcs.Prefix + name
+	err := s.bucket.Object(object).Delete(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil
+	}
+	return err
+}
+
 // Open a Reader by file path.
 func (s *gcsStorage) Open(ctx context.Context, path string) (ReadSeekCloser, error) {
 	// TODO, implement this if needed
@@ -145,10 +155,27 @@ func (s *gcsStorage) URI() string {
 	return "gcs://" + s.gcs.Bucket + "/" + s.gcs.Prefix
 }
 
-// CreateUploader implenments ExternalStorage interface.
+type gcsUploader struct {
+	wc *storage.Writer
+}
+
+func (u *gcsUploader) UploadPart(ctx context.Context, data []byte) error {
+	_, err := u.wc.Write(data)
+	return err
+}
+
+func (u *gcsUploader) CompleteUpload(ctx context.Context) error {
+	return u.wc.Close()
+}
+
+// CreateUploader implenments ExternalStorage interface. The object is written
+// by a single resumable upload, which is finished by CompleteUpload.
 func (s *gcsStorage) CreateUploader(ctx context.Context, name string) (Uploader, error) {
-	// TODO, implement this if needed
-	panic("gcs storage not support multi-upload")
+	object := s.gcs.Prefix + name
+	wc := s.bucket.Object(object).NewWriter(ctx)
+	wc.StorageClass = s.gcs.StorageClass
+	wc.PredefinedACL = s.gcs.PredefinedAcl
+	return &gcsUploader{wc: wc}, nil
 }
 
 func newGCSStorage(ctx context.Context, gcs *backup.GCS, opts *ExternalStorageOptions) (*gcsStorage, error) {
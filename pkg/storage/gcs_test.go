@@ -59,6 +59,15 @@ func (r *testStorageSuite) TestGCS(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(exist, IsFalse)
 
+	uploader, err := stg.CreateUploader(ctx, "parts")
+	c.Assert(err, IsNil)
+	c.Assert(uploader.UploadPart(ctx, []byte("da")), IsNil)
+	c.Assert(uploader.UploadPart(ctx, []byte("ta")), IsNil)
+	c.Assert(uploader.CompleteUpload(ctx), IsNil)
+	d, err = stg.Read(ctx, "parts")
+	c.Assert(err, IsNil)
+	c.Assert(d, DeepEquals, []byte("data"))
+
 	c.Assert(stg.URI(), Equals, "gcs://testbucket/a/b/")
 }
 
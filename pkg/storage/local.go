@@ -21,6 +21,10 @@ type LocalStorage struct {
 
 func (l *LocalStorage) Write(ctx context.Context, name string, data []byte) error {
 	path := filepath.Join(l.base, name)
+	// The name may be in a directory like the keys of the cloud storages.
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Trace(err)
+	}
 	return ioutil.WriteFile(path, data, 0644) // nolint:gosec
 	// the backup meta file _is_ intended to be world-readable.
 }
@@ -36,6 +40,16 @@ func (l *LocalStorage) FileExists(ctx context.Context, name string) (bool, error
 	return pathExists(path)
 }
 
+// DeleteFile implement ExternalStorage.DeleteFile.
+func (l *LocalStorage) DeleteFile(ctx context.Context, name string) error {
+	path := filepath.Join(l.base, name)
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return errors.Trace(err)
+}
+
 // WalkDir traverse all the files in a dir.
 //
 // fn is the function called for each regular file visited by WalkDir.
@@ -61,3 +61,19 @@ func (r *testStorageSuite) TestWalkDirWithSoftLinkFile(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(i, Equals, 2)
 }
+
+func (r *testStorageSuite) TestDeleteFile(c *C) {
+	dir := c.MkDir()
+	sb, err := ParseBackend(fmt.Sprintf("file://%s", dir), &BackendOptions{})
+	c.Assert(err, IsNil)
+	store, err := Create(context.TODO(), sb, true)
+	c.Assert(err, IsNil)
+
+	c.Assert(store.Write(context.TODO(), "file", []byte("data")), IsNil)
+	c.Assert(store.DeleteFile(context.TODO(), "file"), IsNil)
+	exists, err := store.FileExists(context.TODO(), "file")
+	c.Assert(err, IsNil)
+	c.Assert(exists, IsFalse)
+	// Deleting a file not existing is fine.
+	c.Assert(store.DeleteFile(context.TODO(), "file"), IsNil)
+}
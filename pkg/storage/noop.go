@@ -23,6 +23,11 @@ func (*noopStorage) FileExists(ctx context.Context, name string) (bool, error) {
 	return false, nil
 }
 
+// DeleteFile deletes the file.
+func (*noopStorage) DeleteFile(ctx context.Context, name string) error {
+	return nil
+}
+
 // Open a Reader by file path.
 func (*noopStorage) Open(ctx context.Context, path string) (ReadSeekCloser, error) {
 	return noopReader{}, nil
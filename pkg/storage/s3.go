@@ -362,6 +362,17 @@ func (rs *S3Storage) FileExists(ctx context.Context, file string) (bool, error)
 	return true, nil
 }
 
+// DeleteFile deletes the file on s3 storage, s3 doesn't fail on deleting
+// a file not existing.
+func (rs *S3Storage) DeleteFile(ctx context.Context, file string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(rs.options.Bucket),
+		Key:    aws.String(rs.options.Prefix + file),
+	}
+	_, err := rs.svc.DeleteObjectWithContext(ctx, input)
+	return err
+}
+
 // WalkDir traverse all the files in a dir.
 //
 // fn is the function called for each regular file visited by WalkDir.
@@ -39,7 +39,13 @@ type LogCollector interface {
 
 	SetSuccessStatus(success bool)
 
+	SetPhase(phase string)
+
+	Phase() string
+
 	Summary(name string)
+
+	Report(name string, err error) *Report
 }
 
 type logFunc func(msg string, fields ...zap.Field)
@@ -77,6 +83,9 @@ type logCollector struct {
 	ints             map[string]int
 	uints            map[string]uint64
 	successStatus    bool
+	phase            string
+	phaseStart       time.Time
+	phaseDurations   map[string]time.Duration
 	startTime        time.Time
 
 	log logFunc
@@ -93,6 +102,7 @@ func NewLogCollector(log logFunc) LogCollector {
 		durations:        make(map[string]time.Duration),
 		ints:             make(map[string]int),
 		uints:            make(map[string]uint64),
+		phaseDurations:   make(map[string]time.Duration),
 		log:              log,
 		startTime:        time.Now(),
 	}
@@ -150,6 +160,23 @@ func (tc *logCollector) SetSuccessStatus(success bool) {
 	tc.successStatus = success
 }
 
+func (tc *logCollector) SetPhase(phase string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	now := time.Now()
+	if tc.phase != "" {
+		tc.phaseDurations[tc.phase] += now.Sub(tc.phaseStart)
+	}
+	tc.phase = phase
+	tc.phaseStart = now
+}
+
+func (tc *logCollector) Phase() string {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.phase
+}
+
 func (tc *logCollector) Summary(name string) {
 	tc.mu.Lock()
 	defer func() {
@@ -185,6 +212,9 @@ func (tc *logCollector) Summary(name string) {
 		for unitName, reason := range tc.failureReasons {
 			logFields = append(logFields, zap.String("unitName", unitName), zap.Error(reason))
 		}
+		if tc.phase != "" {
+			logFields = append(logFields, zap.String("failed phase", tc.phase))
+		}
 		log.Info(name+" Failed summary : "+msg, logFields...)
 		return
 	}
@@ -216,3 +246,28 @@ func (tc *logCollector) Summary(name string) {
 func SetLogCollector(l LogCollector) {
 	collector = l
 }
+
+func (tc *logCollector) Report(name string, err error) *Report {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	report := &Report{
+		Command:    name,
+		Success:    err == nil && tc.successStatus,
+		BackupTS:   tc.uints["BackupTS"],
+		TotalKVs:   tc.successData[TotalKV],
+		TotalBytes: tc.successData[TotalBytes],
+		Duration:   time.Since(tc.startTime).Seconds(),
+		Phases:     make(map[string]float64, len(tc.phaseDurations)+1),
+	}
+	for phase, d := range tc.phaseDurations {
+		report.Phases[phase] = d.Seconds()
+	}
+	if tc.phase != "" {
+		report.Phases[tc.phase] += time.Since(tc.phaseStart).Seconds()
+	}
+	if err != nil {
+		report.FailedPhase = tc.phase
+		report.setError(err)
+	}
+	return report
+}
@@ -7,7 +7,10 @@ import (
 	"time"
 
 	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
 	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
 )
 
 func TestT(t *testing.T) {
@@ -47,3 +50,28 @@ func (suit *testCollectorSuite) TestSumDurationInt(c *C) {
 	assertContains(zap.Duration("b", 2*time.Second))
 	assertContains(zap.Int("c", 4))
 }
+
+func (suit *testCollectorSuite) TestReport(c *C) {
+	col := NewLogCollector(func(string, ...zap.Field) {})
+	col.SetPhase("prepare")
+	col.CollectUInt("BackupTS", 42)
+	col.SetPhase("backup ranges")
+	col.CollectSuccessUnit(TotalKV, 1, uint64(10))
+	col.CollectSuccessUnit(TotalBytes, 1, uint64(100))
+	col.SetSuccessStatus(true)
+	col.Summary("foo")
+
+	report := col.Report("foo", nil)
+	c.Assert(report.Success, IsTrue)
+	c.Assert(report.BackupTS, Equals, uint64(42))
+	c.Assert(report.TotalKVs, Equals, uint64(10))
+	c.Assert(report.TotalBytes, Equals, uint64(100))
+	c.Assert(report.Phases, HasLen, 2)
+	c.Assert(report.Error, Equals, "")
+
+	report = col.Report("foo", errors.Annotate(berrors.ErrBackupFilesConflict, "2 pairs of files conflict"))
+	c.Assert(report.Success, IsFalse)
+	c.Assert(report.FailedPhase, Equals, "backup ranges")
+	c.Assert(report.Error, Matches, ".*2 pairs of files conflict.*")
+	c.Assert(report.ErrorCode, Equals, "BR:Backup:ErrBackupFilesConflict")
+}
@@ -0,0 +1,33 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package summary
+
+import (
+	"github.com/pingcap/errors"
+)
+
+// Report is the machine-readable summary of a task, printed in a single line
+// of JSON when the task exits, so the automation doesn't parse the log.
+type Report struct {
+	Command    string `json:"command"`
+	Success    bool   `json:"success"`
+	BackupTS   uint64 `json:"backup-ts,omitempty"`
+	TotalKVs   uint64 `json:"total-kv"`
+	TotalBytes uint64 `json:"total-bytes"`
+	// Duration and Phases are in seconds, Phases are the time spent in every
+	// phase of the task.
+	Duration    float64            `json:"duration"`
+	Phases      map[string]float64 `json:"phases"`
+	FailedPhase string             `json:"failed-phase,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	// ErrorCode is the code of the error defined by BR, e.g.
+	// BR:Backup:ErrBackupFilesConflict, it's empty for the other errors.
+	ErrorCode string `json:"error-code,omitempty"`
+}
+
+func (r *Report) setError(err error) {
+	r.Error = err.Error()
+	if e, ok := errors.Cause(err).(*errors.Error); ok {
+		r.ErrorCode = string(e.RFCCode())
+	}
+}
@@ -39,7 +39,24 @@ func SetSuccessStatus(success bool) {
 	collector.SetSuccessStatus(success)
 }
 
+// SetPhase records the phase the task is running in,
+// the last phase is reported if the task fails.
+func SetPhase(phase string) {
+	collector.SetPhase(phase)
+}
+
+// Phase returns the phase the task is running in.
+func Phase() string {
+	return collector.Phase()
+}
+
 // Summary outputs summary log.
 func Summary(name string) {
 	collector.Summary(name)
 }
+
+// BuildReport returns the machine-readable summary of the task, which failed
+// if the error isn't nil.
+func BuildReport(name string, err error) *Report {
+	return collector.Report(name, err)
+}
@@ -4,6 +4,7 @@ package task
 
 import (
 	"context"
+	"crypto/ed25519"
 	"strconv"
 	"strings"
 	"time"
@@ -19,11 +20,15 @@ import (
 	"github.com/pingcap/tidb/sessionctx/variable"
 	"github.com/pingcap/tidb/types"
 	"github.com/spf13/pflag"
+	pd "github.com/tikv/pd/client"
 	"go.uber.org/zap"
 
 	"github.com/pingcap/br/pkg/backup"
+	"github.com/pingcap/br/pkg/conn"
 	berrors "github.com/pingcap/br/pkg/errors"
 	"github.com/pingcap/br/pkg/glue"
+	"github.com/pingcap/br/pkg/metautil"
+	"github.com/pingcap/br/pkg/rtree"
 	"github.com/pingcap/br/pkg/storage"
 	"github.com/pingcap/br/pkg/summary"
 )
@@ -36,11 +41,40 @@ const (
 	flagCompressionLevel = "compression-level"
 	flagRemoveSchedulers = "remove-schedulers"
 	flagIgnoreStats      = "ignore-stats"
+	flagWindow           = "window"
+	flagResume           = "resume"
+
+	flagIncludeSystemTables = "include-system-tables"
+	flagSchemaOnly          = "schema-only"
+	flagSplitRegionSize     = "split-region-size"
+	flagIgnoreStoresDown    = "ignore-stores-down"
+	flagAutoTune            = "auto-tune"
+	flagRangesFile          = "ranges-file"
+	flagUploadJobLog        = "upload-job-log"
+	flagIgnoreDupFiles      = "ignore-dup-files"
+	flagStrictFileNames     = "strict-file-names"
+	flagMetaVersion         = "backupmeta-version"
+	flagMetaSignKey         = "backupmeta-sign-key"
 
 	flagGCTTL = "gcttl"
 
+	backupRateLimitPath   = "/backup/ratelimit"
+	backupConcurrencyPath = "/backup/concurrency"
+
 	defaultBackupConcurrency = 4
 	maxBackupConcurrency     = 256
+	// defaultAutoTuneMaxConcurrency is the upper bound of the tuned
+	// concurrency if the concurrency isn't set.
+	defaultAutoTuneMaxConcurrency = 32
+
+	// maxSplitRegionRounds limits the times a large region is split in half,
+	// the sizes of the new regions are unknown until they report to PD.
+	maxSplitRegionRounds    = 3
+	splitRegionWaitInterval = 5 * time.Second
+
+	// checkpointSafePointTTL is the TTL in seconds of the service safe point
+	// kept for the backup stopped halfway, which is resumed from its checkpoint.
+	checkpointSafePointTTL = 24 * 60 * 60
 )
 
 // CompressionConfig is the configuration for sst file compression.
@@ -59,6 +93,47 @@ type BackupConfig struct {
 	GCTTL            int64         `json:"gc-ttl" toml:"gc-ttl"`
 	RemoveSchedulers bool          `json:"remove-schedulers" toml:"remove-schedulers"`
 	IgnoreStats      bool          `json:"ignore-stats" toml:"ignore-stats"`
+	// Window is the daily time window to run the backup in, e.g. "22:00-06:00".
+	Window string `json:"window" toml:"window"`
+	// Resume continues the backup from the checkpoint in the storage.
+	Resume bool `json:"resume" toml:"resume"`
+	// IncludeSystemTables backs up the tables of the mysql database too.
+	IncludeSystemTables bool `json:"include-system-tables" toml:"include-system-tables"`
+	// SchemaOnly backs up the definitions of databases and tables without data,
+	// the statistics of the tables are backed up too unless IgnoreStats.
+	SchemaOnly bool `json:"schema-only" toml:"schema-only"`
+	// SplitRegionSize is the size in MiB, the regions larger than it are
+	// split before the backup, 0 means never split.
+	SplitRegionSize uint64 `json:"split-region-size" toml:"split-region-size"`
+	// IgnoreStoresDown goes on backing up when a store is unreachable.
+	IgnoreStoresDown bool `json:"ignore-stores-down" toml:"ignore-stores-down"`
+	// AutoTune tunes the concurrency and the rate limit by the load of the
+	// stores, they are the upper bounds of the tuned values.
+	AutoTune bool `json:"auto-tune" toml:"auto-tune"`
+	// RangesFile is the path of a JSON file of the ranges to back up instead
+	// of the whole tables, see RangeSpec.
+	RangesFile string `json:"ranges-file" toml:"ranges-file"`
+	// UploadJobLog uploads the log file and the result of the backup with
+	// the backupmeta.
+	UploadJobLog bool `json:"upload-job-log" toml:"upload-job-log"`
+	// IgnoreDupFiles saves the backupmeta even if some files have the same
+	// name or overlapping ranges.
+	IgnoreDupFiles bool `json:"ignore-dup-files" toml:"ignore-dup-files"`
+	// StrictFileNames fails the backup if the names of some files don't
+	// follow the scheme, they are only warned by default.
+	StrictFileNames bool `json:"strict-file-names" toml:"strict-file-names"`
+	// MetaVersion is the layout of the backupmeta, the files and schemas are
+	// written into sharded meta files in version 2.
+	MetaVersion int `json:"backupmeta-version" toml:"backupmeta-version"`
+	// MetaSignKey is the path of the ed25519 private key signing the
+	// backupmeta, empty means it isn't signed.
+	MetaSignKey string `json:"backupmeta-sign-key" toml:"backupmeta-sign-key"`
+	// Catalog is the storage recording the backups, empty means the backup
+	// isn't recorded.
+	Catalog string `json:"catalog" toml:"catalog"`
+	// LogFile is the log file of BR, set by the caller, empty means the
+	// log is written to the terminal.
+	LogFile string `json:"-" toml:"-"`
 	CompressionConfig
 }
 
@@ -72,11 +147,44 @@ func DefineBackupFlags(flags *pflag.FlagSet) {
 	flags.Uint64(flagLastBackupTS, 0, "(experimental) the last time backup ts,"+
 		" use for incremental backup, support TSO only")
 	flags.String(flagBackupTS, "", "the backup ts support TSO or datetime,"+
-		" e.g. '400036290571534337', '2018-05-11 01:42:23'")
+		" e.g. '400036290571534337', '2018-05-11 01:42:23', '2018-05-11 01:42:23+08:00',"+
+		" the datetime without time zone is in the local time zone")
 	flags.Int64(flagGCTTL, utils.DefaultBRGCSafePointTTL, "the TTL (in seconds) that PD holds for BR's GC safepoint")
 	flags.String(flagCompressionType, "zstd",
 		"backup sst file compression algorithm, value can be one of 'lz4|zstd|snappy'")
-	flags.Int32(flagCompressionLevel, 0, "compression level used for sst file compression")
+	flags.String(flagWindow, "", "the daily time window of the local clock to run the backup in,"+
+		" e.g. '22:00-06:00', the backup waits for the window to start and is suspended once it ends,"+
+		" then it's resumed from its checkpoint in the next window, the GC safe point is kept meanwhile")
+	flags.Bool(flagResume, false, "continue the interrupted backup in the storage from its checkpoint,"+
+		" the backupts and lastbackupts of the interrupted backup are used")
+	flags.Bool(flagIncludeSystemTables, false, "back up the tables of the mysql database too, e.g. the users,"+
+		" privileges and bindings, they are restored only with --"+flagIncludeSystemTables)
+	flags.Bool(flagSchemaOnly, false, "only back up the definitions and the statistics of the databases and tables,"+
+		" without any data")
+	flags.Uint64(flagSplitRegionSize, 0, "split the regions larger than the size (in MiB) before the backup,"+
+		" so a failure of a large region doesn't back up the whole region again, 0 means never split")
+	flags.Bool(flagIgnoreStoresDown, false, "go on when a store is unreachable, its regions are backed up"+
+		" from the other replicas once they become leaders, fails only if all replicas of a region are unreachable")
+	flags.String(flagRangesFile, "", "back up the ranges in the JSON file instead of the whole tables, each range"+
+		` is {"start-key": "<hex>", "end-key": "<hex>"} or {"table": "db.table", "index": "<optional index>"}`)
+	flags.Bool(flagAutoTune, false, "tune the number of ranges backed up concurrently and the rate limit"+
+		" by the CPU usage and the write stalls of the TiKV stores, sampled from their status addresses,"+
+		" the concurrency and the rate limit set are the upper bounds")
+	flags.Bool(flagUploadJobLog, false, "upload the log file and the result of the backup into the storage"+
+		" after the backup succeeds, they are saved as "+utils.JobLogFile+" and "+utils.JobResultFile)
+	flags.Bool(flagIgnoreDupFiles, false, "save the backupmeta even if some backup files have the same name"+
+		" or overlapping ranges, by default the backup fails without backupmeta")
+	flags.Bool(flagStrictFileNames, false, "fail the backup if the names of some backup files don't follow "+
+		backup.FileNameScheme+", by default they are warned")
+	flags.Int(flagMetaVersion, metautil.MetaV1, "the layout of the backupmeta, 2 writes the files and schemas"+
+		" into sharded meta files for the backups of millions of files, which can't be restored by the old BR")
+	flags.String(flagMetaSignKey, "", "the path of the ed25519 private key in PKCS #8 PEM to sign the backupmeta,"+
+		" the restore verifies the signature with the public key given by --"+flagMetaVerifyKey)
+	flags.String(flagCatalog, "", "the storage of the catalog to record the backup into, usually the parent of"+
+		" the backups, so `br list` finds the restore chains without reading every backupmeta")
+	flags.Int32(flagCompressionLevel, 0,
+		"compression level used for sst file compression, 0 means the default level of the algorithm,"+
+			" not supported by snappy")
 
 	flags.Bool(flagRemoveSchedulers, false,
 		"disable the balance, shuffle and region-merge schedulers in PD to speed up backup")
@@ -116,6 +224,81 @@ func (cfg *BackupConfig) ParseFromFlags(flags *pflag.FlagSet) error {
 		return errors.Trace(err)
 	}
 	cfg.GCTTL = gcTTL
+	cfg.Window, err = flags.GetString(flagWindow)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.Window != "" {
+		if _, err = utils.ParseTimeWindow(cfg.Window); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	cfg.Resume, err = flags.GetBool(flagResume)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.IncludeSystemTables, err = flags.GetBool(flagIncludeSystemTables)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	schemaOnly, err := flags.GetBool(flagSchemaOnly)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.SplitRegionSize, err = flags.GetUint64(flagSplitRegionSize)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.IgnoreStoresDown, err = flags.GetBool(flagIgnoreStoresDown)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.AutoTune, err = flags.GetBool(flagAutoTune)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.RangesFile, err = flags.GetString(flagRangesFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.UploadJobLog, err = flags.GetBool(flagUploadJobLog)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.IgnoreDupFiles, err = flags.GetBool(flagIgnoreDupFiles)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.StrictFileNames, err = flags.GetBool(flagStrictFileNames)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.MetaVersion, err = flags.GetInt(flagMetaVersion)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.MetaVersion != metautil.MetaV1 && cfg.MetaVersion != metautil.MetaV2 {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s must be %d or %d", flagMetaVersion, metautil.MetaV1, metautil.MetaV2)
+	}
+	cfg.MetaSignKey, err = flags.GetString(flagMetaSignKey)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.Catalog, err = flags.GetString(flagCatalog)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// `backup schema-only` sets SchemaOnly before parsing the flags.
+	cfg.SchemaOnly = cfg.SchemaOnly || schemaOnly
+	if cfg.SchemaOnly && cfg.Resume {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s can't be used with --%s", flagSchemaOnly, flagResume)
+	}
+	if cfg.SchemaOnly && cfg.RangesFile != "" {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s can't be used with --%s", flagSchemaOnly, flagRangesFile)
+	}
 
 	compressionCfg, err := parseCompressionFlags(flags)
 	if err != nil {
@@ -148,6 +331,10 @@ func parseCompressionFlags(flags *pflag.FlagSet) (*CompressionConfig, error) {
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	if compressionType == kvproto.CompressionType_SNAPPY && level != 0 {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s is not supported by snappy", flagCompressionLevel)
+	}
 	return &CompressionConfig{
 		CompressionLevel: level,
 		CompressionType:  compressionType,
@@ -166,6 +353,14 @@ func (cfg *BackupConfig) adjustBackupConfig() {
 	if cfg.Config.Concurrency > maxBackupConcurrency {
 		cfg.Config.Concurrency = maxBackupConcurrency
 	}
+	// TiKV limits the rate of each backup request, ranges backed up in parallel
+	// would multiply the rate of a store, so back up one range at a time.
+	if cfg.RateLimit != 0 && cfg.Config.Concurrency > 1 {
+		log.Warn("the concurrency is set to 1 because the rate limit is per request",
+			zap.Uint32("concurrency", cfg.Config.Concurrency),
+			zap.Uint64("rate limit", cfg.RateLimit))
+		cfg.Config.Concurrency = 1
+	}
 
 	if cfg.GCTTL == 0 {
 		cfg.GCTTL = utils.DefaultBRGCSafePointTTL
@@ -178,55 +373,141 @@ func (cfg *BackupConfig) adjustBackupConfig() {
 
 // RunBackup starts a backup task inside the current goroutine.
 func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig) error {
+	if cfg.Window == "" {
+		return runBackup(c, g, cmdName, cfg, nil)
+	}
+	window, err := utils.ParseTimeWindow(cfg.Window)
+	if err != nil {
+		return err
+	}
+	resume := cfg.Resume
+	for {
+		// Each run adjusts its own copy of the config.
+		runCfg := *cfg
+		runCfg.Resume = resume
+		err = runBackup(c, g, cmdName, &runCfg, &window)
+		// Only the binary saves the checkpoint, BRIE is suspended for good.
+		if !berrors.ErrBackupWindowExceeded.Equal(errors.Cause(err)) || !g.OwnsStorage() {
+			return err
+		}
+		// The suspended run tells whether it left a checkpoint to resume from.
+		resume = runCfg.Resume
+		log.Warn("the backup is suspended, it continues in the next window",
+			zap.Bool("resume", resume), zap.Error(err))
+	}
+}
+
+// runBackup runs the backup once, in the window if it isn't nil.
+func runBackup(
+	c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig, window *utils.TimeWindow,
+) (err error) {
+	// Leave the fine grained backup auto-scaled by the number of stores
+	// unless the concurrency is set.
+	concurrencySet := cfg.Concurrency != 0
 	cfg.adjustBackupConfig()
 
+	startTime := time.Now()
 	defer summary.Summary(cmdName)
+	summary.SetPhase(phasePrepare)
 	ctx, cancel := context.WithCancel(c)
 	defer cancel()
 
+	if window != nil {
+		if err = waitForWindow(ctx, *window); err != nil {
+			return err
+		}
+		var windowCancel context.CancelFunc
+		ctx, windowCancel = context.WithDeadline(ctx, window.End(time.Now()))
+		defer windowCancel()
+		defer func() {
+			if err != nil && windowExceeded(c, ctx) {
+				err = errors.Annotatef(berrors.ErrBackupWindowExceeded,
+					"the backup is suspended at the end of window %s: %v", cfg.Window, err)
+			}
+		}()
+	}
+
 	u, err := storage.ParseBackend(cfg.Storage, &cfg.BackendOptions)
 	if err != nil {
 		return err
 	}
-	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements)
+	var rangeSpecs []RangeSpec
+	if cfg.RangesFile != "" {
+		if rangeSpecs, err = loadRangesFile(cfg.RangesFile); err != nil {
+			return err
+		}
+	}
+	var signKey ed25519.PrivateKey
+	if cfg.MetaSignKey != "" {
+		if signKey, err = metautil.LoadSignKey(cfg.MetaSignKey); err != nil {
+			return err
+		}
+	}
+	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements,
+		cfg.GRPCDialOptions...)
 	if err != nil {
 		return err
 	}
 	defer mgr.Close()
-
-	client, err := backup.NewBackupClient(ctx, mgr)
+	cfg.keepDiscoveringPD(ctx, mgr)
+	unregister, err := registerTask(ctx, g, cfg.PD, mgr.GetTLSConfig(), cmdName, cfg.ForceConcurrent)
 	if err != nil {
 		return err
 	}
-	if err = client.SetStorage(ctx, u, cfg.SendCreds); err != nil {
-		return err
-	}
-	err = client.SetLockFile(ctx)
+	defer unregister()
+	source := newSourceCluster(ctx, mgr, commandArgs(g), startTime)
+
+	client, safePointID, err := prepareBackupClient(ctx, g, mgr, u, cfg)
 	if err != nil {
 		return err
 	}
-	client.SetGCTTL(cfg.GCTTL)
+	// Leave the state in the storage if the backup stops halfway, e.g. it's
+	// interrupted by a signal, the completed ranges are in the checkpoint.
+	defer func() {
+		if err == nil {
+			return
+		}
+		saveCtx := ctx
+		if saveCtx.Err() != nil {
+			log.Warn("context canceled, saving partial state with background context")
+			saveCtx = context.Background()
+		}
+		if e := client.SavePartialState(saveCtx, summary.Phase(), err); e != nil {
+			log.Warn("failed to save partial state", zap.Error(e))
+		}
+		client.AbortBackupMeta(saveCtx)
+	}()
+	filesChecker := configureBackupClient(client, cfg, signKey, concurrencySet)
+	defer setBackupTunables(client, cfg)()
+	if cfg.AutoTune {
+		client.EnableAutoTune(mgr.NewStoreLoadSampler().Sample, uint(cfg.Concurrency))
+	}
 
 	backupTS, err := client.GetTS(ctx, cfg.TimeAgo, cfg.BackupTS)
 	if err != nil {
 		return err
 	}
 	g.Record("BackupTS", backupTS)
-	sp := utils.BRServiceSafePoint{
-		BackupTS: backupTS,
-		TTL:      client.GetGCTTL(),
-		ID:       utils.MakeSafePointID(),
+	summary.CollectUint("BackupTS", backupTS)
+	catalogEntry := CatalogEntry{
+		Storage:      storage.FormatBackendURL(u).String(),
+		Type:         CatalogTypeFull,
+		BackupTS:     backupTS,
+		LastBackupTS: cfg.LastBackupTS,
+		StartTime:    startTime,
 	}
-	// use lastBackupTS as safePoint if exists
 	if cfg.LastBackupTS > 0 {
-		sp.BackupTS = cfg.LastBackupTS
+		catalogEntry.Type = CatalogTypeIncremental
 	}
-
-	log.Info("current backup safePoint job",
-		zap.Object("safePoint", sp))
-	utils.StartServiceSafePointKeeper(ctx, mgr.GetPDClient(), sp)
-
-	isIncrementalBackup := cfg.LastBackupTS > 0
+	if cfg.Catalog != "" {
+		record := catalogRecorder(ctx, cfg.Catalog, &cfg.Config, &catalogEntry)
+		defer func() { record(err) }()
+	}
+	releaseSP, err := keepBackupSafePoint(c, ctx, mgr, client, cfg, window, backupTS, safePointID)
+	if err != nil {
+		return err
+	}
+	defer func() { releaseSP(err) }()
 
 	if cfg.RemoveSchedulers {
 		log.Debug("removing some PD schedulers")
@@ -246,6 +527,7 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 	}
 
 	req := kvproto.BackupRequest{
+		ClusterId:        client.GetClusterID(),
 		StartVersion:     cfg.LastBackupTS,
 		EndVersion:       backupTS,
 		RateLimit:        cfg.RateLimit,
@@ -255,7 +537,7 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 	}
 
 	ranges, backupSchemas, err := backup.BuildBackupRangeAndSchema(
-		mgr.GetDomain(), mgr.GetTiKV(), cfg.TableFilter, backupTS, cfg.IgnoreStats)
+		mgr.GetDomain(), mgr.GetTiKV(), cfg.TableFilter, backupTS, cfg.IgnoreStats, cfg.IncludeSystemTables)
 	if err != nil {
 		return err
 	}
@@ -268,35 +550,40 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 		pdAddress := strings.Join(cfg.PD, ",")
 		log.Warn("Nothing to backup, maybe connected to cluster for restoring",
 			zap.String("PD address", pdAddress))
-		return client.SaveBackupMeta(ctx, &backupMeta)
+		return client.SaveBackupMeta(ctx, &backupMeta, nil)
+	}
+
+	ddlJobs, err := incrementalDDLJobs(mgr, client, cfg, backupTS)
+	if err != nil {
+		return err
 	}
 
-	ddlJobs := make([]*model.Job, 0)
-	if isIncrementalBackup {
-		if backupTS <= cfg.LastBackupTS {
-			log.Error("LastBackupTS is larger or equal to current TS")
-			return errors.Annotate(berrors.ErrInvalidArgument, "LastBackupTS is larger or equal to current TS")
+	if cfg.SchemaOnly {
+		log.Info("skip backing up the data in schema only mode")
+		backupMeta, err2 := backup.BuildBackupMeta(&req, nil, nil, ddlJobs)
+		if err2 != nil {
+			return err2
 		}
-		err = utils.CheckGCSafePoint(ctx, mgr.GetPDClient(), cfg.LastBackupTS)
-		if err != nil {
-			log.Error("Check gc safepoint for last backup ts failed", zap.Error(err))
+		backupMeta.Schemas = backupSchemas.CopyMeta()
+		return saveBackup(ctx, g, cmdName, startTime, cfg, mgr, client, u, source, &backupMeta, nil, &catalogEntry)
+	}
+
+	if rangeSpecs != nil {
+		if ranges, err = resolveBackupRanges(mgr, cfg, rangeSpecs, backupTS, backupSchemas); err != nil {
 			return err
 		}
-		ddlJobs, err = backup.GetBackupDDLJobs(mgr.GetDomain(), cfg.LastBackupTS, backupTS)
-		if err != nil {
+	}
+
+	if cfg.SplitRegionSize > 0 {
+		if err = splitLargeRegions(ctx, mgr, ranges, cfg.SplitRegionSize); err != nil {
 			return err
 		}
 	}
 
 	// The number of regions need to backup
-	approximateRegions := 0
-	for _, r := range ranges {
-		var regionCount int
-		regionCount, err = mgr.GetRegionCount(ctx, r.StartKey, r.EndKey)
-		if err != nil {
-			return err
-		}
-		approximateRegions += regionCount
+	approximateRegions, err := countRegions(ctx, mgr, ranges)
+	if err != nil {
+		return err
 	}
 
 	summary.CollectInt("backup total regions", approximateRegions)
@@ -306,6 +593,7 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 	updateCh := g.StartProgress(
 		ctx, cmdName, int64(approximateRegions), !cfg.LogProgress)
 
+	summary.SetPhase(phaseBackupRanges)
 	files, err := client.BackupRanges(ctx, ranges, req, uint(cfg.Concurrency), updateCh)
 	if err != nil {
 		return err
@@ -319,24 +607,224 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 	}
 
 	// Checksum from server, and then fulfill the backup metadata.
-	if cfg.Checksum && !isIncrementalBackup {
+	if err = fillBackupSchemas(ctx, g, mgr, client, cfg, backupSchemas, &backupMeta, backupTS); err != nil {
+		return err
+	}
+	return saveBackup(ctx, g, cmdName, startTime, cfg, mgr, client, u, source, &backupMeta, filesChecker, &catalogEntry)
+}
+
+// prepareBackupClient creates the client backing up into the storage, which
+// is resumed from the checkpoint if required. It returns the ID of the
+// service safe point of the backup too.
+func prepareBackupClient(
+	ctx context.Context, g glue.Glue, mgr *conn.Mgr, u *kvproto.StorageBackend, cfg *BackupConfig,
+) (*backup.Client, string, error) {
+	client, err := backup.NewBackupClient(ctx, mgr)
+	if err != nil {
+		return nil, "", err
+	}
+	// Only the binary can resume the backup, don't save checkpoints in SQL.
+	if g.OwnsStorage() {
+		client.EnableCheckpoint(cfg.Resume)
+	}
+	if err = client.SetStorage(ctx, u, cfg.SendCreds); err != nil {
+		return nil, "", err
+	}
+	safePointID := utils.MakeSafePointID()
+	if cfg.Resume {
+		if safePointID, err = resumeFromCheckpoint(ctx, client, cfg, safePointID); err != nil {
+			return nil, "", err
+		}
+	}
+	if err = client.SetCheckpointOptions(safePointID, cfg.FilterRules); err != nil {
+		return nil, "", err
+	}
+	if err = client.SetLockFile(ctx); err != nil {
+		return nil, "", err
+	}
+	return client, safePointID, nil
+}
+
+// configureBackupClient applies the options of the backup to the client, it
+// returns the checker of the backup files.
+func configureBackupClient(
+	client *backup.Client, cfg *BackupConfig, signKey ed25519.PrivateKey, concurrencySet bool,
+) *filesChecker {
+	client.SetGCTTL(cfg.GCTTL)
+	client.SetMetaVersion(cfg.MetaVersion)
+	client.SetMetaSignKey(signKey)
+	filesChecker := newFilesChecker(cfg.IgnoreDupFiles, cfg.StrictFileNames)
+	client.SetFilesCheck(filesChecker.check)
+	client.SetIgnoreStoresDown(cfg.IgnoreStoresDown)
+	if concurrencySet {
+		client.SetConcurrency(uint(cfg.Concurrency))
+	}
+	if cfg.AutoTune && !concurrencySet && cfg.RateLimit == 0 {
+		cfg.Concurrency = defaultAutoTuneMaxConcurrency
+	}
+	return filesChecker
+}
+
+// keepBackupSafePoint keeps the service safe point of the backup, the returned
+// function releases it with the result of the backup. The safe point is kept
+// longer if the backup can be resumed or continues in the next window.
+func keepBackupSafePoint(
+	parent, ctx context.Context,
+	mgr *conn.Mgr,
+	client *backup.Client,
+	cfg *BackupConfig,
+	window *utils.TimeWindow,
+	backupTS uint64,
+	safePointID string,
+) (func(err error), error) {
+	if cfg.LastBackupTS > 0 {
+		// Check it before registering the service safe point, which is useless
+		// if the last backup ts has been GCed.
+		err := utils.CheckGCSafePoint(ctx, mgr.GetPDClient(), cfg.LastBackupTS)
+		if err != nil {
+			log.Error("Check gc safepoint for last backup ts failed", zap.Error(err))
+			return nil, errors.Annotatef(err, "invalid --%s", flagLastBackupTS)
+		}
+	}
+	sp := utils.BRServiceSafePoint{
+		BackupTS: backupTS,
+		TTL:      client.GetGCTTL(),
+		ID:       safePointID,
+	}
+	// use lastBackupTS as safePoint if exists
+	if cfg.LastBackupTS > 0 {
+		sp.BackupTS = cfg.LastBackupTS
+	}
+
+	log.Info("current backup safePoint job",
+		zap.Object("safePoint", sp))
+	spCtx, spCancel := context.WithCancel(ctx)
+	utils.StartServiceSafePointKeeper(spCtx, mgr.GetPDClient(), sp)
+	return func(err error) {
+		// Stop the keeper first, so the safe point won't be registered again.
+		spCancel()
+		var keepTTL int64
+		if err != nil && client.CheckpointExists() {
+			// The backup can be resumed from the checkpoint, whose snapshot
+			// mustn't be GCed in the meantime.
+			keepTTL = checkpointSafePointTTL
+		}
+		if window != nil && windowExceeded(parent, ctx) {
+			// The backup continues in the next window.
+			if ttl := nextWindowTTL(*window, time.Now(), sp.TTL); ttl > keepTTL {
+				keepTTL = ttl
+			}
+			cfg.Resume = client.CheckpointExists()
+		}
+		if releaseSafePoint(ctx, mgr.GetPDClient(), sp, keepTTL) {
+			client.SetSafePointExpireTime(time.Now().Add(time.Duration(keepTTL) * time.Second))
+		}
+	}, nil
+}
+
+// incrementalDDLJobs returns the DDL jobs since the last backup, and makes
+// the client back up the tables created since then in full. There are no
+// jobs for the full backups.
+func incrementalDDLJobs(
+	mgr *conn.Mgr, client *backup.Client, cfg *BackupConfig, backupTS uint64,
+) ([]*model.Job, error) {
+	if cfg.LastBackupTS == 0 {
+		return make([]*model.Job, 0), nil
+	}
+	if backupTS <= cfg.LastBackupTS {
+		log.Error("LastBackupTS is larger or equal to current TS")
+		return nil, errors.Annotate(berrors.ErrInvalidArgument, "LastBackupTS is larger or equal to current TS")
+	}
+	ddlJobs, err := backup.GetBackupDDLJobs(mgr.GetDomain(), cfg.LastBackupTS, backupTS)
+	if err != nil {
+		return nil, err
+	}
+	// The tables truncated or recreated since the last backup have new
+	// IDs, their ranges weren't backed up and must be backed up in full.
+	newTableRanges, err := backup.BuildNewTableRanges(
+		mgr.GetDomain(), cfg.TableFilter, cfg.LastBackupTS, backupTS, cfg.IncludeSystemTables)
+	if err != nil {
+		return nil, err
+	}
+	if len(newTableRanges) > 0 {
+		log.Info("back up the new tables since the last backup in full",
+			zap.Int("ranges", len(newTableRanges)))
+	}
+	client.SetFullRanges(newTableRanges)
+	return ddlJobs, nil
+}
+
+// resolveBackupRanges resolves the ranges of the ranges file at the backup
+// ts, and narrows the schemas to the tables of the ranges.
+func resolveBackupRanges(
+	mgr *conn.Mgr, cfg *BackupConfig, rangeSpecs []RangeSpec, backupTS uint64, backupSchemas *backup.Schemas,
+) ([]rtree.Range, error) {
+	info, err := mgr.GetDomain().GetSnapshotInfoSchema(backupTS)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ranges, err := resolveRangeSpecs(info, rangeSpecs)
+	if err != nil {
+		return nil, err
+	}
+	checksumTables := cfg.checksumMode() == ChecksumRequired && cfg.LastBackupTS == 0
+	if err = narrowSchemas(backupSchemas, ranges, checksumTables); err != nil {
+		return nil, err
+	}
+	log.Info("back up the ranges in the ranges file",
+		zap.Int("ranges", len(ranges)), zap.Int("tables", backupSchemas.Len()))
+	return ranges, nil
+}
+
+// countRegions returns the approximate number of the regions in the ranges.
+func countRegions(ctx context.Context, mgr *conn.Mgr, ranges []rtree.Range) (int, error) {
+	regions := 0
+	for _, r := range ranges {
+		count, err := mgr.GetRegionCount(ctx, r.StartKey, r.EndKey)
+		if err != nil {
+			return 0, err
+		}
+		regions += count
+	}
+	return regions, nil
+}
+
+// fillBackupSchemas fills the schemas of the backupmeta, with the checksums
+// of the tables or the files according to the checksum mode.
+func fillBackupSchemas(
+	ctx context.Context,
+	g glue.Glue,
+	mgr *conn.Mgr,
+	client *backup.Client,
+	cfg *BackupConfig,
+	backupSchemas *backup.Schemas,
+	backupMeta *kvproto.BackupMeta,
+	backupTS uint64,
+) error {
+	isIncrementalBackup := cfg.LastBackupTS > 0
+	checksumMode := cfg.checksumMode()
+	switch {
+	case checksumMode == ChecksumRequired && !isIncrementalBackup:
+		summary.SetPhase(phaseChecksum)
 		backupSchemasConcurrency := utils.MinInt(backup.DefaultSchemaConcurrency, backupSchemas.Len())
-		updateCh = g.StartProgress(
+		updateCh := g.StartProgress(
 			ctx, "Checksum", int64(backupSchemas.Len()), !cfg.LogProgress)
 		backupSchemas.Start(
 			ctx, mgr.GetTiKV(), backupTS, uint(backupSchemasConcurrency), cfg.ChecksumConcurrency, updateCh)
-		backupMeta.Schemas, err = backupSchemas.FinishTableChecksum()
+		schemas, err := backupSchemas.FinishTableChecksum()
 		if err != nil {
 			return err
 		}
+		backupMeta.Schemas = schemas
 		// Checksum has finished
 		updateCh.Close()
 		// collect file information.
-		err = checkChecksums(&backupMeta)
-		if err != nil {
-			return err
-		}
-	} else {
+		return checkChecksums(client, backupMeta)
+	case checksumMode == ChecksumOptional && !isIncrementalBackup:
+		log.Info("use the checksums of the backup files instead of checksumming the tables")
+		backupMeta.Schemas = backupSchemas.CopyMeta()
+		return fillFileChecksums(client, backupMeta)
+	default:
 		// Just... copy schemas from origin.
 		backupMeta.Schemas = backupSchemas.CopyMeta()
 		if isIncrementalBackup {
@@ -347,23 +835,247 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 			log.Info("Skip fast checksum because user requirement.")
 		}
 	}
+	return nil
+}
 
-	err = client.SaveBackupMeta(ctx, &backupMeta)
-	if err != nil {
+// saveBackup saves the backupmeta, its existence means the backup is
+// complete, then verifies the files in the storage and records the size.
+// The checker of the files is nil for the schema only backups.
+func saveBackup(
+	ctx context.Context,
+	g glue.Glue,
+	cmdName string,
+	startTime time.Time,
+	cfg *BackupConfig,
+	mgr *conn.Mgr,
+	client *backup.Client,
+	u *kvproto.StorageBackend,
+	source metautil.SourceCluster,
+	backupMeta *kvproto.BackupMeta,
+	checker *filesChecker,
+	catalogEntry *CatalogEntry,
+) error {
+	summary.SetPhase(phaseSaveMeta)
+	ext := &metautil.Extension{
+		PlacementRules:       tablePlacementRules(mgr, cfg.PD, backupMeta),
+		NewCollationsEnabled: newCollationsEnabled(),
+		SchemaVersion:        utils.SchemaVersion,
+		Source:               finishSourceCluster(source),
+	}
+	if checker != nil {
+		ext.FileNaming = checker.fileNaming()
+	}
+	if err := client.SaveBackupMeta(ctx, backupMeta, ext); err != nil {
 		return err
 	}
+	fileCount := 0
+	if checker == nil {
+		catalogEntry.Size = utils.ArchiveSize(backupMeta)
+	} else {
+		// The backup is complete, there is nothing to resume.
+		if e := client.RemoveCheckpoint(ctx); e != nil {
+			log.Warn("failed to remove the checkpoint", zap.Error(e))
+		}
+		reader, err := verifyBackupFiles(ctx, client, u)
+		if err != nil {
+			return err
+		}
+		if catalogEntry.Size, err = reader.ArchiveSize(ctx); err != nil {
+			return err
+		}
+		fileCount = reader.FileCount()
+	}
+	g.Record("Size", catalogEntry.Size)
 
-	g.Record("Size", utils.ArchiveSize(&backupMeta))
+	if cfg.UploadJobLog {
+		uploadJobArtifacts(ctx, client.GetStorage(),
+			newJobResult(cmdName, cfg.LogFile, startTime, backupMeta, fileCount, catalogEntry.Size))
+	}
 
 	// Set task summary to success status.
 	summary.SetSuccessStatus(true)
 	return nil
 }
 
+// verifyBackupFiles reconciles the files in the storage with the saved
+// backupmeta, it returns the reader of the backupmeta.
+func verifyBackupFiles(
+	ctx context.Context, client *backup.Client, u *kvproto.StorageBackend,
+) (*metautil.MetaReader, error) {
+	// The files may be in the meta shards, read them back one shard at a time.
+	reader, err := metautil.NewMetaReader(ctx, client.GetStorage(), utils.MetaFile, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The files of a local storage are spread over the TiKV nodes.
+	if u.GetLocal() == nil && u.GetNoop() == nil {
+		summary.SetPhase(phaseVerifyFiles)
+		if err = backup.CheckStorageFiles(ctx, client.GetStorage(), reader); err != nil {
+			return nil, err
+		}
+	}
+	return reader, nil
+}
+
+// filesChecker checks the backup files before they are saved into the
+// backupmeta. The conflicts are checked regardless of the names.
+type filesChecker struct {
+	ignoreConflicts bool
+	strictNames     bool
+	// namesFollowScheme is whether the names of all files checked follow
+	// backup.FileNameScheme.
+	namesFollowScheme bool
+}
+
+func newFilesChecker(ignoreConflicts, strictNames bool) *filesChecker {
+	return &filesChecker{
+		ignoreConflicts:   ignoreConflicts,
+		strictNames:       strictNames,
+		namesFollowScheme: true,
+	}
+}
+
+// check fails if the files conflict, unless the conflicts are ignored. The
+// names not following the scheme are warned, or fail if they are strict.
+func (fc *filesChecker) check(files []*kvproto.File) error {
+	if err := backup.CheckFileNames(files); err != nil {
+		if fc.strictNames {
+			return err
+		}
+		if fc.namesFollowScheme {
+			log.Warn("the names of the backup files don't follow the scheme", zap.Error(err))
+		}
+		fc.namesFollowScheme = false
+	}
+	err := backup.CheckFileConflicts(files)
+	if err != nil && fc.ignoreConflicts {
+		log.Warn("ignore the conflicting backup files", zap.Error(err))
+		return nil
+	}
+	return err
+}
+
+// fileNaming returns the scheme of the names of the files checked, it's
+// empty if some names don't follow the scheme.
+func (fc *filesChecker) fileNaming() string {
+	if !fc.namesFollowScheme {
+		return ""
+	}
+	return backup.FileNameScheme
+}
+
+// resumeFromCheckpoint loads the checkpoint and backs up with its versions,
+// it returns the ID of the service safe point kept for the checkpoint, or
+// safePointID if the checkpoint doesn't record one.
+func resumeFromCheckpoint(
+	ctx context.Context, client *backup.Client, cfg *BackupConfig, safePointID string,
+) (string, error) {
+	cp, err := client.LoadCheckpoint(ctx)
+	if err != nil {
+		return "", err
+	}
+	if cfg.BackupTS != 0 && cfg.BackupTS != cp.EndVersion {
+		return "", errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s %d is different from %d of the checkpoint", flagBackupTS, cfg.BackupTS, cp.EndVersion)
+	}
+	if cfg.LastBackupTS != 0 && cfg.LastBackupTS != cp.StartVersion {
+		return "", errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s %d is different from %d of the checkpoint", flagLastBackupTS, cfg.LastBackupTS, cp.StartVersion)
+	}
+	cfg.BackupTS = cp.EndVersion
+	cfg.LastBackupTS = cp.StartVersion
+	if cp.SafePointID != "" {
+		safePointID = cp.SafePointID
+	}
+	return safePointID, nil
+}
+
+// releaseSafePoint removes the service safe point once the backup stops. If
+// keepTTL is positive, the safe point is kept for keepTTL seconds instead, so
+// the snapshot isn't GCed before the backup is resumed, it returns whether
+// the safe point is kept.
+func releaseSafePoint(ctx context.Context, pdClient pd.Client, sp utils.BRServiceSafePoint, keepTTL int64) bool {
+	if ctx.Err() != nil {
+		log.Warn("context canceled, releasing safe point with background context")
+		ctx = context.Background()
+	}
+	if keepTTL > 0 {
+		sp.TTL = keepTTL
+		if err := utils.UpdateServiceSafePoint(ctx, pdClient, sp); err != nil {
+			log.Warn("failed to keep service safe point for resuming the backup, it would be removed after TTL expired",
+				zap.Error(err), zap.Object("safePoint", sp))
+			return false
+		}
+		log.Info("backup suspended, the safe point is kept until its TTL expires", zap.Object("safePoint", sp))
+		return true
+	}
+	if err := utils.RemoveServiceSafePoint(ctx, pdClient, sp); err != nil {
+		log.Warn("failed to remove service safe point, it would be removed after TTL expired",
+			zap.Error(err), zap.Object("safePoint", sp))
+	}
+	return false
+}
+
+// waitForWindow blocks until the window starts.
+func waitForWindow(ctx context.Context, window utils.TimeWindow) error {
+	now := time.Now()
+	start := window.NextStart(now)
+	if !start.After(now) {
+		return nil
+	}
+	log.Info("waiting for the backup window to start", zap.Time("start", start))
+	timer := time.NewTimer(start.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// setBackupTunables makes the rate limit and the concurrency of the backup
+// tunable through the status address and by reloading the config file, it
+// returns the function to unset them.
+func setBackupTunables(client *backup.Client, cfg *BackupConfig) (unset func()) {
+	rateLimit := utils.NewTunableUint64(flagRateLimit, cfg.RateLimit)
+	client.SetTunableRateLimit(rateLimit)
+	utils.SetStatusHandler(backupRateLimitPath, rateLimit)
+	// The concurrency is the number of the ranges backed up concurrently.
+	concurrency := utils.NewTunableUint64(flagConcurrency, uint64(cfg.Concurrency))
+	client.SetTunableConcurrency(concurrency)
+	utils.SetStatusHandler(backupConcurrencyPath, concurrency)
+	utils.SetTunable(flagConcurrency, concurrency.Store)
+	// The rate limit in the config file is in the unit of --ratelimit-unit.
+	if unit := cfg.RateLimitUnit; unit > 0 {
+		utils.SetTunable(flagRateLimit, func(value uint64) {
+			rateLimit.Store(value * unit)
+		})
+	}
+	return func() {
+		utils.SetStatusHandler(backupRateLimitPath, nil)
+		utils.SetStatusHandler(backupConcurrencyPath, nil)
+		utils.SetTunable(flagConcurrency, nil)
+		utils.SetTunable(flagRateLimit, nil)
+	}
+}
+
+// nextWindowTTL returns the TTL in seconds of the safe point which is kept
+// until the next window starts, and ttl seconds more.
+func nextWindowTTL(window utils.TimeWindow, now time.Time, ttl int64) int64 {
+	return int64(window.NextStart(now).Sub(now)/time.Second) + ttl
+}
+
+// windowExceeded tells whether ctx is done because the backup window ended,
+// rather than the parent is canceled.
+func windowExceeded(parent, ctx context.Context) bool {
+	return parent.Err() == nil && ctx.Err() == context.DeadlineExceeded
+}
+
 // checkChecksums checks the checksum of the client, once failed,
 // returning a error with message: "mismatched checksum".
-func checkChecksums(backupMeta *kvproto.BackupMeta) error {
-	checksums, err := backup.CollectChecksums(backupMeta)
+func checkChecksums(client *backup.Client, backupMeta *kvproto.BackupMeta) error {
+	checksums, err := client.CollectChecksums(backupMeta.Schemas)
 	if err != nil {
 		return err
 	}
@@ -374,6 +1086,28 @@ func checkChecksums(backupMeta *kvproto.BackupMeta) error {
 	return nil
 }
 
+// fillFileChecksums fills the checksums of the tables with the checksums of
+// their files returned by TiKV.
+func fillFileChecksums(client *backup.Client, backupMeta *kvproto.BackupMeta) error {
+	checksums, err := client.CollectChecksums(backupMeta.Schemas)
+	if err != nil {
+		return err
+	}
+	for i, schema := range backupMeta.Schemas {
+		schema.Crc64Xor = checksums[i].Crc64Xor
+		schema.TotalKvs = checksums[i].TotalKvs
+		schema.TotalBytes = checksums[i].TotalBytes
+	}
+	return nil
+}
+
+// tsTimeZoneLayouts are the layouts of the datetimes with time zones, e.g.
+// "2024-05-01 03:00:00+08:00".
+var tsTimeZoneLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	time.RFC3339Nano,
+}
+
 // parseTSString port from tidb setSnapshotTS.
 func parseTSString(ts string) (uint64, error) {
 	if len(ts) == 0 {
@@ -382,6 +1116,11 @@ func parseTSString(ts string) (uint64, error) {
 	if tso, err := strconv.ParseUint(ts, 10, 64); err == nil {
 		return tso, nil
 	}
+	for _, layout := range tsTimeZoneLayouts {
+		if t, err := time.Parse(layout, ts); err == nil {
+			return variable.GoTimeToTS(t), nil
+		}
+	}
 
 	loc := time.Local
 	sc := &stmtctx.StatementContext{
@@ -412,3 +1151,36 @@ func parseCompressionType(s string) (kvproto.CompressionType, error) {
 	}
 	return ct, nil
 }
+
+// splitLargeRegions splits the regions larger than sizeMB in the ranges in
+// half, so the failure of a single region retries a smaller range.
+func splitLargeRegions(ctx context.Context, mgr *conn.Mgr, ranges []rtree.Range, sizeMB uint64) error {
+	for round := 1; round <= maxSplitRegionRounds; round++ {
+		split := 0
+		for _, r := range ranges {
+			regionIDs, err := mgr.GetLargeRegions(ctx, r.StartKey, r.EndKey, sizeMB)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			for _, id := range regionIDs {
+				// The region may be changed since it's scanned, it's fine
+				// to back it up as a whole.
+				if err := mgr.SplitRegionByHalf(ctx, id); err != nil {
+					log.Warn("failed to split large region", zap.Uint64("region", id), zap.Error(err))
+					continue
+				}
+				split++
+			}
+		}
+		if split == 0 {
+			return nil
+		}
+		log.Info("large regions split", zap.Int("round", round), zap.Int("count", split))
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-time.After(splitRegionWaitInterval):
+		}
+	}
+	return nil
+}
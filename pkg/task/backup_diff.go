@@ -0,0 +1,145 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/parser/model"
+
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// The changes of the tables between two backups.
+const (
+	TableAdded     = "added"
+	TableRemoved   = "removed"
+	TableChanged   = "changed"
+	TableUnchanged = "unchanged"
+)
+
+// TableDiff is the difference of a table between two backups, the sizes are
+// of the files of the table in each backup.
+type TableDiff struct {
+	Name          string   `json:"name"`
+	Change        string   `json:"change"`
+	FromSize      uint64   `json:"from-size"`
+	ToSize        uint64   `json:"to-size"`
+	FromKVs       uint64   `json:"from-kvs"`
+	ToKVs         uint64   `json:"to-kvs"`
+	SchemaChanges []string `json:"schema-changes,omitempty"`
+}
+
+// SizeDelta returns the size of the table in the second backup minus the
+// size in the first one.
+func (d *TableDiff) SizeDelta() int64 {
+	return int64(d.ToSize) - int64(d.FromSize)
+}
+
+// DiffBackupMeta compares the tables of two backups, the tables are sorted
+// by name. The schema changes compare the columns, the indices and the IDs.
+func DiffBackupMeta(from, to *backup.BackupMeta) ([]TableDiff, error) {
+	fromTables, err := loadTablesByName(from)
+	if err != nil {
+		return nil, err
+	}
+	toTables, err := loadTablesByName(to)
+	if err != nil {
+		return nil, err
+	}
+	diffs := make([]TableDiff, 0, len(toTables))
+	for name, toTable := range toTables {
+		diff := TableDiff{Name: name, Change: TableAdded}
+		diff.ToSize, diff.ToKVs = tableFilesSize(toTable)
+		if fromTable, ok := fromTables[name]; ok {
+			diff.FromSize, diff.FromKVs = tableFilesSize(fromTable)
+			diff.SchemaChanges = diffTableInfo(fromTable.Info, toTable.Info)
+			diff.Change = TableUnchanged
+			if len(diff.SchemaChanges) > 0 || diff.FromSize != diff.ToSize || diff.FromKVs != diff.ToKVs {
+				diff.Change = TableChanged
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	for name, fromTable := range fromTables {
+		if _, ok := toTables[name]; ok {
+			continue
+		}
+		diff := TableDiff{Name: name, Change: TableRemoved}
+		diff.FromSize, diff.FromKVs = tableFilesSize(fromTable)
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs, nil
+}
+
+func loadTablesByName(meta *backup.BackupMeta) (map[string]*utils.Table, error) {
+	databases, err := utils.LoadBackupTables(meta)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]*utils.Table)
+	for _, db := range databases {
+		for _, table := range db.Tables {
+			tables[utils.EncloseName(db.Info.Name.O)+"."+utils.EncloseName(table.Info.Name.O)] = table
+		}
+	}
+	return tables, nil
+}
+
+func tableFilesSize(table *utils.Table) (size, kvs uint64) {
+	for _, file := range table.Files {
+		size += fileSize(file)
+		kvs += file.GetTotalKvs()
+	}
+	return size, kvs
+}
+
+func diffTableInfo(from, to *model.TableInfo) []string {
+	changes := make([]string, 0)
+	if from.ID != to.ID {
+		changes = append(changes, fmt.Sprintf("table ID %d -> %d, the table was truncated or recreated", from.ID, to.ID))
+	}
+	fromColumns := make(map[string]*model.ColumnInfo, len(from.Columns))
+	for _, col := range from.Columns {
+		fromColumns[col.Name.L] = col
+	}
+	toColumns := make(map[string]*model.ColumnInfo, len(to.Columns))
+	for _, col := range to.Columns {
+		toColumns[col.Name.L] = col
+		fromCol, ok := fromColumns[col.Name.L]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("column %s added", col.Name.O))
+			continue
+		}
+		if fromCol.FieldType.String() != col.FieldType.String() {
+			changes = append(changes, fmt.Sprintf("column %s %s -> %s", col.Name.O, fromCol.FieldType.String(), col.FieldType.String()))
+		}
+	}
+	for _, col := range from.Columns {
+		if _, ok := toColumns[col.Name.L]; !ok {
+			changes = append(changes, fmt.Sprintf("column %s removed", col.Name.O))
+		}
+	}
+	fromIndices := make(map[string]bool, len(from.Indices))
+	for _, idx := range from.Indices {
+		fromIndices[idx.Name.L] = true
+	}
+	toIndices := make(map[string]bool, len(to.Indices))
+	for _, idx := range to.Indices {
+		toIndices[idx.Name.L] = true
+		if !fromIndices[idx.Name.L] {
+			changes = append(changes, fmt.Sprintf("index %s added", idx.Name.O))
+		}
+	}
+	for _, idx := range from.Indices {
+		if !toIndices[idx.Name.L] {
+			changes = append(changes, fmt.Sprintf("index %s removed", idx.Name.O))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"encoding/json"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/parser/types"
+)
+
+type testBackupDiffSuite struct{}
+
+var _ = Suite(&testBackupDiffSuite{})
+
+func mockDiffSchema(c *C, table *model.TableInfo) *backup.Schema {
+	db, err := json.Marshal(&model.DBInfo{Name: model.NewCIStr("test")})
+	c.Assert(err, IsNil)
+	info, err := json.Marshal(table)
+	c.Assert(err, IsNil)
+	return &backup.Schema{Db: db, Table: info}
+}
+
+func mockDiffColumn(name string, tp byte) *model.ColumnInfo {
+	return &model.ColumnInfo{Name: model.NewCIStr(name), FieldType: *types.NewFieldType(tp)}
+}
+
+func (s *testBackupDiffSuite) TestDiffBackupMeta(c *C) {
+	users := &model.TableInfo{
+		ID:      10,
+		Name:    model.NewCIStr("users"),
+		Columns: []*model.ColumnInfo{mockDiffColumn("id", mysql.TypeLong), mockDiffColumn("name", mysql.TypeVarchar)},
+		Indices: []*model.IndexInfo{{Name: model.NewCIStr("idx_name")}},
+	}
+	orders := &model.TableInfo{ID: 20, Name: model.NewCIStr("orders")}
+	logs := &model.TableInfo{ID: 30, Name: model.NewCIStr("logs")}
+	from := &backup.BackupMeta{
+		Schemas: []*backup.Schema{mockDiffSchema(c, users), mockDiffSchema(c, orders), mockDiffSchema(c, logs)},
+		Files:   []*backup.File{mockTableFile("1.sst", 10, 100), mockTableFile("2.sst", 20, 200)},
+	}
+
+	newUsers := *users
+	newUsers.Columns = []*model.ColumnInfo{mockDiffColumn("id", mysql.TypeLonglong), mockDiffColumn("email", mysql.TypeVarchar)}
+	newUsers.Indices = nil
+	newOrders := *orders
+	newOrders.ID = 21
+	items := &model.TableInfo{ID: 40, Name: model.NewCIStr("items")}
+	to := &backup.BackupMeta{
+		Schemas: []*backup.Schema{mockDiffSchema(c, &newUsers), mockDiffSchema(c, &newOrders), mockDiffSchema(c, items)},
+		Files:   []*backup.File{mockTableFile("3.sst", 10, 150), mockTableFile("4.sst", 40, 50)},
+	}
+
+	diffs, err := DiffBackupMeta(from, to)
+	c.Assert(err, IsNil)
+	c.Assert(diffs, HasLen, 4)
+	c.Assert(diffs[0].Name, Equals, "`test`.`items`")
+	c.Assert(diffs[0].Change, Equals, TableAdded)
+	c.Assert(diffs[0].SizeDelta(), Equals, int64(50))
+	c.Assert(diffs[1].Name, Equals, "`test`.`logs`")
+	c.Assert(diffs[1].Change, Equals, TableRemoved)
+	c.Assert(diffs[2].Name, Equals, "`test`.`orders`")
+	c.Assert(diffs[2].Change, Equals, TableChanged)
+	c.Assert(diffs[2].SizeDelta(), Equals, int64(-200))
+	c.Assert(diffs[2].SchemaChanges, HasLen, 1)
+	c.Assert(diffs[2].SchemaChanges[0], Matches, "table ID 20 -> 21.*")
+	c.Assert(diffs[3].Name, Equals, "`test`.`users`")
+	c.Assert(diffs[3].Change, Equals, TableChanged)
+	c.Assert(diffs[3].FromSize, Equals, uint64(100))
+	c.Assert(diffs[3].ToSize, Equals, uint64(150))
+	c.Assert(diffs[3].SchemaChanges, HasLen, 4)
+	c.Assert(diffs[3].SchemaChanges[0], Matches, "column id int.* -> bigint.*")
+	c.Assert(diffs[3].SchemaChanges[1:], DeepEquals, []string{
+		"column email added",
+		"column name removed",
+		"index idx_name removed",
+	})
+
+	diffs, err = DiffBackupMeta(from, from)
+	c.Assert(err, IsNil)
+	for _, diff := range diffs {
+		c.Assert(diff.Change, Equals, TableUnchanged)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/distsql"
+	"github.com/pingcap/tidb/infoschema"
+	"github.com/pingcap/tidb/util/ranger"
+
+	"github.com/pingcap/br/pkg/backup"
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/rtree"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// RangeSpec is a range in the ranges file, it's either the keys in hex, or
+// a table with an optional index, which covers the records and all indices
+// of the table if the index is empty.
+type RangeSpec struct {
+	StartKey string `json:"start-key"`
+	EndKey   string `json:"end-key"`
+	// Table is in the form of `db.table`.
+	Table string `json:"table"`
+	Index string `json:"index"`
+}
+
+// loadRangesFile reads the range specs of the ranges file, which is a JSON
+// array of RangeSpec.
+func loadRangesFile(path string) ([]RangeSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "read --%s failed", flagRangesFile)
+	}
+	specs := make([]RangeSpec, 0)
+	if err = json.Unmarshal(data, &specs); err != nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid --%s: %v", flagRangesFile, err)
+	}
+	if len(specs) == 0 {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "no range in --%s", flagRangesFile)
+	}
+	return specs, nil
+}
+
+// resolveRangeSpecs converts the range specs into the key ranges to back up,
+// the tables and indices are looked up in the info schema. The overlapping
+// ranges are merged.
+func resolveRangeSpecs(info infoschema.InfoSchema, specs []RangeSpec) ([]rtree.Range, error) {
+	ranges := make([]rtree.Range, 0, len(specs))
+	for i, spec := range specs {
+		rgs, err := resolveRangeSpec(info, spec)
+		if err != nil {
+			return nil, errors.Annotatef(err, "range #%d", i)
+		}
+		ranges = append(ranges, rgs...)
+	}
+	return mergeRanges(ranges), nil
+}
+
+func resolveRangeSpec(info infoschema.InfoSchema, spec RangeSpec) ([]rtree.Range, error) {
+	if spec.Table == "" {
+		if spec.Index != "" {
+			return nil, errors.Annotate(berrors.ErrInvalidArgument, "index without table")
+		}
+		startKey, err := utils.ParseKey("hex", spec.StartKey)
+		if err != nil {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid start key: %v", err)
+		}
+		endKey, err := utils.ParseKey("hex", spec.EndKey)
+		if err != nil {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid end key: %v", err)
+		}
+		if len(endKey) != 0 && bytes.Compare(startKey, endKey) >= 0 {
+			return nil, errors.Annotate(berrors.ErrInvalidArgument, "the start key must be less than the end key")
+		}
+		return []rtree.Range{{StartKey: startKey, EndKey: endKey}}, nil
+	}
+
+	if spec.StartKey != "" || spec.EndKey != "" {
+		return nil, errors.Annotate(berrors.ErrInvalidArgument, "both keys and table are set")
+	}
+	parts := strings.SplitN(spec.Table, ".", 2)
+	if len(parts) != 2 {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid table %s, must be db.table", spec.Table)
+	}
+	tbl, err := info.TableByName(model.NewCIStr(parts[0]), model.NewCIStr(parts[1]))
+	if err != nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "table %s: %v", spec.Table, err)
+	}
+	tblInfo := tbl.Meta()
+	if spec.Index == "" {
+		kvRanges, err := backup.BuildTableRanges(tblInfo)
+		if err != nil {
+			return nil, err
+		}
+		ranges := make([]rtree.Range, 0, len(kvRanges))
+		for _, r := range kvRanges {
+			ranges = append(ranges, rtree.Range{StartKey: r.StartKey, EndKey: r.EndKey})
+		}
+		return ranges, nil
+	}
+
+	index := tblInfo.FindIndexByName(strings.ToLower(spec.Index))
+	if index == nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "no index %s in table %s", spec.Index, spec.Table)
+	}
+	physicalIDs := []int64{tblInfo.ID}
+	if pi := tblInfo.GetPartitionInfo(); pi != nil {
+		physicalIDs = physicalIDs[:0]
+		for _, def := range pi.Definitions {
+			physicalIDs = append(physicalIDs, def.ID)
+		}
+	}
+	ranges := make([]rtree.Range, 0, len(physicalIDs))
+	for _, id := range physicalIDs {
+		kvRanges, err := distsql.IndexRangesToKVRanges(nil, id, index.ID, ranger.FullRange(), nil)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, r := range kvRanges {
+			ranges = append(ranges, rtree.Range{StartKey: r.StartKey, EndKey: r.EndKey})
+		}
+	}
+	return ranges, nil
+}
+
+// mergeRanges sorts the ranges and merges the overlapping ones, an empty
+// end key means the end of the key space.
+func mergeRanges(ranges []rtree.Range) []rtree.Range {
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].StartKey, ranges[j].StartKey) < 0
+	})
+	merged := make([]rtree.Range, 0, len(ranges))
+	for _, r := range ranges {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			if len(last.EndKey) == 0 {
+				continue
+			}
+			if bytes.Compare(r.StartKey, last.EndKey) <= 0 {
+				if len(r.EndKey) == 0 || bytes.Compare(r.EndKey, last.EndKey) > 0 {
+					last.EndKey = r.EndKey
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// narrowSchemas keeps the schemas of the tables overlapping the ranges, the
+// ranges are sorted and merged. If the tables are checksummed, it fails if
+// some of them are covered partly, whose checksums can't match the files.
+func narrowSchemas(schemas *backup.Schemas, ranges []rtree.Range, checksumTables bool) error {
+	return schemas.Filter(func(table *model.TableInfo) (bool, error) {
+		overlaps, covers, err := tableCoverage(ranges, table)
+		if err != nil || !overlaps {
+			return false, err
+		}
+		if checksumTables && !covers {
+			return false, errors.Annotatef(berrors.ErrInvalidArgument,
+				"table %s is covered partly by --%s, its checksum can't match the backup files, "+
+					"use --%s=%s or --%s=%s", table.Name.O, flagRangesFile,
+				flagChecksum, ChecksumOptional, flagChecksum, ChecksumOff)
+		}
+		return true, nil
+	})
+}
+
+// tableCoverage returns whether the ranges overlap the ranges of the table,
+// and whether they cover all of them.
+func tableCoverage(ranges []rtree.Range, table *model.TableInfo) (overlaps, covers bool, err error) {
+	kvRanges, err := backup.BuildTableRanges(table)
+	if err != nil {
+		return false, false, err
+	}
+	covers = true
+	for _, r := range kvRanges {
+		o, c := rangeCoverage(ranges, r.StartKey, r.EndKey)
+		overlaps = overlaps || o
+		covers = covers && c
+	}
+	return overlaps, covers, nil
+}
+
+// rangeCoverage returns whether the ranges overlap the key range, and whether
+// one of them covers it. The ranges are sorted and merged, an empty end key
+// means the end of the key space.
+func rangeCoverage(ranges []rtree.Range, startKey, endKey []byte) (overlaps, covers bool) {
+	for _, r := range ranges {
+		if (len(endKey) != 0 && bytes.Compare(r.StartKey, endKey) >= 0) ||
+			(len(r.EndKey) != 0 && bytes.Compare(startKey, r.EndKey) >= 0) {
+			continue
+		}
+		overlaps = true
+		if bytes.Compare(r.StartKey, startKey) <= 0 &&
+			(len(r.EndKey) == 0 || (len(endKey) != 0 && bytes.Compare(endKey, r.EndKey) <= 0)) {
+			return true, true
+		}
+	}
+	return overlaps, false
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/tablecodec"
+
+	"github.com/pingcap/br/pkg/rtree"
+)
+
+type testBackupRangesSuite struct{}
+
+var _ = Suite(&testBackupRangesSuite{})
+
+func (s *testBackupRangesSuite) TestLoadRangesFile(c *C) {
+	path := filepath.Join(c.MkDir(), "ranges.json")
+	c.Assert(ioutil.WriteFile(path, []byte(`[
+		{"start-key": "7480", "end-key": "7490"},
+		{"table": "test.t", "index": "idx"}
+	]`), 0644), IsNil)
+	specs, err := loadRangesFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(specs, DeepEquals, []RangeSpec{
+		{StartKey: "7480", EndKey: "7490"},
+		{Table: "test.t", Index: "idx"},
+	})
+
+	c.Assert(ioutil.WriteFile(path, []byte(`[]`), 0644), IsNil)
+	_, err = loadRangesFile(path)
+	c.Assert(err, ErrorMatches, ".*no range in --ranges-file.*")
+}
+
+func (s *testBackupRangesSuite) TestResolveKeyRangeSpecs(c *C) {
+	ranges, err := resolveRangeSpecs(nil, []RangeSpec{
+		{StartKey: "30", EndKey: "40"},
+		{StartKey: "10", EndKey: "20"},
+		{StartKey: "15", EndKey: "25"},
+		{StartKey: "38", EndKey: "39"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(ranges, DeepEquals, []rtree.Range{
+		{StartKey: []byte{0x10}, EndKey: []byte{0x25}},
+		{StartKey: []byte{0x30}, EndKey: []byte{0x40}},
+	})
+
+	ranges, err = resolveRangeSpecs(nil, []RangeSpec{{StartKey: "10"}, {StartKey: "20", EndKey: "30"}})
+	c.Assert(err, IsNil)
+	c.Assert(ranges, DeepEquals, []rtree.Range{{StartKey: []byte{0x10}, EndKey: []byte{}}})
+
+	_, err = resolveRangeSpecs(nil, []RangeSpec{{StartKey: "20", EndKey: "10"}})
+	c.Assert(err, ErrorMatches, ".*the start key must be less than the end key.*")
+	_, err = resolveRangeSpecs(nil, []RangeSpec{{Index: "idx"}})
+	c.Assert(err, ErrorMatches, ".*index without table.*")
+}
+
+func (s *testBackupRangesSuite) TestRangeCoverage(c *C) {
+	ranges := []rtree.Range{
+		{StartKey: []byte{0x10}, EndKey: []byte{0x20}},
+		{StartKey: []byte{0x30}, EndKey: []byte{}},
+	}
+	for _, ca := range []struct {
+		start, end       []byte
+		overlaps, covers bool
+	}{
+		{[]byte{0x10}, []byte{0x20}, true, true},
+		{[]byte{0x12}, []byte{0x18}, true, true},
+		{[]byte{0x05}, []byte{0x15}, true, false},
+		{[]byte{0x20}, []byte{0x30}, false, false},
+		{[]byte{0x25}, []byte{0x35}, true, false},
+		{[]byte{0x40}, []byte{}, true, true},
+		{[]byte{0x18}, []byte{}, true, false},
+	} {
+		overlaps, covers := rangeCoverage(ranges, ca.start, ca.end)
+		c.Assert(overlaps, Equals, ca.overlaps, Commentf("%x-%x", ca.start, ca.end))
+		c.Assert(covers, Equals, ca.covers, Commentf("%x-%x", ca.start, ca.end))
+	}
+}
+
+func (s *testBackupRangesSuite) TestTableCoverage(c *C) {
+	table := &model.TableInfo{ID: 10, Indices: []*model.IndexInfo{{ID: 1, State: model.StatePublic}}}
+	prefix := tablecodec.GenTablePrefix(10)
+	next := tablecodec.GenTablePrefix(11)
+	overlaps, covers, err := tableCoverage([]rtree.Range{{StartKey: prefix, EndKey: next}}, table)
+	c.Assert(err, IsNil)
+	c.Assert(overlaps && covers, IsTrue)
+
+	// Only the index is covered.
+	indexPrefix := tablecodec.EncodeTableIndexPrefix(10, 1)
+	indexRanges := []rtree.Range{{StartKey: indexPrefix, EndKey: indexPrefix.PrefixNext()}}
+	overlaps, covers, err = tableCoverage(indexRanges, table)
+	c.Assert(err, IsNil)
+	c.Assert(overlaps, IsTrue)
+	c.Assert(covers, IsFalse)
+
+	overlaps, _, err = tableCoverage([]rtree.Range{{StartKey: next, EndKey: []byte{}}}, table)
+	c.Assert(err, IsNil)
+	c.Assert(overlaps, IsFalse)
+}
@@ -5,6 +5,7 @@ package task
 import (
 	"bytes"
 	"context"
+	"time"
 
 	"github.com/pingcap/errors"
 	kvproto "github.com/pingcap/kvproto/pkg/backup"
@@ -16,6 +17,7 @@ import (
 	"github.com/pingcap/br/pkg/backup"
 	berrors "github.com/pingcap/br/pkg/errors"
 	"github.com/pingcap/br/pkg/glue"
+	"github.com/pingcap/br/pkg/metautil"
 	"github.com/pingcap/br/pkg/rtree"
 	"github.com/pingcap/br/pkg/storage"
 	"github.com/pingcap/br/pkg/summary"
@@ -38,6 +40,14 @@ type RawKvConfig struct {
 	CF       string `json:"cf" toml:"cf"`
 	CompressionConfig
 	RemoveSchedulers bool `json:"remove-schedulers" toml:"remove-schedulers"`
+	IgnoreDupFiles   bool `json:"ignore-dup-files" toml:"ignore-dup-files"`
+	StrictFileNames  bool `json:"strict-file-names" toml:"strict-file-names"`
+	// Catalog is the storage recording the backups, empty means the backup
+	// isn't recorded.
+	Catalog string `json:"catalog" toml:"catalog"`
+	// UploadJobLog uploads the log file and the result of the backup with
+	// the backupmeta.
+	UploadJobLog bool `json:"upload-job-log" toml:"upload-job-log"`
 }
 
 // DefineRawBackupFlags defines common flags for the backup command.
@@ -107,20 +117,29 @@ func (cfg *RawKvConfig) ParseBackupConfigFromFlags(flags *pflag.FlagSet) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
-	level, err := flags.GetInt32(flagCompressionLevel)
+	cfg.IgnoreDupFiles, err = flags.GetBool(flagIgnoreDupFiles)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	cfg.CompressionLevel = level
-
-	return nil
+	cfg.StrictFileNames, err = flags.GetBool(flagStrictFileNames)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.Catalog, err = flags.GetString(flagCatalog)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.UploadJobLog, err = flags.GetBool(flagUploadJobLog)
+	return errors.Trace(err)
 }
 
 // RunBackupRaw starts a backup task inside the current goroutine.
-func RunBackupRaw(c context.Context, g glue.Glue, cmdName string, cfg *RawKvConfig) error {
+func RunBackupRaw(c context.Context, g glue.Glue, cmdName string, cfg *RawKvConfig) (err error) {
 	cfg.adjust()
 
+	startTime := time.Now()
 	defer summary.Summary(cmdName)
+	summary.SetPhase(phasePrepare)
 	ctx, cancel := context.WithCancel(c)
 	defer cancel()
 
@@ -128,11 +147,19 @@ func RunBackupRaw(c context.Context, g glue.Glue, cmdName string, cfg *RawKvConf
 	if err != nil {
 		return err
 	}
-	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements)
+	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements,
+		cfg.GRPCDialOptions...)
 	if err != nil {
 		return err
 	}
 	defer mgr.Close()
+	cfg.keepDiscoveringPD(ctx, mgr)
+	unregister, err := registerTask(ctx, g, cfg.PD, mgr.GetTLSConfig(), cmdName, cfg.ForceConcurrent)
+	if err != nil {
+		return err
+	}
+	defer unregister()
+	source := newSourceCluster(ctx, mgr, commandArgs(g), startTime)
 
 	client, err := backup.NewBackupClient(ctx, mgr)
 	if err != nil {
@@ -141,6 +168,15 @@ func RunBackupRaw(c context.Context, g glue.Glue, cmdName string, cfg *RawKvConf
 	if err = client.SetStorage(ctx, u, cfg.SendCreds); err != nil {
 		return err
 	}
+	catalogEntry := CatalogEntry{
+		Storage:   storage.FormatBackendURL(u).String(),
+		Type:      CatalogTypeRaw,
+		StartTime: startTime,
+	}
+	if cfg.Catalog != "" {
+		record := catalogRecorder(ctx, cfg.Catalog, &cfg.Config, &catalogEntry)
+		defer func() { record(err) }()
+	}
 
 	backupRange := rtree.Range{StartKey: cfg.StartKey, EndKey: cfg.EndKey}
 
@@ -174,6 +210,7 @@ func RunBackupRaw(c context.Context, g glue.Glue, cmdName string, cfg *RawKvConf
 		ctx, cmdName, int64(approximateRegions), !cfg.LogProgress)
 
 	req := kvproto.BackupRequest{
+		ClusterId:        client.GetClusterID(),
 		StartVersion:     0,
 		EndVersion:       0,
 		RateLimit:        cfg.RateLimit,
@@ -183,6 +220,7 @@ func RunBackupRaw(c context.Context, g glue.Glue, cmdName string, cfg *RawKvConf
 		CompressionType:  cfg.CompressionType,
 		CompressionLevel: cfg.CompressionLevel,
 	}
+	summary.SetPhase(phaseBackupRanges)
 	files, err := client.BackupRange(ctx, backupRange.StartKey, backupRange.EndKey, req, updateCh)
 	if err != nil {
 		return err
@@ -190,18 +228,32 @@ func RunBackupRaw(c context.Context, g glue.Glue, cmdName string, cfg *RawKvConf
 	// Backup has finished
 	updateCh.Close()
 
+	filesChecker := newFilesChecker(cfg.IgnoreDupFiles, cfg.StrictFileNames)
+	if err = filesChecker.check(files); err != nil {
+		return err
+	}
 	// Checksum
 	rawRanges := []*kvproto.RawRange{{StartKey: backupRange.StartKey, EndKey: backupRange.EndKey, Cf: cfg.CF}}
 	backupMeta, err := backup.BuildBackupMeta(&req, files, rawRanges, nil)
 	if err != nil {
 		return err
 	}
-	err = client.SaveBackupMeta(ctx, &backupMeta)
+	summary.SetPhase(phaseSaveMeta)
+	ext := &metautil.Extension{
+		FileNaming: filesChecker.fileNaming(),
+		Source:     finishSourceCluster(source),
+	}
+	err = client.SaveBackupMeta(ctx, &backupMeta, ext)
 	if err != nil {
 		return err
 	}
 
-	g.Record("Size", utils.ArchiveSize(&backupMeta))
+	catalogEntry.Size = utils.ArchiveSize(&backupMeta)
+	g.Record("Size", catalogEntry.Size)
+	if cfg.UploadJobLog {
+		uploadJobArtifacts(ctx, client.GetStorage(),
+			newJobResult(cmdName, cfg.LogFile, startTime, &backupMeta, len(files), catalogEntry.Size))
+	}
 
 	// Set task summary to success status.
 	summary.SetSuccessStatus(true)
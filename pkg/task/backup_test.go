@@ -1,10 +1,16 @@
 package task
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	. "github.com/pingcap/check"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/spf13/pflag"
+
+	"github.com/pingcap/br/pkg/backup"
+	"github.com/pingcap/br/pkg/utils"
 )
 
 var _ = Suite(&testBackupSuite{})
@@ -33,4 +39,87 @@ func (s *testBackupSuite) TestParseTSString(c *C) {
 	ts, err = parseTSString("2018-05-11 01:42:23")
 	c.Assert(err, IsNil)
 	c.Assert(int(ts), Equals, 400032515489792000-(offset*1000)<<18)
+
+	ts, err = parseTSString("2018-05-11 01:42:23+08:00")
+	c.Assert(err, IsNil)
+	c.Assert(int(ts), Equals, 400032515489792000-(8*3600*1000)<<18)
+	ts, err = parseTSString("2018-05-11T01:42:23Z")
+	c.Assert(err, IsNil)
+	c.Assert(int(ts), Equals, 400032515489792000)
+}
+
+func (s *testBackupSuite) TestAdjustBackupConfigRateLimit(c *C) {
+	cfg := &BackupConfig{}
+	cfg.adjustBackupConfig()
+	c.Assert(cfg.Concurrency, Equals, uint32(defaultBackupConcurrency))
+
+	cfg = &BackupConfig{}
+	cfg.RateLimit = 10 * utils.MB
+	cfg.Concurrency = 8
+	cfg.adjustBackupConfig()
+	c.Assert(cfg.Concurrency, Equals, uint32(1))
+}
+
+func (s *testBackupSuite) TestParseCompressionFlags(c *C) {
+	flags := &pflag.FlagSet{}
+	DefineBackupFlags(flags)
+
+	cfg, err := parseCompressionFlags(flags)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.CompressionType, Equals, kvproto.CompressionType_ZSTD)
+	c.Assert(cfg.CompressionLevel, Equals, int32(0))
+
+	c.Assert(flags.Set(flagCompressionType, "lz4"), IsNil)
+	c.Assert(flags.Set(flagCompressionLevel, "3"), IsNil)
+	cfg, err = parseCompressionFlags(flags)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.CompressionType, Equals, kvproto.CompressionType_LZ4)
+	c.Assert(cfg.CompressionLevel, Equals, int32(3))
+
+	c.Assert(flags.Set(flagCompressionType, "snappy"), IsNil)
+	_, err = parseCompressionFlags(flags)
+	c.Assert(err, ErrorMatches, ".*not supported by snappy.*")
+
+	c.Assert(flags.Set(flagCompressionType, "gzip"), IsNil)
+	_, err = parseCompressionFlags(flags)
+	c.Assert(err, ErrorMatches, ".*invalid compression type 'gzip'.*")
+}
+
+func (s *testBackupSuite) TestWindowExceeded(c *C) {
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, ctxCancel := context.WithDeadline(parent, time.Now().Add(-time.Second))
+	defer ctxCancel()
+	c.Assert(windowExceeded(parent, ctx), IsTrue)
+
+	cancel()
+	c.Assert(windowExceeded(parent, ctx), IsFalse)
+}
+
+func (s *testBackupSuite) TestNextWindowTTL(c *C) {
+	window, err := utils.ParseTimeWindow("22:00-06:00")
+	c.Assert(err, IsNil)
+	// The safe point is kept from the end of the window to the next start.
+	end := time.Date(2020, 12, 2, 6, 0, 0, 0, time.Local)
+	c.Assert(nextWindowTTL(window, end, 300), Equals, int64(16*60*60+300))
+}
+
+func (s *testBackupSuite) TestFilesChecker(c *C) {
+	badName := []*kvproto.File{{Name: "1.sst", Cf: "default"}}
+	dup := []*kvproto.File{
+		{Name: "1_2_3_0a1b_default.sst", Cf: "default"},
+		{Name: "1_2_3_0a1b_default.sst", Cf: "default"},
+	}
+
+	checker := newFilesChecker(false, false)
+	c.Assert(checker.check(badName), IsNil)
+	c.Assert(checker.fileNaming(), Equals, "")
+	// The conflicts are checked regardless of the names.
+	c.Assert(checker.check(dup), NotNil)
+
+	checker = newFilesChecker(true, false)
+	c.Assert(checker.check(dup), IsNil)
+	c.Assert(checker.fileNaming(), Equals, backup.FileNameScheme)
+
+	checker = newFilesChecker(true, true)
+	c.Assert(checker.check(badName), NotNil)
 }
@@ -0,0 +1,233 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const (
+	flagCatalog = "catalog"
+	flagChains  = "chains"
+)
+
+// The types of the backups in the catalog.
+const (
+	CatalogTypeFull        = "full"
+	CatalogTypeIncremental = "incremental"
+	CatalogTypeRaw         = "raw"
+)
+
+// The statuses of the backups in the catalog.
+const (
+	CatalogStatusComplete = "complete"
+	CatalogStatusFailed   = "failed"
+)
+
+// CatalogEntry is a backup recorded in the catalog.
+type CatalogEntry struct {
+	// Storage is the URL of the backup without the options.
+	Storage      string    `json:"storage"`
+	Type         string    `json:"type"`
+	BackupTS     uint64    `json:"backup-ts"`
+	LastBackupTS uint64    `json:"last-backup-ts"`
+	Size         uint64    `json:"size"`
+	Status       string    `json:"status"`
+	StartTime    time.Time `json:"start-time"`
+	EndTime      time.Time `json:"end-time"`
+}
+
+// Catalog records the backups under a storage prefix, so the restore chains
+// can be found without reading the backupmeta of every backup.
+type Catalog struct {
+	Backups []CatalogEntry `json:"backups"`
+}
+
+// LoadCatalog loads the catalog in the storage, it's empty if there is none.
+// The backups are recorded in the entry files under utils.CatalogDir, and
+// in utils.CatalogFile by the old BR.
+func LoadCatalog(ctx context.Context, s storage.ExternalStorage) (*Catalog, error) {
+	exist, err := s.FileExists(ctx, utils.CatalogFile)
+	if err != nil {
+		return nil, errors.Annotatef(err, "error occurred when checking %s file", utils.CatalogFile)
+	}
+	catalog := &Catalog{}
+	if exist {
+		data, err := s.Read(ctx, utils.CatalogFile)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err = json.Unmarshal(data, catalog); err != nil {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid %s: %v", utils.CatalogFile, err)
+		}
+	}
+	err = s.WalkDir(ctx, &storage.WalkOption{SubDir: utils.CatalogDir}, func(name string, _ int64) error {
+		if !strings.HasSuffix(name, ".json") {
+			return nil
+		}
+		data, err := s.Read(ctx, name)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		var entry CatalogEntry
+		if err = json.Unmarshal(data, &entry); err != nil {
+			return errors.Annotatef(berrors.ErrInvalidArgument, "invalid catalog entry %s: %v", name, err)
+		}
+		catalog.put(entry)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return catalog, nil
+}
+
+// catalogEntryFile returns the name of the file recording the backup in the
+// storage, so the backups don't overwrite each other's entries.
+func catalogEntryFile(backupStorage string) string {
+	sum := sha256.Sum256([]byte(backupStorage))
+	return path.Join(utils.CatalogDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// put records the backup, the entry of the same storage is replaced since
+// a storage holds one backup.
+func (c *Catalog) put(entry CatalogEntry) {
+	replaced := false
+	for i := range c.Backups {
+		if c.Backups[i].Storage == entry.Storage {
+			c.Backups[i], replaced = entry, true
+		}
+	}
+	if !replaced {
+		c.Backups = append(c.Backups, entry)
+	}
+	sort.SliceStable(c.Backups, func(i, j int) bool {
+		return c.Backups[i].BackupTS < c.Backups[j].BackupTS
+	})
+}
+
+// Chains returns the restore chains of the complete backups, each starts
+// from a full backup, and every incremental backup starts from the end of
+// the previous one. If several incremental backups start from the same
+// backup, the one ending last is chosen.
+func (c *Catalog) Chains() [][]CatalogEntry {
+	next := make(map[uint64]CatalogEntry)
+	chains := make([][]CatalogEntry, 0)
+	for _, entry := range c.Backups {
+		if entry.Status != CatalogStatusComplete || entry.Type == CatalogTypeRaw {
+			continue
+		}
+		if entry.Type == CatalogTypeFull {
+			chains = append(chains, []CatalogEntry{entry})
+			continue
+		}
+		if entry.BackupTS <= entry.LastBackupTS {
+			continue
+		}
+		if prev, ok := next[entry.LastBackupTS]; !ok || entry.BackupTS > prev.BackupTS {
+			next[entry.LastBackupTS] = entry
+		}
+	}
+	for i, chain := range chains {
+		for {
+			entry, ok := next[chain[len(chain)-1].BackupTS]
+			if !ok {
+				break
+			}
+			chain = append(chain, entry)
+		}
+		chains[i] = chain
+	}
+	return chains
+}
+
+// recordCatalog records the backup into the catalog of the storage. A backup
+// mustn't fail because its catalog entry can't be written, the failure is
+// logged. Each backup writes its own entry file, so the backups recording into
+// the same catalog concurrently don't overwrite each other.
+func recordCatalog(ctx context.Context, catalog string, cfg *Config, entry CatalogEntry) {
+	err := func() error {
+		u, err := storage.ParseBackend(catalog, &cfg.BackendOptions)
+		if err != nil {
+			return err
+		}
+		s, err := storage.Create(ctx, u, cfg.SendCreds)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		data, err := json.MarshalIndent(entry, "", "  ")
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(s.Write(ctx, catalogEntryFile(entry.Storage), data))
+	}()
+	if err != nil {
+		log.Warn("failed to record the backup into the catalog", zap.String("catalog", catalog), zap.Error(err))
+		return
+	}
+	log.Info("backup recorded into the catalog", zap.String("catalog", catalog),
+		zap.String("status", entry.Status))
+}
+
+// catalogRecorder returns the function to record the backup into the catalog
+// once it stops, the backup failed if the error passed isn't nil.
+func catalogRecorder(ctx context.Context, catalog string, cfg *Config, entry *CatalogEntry) func(err error) {
+	return func(err error) {
+		entry.Status, entry.EndTime = CatalogStatusComplete, time.Now()
+		if err != nil {
+			entry.Status = CatalogStatusFailed
+		}
+		if ctx.Err() != nil {
+			ctx = context.Background()
+		}
+		recordCatalog(ctx, catalog, cfg, *entry)
+	}
+}
+
+// ListConfig is the configuration specific for list tasks.
+type ListConfig struct {
+	Config
+
+	Chains bool `json:"chains" toml:"chains"`
+}
+
+// DefineListFlags defines the flags for the list command.
+func DefineListFlags(command *cobra.Command) {
+	command.Flags().Bool(flagChains, false, "list the restore chains of the complete backups instead of all backups")
+}
+
+// ParseFromFlags parses the list-related flags from the flag set.
+func (cfg *ListConfig) ParseFromFlags(flags *pflag.FlagSet) error {
+	var err error
+	cfg.Chains, err = flags.GetBool(flagChains)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return cfg.Config.ParseFromFlags(flags)
+}
+
+// RunList loads the catalog in the storage.
+func RunList(ctx context.Context, cfg *ListConfig) (*Catalog, error) {
+	_, s, err := GetStorage(ctx, &cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	return LoadCatalog(ctx, s)
+}
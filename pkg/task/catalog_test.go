@@ -0,0 +1,92 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+type testCatalogSuite struct{}
+
+var _ = Suite(&testCatalogSuite{})
+
+func (s *testCatalogSuite) TestChains(c *C) {
+	full := func(name string, ts uint64) CatalogEntry {
+		return CatalogEntry{Storage: name, Type: CatalogTypeFull, BackupTS: ts, Status: CatalogStatusComplete}
+	}
+	inc := func(name string, lastTS, ts uint64) CatalogEntry {
+		return CatalogEntry{
+			Storage: name, Type: CatalogTypeIncremental, BackupTS: ts, LastBackupTS: lastTS, Status: CatalogStatusComplete,
+		}
+	}
+	catalog := &Catalog{}
+	catalog.put(inc("inc-2", 20, 30))
+	catalog.put(full("full-1", 10))
+	catalog.put(inc("inc-1", 10, 20))
+	catalog.put(inc("inc-1-short", 10, 15))
+	catalog.put(full("full-2", 40))
+	failed := inc("inc-3", 40, 50)
+	failed.Status = CatalogStatusFailed
+	catalog.put(failed)
+	catalog.put(CatalogEntry{Storage: "raw", Type: CatalogTypeRaw, Status: CatalogStatusComplete})
+	c.Assert(catalog.Backups, HasLen, 7)
+	c.Assert(catalog.Backups[1].Storage, Equals, "full-1")
+
+	chains := catalog.Chains()
+	c.Assert(chains, HasLen, 2)
+	c.Assert(chains[0], DeepEquals, []CatalogEntry{full("full-1", 10), inc("inc-1", 10, 20), inc("inc-2", 20, 30)})
+	c.Assert(chains[1], DeepEquals, []CatalogEntry{full("full-2", 40)})
+
+	// The retried backup replaces the failed one.
+	catalog.put(inc("inc-3", 40, 50))
+	c.Assert(catalog.Backups, HasLen, 7)
+	c.Assert(catalog.Chains()[1], HasLen, 2)
+}
+
+func (s *testCatalogSuite) TestRecordCatalog(c *C) {
+	ctx := context.Background()
+	dir := c.MkDir()
+	catalogURL, cfg := "local://"+dir, &Config{}
+	recordCatalog(ctx, catalogURL, cfg, CatalogEntry{Storage: "local:///backup/1", Type: CatalogTypeFull, BackupTS: 42})
+	recordCatalog(ctx, catalogURL, cfg, CatalogEntry{Storage: "local:///backup/2", Type: CatalogTypeFull, BackupTS: 43})
+	record := catalogRecorder(ctx, catalogURL, cfg, &CatalogEntry{Storage: "local:///backup/raw", Type: CatalogTypeRaw})
+	record(nil)
+
+	store, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	catalog, err := LoadCatalog(ctx, store)
+	c.Assert(err, IsNil)
+	c.Assert(catalog.Backups, HasLen, 3)
+	c.Assert(catalog.Backups[0].Type, Equals, CatalogTypeRaw)
+	c.Assert(catalog.Backups[0].Status, Equals, CatalogStatusComplete)
+	c.Assert(catalog.Backups[2].BackupTS, Equals, uint64(43))
+	// Each backup is recorded in its own entry file.
+	entries := 0
+	c.Assert(store.WalkDir(ctx, &storage.WalkOption{SubDir: utils.CatalogDir}, func(string, int64) error {
+		entries++
+		return nil
+	}), IsNil)
+	c.Assert(entries, Equals, 3)
+
+	// The retried backup replaces its entry.
+	recordCatalog(ctx, catalogURL, cfg, CatalogEntry{Storage: "local:///backup/2", Type: CatalogTypeFull, BackupTS: 44})
+	catalog, err = LoadCatalog(ctx, store)
+	c.Assert(err, IsNil)
+	c.Assert(catalog.Backups, HasLen, 3)
+	c.Assert(catalog.Backups[2].BackupTS, Equals, uint64(44))
+
+	// The catalog written by the old BR is still loaded.
+	c.Assert(store.Write(ctx, utils.CatalogFile, []byte(`{"backups": [{"storage": "local:///backup/0"}]}`)), IsNil)
+	catalog, err = LoadCatalog(ctx, store)
+	c.Assert(err, IsNil)
+	c.Assert(catalog.Backups, HasLen, 4)
+
+	c.Assert(store.Write(ctx, utils.CatalogFile, []byte("{")), IsNil)
+	_, err = LoadCatalog(ctx, store)
+	c.Assert(err, ErrorMatches, ".*invalid backup.catalog.json.*")
+}
@@ -4,13 +4,15 @@ package task
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/gogo/protobuf/proto"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/kvproto/pkg/backup"
 	"github.com/pingcap/log"
@@ -22,11 +24,13 @@ import (
 	pd "github.com/tikv/pd/client"
 	"go.etcd.io/etcd/pkg/transport"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/keepalive"
 
 	"github.com/pingcap/br/pkg/conn"
 	berrors "github.com/pingcap/br/pkg/errors"
 	"github.com/pingcap/br/pkg/glue"
+	"github.com/pingcap/br/pkg/metautil"
 	"github.com/pingcap/br/pkg/storage"
 	"github.com/pingcap/br/pkg/utils"
 )
@@ -38,6 +42,8 @@ const (
 	flagStorage = "storage"
 	// flagPD is the name of PD url flag.
 	flagPD = "pd"
+	// pdSRVScheme is the prefix of PD addresses discovered by DNS SRV records.
+	pdSRVScheme = "srv://"
 	// flagCA is the name of TLS CA flag.
 	flagCA = "ca"
 	// flagCert is the name of TLS cert flag.
@@ -55,9 +61,13 @@ const (
 	flagChecksum            = "checksum"
 	flagFilter              = "filter"
 	flagCaseSensitive       = "case-sensitive"
+	flagExclude             = "exclude"
 	flagRemoveTiFlash       = "remove-tiflash"
 	flagCheckRequirement    = "check-requirements"
 	flagSwitchModeInterval  = "switch-mode-interval"
+	flagForceConcurrent     = "force-concurrent"
+	flagMetaVerifyKey       = "backupmeta-verify-key"
+	flagSaveSummary         = "save-summary"
 	// flagGrpcKeepaliveTime is the interval of pinging the server.
 	flagGrpcKeepaliveTime = "grpc-keepalive-time"
 	// flagGrpcKeepaliveTimeout is the max time a grpc conn can keep idel before killed.
@@ -66,6 +76,10 @@ const (
 	defaultSwitchInterval       = 5 * time.Minute
 	defaultGRPCKeepaliveTime    = 10 * time.Second
 	defaultGRPCKeepaliveTimeout = 3 * time.Second
+
+	// rediscoverPDInterval is the interval of re-resolving the DNS SRV records
+	// of PD.
+	rediscoverPDInterval = time.Minute
 )
 
 // TLSConfig is the common configuration for TLS connection.
@@ -94,6 +108,49 @@ func (tls *TLSConfig) ToTLSConfig() (*tls.Config, error) {
 	return tlsConfig, nil
 }
 
+// ChecksumMode is the mode of the checksum at the end of a task.
+type ChecksumMode string
+
+const (
+	// ChecksumRequired checksums the tables in the cluster.
+	ChecksumRequired ChecksumMode = "required"
+	// ChecksumOptional relies on the checksums of the files returned by
+	// TiKV, without checksumming the tables in the cluster, which is
+	// expensive on huge clusters.
+	ChecksumOptional ChecksumMode = "optional"
+	// ChecksumOff skips the checksum.
+	ChecksumOff ChecksumMode = "off"
+)
+
+// checksumModeValue is the value of --checksum, the boolean values are
+// accepted for compatibility.
+type checksumModeValue struct {
+	mode *ChecksumMode
+}
+
+func (v checksumModeValue) String() string {
+	return string(*v.mode)
+}
+
+func (v checksumModeValue) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "true", string(ChecksumRequired):
+		*v.mode = ChecksumRequired
+	case "false", string(ChecksumOff):
+		*v.mode = ChecksumOff
+	case string(ChecksumOptional):
+		*v.mode = ChecksumOptional
+	default:
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"invalid checksum mode %s, must be one of required, optional and off", s)
+	}
+	return nil
+}
+
+func (v checksumModeValue) Type() string {
+	return "string"
+}
+
 // Config is the common configuration for all BRIE tasks.
 type Config struct {
 	storage.BackendOptions
@@ -106,8 +163,14 @@ type Config struct {
 	Concurrency         uint32    `json:"concurrency" toml:"concurrency"`
 	Checksum            bool      `json:"checksum" toml:"checksum"`
 	SendCreds           bool      `json:"send-credentials-to-tikv" toml:"send-credentials-to-tikv"`
+	// RateLimitUnit is the unit of the rate limits in the flags and the
+	// config file.
+	RateLimitUnit uint64 `json:"ratelimit-unit" toml:"ratelimit-unit"`
 	// LogProgress is true means the progress bar is printed to the log instead of stdout.
 	LogProgress bool `json:"log-progress" toml:"log-progress"`
+	// ChecksumMode is the mode of the checksum if Checksum is true, empty
+	// means ChecksumRequired.
+	ChecksumMode ChecksumMode `json:"checksum-mode" toml:"checksum-mode"`
 
 	// CaseSensitive should not be used.
 	//
@@ -120,21 +183,43 @@ type Config struct {
 	// should be removed after TiDB upgrades the BR dependency.
 	Filter filter.MySQLReplicationRules
 
-	TableFilter        filter.Filter `json:"-" toml:"-"`
+	TableFilter filter.Filter `json:"-" toml:"-"`
+	// FilterRules are the rules of TableFilter, the tables of --db and
+	// --table are converted into rules.
+	FilterRules        []string      `json:"filter-rules" toml:"filter-rules"`
 	CheckRequirements  bool          `json:"check-requirements" toml:"check-requirements"`
 	SwitchModeInterval time.Duration `json:"switch-mode-interval" toml:"switch-mode-interval"`
+	// ForceConcurrent runs the task even if another one is running against
+	// the cluster.
+	ForceConcurrent bool `json:"force-concurrent" toml:"force-concurrent"`
+	// MetaVerifyKey is the path of the ed25519 public key verifying the
+	// signature of the backupmeta, empty means the signature isn't verified.
+	MetaVerifyKey string `json:"backupmeta-verify-key" toml:"backupmeta-verify-key"`
+	// SaveSummary writes the JSON summary of the task into the storage.
+	SaveSummary bool `json:"save-summary" toml:"save-summary"`
 
 	// GrpcKeepaliveTime is the interval of pinging the server.
 	GRPCKeepaliveTime time.Duration `json:"grpc-keepalive-time" toml:"grpc-keepalive-time"`
 	// GrpcKeepaliveTimeout is the max time a grpc conn can keep idel before killed.
 	GRPCKeepaliveTimeout time.Duration `json:"grpc-keepalive-timeout" toml:"grpc-keepalive-timeout"`
+	// GRPCDialOptions are appended to the options dialing PD and TiKV. It's for
+	// the callers embedding BR, e.g. to add interceptors for auth or tracing.
+	GRPCDialOptions []grpc.DialOption `json:"-" toml:"-"`
+	// PDDiscovery is the PD addresses given by --pd if some of them are
+	// discovered by DNS SRV records, they are re-resolved while the task runs.
+	PDDiscovery []string `json:"-" toml:"-"`
 }
 
 // DefineCommonFlags defines the flags common to all BRIE commands.
 func DefineCommonFlags(flags *pflag.FlagSet) {
+	flags.String(flagConfigFile, "", "the TOML file of the flags, whose keys are the names of the flags,"+
+		" the flags are also set by the environment variables like "+EnvName(flagPD)+", the command line"+
+		" overrides the environment variables, which override the config file")
 	flags.BoolP(flagSendCreds, "c", true, "Whether send credentials to tikv")
 	flags.StringP(flagStorage, "s", "", `specify the url where backup storage, eg, "s3://bucket/path/prefix"`)
-	flags.StringSliceP(flagPD, "u", []string{"127.0.0.1:2379"}, "PD address")
+	flags.StringSliceP(flagPD, "u", []string{"127.0.0.1:2379"},
+		"PD address, IPv6 addresses should be in brackets, e.g. [::1]:2379, "+
+			"and srv://<name> discovers PD by the DNS SRV records of the name")
 	flags.String(flagCA, "", "CA certificate path for TLS connection")
 	flags.String(flagCert, "", "Certificate path for TLS connection")
 	flags.String(flagKey, "", "Private key path for TLS connection")
@@ -142,7 +227,11 @@ func DefineCommonFlags(flags *pflag.FlagSet) {
 	_ = flags.MarkHidden(flagChecksumConcurrency)
 
 	flags.Uint64(flagRateLimit, 0, "The rate limit of the task, MB/s per node")
-	flags.Bool(flagChecksum, true, "Run checksum at end of task")
+	checksumMode := ChecksumRequired
+	flags.Var(checksumModeValue{mode: &checksumMode}, flagChecksum,
+		"Run checksum at end of task, one of required, optional and off, "+
+			"optional relies on the checksums of the files instead of checksumming the tables in the cluster")
+	flags.Lookup(flagChecksum).NoOptDefVal = string(ChecksumRequired)
 	flags.Bool(flagRemoveTiFlash, true,
 		"Remove TiFlash replicas before backup or restore, for unsupported versions of TiFlash")
 
@@ -160,6 +249,12 @@ func DefineCommonFlags(flags *pflag.FlagSet) {
 	flags.Bool(flagCheckRequirement, true,
 		"Whether start version check before execute command")
 	flags.Duration(flagSwitchModeInterval, defaultSwitchInterval, "maintain import mode on TiKV during restore")
+	flags.Bool(flagForceConcurrent, false,
+		"run even if another backup or restore is running against the cluster")
+	flags.String(flagMetaVerifyKey, "", "the path of the ed25519 public key in PKIX PEM to verify the signature"+
+		" of the backupmeta, the backupmeta not signed by the private key is refused")
+	flags.Bool(flagSaveSummary, false, "write the JSON summary printed on exit into the storage as "+
+		utils.SummaryFile+", whether the task succeeds or not")
 	flags.Duration(flagGrpcKeepaliveTime, defaultGRPCKeepaliveTime,
 		"the interval of pinging gRPC peer, must keep the same value with TiKV and PD")
 	flags.Duration(flagGrpcKeepaliveTimeout, defaultGRPCKeepaliveTimeout,
@@ -170,15 +265,17 @@ func DefineCommonFlags(flags *pflag.FlagSet) {
 	storage.DefineFlags(flags)
 }
 
-// DefineDatabaseFlags defines the required --db flag for `db` subcommand.
+// DefineDatabaseFlags defines the required --db flag and the --exclude flag for `db` subcommand.
 func DefineDatabaseFlags(command *cobra.Command) {
 	command.Flags().String(flagDatabase, "", "database name")
 	_ = command.MarkFlagRequired(flagDatabase)
+	defineExcludeFlag(command)
 }
 
 // DefineTableFlags defines the required --db and --table flags for `table` subcommand.
 func DefineTableFlags(command *cobra.Command) {
-	DefineDatabaseFlags(command)
+	command.Flags().String(flagDatabase, "", "database name")
+	_ = command.MarkFlagRequired(flagDatabase)
 	command.Flags().StringP(flagTable, "t", "", "table name")
 	_ = command.MarkFlagRequired(flagTable)
 }
@@ -188,6 +285,37 @@ func DefineFilterFlags(command *cobra.Command) {
 	flags := command.Flags()
 	flags.StringArrayP(flagFilter, "f", []string{"*.*"}, "select tables to process")
 	flags.Bool(flagCaseSensitive, false, "whether the table names used in --filter should be case-sensitive")
+	defineExcludeFlag(command)
+}
+
+func defineExcludeFlag(command *cobra.Command) {
+	command.Flags().StringArrayP(flagExclude, "x", nil,
+		"skip the tables matching the filter rule, e.g. 'db.big_log_table', can be specified multiple times")
+}
+
+// parseExcludeRules turns the --exclude flags into negated table filter rules.
+func parseExcludeRules(flags *pflag.FlagSet) ([]string, error) {
+	if flags.Lookup(flagExclude) == nil {
+		return nil, nil
+	}
+	excludes, err := flags.GetStringArray(flagExclude)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	rules := make([]string, 0, len(excludes))
+	for _, exclude := range excludes {
+		exclude = strings.TrimSpace(exclude)
+		if len(exclude) == 0 || strings.HasPrefix(exclude, "!") || strings.HasPrefix(exclude, "@") {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid exclude rule '%s'", exclude)
+		}
+		rules = append(rules, "!"+exclude)
+	}
+	return rules, nil
+}
+
+// quoteFilterName quotes the name so it can be used in a table filter rule.
+func quoteFilterName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
 }
 
 // ParseFromFlags parses the TLS config from the flag set.
@@ -209,14 +337,83 @@ func (tls *TLSConfig) ParseFromFlags(flags *pflag.FlagSet) error {
 }
 
 func (cfg *Config) normalizePDURLs() error {
-	for i := range cfg.PD {
-		var err error
-		cfg.PD[i], err = normalizePDURL(cfg.PD[i], cfg.TLS.IsEnabled())
+	pds, discovered, err := resolvePDURLs(cfg.PD, cfg.TLS.IsEnabled(), lookupPDSRV)
+	if err != nil {
+		return err
+	}
+	if discovered {
+		cfg.PDDiscovery = cfg.PD
+	}
+	cfg.PD = pds
+	return nil
+}
+
+// resolvePDURLs normalizes the PD addresses and resolves the ones of srv://,
+// discovered is whether some addresses are resolved.
+func resolvePDURLs(
+	pds []string, useTLS bool, lookup func(name string) ([]string, error),
+) (addrs []string, discovered bool, err error) {
+	addrs = make([]string, 0, len(pds))
+	for _, pd := range pds {
+		if strings.HasPrefix(pd, pdSRVScheme) {
+			resolved, err := lookup(strings.TrimPrefix(pd, pdSRVScheme))
+			if err != nil {
+				return nil, false, err
+			}
+			addrs = append(addrs, resolved...)
+			discovered = true
+			continue
+		}
+		pd, err := normalizePDURL(pd, useTLS)
 		if err != nil {
-			return err
+			return nil, false, err
 		}
+		addrs = append(addrs, pd)
 	}
-	return nil
+	return addrs, discovered, nil
+}
+
+// keepDiscoveringPD re-resolves the DNS SRV records of PD until the context is
+// done, so the HTTP requests to PD follow the rescheduled PD pods rather than
+// the addresses resolved when the task started.
+func (cfg *Config) keepDiscoveringPD(ctx context.Context, mgr *conn.Mgr) {
+	if len(cfg.PDDiscovery) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(rediscoverPDInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			addrs, _, err := resolvePDURLs(cfg.PDDiscovery, cfg.TLS.IsEnabled(), lookupPDSRV)
+			if err != nil {
+				// Keep the known addresses, PD may be reachable by them.
+				log.Warn("failed to rediscover pd", zap.Error(err))
+				continue
+			}
+			mgr.SetAddrs(addrs)
+		}
+	}()
+}
+
+// lookupPDSRV discovers the PD addresses through the DNS SRV records of name.
+func lookupPDSRV(name string) ([]string, error) {
+	_, records, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+			"failed to look up the SRV records of pd %s: %v", name, err)
+	}
+	addrs := make([]string, 0, len(records))
+	for _, r := range records {
+		host := strings.TrimSuffix(r.Target, ".")
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+	}
+	log.Info("pd addresses discovered", zap.String("srv", name), zap.Strings("addresses", addrs))
+	return addrs, nil
 }
 
 // ParseFromFlags parses the config from the flag set.
@@ -234,10 +431,8 @@ func (cfg *Config) ParseFromFlags(flags *pflag.FlagSet) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
-	cfg.Checksum, err = flags.GetBool(flagChecksum)
-	if err != nil {
-		return errors.Trace(err)
-	}
+	cfg.ChecksumMode = ChecksumMode(flags.Lookup(flagChecksum).Value.String())
+	cfg.Checksum = cfg.ChecksumMode != ChecksumOff
 	cfg.ChecksumConcurrency, err = flags.GetUint(flagChecksumConcurrency)
 	if err != nil {
 		return errors.Trace(err)
@@ -253,14 +448,22 @@ func (cfg *Config) ParseFromFlags(flags *pflag.FlagSet) error {
 		return errors.Trace(err)
 	}
 	cfg.RateLimit = rateLimit * rateLimitUnit
+	cfg.RateLimitUnit = rateLimitUnit
 
+	excludes, err := parseExcludeRules(flags)
+	if err != nil {
+		return errors.Trace(err)
+	}
 	var caseSensitive bool
 	if filterFlag := flags.Lookup(flagFilter); filterFlag != nil {
-		f, err := filter.Parse(filterFlag.Value.(pflag.SliceValue).GetSlice())
+		// The later rules take precedence, so the excluded tables are
+		// filtered out even if they are selected by --filter.
+		rules := append(filterFlag.Value.(pflag.SliceValue).GetSlice(), excludes...)
+		f, err := filter.Parse(rules)
 		if err != nil {
 			return err
 		}
-		cfg.TableFilter = f
+		cfg.TableFilter, cfg.FilterRules = f, rules
 		caseSensitive, err = flags.GetBool(flagCaseSensitive)
 		if err != nil {
 			return errors.Trace(err)
@@ -279,11 +482,21 @@ func (cfg *Config) ParseFromFlags(flags *pflag.FlagSet) error {
 				Schema: db,
 				Name:   tbl,
 			})
+			cfg.FilterRules = []string{quoteFilterName(db) + "." + quoteFilterName(tbl)}
+		} else if len(excludes) > 0 {
+			rules := append([]string{quoteFilterName(db) + ".*"}, excludes...)
+			f, err := filter.Parse(rules)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			cfg.TableFilter, cfg.FilterRules = f, rules
 		} else {
 			cfg.TableFilter = filter.NewSchemasFilter(db)
+			cfg.FilterRules = []string{quoteFilterName(db) + ".*"}
 		}
 	} else {
-		cfg.TableFilter, _ = filter.Parse([]string{"*.*"})
+		cfg.FilterRules = []string{"*.*"}
+		cfg.TableFilter, _ = filter.Parse(cfg.FilterRules)
 	}
 	if !caseSensitive {
 		cfg.TableFilter = filter.CaseInsensitive(cfg.TableFilter)
@@ -293,6 +506,18 @@ func (cfg *Config) ParseFromFlags(flags *pflag.FlagSet) error {
 		return errors.Trace(err)
 	}
 	cfg.CheckRequirements = checkRequirements
+	cfg.ForceConcurrent, err = flags.GetBool(flagForceConcurrent)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.MetaVerifyKey, err = flags.GetString(flagMetaVerifyKey)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.SaveSummary, err = flags.GetBool(flagSaveSummary)
+	if err != nil {
+		return errors.Trace(err)
+	}
 
 	cfg.SwitchModeInterval, err = flags.GetDuration(flagSwitchModeInterval)
 	if err != nil {
@@ -332,7 +557,8 @@ func NewMgr(ctx context.Context,
 	g glue.Glue, pds []string,
 	tlsConfig TLSConfig,
 	keepalive keepalive.ClientParameters,
-	checkRequirements bool) (*conn.Mgr, error) {
+	checkRequirements bool,
+	dialOpts ...grpc.DialOption) (*conn.Mgr, error) {
 	var (
 		tlsConf *tls.Config
 		err     error
@@ -363,7 +589,7 @@ func NewMgr(ctx context.Context,
 	return conn.NewMgr(ctx, g,
 		pdAddress, store.(tikv.Storage),
 		tlsConf, securityOption, keepalive,
-		conn.SkipTiFlash, checkRequirements)
+		conn.SkipTiFlash, checkRequirements, dialOpts...)
 }
 
 // GetStorage gets the storage backend from the config.
@@ -382,27 +608,48 @@ func GetStorage(
 	return u, s, nil
 }
 
-// ReadBackupMeta reads the backupmeta file from the storage.
+// ReadBackupMeta reads the whole backupmeta file from the storage.
 func ReadBackupMeta(
 	ctx context.Context,
 	fileName string,
 	cfg *Config,
 ) (*backup.StorageBackend, storage.ExternalStorage, *backup.BackupMeta, error) {
-	u, s, err := GetStorage(ctx, cfg)
+	u, s, reader, err := OpenBackupMeta(ctx, fileName, cfg)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	metaData, err := s.Read(ctx, fileName)
+	backupMeta, err := reader.ReadAll(ctx)
 	if err != nil {
-		return nil, nil, nil, errors.Annotate(err, "load backupmeta failed")
-	}
-	backupMeta := &backup.BackupMeta{}
-	if err = proto.Unmarshal(metaData, backupMeta); err != nil {
-		return nil, nil, nil, errors.Annotate(err, "parse backupmeta failed")
+		return nil, nil, nil, err
 	}
 	return u, s, backupMeta, nil
 }
 
+// OpenBackupMeta reads the root of the backupmeta file from the storage, the
+// files and schemas are read by the returned reader.
+func OpenBackupMeta(
+	ctx context.Context,
+	fileName string,
+	cfg *Config,
+) (*backup.StorageBackend, storage.ExternalStorage, *metautil.MetaReader, error) {
+	var verifyKey ed25519.PublicKey
+	if cfg.MetaVerifyKey != "" {
+		var err error
+		if verifyKey, err = metautil.LoadVerifyKey(cfg.MetaVerifyKey); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	u, s, err := GetStorage(ctx, cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	reader, err := metautil.NewMetaReader(ctx, s, fileName, verifyKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return u, s, reader, nil
+}
+
 // flagToZapField checks whether this flag can be logged,
 // if need to log, return its zap field. Or return a field with hidden value.
 func flagToZapField(f *pflag.Flag) zap.Field {
@@ -437,6 +684,18 @@ func GetKeepalive(cfg *Config) keepalive.ClientParameters {
 	}
 }
 
+// checksumMode returns the mode of the checksum, the callers setting only
+// Checksum get ChecksumRequired.
+func (cfg *Config) checksumMode() ChecksumMode {
+	if !cfg.Checksum {
+		return ChecksumOff
+	}
+	if cfg.ChecksumMode == "" {
+		return ChecksumRequired
+	}
+	return cfg.ChecksumMode
+}
+
 // adjust adjusts the abnormal config value in the current config.
 // useful when not starting BR from CLI (e.g. from BRIE in SQL).
 func (cfg *Config) adjust() {
@@ -456,13 +715,17 @@ func normalizePDURL(pd string, useTLS bool) (string, error) {
 		if useTLS {
 			return "", errors.Annotate(berrors.ErrInvalidArgument, "pd url starts with http while TLS enabled")
 		}
-		return strings.TrimPrefix(pd, "http://"), nil
-	}
-	if strings.HasPrefix(pd, "https://") {
+		pd = strings.TrimPrefix(pd, "http://")
+	} else if strings.HasPrefix(pd, "https://") {
 		if !useTLS {
 			return "", errors.Annotate(berrors.ErrInvalidArgument, "pd url starts with https while TLS disabled")
 		}
-		return strings.TrimPrefix(pd, "https://"), nil
+		pd = strings.TrimPrefix(pd, "https://")
+	}
+	// The port can't be told from an IPv6 literal without brackets.
+	if strings.Count(pd, ":") > 1 && !strings.HasPrefix(pd, "[") {
+		return "", errors.Annotatef(berrors.ErrInvalidArgument,
+			"pd address %s should be in brackets if it's an IPv6 address, e.g. [::1]:2379", pd)
 	}
 	return pd, nil
 }
@@ -3,11 +3,13 @@
 package task
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/pingcap/tidb/config"
 
 	. "github.com/pingcap/check"
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
 	"github.com/spf13/pflag"
 )
 
@@ -62,4 +64,86 @@ func (s *testCommonSuite) TestStripingPDURL(c *C) {
 	noChange, err := normalizePDURL("127.0.0.1:2379", false)
 	c.Assert(err, IsNil)
 	c.Assert(noChange, Equals, "127.0.0.1:2379")
+	ipv6, err := normalizePDURL("http://[::1]:2379", false)
+	c.Assert(err, IsNil)
+	c.Assert(ipv6, Equals, "[::1]:2379")
+	_, err = normalizePDURL("::1:2379", false)
+	c.Assert(err, ErrorMatches, ".*should be in brackets.*")
+}
+
+func (s *testCommonSuite) TestResolvePDURLs(c *C) {
+	records := []string{"pd0.pd:2379", "pd1.pd:2379"}
+	lookup := func(name string) ([]string, error) {
+		if name != "_pd._tcp.pd" {
+			return nil, errors.New("no such host")
+		}
+		return records, nil
+	}
+	addrs, discovered, err := resolvePDURLs([]string{"http://127.0.0.1:2379"}, false, lookup)
+	c.Assert(err, IsNil)
+	c.Assert(discovered, IsFalse)
+	c.Assert(addrs, DeepEquals, []string{"127.0.0.1:2379"})
+
+	pds := []string{"srv://_pd._tcp.pd", "127.0.0.1:2379"}
+	addrs, discovered, err = resolvePDURLs(pds, false, lookup)
+	c.Assert(err, IsNil)
+	c.Assert(discovered, IsTrue)
+	c.Assert(addrs, DeepEquals, []string{"pd0.pd:2379", "pd1.pd:2379", "127.0.0.1:2379"})
+
+	// The pods are rescheduled.
+	records = []string{"pd2.pd:2379"}
+	addrs, _, err = resolvePDURLs(pds, false, lookup)
+	c.Assert(err, IsNil)
+	c.Assert(addrs, DeepEquals, []string{"pd2.pd:2379", "127.0.0.1:2379"})
+
+	_, _, err = resolvePDURLs([]string{"srv://_pd._tcp.unknown"}, false, lookup)
+	c.Assert(err, ErrorMatches, "no such host")
+}
+
+func (s *testCommonSuite) TestParseExcludeRules(c *C) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringArray(flagExclude, nil, "")
+	c.Assert(flags.Parse([]string{"--exclude", "db.big_log_table", "--exclude", "audit_*.*"}), IsNil)
+	rules, err := parseExcludeRules(flags)
+	c.Assert(err, IsNil)
+	c.Assert(rules, DeepEquals, []string{"!db.big_log_table", "!audit_*.*"})
+
+	f, err := filter.Parse(append([]string{quoteFilterName("db") + ".*"}, rules...))
+	c.Assert(err, IsNil)
+	c.Assert(f.MatchTable("db", "big_log_table"), IsFalse)
+	c.Assert(f.MatchTable("db", "orders"), IsTrue)
+	c.Assert(f.MatchTable("audit_2020", "log"), IsFalse)
+
+	c.Assert(flags.Set(flagExclude, "!db.t"), IsNil)
+	_, err = parseExcludeRules(flags)
+	c.Assert(err, ErrorMatches, ".*invalid exclude rule.*")
+}
+
+func (s *testCommonSuite) TestChecksumModeFlag(c *C) {
+	parse := func(args ...string) (ChecksumMode, error) {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		DefineCommonFlags(flags)
+		err := flags.Parse(args)
+		return ChecksumMode(flags.Lookup(flagChecksum).Value.String()), err
+	}
+	mode, err := parse()
+	c.Assert(err, IsNil)
+	c.Assert(mode, Equals, ChecksumRequired)
+	mode, err = parse("--checksum")
+	c.Assert(err, IsNil)
+	c.Assert(mode, Equals, ChecksumRequired)
+	mode, err = parse("--checksum=false")
+	c.Assert(err, IsNil)
+	c.Assert(mode, Equals, ChecksumOff)
+	mode, err = parse("--checksum=optional")
+	c.Assert(err, IsNil)
+	c.Assert(mode, Equals, ChecksumOptional)
+	_, err = parse("--checksum=maybe")
+	c.Assert(err, ErrorMatches, ".*invalid checksum mode maybe.*")
+
+	// The callers setting only Checksum get the required mode.
+	cfg := Config{Checksum: true}
+	c.Assert(cfg.checksumMode(), Equals, ChecksumRequired)
+	cfg.Checksum = false
+	c.Assert(cfg.checksumMode(), Equals, ChecksumOff)
 }
@@ -0,0 +1,194 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const (
+	flagConfigFile = "config-file"
+	// flagLogLevel is defined by the command, it can be reloaded.
+	flagLogLevel = "log-level"
+
+	// envPrefix is the prefix of the environment variables overriding the
+	// flags, e.g. BR_PD overrides --pd and BR_S3_REGION overrides --s3.region.
+	envPrefix = "BR_"
+)
+
+// ApplyConfig sets the flags not given in the command line by the
+// environment variables and then by the TOML config file given by
+// --config-file, so the command line overrides the environment variables,
+// which override the config file. The keys of the config file are the names
+// of the flags, the tables are joined with dots, e.g.
+//
+//	pd = ["127.0.0.1:2379"]
+//	storage = "s3://backup/prefix"
+//	ratelimit = 128
+//
+//	[s3]
+//	region = "us-west-2"
+//
+// The config file may be shared by the commands, so the keys which aren't
+// the flags of the command are returned instead of failing. The environment
+// variables are looked up by lookupEnv, e.g. os.LookupEnv.
+func ApplyConfig(
+	flags *pflag.FlagSet, lookupEnv func(string) (string, bool),
+) (unknown []string, err error) {
+	if err = applyEnv(flags, lookupEnv); err != nil {
+		return nil, err
+	}
+	path, err := flags.GetString(flagConfigFile)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if path == "" {
+		return nil, nil
+	}
+	values := make(map[string]interface{})
+	if _, err = toml.DecodeFile(path, &values); err != nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid config file %s: %v", path, err)
+	}
+	unknown, err = applyConfigValues(flags, "", values)
+	return unknown, errors.Annotatef(err, "invalid config file %s", path)
+}
+
+// WatchConfigReload reloads the config file given by --config-file once BR
+// receives SIGHUP, the tunable parameters in it, e.g. ratelimit and
+// concurrency of the backup, and log-level, are changed while the task runs.
+func WatchConfigReload(flags *pflag.FlagSet) error {
+	path, err := flags.GetString(flagConfigFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if path == "" {
+		return nil
+	}
+	utils.StartConfigReloader(func() {
+		if err := reloadConfig(path); err != nil {
+			log.Warn("failed to reload the config file", zap.String("path", path), zap.Error(err))
+		}
+	})
+	return nil
+}
+
+func reloadConfig(path string) error {
+	values := make(map[string]interface{})
+	if _, err := toml.DecodeFile(path, &values); err != nil {
+		return errors.Annotatef(berrors.ErrInvalidArgument, "invalid config file %s: %v", path, err)
+	}
+	return tuneByConfigValues(values)
+}
+
+// tuneByConfigValues changes the tunable parameters and the log level by the
+// values decoded from the config file, the other values are ignored.
+func tuneByConfigValues(values map[string]interface{}) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == flagLogLevel {
+			level, ok := values[key].(string)
+			if !ok {
+				return errors.Annotatef(berrors.ErrInvalidArgument, "invalid %s: %v", key, values[key])
+			}
+			if err := utils.SetLogLevel(level); err != nil {
+				return errors.Annotatef(berrors.ErrInvalidArgument, "invalid %s: %v", key, err)
+			}
+			continue
+		}
+		// The integers are decoded as int64 from TOML.
+		value, ok := values[key].(int64)
+		if !ok {
+			continue
+		}
+		if value < 0 {
+			return errors.Annotatef(berrors.ErrInvalidArgument, "invalid %s: %d", key, value)
+		}
+		if utils.Tune(key, uint64(value)) {
+			log.Info("parameter reloaded", zap.String("name", key), zap.Int64("value", value))
+		}
+	}
+	return nil
+}
+
+// EnvName returns the name of the environment variable overriding the flag.
+func EnvName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(flag))
+}
+
+func applyEnv(flags *pflag.FlagSet, lookupEnv func(string) (string, bool)) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed {
+			return
+		}
+		if value, ok := lookupEnv(EnvName(f.Name)); ok {
+			if e := flags.Set(f.Name, value); e != nil {
+				err = errors.Annotatef(berrors.ErrInvalidArgument, "invalid %s: %v", EnvName(f.Name), e)
+			}
+		}
+	})
+	return err
+}
+
+// applyConfigValues sets the flags not changed by the values decoded from
+// the config file, and returns the keys which aren't flags.
+func applyConfigValues(flags *pflag.FlagSet, prefix string, values map[string]interface{}) ([]string, error) {
+	unknown := make([]string, 0)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := prefix + key
+		if table, ok := values[key].(map[string]interface{}); ok {
+			unknownInTable, err := applyConfigValues(flags, name+".", table)
+			if err != nil {
+				return nil, err
+			}
+			unknown = append(unknown, unknownInTable...)
+			continue
+		}
+		f := flags.Lookup(name)
+		if f == nil {
+			unknown = append(unknown, name)
+			continue
+		}
+		if f.Changed {
+			continue
+		}
+		list, isList := values[key].([]interface{})
+		if !isList {
+			list = []interface{}{values[key]}
+		}
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+		// The array flags append every value set, the others are set once.
+		if f.Value.Type() != "stringArray" {
+			items = []string{strings.Join(items, ",")}
+		}
+		for _, item := range items {
+			if err := flags.Set(name, item); err != nil {
+				return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid %s: %v", name, err)
+			}
+		}
+	}
+	return unknown, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/pingcap/br/pkg/utils"
+)
+
+type testConfigFileSuite struct{}
+
+var _ = Suite(&testConfigFileSuite{})
+
+func (s *testConfigFileSuite) TestApplyConfig(c *C) {
+	path := filepath.Join(c.MkDir(), "br.toml")
+	c.Assert(ioutil.WriteFile(path, []byte(`
+pd = ["10.0.1.1:2379", "10.0.1.2:2379"]
+storage = "s3://backup/from-file"
+ratelimit = 128
+ignore-dup-files = true
+
+[s3]
+region = "us-west-2"
+`), 0644), IsNil)
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	DefineCommonFlags(flags)
+	c.Assert(flags.Parse([]string{"--config-file", path, "--ratelimit", "64"}), IsNil)
+	c.Assert(applyEnv(flags, func(name string) (string, bool) {
+		if name == "BR_STORAGE" {
+			return "s3://backup/from-env", true
+		}
+		return "", false
+	}), IsNil)
+	unknown, err := applyConfigValues(flags, "", map[string]interface{}{
+		"pd":               []interface{}{"10.0.1.1:2379", "10.0.1.2:2379"},
+		"storage":          "s3://backup/from-file",
+		"ratelimit":        int64(128),
+		"ignore-dup-files": true,
+		"s3":               map[string]interface{}{"region": "us-west-2"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(unknown, DeepEquals, []string{"ignore-dup-files"})
+
+	pd, err := flags.GetStringSlice(flagPD)
+	c.Assert(err, IsNil)
+	c.Assert(pd, DeepEquals, []string{"10.0.1.1:2379", "10.0.1.2:2379"})
+	// The command line overrides the environment variables, which override
+	// the config file.
+	rateLimit, err := flags.GetUint64(flagRateLimit)
+	c.Assert(err, IsNil)
+	c.Assert(rateLimit, Equals, uint64(64))
+	storage, err := flags.GetString(flagStorage)
+	c.Assert(err, IsNil)
+	c.Assert(storage, Equals, "s3://backup/from-env")
+	region, err := flags.GetString("s3.region")
+	c.Assert(err, IsNil)
+	c.Assert(region, Equals, "us-west-2")
+
+	// The whole file is applied by ApplyConfig.
+	flags = pflag.NewFlagSet("test", pflag.ContinueOnError)
+	DefineCommonFlags(flags)
+	c.Assert(flags.Parse([]string{"--config-file", path}), IsNil)
+	noEnv := func(string) (string, bool) { return "", false }
+	unknown, err = ApplyConfig(flags, noEnv)
+	c.Assert(err, IsNil)
+	c.Assert(unknown, DeepEquals, []string{"ignore-dup-files"})
+	storage, err = flags.GetString(flagStorage)
+	c.Assert(err, IsNil)
+	c.Assert(storage, Equals, "s3://backup/from-file")
+	region, err = flags.GetString("s3.region")
+	c.Assert(err, IsNil)
+	c.Assert(region, Equals, "us-west-2")
+
+	// The environment variables override the config file in ApplyConfig too.
+	flags = pflag.NewFlagSet("test", pflag.ContinueOnError)
+	DefineCommonFlags(flags)
+	c.Assert(flags.Parse([]string{"--config-file", path}), IsNil)
+	_, err = ApplyConfig(flags, func(name string) (string, bool) {
+		if name == "BR_S3_REGION" {
+			return "eu-west-1", true
+		}
+		return "", false
+	})
+	c.Assert(err, IsNil)
+	region, err = flags.GetString("s3.region")
+	c.Assert(err, IsNil)
+	c.Assert(region, Equals, "eu-west-1")
+
+	c.Assert(EnvName("s3.sse-kms-key-id"), Equals, "BR_S3_SSE_KMS_KEY_ID")
+}
+
+func (s *testConfigFileSuite) TestTuneByConfigValues(c *C) {
+	defer log.SetLevel(log.GetLevel())
+	var concurrency uint64
+	utils.SetTunable(flagConcurrency, func(v uint64) { concurrency = v })
+	defer utils.SetTunable(flagConcurrency, nil)
+
+	c.Assert(tuneByConfigValues(map[string]interface{}{
+		flagLogLevel:    "warn",
+		flagConcurrency: int64(8),
+		// The parameters which aren't tunable are ignored.
+		flagPD:        []interface{}{"10.0.1.1:2379"},
+		flagRateLimit: int64(10),
+	}), IsNil)
+	c.Assert(log.GetLevel(), Equals, zapcore.WarnLevel)
+	c.Assert(concurrency, Equals, uint64(8))
+
+	c.Assert(tuneByConfigValues(map[string]interface{}{flagConcurrency: int64(-1)}), ErrorMatches, ".*invalid concurrency.*")
+	c.Assert(tuneByConfigValues(map[string]interface{}{flagLogLevel: "loud"}), ErrorMatches, ".*invalid log-level.*")
+	c.Assert(concurrency, Equals, uint64(8))
+}
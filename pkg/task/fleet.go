@@ -0,0 +1,173 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const (
+	flagFleetConfig = "config"
+
+	defaultFleetParallelism = 4
+)
+
+// FleetConfig is the configuration of backing up multiple clusters, e.g.
+//
+//	parallelism = 4
+//	log-dir = "/var/log/br"
+//
+//	[[cluster]]
+//	name = "cluster-1"
+//	pd = ["10.0.1.1:2379"]
+//	storage = "s3://backup/cluster-1/2020-12-01"
+//	args = ["--ratelimit", "128"]
+type FleetConfig struct {
+	// Parallelism is the max number of the clusters backed up concurrently.
+	Parallelism uint `toml:"parallelism" json:"parallelism"`
+	// LogDir is the directory of the logs of the clusters, the log of a
+	// cluster is named after it.
+	LogDir   string         `toml:"log-dir" json:"log-dir"`
+	Clusters []FleetCluster `toml:"cluster" json:"cluster"`
+}
+
+// FleetCluster is a cluster backed up by a fleet backup.
+type FleetCluster struct {
+	Name    string   `toml:"name" json:"name"`
+	PD      []string `toml:"pd" json:"pd"`
+	Storage string   `toml:"storage" json:"storage"`
+	// Args are the extra arguments of `br backup full` for the cluster.
+	Args []string `toml:"args" json:"args"`
+}
+
+// DefineFleetFlags defines the flags for the fleet backup command.
+func DefineFleetFlags(command *cobra.Command) {
+	command.Flags().String(flagFleetConfig, "", "the TOML file of the clusters to back up")
+	_ = command.MarkFlagRequired(flagFleetConfig)
+}
+
+// ParseFleetConfigFromFlags loads the fleet config file in the flags.
+func ParseFleetConfigFromFlags(flags *pflag.FlagSet) (*FleetConfig, error) {
+	path, err := flags.GetString(flagFleetConfig)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return LoadFleetConfig(path)
+}
+
+// LoadFleetConfig loads and validates the fleet config file.
+func LoadFleetConfig(path string) (*FleetConfig, error) {
+	cfg := &FleetConfig{}
+	if _, err := toml.DecodeFile(path, cfg); err != nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid fleet config %s: %v", path, err)
+	}
+	if err := cfg.adjust(); err != nil {
+		return nil, errors.Annotatef(err, "invalid fleet config %s", path)
+	}
+	return cfg, nil
+}
+
+func (cfg *FleetConfig) adjust() error {
+	if cfg.Parallelism == 0 {
+		cfg.Parallelism = defaultFleetParallelism
+	}
+	if len(cfg.Clusters) == 0 {
+		return errors.Annotate(berrors.ErrInvalidArgument, "no cluster")
+	}
+	names := make(map[string]struct{}, len(cfg.Clusters))
+	for i, c := range cfg.Clusters {
+		switch {
+		case c.Name == "":
+			return errors.Annotatef(berrors.ErrInvalidArgument, "cluster #%d has no name", i)
+		case len(c.PD) == 0:
+			return errors.Annotatef(berrors.ErrInvalidArgument, "cluster %s has no pd", c.Name)
+		case c.Storage == "":
+			return errors.Annotatef(berrors.ErrInvalidArgument, "cluster %s has no storage", c.Name)
+		}
+		if _, ok := names[c.Name]; ok {
+			return errors.Annotatef(berrors.ErrInvalidArgument, "duplicated cluster %s", c.Name)
+		}
+		names[c.Name] = struct{}{}
+	}
+	return nil
+}
+
+// FleetResult is the result of backing up a cluster of the fleet.
+type FleetResult struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// RunFleetBackup backs up the clusters by backupCluster, at most
+// cfg.Parallelism of them concurrently. A failed cluster doesn't stop the
+// others, the results are sorted by the cluster names.
+func RunFleetBackup(
+	ctx context.Context,
+	cfg *FleetConfig,
+	backupCluster func(ctx context.Context, c FleetCluster) error,
+) []FleetResult {
+	results := make([]FleetResult, len(cfg.Clusters))
+	pool := utils.NewWorkerPool(cfg.Parallelism, "fleet backup")
+	wg := sync.WaitGroup{}
+	for i := range cfg.Clusters {
+		i, c := i, cfg.Clusters[i]
+		wg.Add(1)
+		pool.Apply(func() {
+			defer wg.Done()
+			start := time.Now()
+			log.Info("backing up cluster", zap.String("cluster", c.Name))
+			err := ctx.Err()
+			if err == nil {
+				err = backupCluster(ctx, c)
+			}
+			results[i] = FleetResult{Name: c.Name, Duration: time.Since(start), Err: err}
+			if err != nil {
+				log.Error("failed to back up cluster", zap.String("cluster", c.Name), zap.Error(err))
+				return
+			}
+			log.Info("cluster backed up", zap.String("cluster", c.Name),
+				zap.Duration("take", results[i].Duration))
+		})
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// FleetReport formats the results as a report, it returns an error if any
+// cluster failed.
+func FleetReport(results []FleetResult) (string, error) {
+	var b strings.Builder
+	failed := make([]string, 0)
+	for _, r := range results {
+		status := "succeeded"
+		if r.Err != nil {
+			status = "failed: " + r.Err.Error()
+			failed = append(failed, r.Name)
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", r.Name, r.Duration.Round(time.Second), status)
+	}
+	fmt.Fprintf(&b, "%d clusters, %d succeeded, %d failed\n",
+		len(results), len(results)-len(failed), len(failed))
+	if len(failed) > 0 {
+		return b.String(), errors.Annotatef(berrors.ErrBackupFleetFailed,
+			"failed to back up %s", strings.Join(failed, ", "))
+	}
+	return b.String(), nil
+}
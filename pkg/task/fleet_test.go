@@ -0,0 +1,78 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type testFleetSuite struct{}
+
+var _ = Suite(&testFleetSuite{})
+
+func (s *testFleetSuite) TestLoadFleetConfig(c *C) {
+	path := filepath.Join(c.MkDir(), "fleet.toml")
+	c.Assert(ioutil.WriteFile(path, []byte(`
+[[cluster]]
+name = "a"
+pd = ["127.0.0.1:2379"]
+storage = "local:///tmp/a"
+args = ["--ratelimit", "128"]
+`), 0644), IsNil)
+	cfg, err := LoadFleetConfig(path)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Parallelism, Equals, uint(defaultFleetParallelism))
+	c.Assert(cfg.Clusters, HasLen, 1)
+	c.Assert(cfg.Clusters[0].Args, DeepEquals, []string{"--ratelimit", "128"})
+
+	c.Assert(ioutil.WriteFile(path, []byte(`
+[[cluster]]
+name = "a"
+pd = ["127.0.0.1:2379"]
+storage = "local:///tmp/a"
+[[cluster]]
+name = "a"
+pd = ["127.0.0.1:2379"]
+storage = "local:///tmp/b"
+`), 0644), IsNil)
+	_, err = LoadFleetConfig(path)
+	c.Assert(err, ErrorMatches, ".*duplicated cluster a.*")
+}
+
+func (s *testFleetSuite) TestRunFleetBackup(c *C) {
+	cfg := &FleetConfig{Parallelism: 2}
+	for _, name := range []string{"d", "c", "b", "a"} {
+		cfg.Clusters = append(cfg.Clusters, FleetCluster{Name: name})
+	}
+	var running, maxRunning int32
+	results := RunFleetBackup(context.Background(), cfg, func(ctx context.Context, fc FleetCluster) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if fc.Name == "c" {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	c.Assert(atomic.LoadInt32(&maxRunning) <= 2, IsTrue)
+	c.Assert(results, HasLen, 4)
+	c.Assert(results[0].Name, Equals, "a")
+	c.Assert(results[2].Err, ErrorMatches, "connection refused")
+
+	report, err := FleetReport(results)
+	c.Assert(err, ErrorMatches, ".*failed to back up c.*")
+	c.Assert(report, Matches, "(?s).*4 clusters, 3 succeeded, 1 failed.*")
+}
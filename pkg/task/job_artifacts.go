@@ -0,0 +1,127 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// logUploadChunkSize is the size of the parts of the uploaded log file, S3
+// requires the parts except the last one to be at least 5 MiB.
+const logUploadChunkSize = 5 * 1024 * 1024
+
+// JobResult is the result of a backup uploaded with the backupmeta, so the
+// context of the backup is kept with it.
+type JobResult struct {
+	Command      string    `json:"command"`
+	Version      string    `json:"version"`
+	GitHash      string    `json:"git-hash"`
+	StartTime    time.Time `json:"start-time"`
+	EndTime      time.Time `json:"end-time"`
+	BackupTS     uint64    `json:"backup-ts"`
+	LastBackupTS uint64    `json:"last-backup-ts"`
+	FileCount    int       `json:"file-count"`
+	Size         uint64    `json:"size"`
+	// LogFile is the path of the log on the host running the backup.
+	LogFile string `json:"log-file"`
+}
+
+func newJobResult(
+	cmdName, logFile string, startTime time.Time, meta *kvproto.BackupMeta, fileCount int, size uint64,
+) *JobResult {
+	return &JobResult{
+		Command:      cmdName,
+		Version:      utils.BRReleaseVersion,
+		GitHash:      utils.BRGitHash,
+		StartTime:    startTime,
+		EndTime:      time.Now(),
+		BackupTS:     meta.EndVersion,
+		LastBackupTS: meta.StartVersion,
+		FileCount:    fileCount,
+		Size:         size,
+		LogFile:      logFile,
+	}
+}
+
+// uploadJobArtifacts writes the result and the log file of the job into the
+// storage. The backupmeta is saved already, a failed upload mustn't fail the
+// complete backup.
+func uploadJobArtifacts(ctx context.Context, s storage.ExternalStorage, result *JobResult) {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err == nil {
+		err = s.Write(ctx, utils.JobResultFile, data)
+	}
+	if err != nil {
+		log.Warn("failed to upload the job result", zap.Error(err))
+	}
+
+	if result.LogFile == "" {
+		log.Warn("no log file to upload, the log is written to the terminal")
+		return
+	}
+	if err = uploadLogFile(ctx, s, result.LogFile); err != nil {
+		log.Warn("failed to upload the log file", zap.String("path", result.LogFile), zap.Error(err))
+		return
+	}
+	log.Info("job result and log uploaded", zap.String("log", result.LogFile))
+}
+
+// uploadLogFile uploads the log written so far, the summary logged on exit
+// isn't included, but it's in the job result. The log may be large, so it's
+// uploaded in chunks rather than read into the memory.
+func uploadLogFile(ctx context.Context, s storage.ExternalStorage, path string) error {
+	_ = log.L().Sync()
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	uploader, err := s.CreateUploader(ctx, utils.JobLogFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	w := storage.NewUploaderWriter(uploader, logUploadChunkSize, storage.NoCompression)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(ctx, buf[:n]); werr != nil {
+				return errors.Trace(werr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(w.Close(ctx))
+}
+
+// SaveSummary writes the JSON summary of the task into the storage. It's saved
+// after the task exits and has printed the summary to stdout already, so the
+// failure is logged rather than changing the result of the task.
+func SaveSummary(ctx context.Context, cfg *Config, data []byte) {
+	_, s, err := GetStorage(ctx, cfg)
+	if err == nil {
+		err = s.Write(ctx, utils.SummaryFile, data)
+	}
+	if err != nil {
+		log.Warn("failed to save the summary", zap.Error(err))
+		return
+	}
+	log.Info("summary saved", zap.String("file", utils.SummaryFile))
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+type testJobArtifactsSuite struct{}
+
+var _ = Suite(&testJobArtifactsSuite{})
+
+func (s *testJobArtifactsSuite) TestUploadJobArtifacts(c *C) {
+	ctx := context.Background()
+	dir := c.MkDir()
+	logFile := filepath.Join(c.MkDir(), "br.log")
+	c.Assert(ioutil.WriteFile(logFile, []byte("backup started\n"), 0644), IsNil)
+	store, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+
+	uploadJobArtifacts(ctx, store, &JobResult{Command: "Full backup", BackupTS: 42, LogFile: logFile})
+	data, err := ioutil.ReadFile(filepath.Join(dir, utils.JobResultFile))
+	c.Assert(err, IsNil)
+	result := &JobResult{}
+	c.Assert(json.Unmarshal(data, result), IsNil)
+	c.Assert(result.Command, Equals, "Full backup")
+	c.Assert(result.BackupTS, Equals, uint64(42))
+	data, err = ioutil.ReadFile(filepath.Join(dir, utils.JobLogFile))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "backup started\n")
+}
+
+func (s *testJobArtifactsSuite) TestUploadLargeLogFile(c *C) {
+	ctx := context.Background()
+	dir := c.MkDir()
+	logFile := filepath.Join(c.MkDir(), "br.log")
+	// The log is uploaded in several parts.
+	log := bytes.Repeat([]byte("backup is running\n"), logUploadChunkSize/8)
+	c.Assert(ioutil.WriteFile(logFile, log, 0644), IsNil)
+	store, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+
+	c.Assert(uploadLogFile(ctx, store, logFile), IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(dir, utils.JobLogFile))
+	c.Assert(err, IsNil)
+	c.Assert(bytes.Equal(data, log), IsTrue)
+}
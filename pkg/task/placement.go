@@ -0,0 +1,113 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"github.com/tikv/pd/server/schedule/placement"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/backup"
+	"github.com/pingcap/br/pkg/conn"
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/metautil"
+	"github.com/pingcap/br/pkg/restore"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const (
+	flagPlacementRules    = "placement-rules"
+	flagPlacementLabelMap = "placement-label-map"
+
+	placementRulesRestore = "restore"
+	placementRulesDrop    = "drop"
+)
+
+// parsePlacementLabelMap parses the label maps in the form of `key:old=new`.
+func parsePlacementLabelMap(maps []string) (restore.PlacementLabelMap, error) {
+	labels := make(restore.PlacementLabelMap)
+	for _, m := range maps {
+		parts := strings.SplitN(m, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"invalid --%s %s, must be in the form of 'key:old=new'", flagPlacementLabelMap, m)
+		}
+		values := strings.SplitN(parts[1], "=", 2)
+		if len(values) != 2 || values[0] == "" || values[1] == "" {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"invalid --%s %s, must be in the form of 'key:old=new'", flagPlacementLabelMap, m)
+		}
+		if labels[parts[0]] == nil {
+			labels[parts[0]] = make(map[string]string)
+		}
+		labels[parts[0]][values[0]] = values[1]
+	}
+	return labels, nil
+}
+
+// tablePlacementRules returns the placement rules of the backed up tables,
+// which are recorded in the backupmeta, so they can be re-created on restore.
+// The backup doesn't rely on them, so it only warns if they can't be got.
+func tablePlacementRules(mgr *conn.Mgr, pdAddrs []string, backupMeta *kvproto.BackupMeta) json.RawMessage {
+	data, err := func() ([]byte, error) {
+		var rules []placement.Rule
+		var err error
+		for _, addr := range pdAddrs {
+			if rules, err = utils.GetPlacementRules(addr, mgr.GetTLSConfig()); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		dbs, err := utils.LoadBackupTables(backupMeta)
+		if err != nil {
+			return nil, err
+		}
+		tables := make([]*utils.Table, 0)
+		for _, db := range dbs {
+			tables = append(tables, db.Tables...)
+		}
+		rules = backup.TablePlacementRules(rules, tables)
+		if len(rules) == 0 {
+			return nil, nil
+		}
+		log.Info("record placement rules", zap.Int("rules", len(rules)))
+		data, err := json.Marshal(rules)
+		return data, errors.Trace(err)
+	}()
+	if err != nil {
+		log.Warn("failed to get the placement rules of the tables", zap.Error(err))
+		return nil
+	}
+	return data
+}
+
+// setPlacementRules sets the placement rules recorded in the backupmeta to
+// the client, which re-creates them for the restored tables before their
+// regions are split.
+func setPlacementRules(client *restore.Client, cfg *RestoreConfig, reader *metautil.MetaReader) error {
+	data := reader.Extension().PlacementRules
+	if len(data) == 0 {
+		return nil
+	}
+	if cfg.PlacementRules == placementRulesDrop {
+		log.Info("drop the placement rules in the backup")
+		return nil
+	}
+	var rules []placement.Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return errors.Annotatef(berrors.ErrRestoreInvalidBackup, "invalid placement rules: %v", err)
+	}
+	labels, err := parsePlacementLabelMap(cfg.PlacementLabelMap)
+	if err != nil {
+		return err
+	}
+	client.SetTablePlacementRules(rules, labels)
+	return nil
+}
@@ -0,0 +1,27 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/br/pkg/restore"
+)
+
+type testPlacementSuite struct{}
+
+var _ = Suite(&testPlacementSuite{})
+
+func (s *testPlacementSuite) TestParsePlacementLabelMap(c *C) {
+	labels, err := parsePlacementLabelMap([]string{"zone:sh=hz", "zone:bj=sz", "rack:r1=r2"})
+	c.Assert(err, IsNil)
+	c.Assert(labels, DeepEquals, restore.PlacementLabelMap{
+		"zone": {"sh": "hz", "bj": "sz"},
+		"rack": {"r1": "r2"},
+	})
+
+	for _, m := range []string{"zone", "zone:sh", ":sh=hz", "zone:=hz", "zone:sh="} {
+		_, err = parsePlacementLabelMap([]string{m})
+		c.Assert(err, ErrorMatches, ".*invalid.*", Commentf("%s", m))
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/metautil"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const (
+	flagMaxAge = "max-age"
+)
+
+// ProbeConfig is the configuration specific for probe tasks.
+type ProbeConfig struct {
+	Config
+
+	MaxAge time.Duration `json:"max-age" toml:"max-age"`
+}
+
+// DefineProbeFlags defines the flags for the probe command.
+func DefineProbeFlags(command *cobra.Command) {
+	command.Flags().Duration(flagMaxAge, 0,
+		"fail if the newest complete backup is older than it, 0 means no limit")
+}
+
+// ParseFromFlags parses the probe-related flags from the flag set.
+func (cfg *ProbeConfig) ParseFromFlags(flags *pflag.FlagSet) error {
+	var err error
+	cfg.MaxAge, err = flags.GetDuration(flagMaxAge)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.MaxAge < 0 {
+		return errors.Annotatef(berrors.ErrInvalidArgument, "negative --%s", flagMaxAge)
+	}
+	return cfg.Config.ParseFromFlags(flags)
+}
+
+// ProbeResult is the newest complete backup found by a probe.
+type ProbeResult struct {
+	// Path is the directory of the backup relative to the storage.
+	Path      string
+	BackupTS  uint64
+	Age       time.Duration
+	FileCount int
+}
+
+// RunProbe finds the newest complete backup in the storage, i.e. the one
+// having the largest backup ts among the ones having backupmeta, and checks
+// it's not older than the max age and its files are all in the storage.
+func RunProbe(ctx context.Context, cfg *ProbeConfig) (*ProbeResult, error) {
+	u, s, err := GetStorage(ctx, &cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]int64)
+	metas := make([]string, 0)
+	err = s.WalkDir(ctx, &storage.WalkOption{}, func(p string, size int64) error {
+		p = path.Clean(p)
+		stored[p] = size
+		if path.Base(p) == utils.MetaFile {
+			metas = append(metas, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(metas) == 0 {
+		return nil, errors.Annotatef(berrors.ErrBackupStale, "no complete backup found in %s", cfg.Storage)
+	}
+
+	var newest *metautil.MetaReader
+	var newestPath string
+	for _, p := range metas {
+		r, err := metautil.NewMetaReader(ctx, s, p, nil)
+		if err != nil {
+			log.Warn("skip invalid backupmeta", zap.String("path", p), zap.Error(err))
+			continue
+		}
+		if newest == nil || r.Meta().EndVersion > newest.Meta().EndVersion {
+			newest, newestPath = r, p
+		}
+	}
+	if newest == nil {
+		return nil, errors.Annotatef(berrors.ErrBackupStale, "no valid backupmeta found in %s", cfg.Storage)
+	}
+
+	dir := path.Dir(newestPath)
+	// The shards of a version 2 backupmeta are checked with the files in them.
+	files := make([]*backup.File, 0)
+	err = newest.WalkFiles(ctx, func(f *backup.File) error {
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	backupTS := newest.Meta().EndVersion
+	result := &ProbeResult{
+		Path:      dir,
+		BackupTS:  backupTS,
+		Age:       time.Since(oracle.GetTimeFromTS(backupTS)),
+		FileCount: len(files),
+	}
+	log.Info("newest backup found", zap.String("path", dir), zap.Uint64("BackupTS", result.BackupTS),
+		zap.Duration("age", result.Age), zap.Int("files", result.FileCount))
+	if cfg.MaxAge > 0 && result.Age > cfg.MaxAge {
+		return result, errors.Annotatef(berrors.ErrBackupStale,
+			"the newest backup %s is %s old, older than %s", dir, result.Age.Round(time.Second), cfg.MaxAge)
+	}
+
+	// The files of a local storage are spread over the TiKV nodes.
+	if u.GetLocal() != nil {
+		return result, nil
+	}
+	for _, f := range files {
+		name := path.Join(dir, f.Name)
+		size, ok := stored[name]
+		if !ok {
+			return result, errors.Annotatef(berrors.ErrBackupFilesIncomplete,
+				"file %s of the newest backup %s is missing", f.Name, dir)
+		}
+		if f.Size_ != 0 && uint64(size) != f.Size_ {
+			return result, errors.Annotatef(berrors.ErrBackupFilesIncomplete,
+				"file %s of the newest backup %s is %d bytes, but %d bytes in backupmeta", f.Name, dir, size, f.Size_)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+
+	"github.com/pingcap/br/pkg/utils"
+)
+
+type testProbeSuite struct{}
+
+var _ = Suite(&testProbeSuite{})
+
+func writeBackupMeta(c *C, dir string, backupTime time.Time) {
+	c.Assert(os.MkdirAll(dir, 0755), IsNil)
+	meta := &backup.BackupMeta{EndVersion: oracle.ComposeTS(oracle.GetPhysical(backupTime), 0)}
+	data, err := proto.Marshal(meta)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, utils.MetaFile), data, 0644), IsNil)
+}
+
+func (s *testProbeSuite) TestRunProbe(c *C) {
+	ctx := context.Background()
+	root := c.MkDir()
+	cfg := &ProbeConfig{Config: Config{Storage: "local://" + root}}
+
+	_, err := RunProbe(ctx, cfg)
+	c.Assert(err, ErrorMatches, ".*no complete backup found.*")
+
+	writeBackupMeta(c, filepath.Join(root, "old"), time.Now().Add(-48*time.Hour))
+	writeBackupMeta(c, filepath.Join(root, "new"), time.Now().Add(-time.Hour))
+	// A stopped backup has no backupmeta.
+	c.Assert(os.MkdirAll(filepath.Join(root, "stopped"), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(root, "stopped", utils.LockFile), nil, 0644), IsNil)
+
+	cfg.MaxAge = 26 * time.Hour
+	result, err := RunProbe(ctx, cfg)
+	c.Assert(err, IsNil)
+	c.Assert(result.Path, Equals, "new")
+
+	cfg.MaxAge = 30 * time.Minute
+	_, err = RunProbe(ctx, cfg)
+	c.Assert(err, ErrorMatches, ".*the newest backup new is .* old.*")
+}
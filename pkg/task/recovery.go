@@ -0,0 +1,171 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/summary"
+)
+
+// The phases of tasks, they are recorded in summary so that we can tell
+// the user what to do next once the task failed.
+const (
+	phasePrepare      = "prepare"
+	phaseBackupRanges = "backup ranges"
+	phaseChecksum     = "checksum"
+	phaseSaveMeta     = "save backup meta"
+	phaseVerifyFiles  = "verify backup files"
+	phaseExecDDLs     = "execute ddl jobs"
+	phaseStageFiles   = "stage backup files"
+	phaseRestore      = "restore tables"
+	phaseRestoreFiles = "restore files"
+)
+
+// RecoveryOptions tells the recovery guide how the failed task can be rerun.
+type RecoveryOptions struct {
+	// Args are the command line of the task, they are rerun with the secrets
+	// redacted. The command is rerun without the flags if it's empty.
+	Args []string
+	// Resume is whether the backup can continue from its checkpoint by --resume.
+	Resume bool
+	// Checkpoint is whether the restore can skip the restored tables by
+	// --checkpoint-storage, CheckpointStorage is the one the task used.
+	Checkpoint        bool
+	CheckpointStorage string
+}
+
+// RecoveryGuide returns the next steps for a failed task, derived from the
+// phase it failed at and the class of the error. command is the command the
+// user ran, e.g. `br backup full`.
+func RecoveryGuide(command string, err error, opts RecoveryOptions) string {
+	if err == nil {
+		return ""
+	}
+	phase := summary.Phase()
+	if phase == "" {
+		phase = phasePrepare
+	}
+	steps := make([]string, 0, 2)
+	if hint := errorHint(err); hint != "" {
+		steps = append(steps, hint)
+	}
+	steps = append(steps, phaseHint(phase, rerunCommand(command, opts.Args), opts))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s failed at phase \"%s\": %s\n", command, phase, errors.Cause(err))
+	b.WriteString("Next steps:\n")
+	for _, step := range steps {
+		fmt.Fprintf(&b, "  - %s\n", step)
+	}
+	return b.String()
+}
+
+func errorHint(err error) string {
+	cause := errors.Cause(err)
+	switch {
+	case cause == context.Canceled:
+		return "the task was canceled."
+	case berrors.ErrBackupGCSafepointExceeded.Equal(cause):
+		return "the requested snapshot has been GCed, choose a newer --backupts or a smaller --timeago, " +
+			"or raise tikv_gc_life_time before the next backup."
+	case berrors.ErrBackupWindowExceeded.Equal(cause):
+		return "the backup didn't finish in --window, its GC safe point is kept until the next window, " +
+			"run it with --resume in the next window."
+	case berrors.ErrBackupChecksumMismatch.Equal(cause):
+		return "the backup files don't match the data in the cluster, the backup must not be used, " +
+			"please check the TiKV logs and report it if the cluster is healthy."
+	case berrors.ErrRestoreChecksumMismatch.Equal(cause):
+		return "the restored data don't match the backup, drop the mismatched tables before restoring again."
+	case berrors.ErrRestoreSameCluster.Equal(cause):
+		return "the target is the cluster the backup was taken from, add --allow-same-cluster if it's intended."
+	case berrors.ErrStorageInvalidConfig.Equal(cause), berrors.ErrStorageUnknown.Equal(cause):
+		return "check the --storage URL, the credentials and the permissions of the external storage."
+	case berrors.ErrKVNotHealth.Equal(cause), berrors.ErrKVUnknown.Equal(cause),
+		berrors.ErrPDLeaderNotFound.Equal(cause):
+		return "check the health of the TiKV and PD nodes, e.g. with `pd-ctl store`."
+	case berrors.ErrVersionMismatch.Equal(cause):
+		return "check the versions of BR and the cluster, or skip the check with --check-requirements=false."
+	}
+	return ""
+}
+
+// rerunCommand returns the command line to rerun the task, the secrets in the
+// args are redacted and the args holding spaces are quoted.
+func rerunCommand(command string, args []string) string {
+	if len(args) == 0 {
+		return command
+	}
+	args = redactArgs(args)
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t'\"$&|;<>*?()`\\") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// withFlag appends the flag to the command unless it's there.
+func withFlag(command, flag string) string {
+	for _, arg := range strings.Fields(command) {
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			return command
+		}
+	}
+	return command + " " + flag
+}
+
+func phaseHint(phase, command string, opts RecoveryOptions) string {
+	switch phase {
+	case phaseBackupRanges, phaseChecksum, phaseSaveMeta:
+		return backupHint(phase, command, opts)
+	case phaseExecDDLs, phaseRestore, phaseRestoreFiles:
+		return restoreHint(command, opts)
+	}
+	return commonHint(phase, command)
+}
+
+func backupHint(phase, command string, opts RecoveryOptions) string {
+	switch {
+	case !opts.Resume:
+		return fmt.Sprintf("the backup can't be resumed, rerun `%s` to back up again.", command)
+	case phaseBackupRanges == phase:
+		return fmt.Sprintf("the progress is saved in the storage, rerun `%s` to continue.",
+			withFlag(command, "--"+flagResume))
+	}
+	return fmt.Sprintf("all ranges are backed up, rerun `%s` to finish the backup.",
+		withFlag(command, "--"+flagResume))
+}
+
+func restoreHint(command string, opts RecoveryOptions) string {
+	switch {
+	case opts.CheckpointStorage != "":
+		return fmt.Sprintf("the progress is saved in --%s, rerun `%s` to skip the restored tables and files.",
+			flagCheckpointStore, withFlag(command, "--"+flagResume))
+	case opts.Checkpoint:
+		return fmt.Sprintf("the target may contain partially restored data, restoring is idempotent, "+
+			"rerun `%s --%s <storage>` so the restore can be continued by --%s if it fails again.",
+			command, flagCheckpointStore, flagResume)
+	}
+	return fmt.Sprintf("the target may contain partially restored data, restoring is idempotent, "+
+		"rerun `%s`.", command)
+}
+
+func commonHint(phase, command string) string {
+	switch phase {
+	case phaseVerifyFiles:
+		return fmt.Sprintf("the files in the storage don't match the backupmeta, the backup must not be used, "+
+			"check whether the files are changed by others and rerun `%s` into an empty storage.", command)
+	case phaseStageFiles:
+		return fmt.Sprintf("the files staged are kept in --%s and skipped by the next run, rerun `%s`.",
+			flagStagingStorage, command)
+	}
+	return fmt.Sprintf("nothing has been written yet, fix the problem and rerun `%s`.", command)
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/summary"
+)
+
+var _ = Suite(&testRecoverySuite{})
+
+type testRecoverySuite struct{}
+
+func (s *testRecoverySuite) TearDownTest(c *C) {
+	summary.SetPhase("")
+}
+
+func (s *testRecoverySuite) TestRecoveryGuide(c *C) {
+	backupOpts := RecoveryOptions{Resume: true}
+	c.Assert(RecoveryGuide("br backup full", nil, backupOpts), Equals, "")
+
+	summary.SetPhase("")
+	guide := RecoveryGuide("br backup full", errors.Annotate(berrors.ErrBackupGCSafepointExceeded, "invalid backup ts"),
+		backupOpts)
+	c.Assert(strings.Contains(guide, `failed at phase "prepare"`), IsTrue, Commentf("%s", guide))
+	c.Assert(strings.Contains(guide, "--backupts"), IsTrue, Commentf("%s", guide))
+	c.Assert(strings.Contains(guide, "nothing has been written yet"), IsTrue, Commentf("%s", guide))
+
+	summary.SetPhase(phaseBackupRanges)
+	guide = RecoveryGuide("br backup full", errors.Trace(context.Canceled), backupOpts)
+	c.Assert(strings.Contains(guide, "canceled"), IsTrue, Commentf("%s", guide))
+	c.Assert(strings.Contains(guide, "rerun `br backup full --resume`"), IsTrue, Commentf("%s", guide))
+
+	summary.SetPhase(phaseRestore)
+	guide = RecoveryGuide("br restore full", errors.New("unknown"), RecoveryOptions{})
+	c.Assert(strings.Count(guide, "  - "), Equals, 1, Commentf("%s", guide))
+	c.Assert(strings.Contains(guide, "rerun `br restore full`"), IsTrue, Commentf("%s", guide))
+}
+
+func (s *testRecoverySuite) TestRecoveryGuideRerun(c *C) {
+	defer summary.SetPhase("")
+	args := []string{"br", "backup", "full", "-s", "s3://bucket/prefix?secret-access-key=abc", "--log-file", "/tmp/my br.log"}
+
+	// The flags of the user are kept with the secrets redacted.
+	summary.SetPhase(phaseBackupRanges)
+	guide := RecoveryGuide("br backup full", errors.New("unknown"), RecoveryOptions{Args: args, Resume: true})
+	c.Assert(strings.Contains(guide, "rerun `br backup full -s 's3://bucket/prefix?secret-access-key=******' "+
+		"--log-file '/tmp/my br.log' --resume` to continue"), IsTrue, Commentf("%s", guide))
+	c.Assert(strings.Contains(guide, "abc"), IsFalse, Commentf("%s", guide))
+
+	// --resume isn't added twice.
+	resumed := append(append([]string{}, args...), "--resume")
+	guide = RecoveryGuide("br backup full", errors.New("unknown"), RecoveryOptions{Args: resumed, Resume: true})
+	c.Assert(strings.Count(guide, "--resume"), Equals, 1, Commentf("%s", guide))
+
+	// The raw backup can't be resumed.
+	summary.SetPhase(phaseSaveMeta)
+	guide = RecoveryGuide("br backup raw", errors.New("unknown"), RecoveryOptions{})
+	c.Assert(strings.Contains(guide, "--resume"), IsFalse, Commentf("%s", guide))
+	c.Assert(strings.Contains(guide, "can't be resumed"), IsTrue, Commentf("%s", guide))
+
+	summary.SetPhase(phaseRestoreFiles)
+	guide = RecoveryGuide("br restore full", errors.New("unknown"), RecoveryOptions{Checkpoint: true})
+	c.Assert(strings.Contains(guide, "rerun `br restore full --checkpoint-storage <storage>`"), IsTrue,
+		Commentf("%s", guide))
+	guide = RecoveryGuide("br restore full", errors.New("unknown"), RecoveryOptions{
+		Args:              []string{"br", "restore", "full", "--checkpoint-storage", "local:///cp"},
+		Checkpoint:        true,
+		CheckpointStorage: "local:///cp",
+	})
+	c.Assert(strings.Contains(guide, "rerun `br restore full --checkpoint-storage local:///cp --resume`"), IsTrue,
+		Commentf("%s", guide))
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.etcd.io/etcd/clientv3"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/glue"
+)
+
+const (
+	// taskRegistryPrefix is the prefix of the keys in the etcd of PD, each
+	// running task against the cluster owns one.
+	taskRegistryPrefix = "/tidb/br/tasks/"
+	// taskRegistryTTL is the TTL (in seconds) of the key of a task, so the
+	// key of a killed task expires soon.
+	taskRegistryTTL = 30
+
+	registryDialTimeout = 5 * time.Second
+)
+
+// registeredTask is the value of the key of a running task.
+type registeredTask struct {
+	Name      string    `json:"name"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	StartTime time.Time `json:"start-time"`
+}
+
+// newEtcdClient connects to the etcd of PD.
+func newEtcdClient(ctx context.Context, pds []string, tlsConf *tls.Config) (*clientv3.Client, error) {
+	scheme := "http://"
+	if tlsConf != nil {
+		scheme = "https://"
+	}
+	endpoints := make([]string, 0, len(pds))
+	for _, pd := range pds {
+		endpoints = append(endpoints, scheme+pd)
+	}
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		TLS:         tlsConf,
+		DialTimeout: registryDialTimeout,
+		Context:     ctx,
+	})
+	return cli, errors.Trace(err)
+}
+
+// registerTask registers the task in the etcd of PD, it fails if another
+// task is running against the cluster unless force is set, because the
+// tasks interact badly through the schedulers and GC safe points. The check
+// and the registration are in one transaction, so the tasks started at once
+// can't both pass. The tasks of BRIE aren't registered, TiDB runs one at a
+// time. The returned function unregisters the task.
+func registerTask(
+	ctx context.Context,
+	g glue.Glue,
+	pds []string,
+	tlsConf *tls.Config,
+	name string,
+	force bool,
+) (func(), error) {
+	if !g.OwnsStorage() {
+		return func() {}, nil
+	}
+	cli, err := newEtcdClient(ctx, pds, tlsConf)
+	if err != nil {
+		return nil, err
+	}
+	lease, err := cli.Grant(ctx, taskRegistryTTL)
+	if err != nil {
+		cli.Close()
+		return nil, errors.Trace(err)
+	}
+	key, err := putTask(ctx, cli, lease.ID, name, force)
+	if err != nil {
+		revokeTask(cli, lease.ID, "")
+		cli.Close()
+		return nil, err
+	}
+	keepaliveCtx, cancel := context.WithCancel(ctx)
+	// The channel must be drained, or the client warns about it.
+	ch, err := cli.KeepAlive(keepaliveCtx, lease.ID)
+	if err != nil {
+		cancel()
+		revokeTask(cli, lease.ID, key)
+		cli.Close()
+		return nil, errors.Trace(err)
+	}
+	go func() {
+		for range ch {
+		}
+	}()
+	log.Info("task registered", zap.String("key", key))
+
+	return func() {
+		cancel()
+		revokeTask(cli, lease.ID, key)
+		cli.Close()
+	}, nil
+}
+
+// putTask puts the key of the task with the lease, unless force is not set
+// and there is any other task registered. It returns the key of the task.
+func putTask(ctx context.Context, cli *clientv3.Client, lease clientv3.LeaseID, name string, force bool) (string, error) {
+	host, _ := os.Hostname()
+	self := registeredTask{Name: name, Host: host, PID: os.Getpid(), StartTime: time.Now()}
+	value, err := json.Marshal(self)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	key := fmt.Sprintf("%s%s-%d-%d", taskRegistryPrefix, host, self.PID, self.StartTime.UnixNano())
+	txn := cli.Txn(ctx)
+	if !force {
+		// No key of the prefix has been created.
+		txn = txn.If(clientv3.Compare(clientv3.CreateRevision(taskRegistryPrefix), "=", 0).WithPrefix())
+	}
+	getTasks := clientv3.OpGet(taskRegistryPrefix, clientv3.WithPrefix())
+	resp, err := txn.
+		Then(clientv3.OpPut(key, string(value), clientv3.WithLease(lease)), getTasks).
+		Else(getTasks).
+		Commit()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	for _, r := range resp.Responses {
+		getResp := r.GetResponseRange()
+		if getResp == nil {
+			continue
+		}
+		for _, kv := range getResp.Kvs {
+			if string(kv.Key) == key {
+				continue
+			}
+			task := registeredTask{}
+			if err := json.Unmarshal(kv.Value, &task); err != nil {
+				log.Warn("invalid task in registry", zap.ByteString("key", kv.Key), zap.Error(err))
+				task.Name = string(kv.Key)
+			}
+			if !resp.Succeeded {
+				return "", errors.Annotatef(berrors.ErrTaskConflict,
+					"%s on %s (pid %d) started at %s, use --%s to run anyway",
+					task.Name, task.Host, task.PID, task.StartTime.Format(time.RFC3339), flagForceConcurrent)
+			}
+			log.Warn("run concurrently with another task", zap.String("task", task.Name),
+				zap.String("host", task.Host), zap.Int("pid", task.PID))
+		}
+	}
+	return key, nil
+}
+
+// revokeTask revokes the lease of the task, so its key is deleted.
+func revokeTask(cli *clientv3.Client, lease clientv3.LeaseID, key string) {
+	revokeCtx, revokeCancel := context.WithTimeout(context.Background(), registryDialTimeout)
+	defer revokeCancel()
+	if _, err := cli.Revoke(revokeCtx, lease); err != nil {
+		log.Warn("failed to unregister task, it expires soon", zap.String("key", key), zap.Error(err))
+	}
+}
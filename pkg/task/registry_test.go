@@ -0,0 +1,87 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"go.etcd.io/etcd/embed"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/glue"
+	"github.com/pingcap/br/pkg/gluetikv"
+)
+
+type testRegistrySuite struct {
+	etcd *embed.Etcd
+	pds  []string
+}
+
+var _ = Suite(&testRegistrySuite{})
+
+// brieGlue is the glue of BRIE, which doesn't own the storage.
+type brieGlue struct {
+	glue.Glue
+}
+
+func (brieGlue) OwnsStorage() bool {
+	return false
+}
+
+func freeURL(c *C) *url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+	u, err := url.Parse(fmt.Sprintf("http://%s", l.Addr()))
+	c.Assert(err, IsNil)
+	return u
+}
+
+func (s *testRegistrySuite) SetUpTest(c *C) {
+	cfg := embed.NewConfig()
+	cfg.Dir = c.MkDir()
+	clientURL, peerURL := freeURL(c), freeURL(c)
+	cfg.LCUrls, cfg.ACUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	cfg.LogOutputs = []string{"stderr"}
+	var err error
+	s.etcd, err = embed.StartEtcd(cfg)
+	c.Assert(err, IsNil)
+	<-s.etcd.Server.ReadyNotify()
+	s.pds = []string{clientURL.Host}
+}
+
+func (s *testRegistrySuite) TearDownTest(c *C) {
+	s.etcd.Close()
+}
+
+func (s *testRegistrySuite) TestRegisterTask(c *C) {
+	ctx := context.Background()
+	unregister1, err := registerTask(ctx, gluetikv.Glue{}, s.pds, nil, "backup", false)
+	c.Assert(err, IsNil)
+
+	_, err = registerTask(ctx, gluetikv.Glue{}, s.pds, nil, "restore", false)
+	c.Assert(berrors.ErrTaskConflict.Equal(errors.Cause(err)), IsTrue)
+	c.Assert(err, ErrorMatches, ".*backup on .* use --force-concurrent to run anyway.*")
+
+	unregister2, err := registerTask(ctx, gluetikv.Glue{}, s.pds, nil, "restore", true)
+	c.Assert(err, IsNil)
+	// The tasks of BRIE aren't registered.
+	unregister3, err := registerTask(ctx, brieGlue{}, s.pds, nil, "restore", false)
+	c.Assert(err, IsNil)
+	unregister3()
+
+	unregister1()
+	_, err = registerTask(ctx, gluetikv.Glue{}, s.pds, nil, "restore", false)
+	c.Assert(err, NotNil)
+	unregister2()
+	unregister4, err := registerTask(ctx, gluetikv.Glue{}, s.pds, nil, "restore", false)
+	c.Assert(err, IsNil)
+	unregister4()
+}
@@ -4,20 +4,27 @@ package task
 
 import (
 	"context"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/failpoint"
 	"github.com/pingcap/kvproto/pkg/backup"
 	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb/config"
+	"github.com/pingcap/tidb/util/collate"
 	"github.com/spf13/pflag"
+	pd "github.com/tikv/pd/client"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 
 	"github.com/pingcap/br/pkg/conn"
 	berrors "github.com/pingcap/br/pkg/errors"
 	"github.com/pingcap/br/pkg/glue"
+	"github.com/pingcap/br/pkg/metautil"
 	"github.com/pingcap/br/pkg/restore"
 	"github.com/pingcap/br/pkg/storage"
 	"github.com/pingcap/br/pkg/summary"
@@ -25,12 +32,32 @@ import (
 )
 
 const (
-	flagOnline   = "online"
-	flagNoSchema = "no-schema"
+	flagOnline           = "online"
+	flagNoSchema         = "no-schema"
+	flagAllowSameCluster = "allow-same-cluster"
+	flagIngestRateLimit  = "ingest-ratelimit"
+	flagRegionTimeline   = "region-timeline"
+	flagDBPrefix         = "db-prefix"
+	flagDBSuffix         = "db-suffix"
+	flagRename           = "rename"
+	flagIncrementalStore = "incremental-storage"
+	flagWaitTiFlash      = "wait-tiflash-replica"
+	flagReplaceSysTables = "replace-system-tables"
+	flagCreateMissingDB  = "create-missing-db"
+	flagDDLConcurrency   = "ddl-concurrency"
+	flagPipelineDepth    = "pipeline-depth"
+	flagCheckpointStore  = "checkpoint-storage"
+	flagRateLimitAfter   = "ratelimit-after-restore"
 
 	defaultRestoreConcurrency = 128
 	maxRestoreBatchSizeLimit  = 256
 	defaultDDLConcurrency     = 16
+	defaultPipelineDepth      = 2
+
+	ingestRateLimitPath = "/restore/ingest-ratelimit"
+	// resetSpeedLimitTimeout is the longest time to reset the download speed
+	// limit of the stores, it's done even if the restore is canceled.
+	resetSpeedLimitTimeout = 30 * time.Second
 )
 
 // RestoreConfig is the configuration specific for restore tasks.
@@ -39,13 +66,138 @@ type RestoreConfig struct {
 
 	Online   bool `json:"online" toml:"online"`
 	NoSchema bool `json:"no-schema" toml:"no-schema"`
+	// AllowSameCluster allows restoring a backup into the cluster it was taken from.
+	AllowSameCluster bool `json:"allow-same-cluster" toml:"allow-same-cluster"`
+	// IngestRateLimit is the total bytes ingested per second, zero means unlimited.
+	IngestRateLimit uint64 `json:"ingest-rate-limit" toml:"ingest-rate-limit"`
+	// RateLimitAfterRestore is the download speed limit of the stores set
+	// after the restore limited by RateLimit, zero means unlimited.
+	RateLimitAfterRestore uint64 `json:"ratelimit-after-restore" toml:"ratelimit-after-restore"`
+	// RegionTimeline is the file to dump the timeline of restoring every region.
+	RegionTimeline string `json:"region-timeline" toml:"region-timeline"`
+	// SaveReport writes the summary of the restore into the storage.
+	SaveReport bool `json:"save-report" toml:"save-report"`
+	// StagingStorage is the storage the files in the local storage are
+	// copied into, for TiKV to download them from.
+	StagingStorage string `json:"staging-storage" toml:"staging-storage"`
+	// IncludeSystemTables restores the users, privileges and bindings in the backup.
+	IncludeSystemTables bool `json:"include-system-tables" toml:"include-system-tables"`
+	// ReplaceSystemTables replaces the existing rows of the system tables
+	// with the ones in the backup, instead of keeping them.
+	ReplaceSystemTables bool `json:"replace-system-tables" toml:"replace-system-tables"`
+	// SchemaOnly creates the databases and tables without restoring any data.
+	SchemaOnly bool `json:"schema-only" toml:"schema-only"`
+	// DBPrefix and DBSuffix are added to the names of the restored databases.
+	DBPrefix string `json:"db-prefix" toml:"db-prefix"`
+	DBSuffix string `json:"db-suffix" toml:"db-suffix"`
+	// Rename are the rules to rename the restored databases and tables, in
+	// the form of `olddb:newdb` or `olddb.oldtable:newdb.newtable`.
+	Rename []string `json:"rename" toml:"rename"`
+	// IncrementalStorages are the incremental backups restored after the
+	// backup in Storage in order, see RunRestoreChain.
+	IncrementalStorages []string `json:"incremental-storages" toml:"incremental-storages"`
+	// WaitTiFlashReplica is the longest time to wait for the TiFlash
+	// replicas of the restored tables to be available, zero means not waiting.
+	WaitTiFlashReplica time.Duration `json:"wait-tiflash-replica" toml:"wait-tiflash-replica"`
+	// PlacementRules is what to do with the placement rules in the backup,
+	// either restore or drop.
+	PlacementRules string `json:"placement-rules" toml:"placement-rules"`
+	// PlacementLabelMap maps the label values of the placement rules, in the
+	// form of `key:old=new`.
+	PlacementLabelMap []string `json:"placement-label-map" toml:"placement-label-map"`
+	// CheckpointStorage is the storage the checkpoint of the restore is
+	// saved in, empty means the checkpoint is disabled.
+	CheckpointStorage string `json:"checkpoint-storage" toml:"checkpoint-storage"`
+	// Resume skips the files ingested and the tables finished by the
+	// interrupted restore according to the checkpoint.
+	Resume bool `json:"resume" toml:"resume"`
+	// ConflictPolicy is applied to the existing tables containing data.
+	ConflictPolicy ConflictPolicy `json:"conflict-policy" toml:"conflict-policy"`
+	// Force restores into the existing tables containing data.
+	Force bool `json:"force" toml:"force"`
+	// CreateMissingDB creates the databases of the restored tables missing in
+	// the target cluster with the charsets and collations in the backup.
+	CreateMissingDB bool `json:"create-missing-db" toml:"create-missing-db"`
+	// PartitionToTable are the rules to restore a partition of a table as a
+	// standalone table, in the form of `db.table.partition:newdb.newtable`.
+	PartitionToTable []string `json:"partition-to-table" toml:"partition-to-table"`
+	// DDLConcurrency is the number of sessions creating the sequences and the
+	// tables. The sequences are created before the tables, which may use them
+	// as the default values, and the views are created by one session after
+	// the tables and the views they depend on.
+	DDLConcurrency uint `json:"ddl-concurrency" toml:"ddl-concurrency"`
+	// PipelineDepth is the number of the batches downloaded concurrently, and
+	// the number of the batches ingested concurrently.
+	PipelineDepth uint `json:"pipeline-depth" toml:"pipeline-depth"`
+	// StartKey and EndKey restrict the restored data of a table to the keys
+	// in the range, the keys are of the restored table.
+	StartKey []byte `json:"start-key" toml:"start-key"`
+	EndKey   []byte `json:"end-key" toml:"end-key"`
+	// DryRun validates the backup and prints the plan of the restore without
+	// touching the cluster.
+	DryRun bool `json:"dry-run" toml:"dry-run"`
 }
 
 // DefineRestoreFlags defines common flags for the restore command.
 func DefineRestoreFlags(flags *pflag.FlagSet) {
 	// TODO remove experimental tag if it's stable
-	flags.Bool(flagOnline, false, "(experimental) Whether online when restore")
+	flags.Bool(flagOnline, false, "(experimental) restore without switching TiKV to import mode, "+
+		"only the schedulers moving regions are paused and fewer regions are scheduled")
 	flags.Bool(flagNoSchema, false, "skip creating schemas and tables, reuse existing empty ones")
+	flags.Bool(flagAllowSameCluster, false,
+		"allow restoring the backup into the same cluster it was taken from, which may overwrite the live tables")
+	flags.Uint64(flagIngestRateLimit, 0,
+		"the total rate limit of ingesting sst files, MB/s, it can be changed at runtime "+
+			"by posting `rate`(bytes/s) to "+ingestRateLimitPath+" of the status address")
+	flags.Uint64(flagRateLimitAfter, 0,
+		"the download speed limit of the stores, MB/s, set after the restore limited by --"+flagRateLimit+
+			", 0 lifts the limit, set it to the limit of the stores before the restore, which BR can't read from TiKV")
+	flags.String(flagRegionTimeline, "",
+		"the local file to dump when every region is split, downloaded and ingested, one json object per line")
+	flags.Bool(flagSaveReport, false,
+		"write the summary of the restore, with the time of every step and the slowest regions, "+
+			"into "+utils.RestoreReportFile+" of the storage")
+	flags.String(flagStagingStorage, "",
+		"the storage to copy the files of a local:// backup into before restoring, e.g. \"s3://bucket/staging\", "+
+			"so the stores don't need the files at the same local paths, the files of all stores of the "+
+			"backup cluster must be gathered into --"+flagStorage+" on the host running BR")
+	flags.Bool(flagIncludeSystemTables, false,
+		"restore the users, privileges and bindings of the mysql database in the backup, they are merged into "+
+			"the system tables, the existing rows of the same keys are kept unless --"+flagReplaceSysTables)
+	flags.Bool(flagReplaceSysTables, false,
+		"replace the existing users, privileges and bindings with the ones in the backup")
+	flags.String(flagDBPrefix, "", "the prefix added to the names of all restored databases, e.g. 'dr_'")
+	flags.String(flagDBSuffix, "", "the suffix added to the names of all restored databases, e.g. '_restored'")
+	flags.StringArray(flagIncrementalStore, nil, "the incremental backup restored after the backup of --storage, "+
+		"can be repeated to restore a chain of them in order, the lastbackupts of each one must be the backupts of "+
+		"the previous one")
+	flags.StringArray(flagRename, nil, "restore a database or table under a new name, "+
+		"in the form of 'olddb:newdb' or 'olddb.oldtable:newdb.newtable', can be repeated")
+	flags.Duration(flagWaitTiFlash, 0, "the longest time to wait for the tiflash replicas "+
+		"of the restored tables to be available, they are set after the data is restored, 0 means not waiting")
+	flags.String(flagPlacementRules, placementRulesRestore, "what to do with the placement rules of the tables "+
+		"in the backup, 'restore' re-creates them for the restored tables, 'drop' drops them")
+	flags.StringArray(flagPlacementLabelMap, nil, "map the label values of the restored placement rules "+
+		"if the topology differs, in the form of 'key:old=new', e.g. 'zone:us-east=eu-west', can be repeated")
+	flags.String(flagCheckpointStore, "", "the storage to save the checkpoint of the restore in, "+
+		"e.g. 'local:///data/br', so that the restore interrupted halfway can be resumed by --resume, "+
+		"empty disables the checkpoint")
+	flags.Bool(flagResume, false, "run the interrupted restore again, skipping the files it has ingested "+
+		"and the tables it has finished according to the checkpoint in --checkpoint-storage")
+	flags.String(flagConflictPolicy, string(ConflictError), "what to do if the tables to restore already exist "+
+		"and contain data, 'error' refuses to restore, 'skip' skips restoring them, 'replace' drops each of them right before creating it and restores it")
+	flags.Bool(flagForce, false, "restore into the existing tables even if they contain data")
+	flags.Bool(flagCreateMissingDB, true, "create the databases of the restored tables if they don't exist, "+
+		"with the charsets and collations in the backup, otherwise refuse to restore into the missing databases")
+	flags.StringArray(flagPartitionToTable, nil, "restore a partition of a table as a standalone table "+
+		"instead of the partitioned table, in the form of 'db.table.partition:newdb.newtable', can be repeated")
+	flags.Uint(flagDDLConcurrency, defaultDDLConcurrency, "the number of sessions creating the tables, "+
+		"raise it for the backups of many tables")
+	flags.Uint(flagPipelineDepth, defaultPipelineDepth, "the number of batches downloaded concurrently "+
+		"and the number of batches ingested concurrently, the files of the next batches are downloaded "+
+		"while a batch is ingested, raise it to hide the latency of the object storages")
+	flags.Bool(flagDryRun, false, "validate the backup and print the tables, ranges, size and regions "+
+		"to restore without touching the cluster")
 
 	// Do not expose this flag
 	_ = flags.MarkHidden(flagNoSchema)
@@ -62,6 +214,89 @@ func (cfg *RestoreConfig) ParseFromFlags(flags *pflag.FlagSet) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	cfg.AllowSameCluster, err = flags.GetBool(flagAllowSameCluster)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ingestRateLimit, err := flags.GetUint64(flagIngestRateLimit)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	rateLimitUnit, err := flags.GetUint64(flagRateLimitUnit)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.IngestRateLimit = ingestRateLimit * rateLimitUnit
+	if cfg.RateLimitAfterRestore, err = parseRateLimitAfterRestore(flags); err != nil {
+		return errors.Trace(err)
+	}
+	cfg.RegionTimeline, err = flags.GetString(flagRegionTimeline)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.SaveReport, err = flags.GetBool(flagSaveReport)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.StagingStorage, err = flags.GetString(flagStagingStorage)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.IncludeSystemTables, err = flags.GetBool(flagIncludeSystemTables)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.ReplaceSystemTables, err = flags.GetBool(flagReplaceSysTables)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = cfg.parseRenameFromFlags(flags); err != nil {
+		return err
+	}
+	cfg.IncrementalStorages, err = flags.GetStringArray(flagIncrementalStore)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.SchemaOnly && len(cfg.IncrementalStorages) > 0 {
+		return errors.Annotatef(berrors.ErrInvalidArgument, "--%s can't be used to restore schemas only", flagIncrementalStore)
+	}
+	cfg.WaitTiFlashReplica, err = flags.GetDuration(flagWaitTiFlash)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.PlacementRules, err = flags.GetString(flagPlacementRules)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.PlacementRules != placementRulesRestore && cfg.PlacementRules != placementRulesDrop {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"invalid --%s %s, must be restore or drop", flagPlacementRules, cfg.PlacementRules)
+	}
+	cfg.PlacementLabelMap, err = flags.GetStringArray(flagPlacementLabelMap)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, err = parsePlacementLabelMap(cfg.PlacementLabelMap); err != nil {
+		return err
+	}
+	if err = cfg.parseConflictFromFlags(flags); err != nil {
+		return err
+	}
+	cfg.DDLConcurrency, err = flags.GetUint(flagDDLConcurrency)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.PipelineDepth, err = flags.GetUint(flagPipelineDepth)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.StartKey, cfg.EndKey, err = parseRestoreKeyRange(flags); err != nil {
+		return err
+	}
+	cfg.DryRun, err = flags.GetBool(flagDryRun)
+	if err != nil {
+		return errors.Trace(err)
+	}
 	err = cfg.Config.ParseFromFlags(flags)
 	if err != nil {
 		return errors.Trace(err)
@@ -73,6 +308,76 @@ func (cfg *RestoreConfig) ParseFromFlags(flags *pflag.FlagSet) error {
 	return nil
 }
 
+// parseRenameFromFlags parses the flags renaming the restored databases and
+// tables.
+func (cfg *RestoreConfig) parseRenameFromFlags(flags *pflag.FlagSet) error {
+	var err error
+	cfg.DBPrefix, err = flags.GetString(flagDBPrefix)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.DBSuffix, err = flags.GetString(flagDBSuffix)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.Rename, err = flags.GetStringArray(flagRename)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(cfg.Rename) > 0 {
+		if cfg.DBPrefix != "" || cfg.DBSuffix != "" {
+			return errors.Annotatef(berrors.ErrInvalidArgument,
+				"--%s can't be used with --%s or --%s", flagRename, flagDBPrefix, flagDBSuffix)
+		}
+		if _, err = parseRenameRules(cfg.Rename); err != nil {
+			return err
+		}
+	}
+	cfg.CreateMissingDB, err = flags.GetBool(flagCreateMissingDB)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.PartitionToTable, err = flags.GetStringArray(flagPartitionToTable)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = parsePartitionRules(cfg.PartitionToTable)
+	return err
+}
+
+// parseConflictFromFlags parses the flags handling the restored data which
+// conflicts with the cluster, or with a former attempt of the restore.
+func (cfg *RestoreConfig) parseConflictFromFlags(flags *pflag.FlagSet) error {
+	var err error
+	cfg.CheckpointStorage, err = flags.GetString(flagCheckpointStore)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.Resume, err = flags.GetBool(flagResume)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.Resume && cfg.CheckpointStorage == "" {
+		return errors.Annotatef(berrors.ErrInvalidArgument, "--%s requires --%s", flagResume, flagCheckpointStore)
+	}
+	policy, err := flags.GetString(flagConflictPolicy)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.ConflictPolicy, err = parseConflictPolicy(policy); err != nil {
+		return err
+	}
+	cfg.Force, err = flags.GetBool(flagForce)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.Force && cfg.ConflictPolicy != ConflictError {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s can't be used with --%s %s", flagForce, flagConflictPolicy, cfg.ConflictPolicy)
+	}
+	return nil
+}
+
 // adjustRestoreConfig is use for BR(binary) and BR in TiDB.
 // When new config was add and not included in parser.
 // we should set proper value in this function.
@@ -86,6 +391,15 @@ func (cfg *RestoreConfig) adjustRestoreConfig() {
 	if cfg.Config.SwitchModeInterval == 0 {
 		cfg.Config.SwitchModeInterval = defaultSwitchInterval
 	}
+	if cfg.PlacementRules == "" {
+		cfg.PlacementRules = placementRulesRestore
+	}
+	if cfg.DDLConcurrency == 0 {
+		cfg.DDLConcurrency = defaultDDLConcurrency
+	}
+	if cfg.PipelineDepth == 0 {
+		cfg.PipelineDepth = defaultPipelineDepth
+	}
 }
 
 // RunRestore starts a restore task inside the current goroutine.
@@ -93,60 +407,74 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 	cfg.adjustRestoreConfig()
 
 	defer summary.Summary(cmdName)
+	summary.SetPhase(phasePrepare)
 	ctx, cancel := context.WithCancel(c)
 	defer cancel()
 
-	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements)
+	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements,
+		cfg.GRPCDialOptions...)
 	if err != nil {
 		return err
 	}
 	defer mgr.Close()
+	cfg.keepDiscoveringPD(ctx, mgr)
+	// The dry run doesn't conflict with other tasks.
+	if !cfg.DryRun {
+		unregister, err2 := registerTask(ctx, g, cfg.PD, mgr.GetTLSConfig(), cmdName, cfg.ForceConcurrent)
+		if err2 != nil {
+			return err2
+		}
+		defer unregister()
+	}
 
-	keepaliveCfg := GetKeepalive(&cfg.Config)
-	keepaliveCfg.PermitWithoutStream = true
-	client, err := restore.NewRestoreClient(g, mgr.GetPDClient(), mgr.GetTiKV(), mgr.GetTLSConfig(), keepaliveCfg)
+	client, err := newRestoreClient(ctx, g, mgr, cfg)
 	if err != nil {
 		return err
 	}
 	defer client.Close()
+	defer setIngestRateLimit(client, cfg)()
+	// The statistics of the steps are always collected for the report.
+	timeline := restore.NewRegionTimelineStats()
+	if cfg.RegionTimeline != "" {
+		timeline = restore.NewRegionTimeline()
+		// Dump it even if the restore failed, the stragglers are more interesting then.
+		defer dumpRegionTimeline(cfg.RegionTimeline, timeline)
+	}
+	client.SetRegionTimeline(timeline)
 
-	u, err := storage.ParseBackend(cfg.Storage, &cfg.BackendOptions)
+	u, s, reader, err := OpenBackupMeta(ctx, utils.MetaFile, &cfg.Config)
 	if err != nil {
 		return err
 	}
-	if err = client.SetStorage(ctx, u, cfg.SendCreds); err != nil {
+	archiveSize, err := reader.ArchiveSize(ctx)
+	if err != nil {
 		return err
 	}
-	client.SetRateLimit(cfg.RateLimit)
-	client.SetConcurrency(uint(cfg.Concurrency))
-	if cfg.Online {
-		client.EnableOnline()
-	}
-	if cfg.NoSchema {
-		client.EnableSkipCreateSQL()
+	g.Record("Size", archiveSize)
+	if err = checkRestoreSource(ctx, g, mgr, cfg, reader); err != nil {
+		return err
 	}
-	client.SetSwitchModeInterval(cfg.SwitchModeInterval)
-	err = client.LoadRestoreStores(ctx)
+	importBackend, err := initRestoreClient(ctx, g, mgr, client, cfg, u, reader)
 	if err != nil {
 		return err
 	}
 
-	u, _, backupMeta, err := ReadBackupMeta(ctx, utils.MetaFile, &cfg.Config)
-	if err != nil {
-		return err
+	files, tables, dbs := filterRestoreFiles(client, cfg)
+	if len(dbs) == 0 && len(tables) != 0 {
+		return errors.Annotate(berrors.ErrRestoreInvalidBackup, "contain tables but no databases")
 	}
-	g.Record("Size", utils.ArchiveSize(backupMeta))
-	if err = client.InitBackupMeta(backupMeta, u); err != nil {
+
+	ddlJobs := restore.FilterDDLJobs(client.GetDDLJobs(), tables)
+	if dbs, tables, files, err = renameRestoredObjects(cfg, ddlJobs, dbs, tables, files); err != nil {
 		return err
 	}
 
-	if client.IsRawKvMode() {
-		return errors.Annotate(berrors.ErrRestoreModeMismatch, "cannot do transactional restore from raw kv data")
+	if cfg.DryRun {
+		return runRestorePlan(ctx, mgr.GetDomain(), mgr.GetTiKV(), u, s, reader, tables)
 	}
-
-	files, tables, dbs := filterRestoreFiles(client, cfg)
-	if len(dbs) == 0 && len(tables) != 0 {
-		return errors.Annotate(berrors.ErrRestoreInvalidBackup, "contain tables but no databases")
+	missingDBs, err := checkMissingDatabases(mgr, cfg, dbs)
+	if err != nil {
+		return err
 	}
 
 	restoreTS, err := client.GetTS(ctx)
@@ -168,13 +496,13 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 	if client.IsIncremental() {
 		newTS = restoreTS
 	}
-	ddlJobs := restore.FilterDDLJobs(client.GetDDLJobs(), tables)
 
 	// pre-set TiDB config for restore
 	restoreDBConfig := enableTiDBConfig()
 	defer restoreDBConfig()
 
 	// execute DDL first
+	summary.SetPhase(phaseExecDDLs)
 	err = client.ExecDDLs(ctx, ddlJobs)
 	if err != nil {
 		return errors.Trace(err)
@@ -188,35 +516,34 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 		return nil
 	}
 
-	for _, db := range dbs {
-		err = client.CreateDatabase(ctx, db.Info)
-		if err != nil {
+	summary.SetPhase(phaseRestore)
+	if cfg.Resume {
+		tables, files = filterRestoredTables(client, tables)
+	}
+	if len(cfg.StartKey) > 0 {
+		if err = checkRestoreKeyRange(mgr.GetDomain().InfoSchema(), tables, cfg.StartKey); err != nil {
 			return err
 		}
 	}
+	if tables, files, err = resolveRestoreConflicts(mgr, client, cfg, tables, files); err != nil {
+		return err
+	}
+	if cfg.StagingStorage != "" && !cfg.SchemaOnly {
+		if err = stageRestoreFiles(ctx, cfg, importBackend, s, files); err != nil {
+			return err
+		}
+	}
+	if err = createRestoredDatabases(ctx, client, dbs, missingDBs); err != nil {
+		return err
+	}
 
 	// We make bigger errCh so we won't block on multi-part failed.
 	errCh := make(chan error, 32)
-	// Maybe allow user modify the DDL concurrency isn't necessary,
-	// because executing DDL is really I/O bound (or, algorithm bound?),
-	// and we cost most of time at waiting DDL jobs be enqueued.
-	// So these jobs won't be faster or slower when machine become faster or slower,
-	// hence make it a fixed value would be fine.
-	var dbPool []*restore.DB
-	if g.OwnsStorage() {
-		// Only in binary we can use multi-thread sessions to create tables.
-		// so use OwnStorage() to tell whether we are use binary or SQL.
-		dbPool, err = restore.MakeDBPool(defaultDDLConcurrency, func() (*restore.DB, error) {
-			return restore.NewDB(g, mgr.GetTiKV())
-		})
-	}
-	if err != nil {
-		log.Warn("create session pool failed, we will send DDLs only by created sessions",
-			zap.Error(err),
-			zap.Int("sessionCount", len(dbPool)),
-		)
-	}
+	dbPool := makeRestoreDBPool(g, mgr, cfg)
 	tableStream := client.GoCreateTables(ctx, mgr.GetDomain(), tables, newTS, dbPool, errCh)
+	if cfg.SchemaOnly {
+		return finishSchemaOnlyRestore(ctx, client, cfg, tables, tableStream, errCh)
+	}
 	if len(files) == 0 {
 		log.Info("no files, empty databases and tables are restored")
 		summary.SetSuccessStatus(true)
@@ -238,7 +565,9 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 	}
 	// Always run the post-work even on error, so we don't stuck in the import
 	// mode or emptied schedulers
-	defer restorePostWork(ctx, client, restoreSchedulers)
+	defer restorePostWork(ctx, client, restoreSchedulers, cfg.RateLimitAfterRestore)
+	stopSaver := client.StartCheckpointSaver(ctx)
+	defer stopSaver()
 
 	// Do not reset timestamp if we are doing incremental restore, because
 	// we are not allowed to decrease timestamp.
@@ -264,7 +593,7 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 		int64(rangeSize+len(files)+len(tables)),
 		!cfg.LogProgress)
 	defer updateCh.Close()
-	sender, err := restore.NewTiKVSender(ctx, client, updateCh)
+	sender, err := restore.NewTiKVSender(ctx, client, updateCh, cfg.PipelineDepth)
 	if err != nil {
 		return err
 	}
@@ -274,36 +603,461 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 	batcher.EnableAutoCommit(ctx, time.Second)
 	go restoreTableStream(ctx, rangeStream, batcher, errCh)
 
-	var finish <-chan struct{}
 	// Checksum
-	if cfg.Checksum {
-		finish = client.GoValidateChecksum(
-			ctx, afterRestoreStream, mgr.GetTiKV().GetClient(), errCh, updateCh, cfg.ChecksumConcurrency)
-	} else {
-		// when user skip checksum, just collect tables, and drop them.
-		finish = dropToBlackhole(ctx, afterRestoreStream, errCh, updateCh)
-	}
+	finish := goRestoreChecksum(ctx, mgr, client, cfg, afterRestoreStream, errCh, updateCh)
 
 	select {
 	case err = <-errCh:
 		err = multierr.Append(err, multierr.Combine(restore.Exhaust(errCh)...))
 	case <-finish:
 	}
+	// Report the failed restore too, to find out what is slow.
+	report := buildRestoreReport(tables, timeline)
+	report.print()
+	if cfg.SaveReport {
+		saveRestoreReport(ctx, s, report)
+	}
 
 	// If any error happened, return now.
 	if err != nil {
 		return err
 	}
+	return finishRestore(ctx, mgr, client, cfg, tables)
+}
+
+// newRestoreClient creates the client restoring from the storage into the
+// cluster.
+func newRestoreClient(ctx context.Context, g glue.Glue, mgr *conn.Mgr, cfg *RestoreConfig) (*restore.Client, error) {
+	keepaliveCfg := GetKeepalive(&cfg.Config)
+	keepaliveCfg.PermitWithoutStream = true
+	client, err := restore.NewRestoreClient(g, mgr.GetPDClient(), mgr.GetTiKV(), mgr.GetTLSConfig(), keepaliveCfg)
+	if err != nil {
+		return nil, err
+	}
+	client.SetDialOptions(mgr.GetDialOptions())
+
+	u, err := storage.ParseBackend(cfg.Storage, &cfg.BackendOptions)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err = client.SetStorage(ctx, u, cfg.SendCreds); err != nil {
+		client.Close()
+		return nil, err
+	}
+	client.SetRateLimit(cfg.RateLimit)
+	client.SetConcurrency(uint(cfg.Concurrency))
+	if cfg.Online {
+		client.EnableOnline()
+	}
+	if cfg.NoSchema {
+		client.EnableSkipCreateSQL()
+	}
+	client.SetSwitchModeInterval(cfg.SwitchModeInterval)
+	client.SetKeyRange(cfg.StartKey, cfg.EndKey)
+	if err = client.LoadRestoreStores(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// setIngestRateLimit limits the rate of ingesting the files, the limit can
+// be tuned while restoring. The returned function stops the tuning.
+func setIngestRateLimit(client *restore.Client, cfg *RestoreConfig) (unset func()) {
+	ingestLimiter := utils.NewTokenBucket(cfg.IngestRateLimit)
+	client.SetIngestLimiter(ingestLimiter)
+	utils.SetStatusHandler(ingestRateLimitPath, ingestLimiter)
+	// The rate limit in the config file is in the unit of --ratelimit-unit.
+	unit := cfg.RateLimitUnit
+	if unit > 0 {
+		utils.SetTunable(flagIngestRateLimit, func(value uint64) {
+			ingestLimiter.SetRate(value * unit)
+		})
+	}
+	return func() {
+		utils.SetStatusHandler(ingestRateLimitPath, nil)
+		if unit > 0 {
+			utils.SetTunable(flagIngestRateLimit, nil)
+		}
+	}
+}
+
+// checkRestoreSource checks whether the backup can be restored into the
+// cluster.
+func checkRestoreSource(
+	ctx context.Context,
+	g glue.Glue,
+	mgr *conn.Mgr,
+	cfg *RestoreConfig,
+	reader *metautil.MetaReader,
+) error {
+	// Restoring through SQL (BRIE) is explicit enough, only check it in binary.
+	if g.OwnsStorage() && !cfg.AllowSameCluster {
+		if err := checkSameCluster(ctx, mgr.GetPDClient(), reader.Meta()); err != nil {
+			return err
+		}
+	}
+	checkSourceCluster(ctx, mgr, reader.Extension().Source)
+	if cfg.CheckRequirements {
+		return checkNewCollations(reader.Extension().NewCollationsEnabled, collate.NewCollationEnabled())
+	}
+	return nil
+}
+
+// initRestoreClient loads the backup into the client, it returns the backend
+// which TiKV downloads the files from.
+func initRestoreClient(
+	ctx context.Context,
+	g glue.Glue,
+	mgr *conn.Mgr,
+	client *restore.Client,
+	cfg *RestoreConfig,
+	u *backup.StorageBackend,
+	reader *metautil.MetaReader,
+) (*backup.StorageBackend, error) {
+	// TiKV downloads the files from the staging storage if any.
+	importBackend, err := parseStagingStorage(cfg, u)
+	if err != nil {
+		return nil, err
+	}
+	if err = client.InitBackupMetaReader(ctx, reader, importBackend); err != nil {
+		return nil, err
+	}
+
+	if client.IsRawKvMode() {
+		return nil, errors.Annotate(berrors.ErrRestoreModeMismatch, "cannot do transactional restore from raw kv data")
+	}
+	if !cfg.NoSchema {
+		if err = setPlacementRules(client, cfg, reader); err != nil {
+			return nil, err
+		}
+	}
+	// Only the binary can resume the restore, don't save checkpoints in SQL.
+	if g.OwnsStorage() && cfg.CheckpointStorage != "" {
+		if err = enableRestoreCheckpoint(ctx, client, mgr.GetPDClient().GetClusterID(ctx), u, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return importBackend, nil
+}
+
+// renameRestoredObjects applies --partition-to-table, --rename, --db-prefix
+// and --db-suffix to the restored databases and tables. They can't be used
+// with the DDL jobs, whose queries refer to the objects by the old names.
+func renameRestoredObjects(
+	cfg *RestoreConfig,
+	ddlJobs []*model.Job,
+	dbs []*utils.Database,
+	tables []*utils.Table,
+	files []*backup.File,
+) ([]*utils.Database, []*utils.Table, []*backup.File, error) {
+	var err error
+	if len(ddlJobs) != 0 {
+		if cfg.DBPrefix != "" || cfg.DBSuffix != "" {
+			return nil, nil, nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"--%s and --%s can't be used when restoring the DDL jobs of an incremental backup", flagDBPrefix, flagDBSuffix)
+		}
+		if len(cfg.PartitionToTable) > 0 {
+			return nil, nil, nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"--%s can't be used when restoring the DDL jobs of an incremental backup", flagPartitionToTable)
+		}
+		if len(cfg.Rename) > 0 {
+			return nil, nil, nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"--%s can't be used when restoring the DDL jobs of an incremental backup", flagRename)
+		}
+	}
+	if len(cfg.PartitionToTable) > 0 {
+		rules, err := parsePartitionRules(cfg.PartitionToTable)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if dbs, tables, files, err = rules.apply(dbs, tables); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if len(cfg.Rename) > 0 {
+		rules, err := parseRenameRules(cfg.Rename)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if dbs, err = rules.apply(dbs, tables); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if err = renameRestoredDatabases(dbs, cfg.DBPrefix, cfg.DBSuffix); err != nil {
+		return nil, nil, nil, err
+	}
+	return dbs, tables, files, nil
+}
+
+// checkMissingDatabases returns the restored databases which don't exist in
+// the cluster, which are refused unless they can be created.
+func checkMissingDatabases(mgr *conn.Mgr, cfg *RestoreConfig, dbs []*utils.Database) ([]*utils.Database, error) {
+	missingDBs := findMissingDatabases(mgr.GetDomain().InfoSchema().SchemaExists, dbs)
+	if len(missingDBs) != 0 && !cfg.CreateMissingDB && !cfg.NoSchema {
+		names := make([]string, 0, len(missingDBs))
+		for _, db := range missingDBs {
+			names = append(names, db.Info.Name.O)
+		}
+		return nil, errors.Annotatef(berrors.ErrRestoreSchemaNotExists,
+			"databases %s don't exist in the target cluster, remove --%s=false to create them",
+			strings.Join(names, ", "), flagCreateMissingDB)
+	}
+	return missingDBs, nil
+}
+
+// createRestoredDatabases creates the restored databases, the missing ones
+// are logged as they are new in the cluster.
+func createRestoredDatabases(
+	ctx context.Context, client *restore.Client, dbs, missingDBs []*utils.Database,
+) error {
+	for _, db := range missingDBs {
+		log.Info("create the missing database", zap.Stringer("db", db.Info.Name),
+			zap.String("charset", db.Info.Charset), zap.String("collate", db.Info.Collate))
+	}
+	for _, db := range dbs {
+		if err := client.CreateDatabase(ctx, db.Info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveRestoreConflicts resolves the restored tables which aren't empty in
+// the cluster by the conflict policy, it returns the tables and files to
+// restore.
+func resolveRestoreConflicts(
+	mgr *conn.Mgr, client *restore.Client, cfg *RestoreConfig, tables []*utils.Table, files []*backup.File,
+) ([]*utils.Table, []*backup.File, error) {
+	// Incremental backups are restored into the tables restored before, and
+	// a range of the keys is restored into the existing table. BRIE sets no
+	// conflict policy and restores into the existing tables.
+	if client.IsIncremental() || cfg.Force || len(cfg.StartKey) > 0 || cfg.ConflictPolicy == "" {
+		return tables, files, nil
+	}
+	conflicts, err := findNonEmptyTables(mgr.GetDomain(), mgr.GetTiKV(), tables)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The tables are being restored by the interrupted run.
+	conflicts = filterResumedTables(client.IsFileIngested, conflicts)
+	tables, files, replace, err := resolveTableConflicts(cfg.ConflictPolicy, conflicts, tables, files)
+	if err != nil {
+		return nil, nil, err
+	}
+	client.SetReplaceTables(replace)
+	return tables, files, nil
+}
+
+// stageRestoreFiles copies the files into the staging storage, which TiKV
+// downloads them from.
+func stageRestoreFiles(
+	ctx context.Context,
+	cfg *RestoreConfig,
+	stagingBackend *backup.StorageBackend,
+	s storage.ExternalStorage,
+	files []*backup.File,
+) error {
+	summary.SetPhase(phaseStageFiles)
+	staging, err := storage.Create(ctx, stagingBackend, cfg.SendCreds)
+	if err != nil {
+		return err
+	}
+	if err = stageBackupFiles(ctx, s, staging, files); err != nil {
+		return err
+	}
+	summary.SetPhase(phaseRestore)
+	return nil
+}
+
+// makeRestoreDBPool returns the sessions creating the tables concurrently,
+// it's empty if the tables are created by the session of the client.
+func makeRestoreDBPool(g glue.Glue, mgr *conn.Mgr, cfg *RestoreConfig) []*restore.DB {
+	// Creating the tables is bound by waiting for the DDL jobs to be enqueued,
+	// the backups of many tables need more sessions than the machine's cores.
+	// Only in binary we can use multi-thread sessions to create tables.
+	// so use OwnStorage() to tell whether we are use binary or SQL.
+	if !g.OwnsStorage() || cfg.DDLConcurrency <= 1 {
+		return nil
+	}
+	dbPool, err := restore.MakeDBPool(cfg.DDLConcurrency, func() (*restore.DB, error) {
+		return restore.NewDB(g, mgr.GetTiKV())
+	})
+	if err != nil {
+		log.Warn("create session pool failed, we will send DDLs only by created sessions",
+			zap.Error(err),
+			zap.Int("sessionCount", len(dbPool)),
+		)
+	}
+	return dbPool
+}
+
+// finishSchemaOnlyRestore waits for the tables to be created, and restores
+// their placement rules and TiFlash replicas.
+func finishSchemaOnlyRestore(
+	ctx context.Context,
+	client *restore.Client,
+	cfg *RestoreConfig,
+	tables []*utils.Table,
+	tableStream <-chan restore.CreatedTable,
+	errCh <-chan error,
+) error {
+	created, err := waitTablesCreated(tableStream, errCh)
+	if err != nil {
+		return err
+	}
+	log.Info("schemas restored, skip restoring the data", zap.Int("tables", len(tables)))
+	if !cfg.NoSchema {
+		if err = client.RestorePlacementRules(ctx, created); err != nil {
+			return err
+		}
+		// Nothing to sync for the empty tables.
+		client.RecoverTiFlashReplicas(ctx, tables)
+	}
+	summary.SetSuccessStatus(true)
+	return nil
+}
+
+// goRestoreChecksum checksums the restored tables according to the checksum
+// mode, the returned channel is closed once all tables are done.
+func goRestoreChecksum(
+	ctx context.Context,
+	mgr *conn.Mgr,
+	client *restore.Client,
+	cfg *RestoreConfig,
+	afterRestoreStream <-chan restore.CreatedTable,
+	errCh chan<- error,
+	updateCh glue.Progress,
+) <-chan struct{} {
+	checksumMode := cfg.checksumMode()
+	if len(cfg.StartKey) > 0 && checksumMode == ChecksumRequired {
+		// Only a part of the table is restored.
+		log.Info("checksumming the table is skipped when restoring a range of its keys")
+		checksumMode = ChecksumOptional
+	}
+	if checksumMode == ChecksumRequired {
+		return client.GoValidateChecksum(
+			ctx, afterRestoreStream, mgr.GetTiKV().GetClient(), errCh, updateCh, cfg.ChecksumConcurrency)
+	}
+	if checksumMode == ChecksumOptional {
+		log.Info("skip checksumming the restored tables, the files are verified by TiKV on downloading")
+	}
+	// when user skip checksum, just collect tables, and drop them.
+	return dropToBlackhole(ctx, client, afterRestoreStream, errCh, updateCh)
+}
+
+// finishRestore restores the system tables and the TiFlash replicas after
+// the data is restored.
+func finishRestore(
+	ctx context.Context, mgr *conn.Mgr, client *restore.Client, cfg *RestoreConfig, tables []*utils.Table,
+) error {
+	if cfg.IncludeSystemTables {
+		if err := client.RestoreSystemSchemas(ctx, tables, cfg.ReplaceSystemTables); err != nil {
+			return err
+		}
+	}
+	if !cfg.NoSchema {
+		recovered := client.RecoverTiFlashReplicas(ctx, tables)
+		if err := waitTiFlashReplicas(ctx, mgr, recovered, cfg.WaitTiFlashReplica); err != nil {
+			return err
+		}
+	}
+
+	// The restore is complete, there is nothing to resume.
+	if e := client.RemoveCheckpoint(ctx); e != nil {
+		log.Warn("failed to remove the restore checkpoint", zap.Error(e))
+	}
 
 	// Set task summary to success status.
 	summary.SetSuccessStatus(true)
 	return nil
 }
 
+// enableRestoreCheckpoint saves the checkpoint of the restore from the backup
+// into the cluster in the checkpoint storage, and loads the one saved by the
+// interrupted run if resuming.
+func enableRestoreCheckpoint(
+	ctx context.Context, client *restore.Client, clusterID uint64, u *backup.StorageBackend, cfg *RestoreConfig,
+) error {
+	cu, err := storage.ParseBackend(cfg.CheckpointStorage, &cfg.BackendOptions)
+	if err != nil {
+		return err
+	}
+	s, err := storage.Create(ctx, cu, cfg.SendCreds)
+	if err != nil {
+		return err
+	}
+	backupURL := storage.FormatBackendURL(u)
+	client.EnableCheckpoint(s, restore.CheckpointKey{
+		ClusterID: clusterID,
+		Storage:   backupURL.String(),
+		Filter:    cfg.FilterRules,
+		DBPrefix:  cfg.DBPrefix,
+		DBSuffix:  cfg.DBSuffix,
+		Rename:    cfg.Rename,
+	})
+	if cfg.Resume {
+		if _, err = client.LoadCheckpoint(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterRestoredTables removes the tables restored by the interrupted run
+// according to the checkpoint, it returns the tables and files to restore.
+func filterRestoredTables(client *restore.Client, tables []*utils.Table) ([]*utils.Table, []*backup.File) {
+	remainTables := make([]*utils.Table, 0, len(tables))
+	remainFiles := make([]*backup.File, 0)
+	for _, table := range tables {
+		if client.IsTableRestored(table) {
+			log.Info("skip the table restored by the last run",
+				zap.Stringer("db", table.DB.Name), zap.Stringer("table", table.Info.Name))
+			continue
+		}
+		remainTables = append(remainTables, table)
+		remainFiles = append(remainFiles, table.Files...)
+	}
+	summary.CollectInt("restored tables skipped", len(tables)-len(remainTables))
+	return remainTables, remainFiles
+}
+
+// dumpRegionTimeline writes the timeline of restoring regions into the local file.
+func dumpRegionTimeline(path string, timeline *restore.RegionTimeline) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Warn("failed to create region timeline file", zap.String("path", path), zap.Error(err))
+		return
+	}
+	defer f.Close()
+	if err = timeline.Dump(f); err != nil {
+		log.Warn("failed to dump region timeline", zap.String("path", path), zap.Error(err))
+		return
+	}
+	log.Info("region timeline dumped", zap.String("path", path), zap.Int("events", timeline.Len()))
+}
+
+// checkSameCluster refuses to restore the backup into the cluster it was taken from.
+func checkSameCluster(ctx context.Context, pdClient pd.Client, backupMeta *backup.BackupMeta) error {
+	// Backups taken by older BR don't record the cluster ID.
+	if backupMeta.ClusterId == 0 {
+		return nil
+	}
+	clusterID := pdClient.GetClusterID(ctx)
+	if clusterID == backupMeta.ClusterId {
+		return errors.Annotatef(berrors.ErrRestoreSameCluster,
+			"the backup was taken from the target cluster %d, which may overwrite the live tables, "+
+				"use --%s if you really want to do this", clusterID, flagAllowSameCluster)
+	}
+	return nil
+}
+
 // dropToBlackhole drop all incoming tables into black hole,
 // i.e. don't execute checksum, just increase the process anyhow.
 func dropToBlackhole(
 	ctx context.Context,
+	client *restore.Client,
 	tableStream <-chan restore.CreatedTable,
 	errCh chan<- error,
 	updateCh glue.Progress,
@@ -318,10 +1072,11 @@ func dropToBlackhole(
 			case <-ctx.Done():
 				errCh <- ctx.Err()
 				return
-			case _, ok := <-tableStream:
+			case tbl, ok := <-tableStream:
 				if !ok {
 					return
 				}
+				client.SetTablePhase(tbl.OldTable, restore.TablePhaseDone)
 				updateCh.Inc()
 			}
 		}
@@ -329,16 +1084,40 @@ func dropToBlackhole(
 	return outCh
 }
 
+// findMissingDatabases returns the databases to restore which don't exist in
+// the target cluster. The temporary database of the system tables is always
+// created by the restore, so it's never missing.
+func findMissingDatabases(exists func(model.CIStr) bool, dbs []*utils.Database) []*utils.Database {
+	tmpSysDB := utils.TemporaryDBName(mysql.SystemDB)
+	missing := make([]*utils.Database, 0)
+	for _, db := range dbs {
+		if db.Info.Name.L == tmpSysDB.L || exists(db.Info.Name) {
+			continue
+		}
+		missing = append(missing, db)
+	}
+	return missing
+}
+
 func filterRestoreFiles(
 	client *restore.Client,
 	cfg *RestoreConfig,
 ) (files []*backup.File, tables []*utils.Table, dbs []*utils.Database) {
 	for _, db := range client.GetDatabases() {
 		createdDatabase := false
+		isSysDB := utils.IsSysDB(db.Info.Name.L)
+		// There's nothing to apply to the system tables without data.
+		if isSysDB && (!cfg.IncludeSystemTables || cfg.SchemaOnly) {
+			continue
+		}
 		for _, table := range db.Tables {
 			if !cfg.TableFilter.MatchTable(db.Info.Name.O, table.Info.Name.O) {
 				continue
 			}
+			if isSysDB && !restore.IsSysTableRecoverable(table.Info.Name.L) {
+				log.Info("skip unrecoverable system table", zap.Stringer("table", table.Info.Name))
+				continue
+			}
 
 			if !createdDatabase {
 				dbs = append(dbs, db)
@@ -351,11 +1130,28 @@ func filterRestoreFiles(
 	return
 }
 
+// waitTablesCreated waits for all tables created, for restoring the schemas
+// only, it returns the tables created.
+func waitTablesCreated(tableStream <-chan restore.CreatedTable, errCh <-chan error) ([]restore.CreatedTable, error) {
+	created := make([]restore.CreatedTable, 0)
+	for table := range tableStream {
+		created = append(created, table)
+	}
+	// The error is sent before the stream is closed.
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+		return created, nil
+	}
+}
+
 // restorePreWork executes some prepare work before restore.
 // TODO make this function returns a restore post work.
 func restorePreWork(ctx context.Context, client *restore.Client, mgr *conn.Mgr) (utils.UndoFunc, error) {
 	if client.IsOnline() {
-		return utils.Nop, nil
+		// The import mode slows down the writes of the online services.
+		return mgr.RemoveSchedulersForOnline(ctx)
 	}
 
 	// Switch TiKV cluster to import mode (adjust rocksdb configuration).
@@ -367,21 +1163,61 @@ func restorePreWork(ctx context.Context, client *restore.Client, mgr *conn.Mgr)
 // restorePostWork executes some post work after restore.
 // TODO: aggregate all lifetime manage methods into batcher's context manager field.
 func restorePostWork(
-	ctx context.Context, client *restore.Client, restoreSchedulers utils.UndoFunc,
+	ctx context.Context, client *restore.Client, restoreSchedulers utils.UndoFunc, rateLimitAfter uint64,
 ) {
 	if ctx.Err() != nil {
 		log.Warn("context canceled, try shutdown")
 		ctx = context.Background()
 	}
-	if client.IsOnline() {
-		return
-	}
-	if err := client.SwitchToNormalMode(ctx); err != nil {
-		log.Warn("fail to switch to normal mode", zap.Error(err))
+	if !client.IsOnline() {
+		if err := client.SwitchToNormalMode(ctx); err != nil {
+			log.Warn("fail to switch to normal mode", zap.Error(err))
+		}
 	}
 	if err := restoreSchedulers(ctx); err != nil {
 		log.Warn("failed to restore PD schedulers", zap.Error(err))
 	}
+	resetCtx, cancel := context.WithTimeout(context.Background(), resetSpeedLimitTimeout)
+	defer cancel()
+	if err := client.ResetSpeedLimit(resetCtx, rateLimitAfter); err != nil {
+		log.Warn("failed to reset the download speed limit of the stores", zap.Error(err))
+	}
+}
+
+// parseRateLimitAfterRestore parses --ratelimit-after-restore in bytes.
+func parseRateLimitAfterRestore(flags *pflag.FlagSet) (uint64, error) {
+	rateLimit, err := flags.GetUint64(flagRateLimitAfter)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	rateLimitUnit, err := flags.GetUint64(flagRateLimitUnit)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return rateLimit * rateLimitUnit, nil
+}
+
+// waitTiFlashReplicas waits for the recovered TiFlash replicas of the tables
+// to be available for at most the wait duration.
+func waitTiFlashReplicas(
+	ctx context.Context,
+	mgr *conn.Mgr,
+	recovered []*utils.Table,
+	wait time.Duration,
+) error {
+	summary.CollectInt("tiflash replica tables", len(recovered))
+	if len(recovered) == 0 || wait == 0 {
+		return nil
+	}
+	pending, err := restore.WaitTiFlashReplicasAvailable(ctx, mgr.GetDomain(), recovered, wait)
+	if err != nil {
+		return err
+	}
+	for _, table := range pending {
+		log.Warn("the tiflash replicas are still unavailable, they are synced in background",
+			zap.Stringer("db", table.DB.Name), zap.Stringer("table", table.Info.Name))
+	}
+	return nil
 }
 
 // RunRestoreTiflashReplica restores the replica of tiflash saved in the last restore.
@@ -390,7 +1226,8 @@ func RunRestoreTiflashReplica(c context.Context, g glue.Glue, cmdName string, cf
 	ctx, cancel := context.WithCancel(c)
 	defer cancel()
 
-	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements)
+	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements,
+		cfg.GRPCDialOptions...)
 	if err != nil {
 		return err
 	}
@@ -409,26 +1246,16 @@ func RunRestoreTiflashReplica(c context.Context, g glue.Glue, cmdName string, cf
 	if err != nil {
 		return err
 	}
+	defer se.Close()
 
 	tables := make([]*utils.Table, 0)
 	for _, db := range dbs {
 		tables = append(tables, db.Tables...)
 	}
-	updateCh := g.StartProgress(
-		ctx, "RecoverTiflashReplica", int64(len(tables)), !cfg.LogProgress)
-	for _, t := range tables {
-		log.Info("get table", zap.Stringer("name", t.Info.Name),
-			zap.Int("replica", t.TiFlashReplicas))
-		if t.TiFlashReplicas > 0 {
-			err := se.AlterTiflashReplica(ctx, t, t.TiFlashReplicas)
-			if err != nil {
-				return err
-			}
-			updateCh.Inc()
-		}
+	recovered := se.RecoverTiFlashReplicas(ctx, tables)
+	if err = waitTiFlashReplicas(ctx, mgr, recovered, cfg.WaitTiFlashReplica); err != nil {
+		return err
 	}
-	updateCh.Close()
-	summary.CollectInt("recover tables", len(tables))
 
 	// Set task summary to success status.
 	summary.SetSuccessStatus(true)
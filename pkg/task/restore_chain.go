@@ -0,0 +1,79 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/glue"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// RunRestoreChain restores the backup in cfg.Storage, then the incremental
+// backups in cfg.IncrementalStorages in order. Each incremental backup must
+// start from the end of the previous one, the DDL jobs of it are replayed
+// before its data are restored.
+func RunRestoreChain(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConfig) error {
+	if len(cfg.IncrementalStorages) == 0 {
+		return RunRestore(c, g, cmdName, cfg)
+	}
+	storages := append([]string{cfg.Storage}, cfg.IncrementalStorages...)
+	metas := make([]*backup.BackupMeta, 0, len(storages))
+	for _, s := range storages {
+		metaCfg := cfg.Config
+		metaCfg.Storage = s
+		// Only the versions of the backups are checked, their files aren't read.
+		_, _, reader, err := OpenBackupMeta(c, utils.MetaFile, &metaCfg)
+		if err != nil {
+			return errors.Annotatef(err, "failed to read the backupmeta of %s", s)
+		}
+		metas = append(metas, reader.Meta())
+	}
+	if err := checkBackupChain(metas); err != nil {
+		return err
+	}
+
+	for i, s := range storages {
+		stepCfg := *cfg
+		stepCfg.Storage = s
+		stepCfg.IncrementalStorages = nil
+		log.Info("restore backup of the chain", zap.Int("index", i),
+			zap.Uint64("lastBackupTS", metas[i].StartVersion), zap.Uint64("backupTS", metas[i].EndVersion))
+		stepName := fmt.Sprintf("%s (%d/%d)", cmdName, i+1, len(storages))
+		if err := RunRestore(c, g, stepName, &stepCfg); err != nil {
+			return errors.Annotatef(err, "failed to restore backup #%d of the chain", i)
+		}
+	}
+	return nil
+}
+
+// checkBackupChain checks every backup after the first one is incremental
+// and starts from the end of the previous one.
+func checkBackupChain(metas []*backup.BackupMeta) error {
+	for i, meta := range metas {
+		if meta.IsRawKv {
+			return errors.Annotatef(berrors.ErrRestoreModeMismatch, "backup #%d of the chain is raw kv", i)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := metas[i-1]
+		if meta.StartVersion == 0 || meta.StartVersion == meta.EndVersion {
+			return errors.Annotatef(berrors.ErrRestoreInvalidBackup,
+				"backup #%d of the chain isn't an incremental backup", i)
+		}
+		if meta.StartVersion != prev.EndVersion {
+			return errors.Annotatef(berrors.ErrRestoreInvalidBackup,
+				"backup #%d of the chain starts at %d, but backup #%d ends at %d",
+				i, meta.StartVersion, i-1, prev.EndVersion)
+		}
+	}
+	return nil
+}
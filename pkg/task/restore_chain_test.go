@@ -0,0 +1,27 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+)
+
+type testRestoreChainSuite struct{}
+
+var _ = Suite(&testRestoreChainSuite{})
+
+func (s *testRestoreChainSuite) TestCheckBackupChain(c *C) {
+	metas := []*backup.BackupMeta{
+		{StartVersion: 0, EndVersion: 100},
+		{StartVersion: 100, EndVersion: 200},
+		{StartVersion: 200, EndVersion: 300},
+	}
+	c.Assert(checkBackupChain(metas), IsNil)
+
+	metas[2].StartVersion = 150
+	c.Assert(checkBackupChain(metas), ErrorMatches, ".*backup #2 of the chain starts at 150, but backup #1 ends at 200.*")
+
+	metas[2] = &backup.BackupMeta{StartVersion: 0, EndVersion: 300}
+	c.Assert(checkBackupChain(metas), ErrorMatches, ".*backup #2 of the chain isn't an incremental backup.*")
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/domain"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/tablecodec"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/restore"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const (
+	flagConflictPolicy = "conflict-policy"
+	flagForce          = "force"
+)
+
+// ConflictPolicy is what to do with the tables to restore which already
+// exist in the cluster and contain data.
+type ConflictPolicy string
+
+const (
+	// ConflictError refuses to restore.
+	ConflictError ConflictPolicy = "error"
+	// ConflictSkip skips restoring the tables.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictReplace drops the tables and restores them, each table is
+	// dropped right before it's created.
+	ConflictReplace ConflictPolicy = "replace"
+)
+
+func parseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(strings.ToLower(s)); p {
+	case ConflictError, ConflictSkip, ConflictReplace:
+		return p, nil
+	case "":
+		return ConflictError, nil
+	default:
+		return "", errors.Annotatef(berrors.ErrInvalidArgument,
+			"invalid --%s %s, must be one of error, skip and replace", flagConflictPolicy, s)
+	}
+}
+
+// findNonEmptyTables returns the tables to restore which already exist in
+// the cluster and contain data.
+func findNonEmptyTables(dom *domain.Domain, store kv.Storage, tables []*utils.Table) ([]*utils.Table, error) {
+	info := dom.InfoSchema()
+	txn, err := store.Begin()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer func() {
+		_ = txn.Rollback()
+	}()
+
+	nonEmpty := make([]*utils.Table, 0)
+	for _, table := range tables {
+		existing, err := info.TableByName(table.DB.Name, table.Info.Name)
+		if err != nil {
+			// The table doesn't exist.
+			continue
+		}
+		empty, err := isTableEmpty(txn, existing.Meta())
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			nonEmpty = append(nonEmpty, table)
+		}
+	}
+	return nonEmpty, nil
+}
+
+// filterResumedTables removes the tables having files ingested according to
+// the checkpoint from the tables, isIngested is usually IsFileIngested of the
+// restore client.
+func filterResumedTables(isIngested func(*backup.File) bool, tables []*utils.Table) []*utils.Table {
+	remain := tables[:0]
+	for _, table := range tables {
+		resumed := false
+		for _, file := range table.Files {
+			if isIngested(file) {
+				resumed = true
+				break
+			}
+		}
+		if !resumed {
+			remain = append(remain, table)
+		}
+	}
+	return remain
+}
+
+// isTableEmpty checks whether the table has any record, the partitions are
+// checked one by one.
+func isTableEmpty(txn kv.Transaction, tbl *model.TableInfo) (bool, error) {
+	physicalIDs := []int64{tbl.ID}
+	if pi := tbl.GetPartitionInfo(); pi != nil {
+		physicalIDs = physicalIDs[:0]
+		for _, def := range pi.Definitions {
+			physicalIDs = append(physicalIDs, def.ID)
+		}
+	}
+	for _, id := range physicalIDs {
+		prefix := tablecodec.GenTableRecordPrefix(id)
+		it, err := txn.Iter(prefix, prefix.PrefixNext())
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		valid := it.Valid()
+		it.Close()
+		if valid {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// resolveTableConflicts applies the conflict policy to the tables to restore
+// which already contain data, it returns the tables and files to restore,
+// and the tables to replace.
+func resolveTableConflicts(
+	policy ConflictPolicy,
+	conflicts []*utils.Table,
+	tables []*utils.Table,
+	files []*backup.File,
+) ([]*utils.Table, []*backup.File, []*utils.Table, error) {
+	if len(conflicts) == 0 {
+		return tables, files, nil, nil
+	}
+	names := make([]string, 0, len(conflicts))
+	for _, table := range conflicts {
+		names = append(names, fmt.Sprintf("%s.%s", table.DB.Name, table.Info.Name))
+	}
+
+	switch policy {
+	case ConflictSkip:
+		log.Warn("skip restoring the non-empty tables", zap.Strings("tables", names))
+		skipped := make(map[*utils.Table]struct{}, len(conflicts))
+		for _, table := range conflicts {
+			skipped[table] = struct{}{}
+		}
+		remainTables := make([]*utils.Table, 0, len(tables))
+		remainFiles := make([]*backup.File, 0, len(files))
+		for _, table := range tables {
+			if _, ok := skipped[table]; ok {
+				continue
+			}
+			remainTables = append(remainTables, table)
+			remainFiles = append(remainFiles, table.Files...)
+		}
+		return remainTables, remainFiles, nil, nil
+	case ConflictReplace:
+		// The tables are kept until they are created, so they are still
+		// there if the restore fails before.
+		log.Warn("replace the non-empty tables", zap.Strings("tables", names))
+		return tables, files, conflicts, nil
+	default:
+		return nil, nil, nil, errors.Annotatef(berrors.ErrRestoreTableNotEmpty,
+			"tables %s already contain data, use --%s to ingest into them anyway, or --%s skip|replace",
+			strings.Join(names, ", "), flagForce, flagConflictPolicy)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+)
+
+type testConflictSuite struct{}
+
+var _ = Suite(&testConflictSuite{})
+
+func (s *testConflictSuite) TestParseConflictPolicy(c *C) {
+	for in, expected := range map[string]ConflictPolicy{
+		"":        ConflictError,
+		"error":   ConflictError,
+		"Skip":    ConflictSkip,
+		"replace": ConflictReplace,
+	} {
+		policy, err := parseConflictPolicy(in)
+		c.Assert(err, IsNil)
+		c.Assert(policy, Equals, expected)
+	}
+	_, err := parseConflictPolicy("overwrite")
+	c.Assert(berrors.ErrInvalidArgument.Equal(errors.Cause(err)), IsTrue)
+}
+
+func (s *testConflictSuite) TestResolveTableConflicts(c *C) {
+	_, tables := mockDatabase("test", "t1", "t2")
+	tables[0].Files = []*backup.File{{Name: "1.sst"}}
+	tables[1].Files = []*backup.File{{Name: "2.sst"}, {Name: "3.sst"}}
+	files := append(append([]*backup.File{}, tables[0].Files...), tables[1].Files...)
+
+	remainTables, remainFiles, _, err := resolveTableConflicts(ConflictError, nil, tables, files)
+	c.Assert(err, IsNil)
+	c.Assert(remainTables, HasLen, 2)
+	c.Assert(remainFiles, HasLen, 3)
+
+	_, _, _, err = resolveTableConflicts(ConflictError, tables[1:], tables, files)
+	c.Assert(berrors.ErrRestoreTableNotEmpty.Equal(errors.Cause(err)), IsTrue)
+	c.Assert(err, ErrorMatches, ".*test.t2.*")
+
+	remainTables, remainFiles, _, err = resolveTableConflicts(ConflictSkip, tables[1:], tables, files)
+	c.Assert(err, IsNil)
+	c.Assert(remainTables, HasLen, 1)
+	c.Assert(remainTables[0].Info.Name.O, Equals, "t1")
+	c.Assert(remainFiles, DeepEquals, tables[0].Files)
+
+	// The tables to replace are dropped when they are created.
+	remainTables, remainFiles, replace, err := resolveTableConflicts(ConflictReplace, tables[1:], tables, files)
+	c.Assert(err, IsNil)
+	c.Assert(remainTables, HasLen, 2)
+	c.Assert(remainFiles, HasLen, 3)
+	c.Assert(replace, DeepEquals, tables[1:])
+}
+
+func (s *testConflictSuite) TestFilterResumedTables(c *C) {
+	_, tables := mockDatabase("test", "t1", "t2", "t3")
+	tables[0].Files = []*backup.File{{Name: "1.sst"}, {Name: "2.sst"}}
+	tables[1].Files = []*backup.File{{Name: "3.sst"}}
+	ingested := map[string]bool{"2.sst": true}
+	isIngested := func(f *backup.File) bool { return ingested[f.GetName()] }
+
+	// t1 is being restored by the interrupted run, t3 has no files.
+	remain := filterResumedTables(isIngested, tables)
+	c.Assert(remain, HasLen, 2)
+	c.Assert(remain[0].Info.Name.O, Equals, "t2")
+	c.Assert(remain[1].Info.Name.O, Equals, "t3")
+
+	c.Assert(filterResumedTables(func(*backup.File) bool { return false }, remain), HasLen, 2)
+}
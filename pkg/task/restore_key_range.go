@@ -0,0 +1,99 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"bytes"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/infoschema"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// DefineRestoreKeyRangeFlags defines the flags to restore a range of the keys
+// of a table, for the `table` subcommand.
+func DefineRestoreKeyRangeFlags(command *cobra.Command) {
+	command.Flags().String(flagKeyFormat, "hex", "start/end key format, support raw|escaped|hex")
+	command.Flags().String(flagStartKey, "", "only restore the keys of the restored table from the start key, "+
+		"inclusive, e.g. the start key of a corrupted region")
+	command.Flags().String(flagEndKey, "", "only restore the keys of the restored table before the end key, "+
+		"exclusive, e.g. the end key of a corrupted region")
+}
+
+// parseRestoreKeyRange parses the range of the keys to restore, the keys must
+// be in the same table.
+func parseRestoreKeyRange(flags *pflag.FlagSet) (startKey, endKey []byte, err error) {
+	if flags.Lookup(flagStartKey) == nil {
+		return nil, nil, nil
+	}
+	format, err := flags.GetString(flagKeyFormat)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	start, err := flags.GetString(flagStartKey)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	end, err := flags.GetString(flagEndKey)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	if start == "" && end == "" {
+		return nil, nil, nil
+	}
+	if start == "" || end == "" {
+		return nil, nil, errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s and --%s must be specified together", flagStartKey, flagEndKey)
+	}
+	if startKey, err = utils.ParseKey(format, start); err != nil {
+		return nil, nil, err
+	}
+	if endKey, err = utils.ParseKey(format, end); err != nil {
+		return nil, nil, err
+	}
+	if bytes.Compare(startKey, endKey) >= 0 {
+		return nil, nil, errors.Annotate(berrors.ErrRestoreInvalidRange, "end key must be greater than start key")
+	}
+	tableID := tablecodec.DecodeTableID(startKey)
+	if tableID == 0 {
+		return nil, nil, errors.Annotate(berrors.ErrRestoreInvalidRange, "start key isn't a key of a table")
+	}
+	// The end key of the last region of a table is the prefix of the next one.
+	if tablecodec.DecodeTableID(endKey) != tableID && !bytes.Equal(endKey, tablecodec.EncodeTablePrefix(tableID+1)) {
+		return nil, nil, errors.Annotatef(berrors.ErrRestoreInvalidRange, "the keys aren't in the same table %d", tableID)
+	}
+	return startKey, endKey, nil
+}
+
+// checkRestoreKeyRange checks the range of the keys is in the table to
+// restore, which must exist since only a part of its data is restored.
+func checkRestoreKeyRange(info infoschema.InfoSchema, tables []*utils.Table, startKey []byte) error {
+	if len(tables) != 1 {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s must be used to restore one table, but %d tables are restored", flagStartKey, len(tables))
+	}
+	table, err := info.TableByName(tables[0].DB.Name, tables[0].Info.Name)
+	if err != nil {
+		return errors.Annotatef(berrors.ErrRestoreSchemaNotExists,
+			"table %s.%s must exist to restore a range of its keys", tables[0].DB.Name, tables[0].Info.Name)
+	}
+	tableID := tablecodec.DecodeTableID(startKey)
+	physicalIDs := []int64{table.Meta().ID}
+	if pi := table.Meta().GetPartitionInfo(); pi != nil {
+		for _, def := range pi.Definitions {
+			physicalIDs = append(physicalIDs, def.ID)
+		}
+	}
+	for _, id := range physicalIDs {
+		if id == tableID {
+			return nil
+		}
+	}
+	return errors.Annotatef(berrors.ErrRestoreInvalidRange, "the keys of table %d aren't in table %s.%s",
+		tableID, tables[0].DB.Name, tables[0].Info.Name)
+}
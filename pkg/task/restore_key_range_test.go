@@ -0,0 +1,45 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"encoding/hex"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/spf13/cobra"
+)
+
+type testKeyRangeSuite struct{}
+
+var _ = Suite(&testKeyRangeSuite{})
+
+func (s *testKeyRangeSuite) TestParseRestoreKeyRange(c *C) {
+	command := &cobra.Command{}
+	DefineRestoreKeyRangeFlags(command)
+	flags := command.Flags()
+	startKey, endKey, err := parseRestoreKeyRange(flags)
+	c.Assert(err, IsNil)
+	c.Assert(startKey, IsNil)
+	c.Assert(endKey, IsNil)
+
+	start := []byte(tablecodec.EncodeRowKey(42, []byte("a")))
+	c.Assert(flags.Set(flagStartKey, hex.EncodeToString(start)), IsNil)
+	_, _, err = parseRestoreKeyRange(flags)
+	c.Assert(err, ErrorMatches, ".*must be specified together.*")
+
+	end := []byte(tablecodec.EncodeTablePrefix(43))
+	c.Assert(flags.Set(flagEndKey, hex.EncodeToString(end)), IsNil)
+	startKey, endKey, err = parseRestoreKeyRange(flags)
+	c.Assert(err, IsNil)
+	c.Assert(startKey, DeepEquals, start)
+	c.Assert(endKey, DeepEquals, end)
+
+	c.Assert(flags.Set(flagEndKey, hex.EncodeToString(tablecodec.EncodeTablePrefix(44))), IsNil)
+	_, _, err = parseRestoreKeyRange(flags)
+	c.Assert(err, ErrorMatches, ".*aren't in the same table.*")
+
+	c.Assert(flags.Set(flagStartKey, hex.EncodeToString([]byte("m"))), IsNil)
+	_, _, err = parseRestoreKeyRange(flags)
+	c.Assert(err, ErrorMatches, ".*isn't a key of a table.*")
+}
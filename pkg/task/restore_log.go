@@ -99,7 +99,8 @@ func RunLogRestore(c context.Context, g glue.Glue, cfg *LogRestoreConfig) error
 	ctx, cancel := context.WithCancel(c)
 	defer cancel()
 
-	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements)
+	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements,
+		cfg.GRPCDialOptions...)
 	if err != nil {
 		return err
 	}
@@ -116,6 +117,7 @@ func RunLogRestore(c context.Context, g glue.Glue, cfg *LogRestoreConfig) error
 		return err
 	}
 	defer client.Close()
+	client.SetDialOptions(mgr.GetDialOptions())
 
 	if err = client.SetStorage(ctx, u, false); err != nil {
 		return err
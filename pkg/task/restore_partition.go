@@ -0,0 +1,179 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/tablecodec"
+	"go.uber.org/zap"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const flagPartitionToTable = "partition-to-table"
+
+type partitionName struct {
+	tableName
+	partition string
+}
+
+// partitionRules are the rules of --partition-to-table, the keys are the
+// old names in lower case.
+type partitionRules map[partitionName]tableName
+
+// parsePartitionRules parses the rules in the form of
+// `db.table.partition:newdb.newtable`.
+func parsePartitionRules(rules []string) (partitionRules, error) {
+	r := make(partitionRules, len(rules))
+	for _, rule := range rules {
+		parts := strings.Split(rule, ":")
+		if len(parts) != 2 {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"invalid --%s %s, must be db.table.partition:newdb.newtable", flagPartitionToTable, rule)
+		}
+		from, to := strings.Split(parts[0], "."), strings.Split(parts[1], ".")
+		if len(from) != 3 || len(to) != 2 || from[0] == "" || from[1] == "" || from[2] == "" ||
+			to[0] == "" || to[1] == "" {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"invalid --%s %s, must be db.table.partition:newdb.newtable", flagPartitionToTable, rule)
+		}
+		if utils.IsSysDB(strings.ToLower(from[0])) || utils.IsSysDB(strings.ToLower(to[0])) {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"invalid --%s %s, the system tables aren't partitioned", flagPartitionToTable, rule)
+		}
+		if len(to[0]) > mysql.MaxDatabaseNameLength {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument, "the database name %s is too long", to[0])
+		}
+		if len(to[1]) > mysql.MaxTableNameLength {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument, "the table name %s is too long", to[1])
+		}
+		key := partitionName{
+			tableName: tableName{db: strings.ToLower(from[0]), table: strings.ToLower(from[1])},
+			partition: strings.ToLower(from[2]),
+		}
+		r[key] = tableName{db: to[0], table: to[1]}
+	}
+	return r, nil
+}
+
+// apply replaces the partitioned tables with the standalone tables of their
+// partitions, the other partitions of the tables aren't restored. The data of
+// a partition is rewritten from the ID of the partition to the new table.
+func (r partitionRules) apply(
+	dbs []*utils.Database,
+	tables []*utils.Table,
+) ([]*utils.Database, []*utils.Table, []*backup.File, error) {
+	dbByName := make(map[string]*utils.Database, len(dbs))
+	for _, db := range dbs {
+		dbByName[db.Info.Name.L] = db
+	}
+	replaced := make(map[*utils.Table]struct{})
+	newTables := make([]*utils.Table, 0, len(tables))
+	for _, table := range tables {
+		pi := table.Info.GetPartitionInfo()
+		if pi == nil {
+			continue
+		}
+		for _, def := range pi.Definitions {
+			key := partitionName{
+				tableName: tableName{db: table.DB.Name.L, table: table.Info.Name.L},
+				partition: def.Name.L,
+			}
+			to, ok := r[key]
+			if !ok {
+				continue
+			}
+			delete(r, key)
+			db, ok := dbByName[strings.ToLower(to.db)]
+			if !ok {
+				info := table.DB.Clone()
+				info.Name = model.NewCIStr(to.db)
+				info.Tables = nil
+				db = &utils.Database{Info: info}
+				dbByName[info.Name.L] = db
+				dbs = append(dbs, db)
+			}
+			newTables = append(newTables, partitionTable(table, def, db.Info, model.NewCIStr(to.table)))
+			replaced[table] = struct{}{}
+		}
+	}
+	for from := range r {
+		return nil, nil, nil, errors.Annotatef(berrors.ErrInvalidArgument,
+			"partition %s of table %s.%s of --%s isn't restored", from.partition, from.db, from.table,
+			flagPartitionToTable)
+	}
+
+	kept := make([]*utils.Table, 0, len(tables))
+	files := make([]*backup.File, 0)
+	names := make(map[tableName]struct{}, len(tables))
+	for _, table := range tables {
+		if _, ok := replaced[table]; !ok {
+			kept = append(kept, table)
+		}
+	}
+	kept = append(kept, newTables...)
+	for _, table := range kept {
+		name := tableName{db: table.DB.Name.L, table: table.Info.Name.L}
+		if _, ok := names[name]; ok {
+			return nil, nil, nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"multiple tables are restored as %s.%s", table.DB.Name, table.Info.Name)
+		}
+		names[name] = struct{}{}
+		files = append(files, table.Files...)
+	}
+
+	// Remove the databases without any table left, unless they are empty in
+	// the backup.
+	keptDBs := dbs[:0]
+	for _, db := range dbs {
+		used := len(db.Tables) == 0
+		for _, table := range kept {
+			if table.DB.Name.L == db.Info.Name.L {
+				used = true
+				break
+			}
+		}
+		if used {
+			keptDBs = append(keptDBs, db)
+		}
+	}
+	return keptDBs, kept, files, nil
+}
+
+// partitionTable makes the standalone table of a partition of the table.
+func partitionTable(table *utils.Table, def model.PartitionDefinition, db *model.DBInfo, name model.CIStr) *utils.Table {
+	log.Info("restore partition as table", zap.Stringer("db", table.DB.Name), zap.Stringer("table", table.Info.Name),
+		zap.Stringer("partition", def.Name), zap.Stringer("to db", db.Name), zap.Stringer("to", name))
+	info := table.Info.Clone()
+	info.ID = def.ID
+	info.Name = name
+	info.Partition = nil
+
+	newTable := &utils.Table{
+		DB:              db,
+		Info:            info,
+		TiFlashReplicas: table.TiFlashReplicas,
+	}
+	for _, file := range table.Files {
+		if tablecodec.DecodeTableID(file.GetStartKey()) == def.ID {
+			newTable.Files = append(newTable.Files, file)
+		}
+	}
+	// The checksum of the table covers all partitions, so the one of the
+	// partition is calculated from its files.
+	if !table.NoChecksum() {
+		for _, file := range newTable.Files {
+			newTable.Crc64Xor ^= file.Crc64Xor
+			newTable.TotalKvs += file.TotalKvs
+			newTable.TotalBytes += file.TotalBytes
+		}
+	}
+	return newTable
+}
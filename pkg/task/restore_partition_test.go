@@ -0,0 +1,79 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/parser/model"
+
+	"github.com/pingcap/br/pkg/utils"
+)
+
+type testPartitionSuite struct{}
+
+var _ = Suite(&testPartitionSuite{})
+
+func (s *testPartitionSuite) TestParsePartitionRules(c *C) {
+	rules, err := parsePartitionRules([]string{"Prod.Orders.P2020:archive.orders_2020"})
+	c.Assert(err, IsNil)
+	c.Assert(rules, DeepEquals, partitionRules{
+		{tableName: tableName{db: "prod", table: "orders"}, partition: "p2020"}: {db: "archive", table: "orders_2020"},
+	})
+
+	for _, rule := range []string{"prod.orders:archive.orders", "prod.orders.p0:archive", "prod.orders.:a.b",
+		"prod.orders.p0", "mysql.user.p0:a.b"} {
+		_, err = parsePartitionRules([]string{rule})
+		c.Assert(err, ErrorMatches, ".*invalid.*", Commentf("%s", rule))
+	}
+}
+
+func (s *testPartitionSuite) TestApplyPartitionRules(c *C) {
+	prod, tables := mockDatabase("prod", "orders", "users")
+	orders := tables[0]
+	orders.Info.ID = 10
+	orders.Info.Partition = &model.PartitionInfo{Definitions: []model.PartitionDefinition{
+		{ID: 11, Name: model.NewCIStr("p0")},
+		{ID: 12, Name: model.NewCIStr("p1")},
+	}}
+	orders.Crc64Xor, orders.TotalKvs, orders.TotalBytes = 3, 3, 3
+	orders.Files = []*backup.File{
+		mockTableFile("11_write.sst", 11, 10),
+		mockTableFile("12_write.sst", 12, 10),
+		mockTableFile("12_default.sst", 12, 10),
+	}
+	orders.Files[1].Crc64Xor, orders.Files[2].Crc64Xor = 1, 2
+	tables[1].Files = []*backup.File{mockTableFile("20_write.sst", 20, 10)}
+
+	rules, err := parsePartitionRules([]string{"prod.orders.p1:archive.orders_p1"})
+	c.Assert(err, IsNil)
+	dbs, restored, files, err := rules.apply([]*utils.Database{prod}, tables)
+	c.Assert(err, IsNil)
+	c.Assert(dbs, HasLen, 2)
+	c.Assert(dbs[1].Info.Name.O, Equals, "archive")
+	c.Assert(restored, HasLen, 2)
+	c.Assert(restored[0], Equals, tables[1])
+
+	p1 := restored[1]
+	c.Assert(p1.DB, Equals, dbs[1].Info)
+	c.Assert(p1.Info.Name.O, Equals, "orders_p1")
+	c.Assert(p1.Info.ID, Equals, int64(12))
+	c.Assert(p1.Info.Partition, IsNil)
+	c.Assert(p1.Files, DeepEquals, orders.Files[1:])
+	c.Assert(p1.Crc64Xor, Equals, uint64(3))
+	c.Assert(p1.TotalKvs, Equals, uint64(20))
+	c.Assert(files, DeepEquals, []*backup.File{tables[1].Files[0], orders.Files[1], orders.Files[2]})
+	// The partitioned table is untouched.
+	c.Assert(orders.Info.Name.O, Equals, "orders")
+	c.Assert(orders.Info.Partition, NotNil)
+
+	rules, err = parsePartitionRules([]string{"prod.orders.p2:archive.orders_p2"})
+	c.Assert(err, IsNil)
+	_, _, _, err = rules.apply([]*utils.Database{prod}, tables)
+	c.Assert(err, ErrorMatches, ".*isn't restored.*")
+
+	rules, err = parsePartitionRules([]string{"prod.orders.p0:prod.users"})
+	c.Assert(err, IsNil)
+	_, _, _, err = rules.apply([]*utils.Database{prod}, tables)
+	c.Assert(err, ErrorMatches, ".*multiple tables.*")
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/domain"
+	"github.com/pingcap/tidb/kv"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/backup"
+	"github.com/pingcap/br/pkg/metautil"
+	"github.com/pingcap/br/pkg/restore"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/summary"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const (
+	flagDryRun = "dry-run"
+
+	// planRegionSize is the size of the regions assumed by the plan, it's
+	// the default region-max-size of TiKV.
+	planRegionSize = 96 * 1024 * 1024
+)
+
+// tablePlan is how a table in the backup is going to be restored.
+type tablePlan struct {
+	Name    string
+	Exists  bool
+	OldID   int64
+	NewID   int64
+	Files   int
+	Ranges  int
+	Size    uint64
+	KVs     uint64
+	Regions int
+}
+
+// restorePlan is what the restore is going to do, estimated without
+// touching the cluster.
+type restorePlan struct {
+	Tables  []tablePlan
+	Files   int
+	Ranges  int
+	Size    uint64
+	KVs     uint64
+	Regions int
+}
+
+// buildRestorePlan computes the rewrite rules and the ranges to split of the
+// tables. The existing tables are rewritten to their IDs, the ones to create
+// don't have IDs yet, so their ranges are computed with the IDs in the backup.
+func buildRestorePlan(info func(db, table model.CIStr) *model.TableInfo, tables []*utils.Table) (*restorePlan, error) {
+	plan := &restorePlan{Tables: make([]tablePlan, 0, len(tables))}
+	for _, table := range tables {
+		tp := tablePlan{
+			Name:  utils.EncloseName(table.DB.Name.O) + "." + utils.EncloseName(table.Info.Name.O),
+			OldID: table.Info.ID,
+			Files: len(table.Files),
+		}
+		newTable := info(table.DB.Name, table.Info.Name)
+		if newTable != nil {
+			tp.Exists = true
+			tp.NewID = newTable.ID
+			if err := restore.CheckPartitions(newTable, table.Info); err != nil {
+				return nil, errors.Annotatef(err, "table %s", tp.Name)
+			}
+		} else {
+			newTable = table.Info
+		}
+		rules := restore.GetRewriteRules(newTable, table.Info, 0)
+		ranges, err := restore.ValidateFileRanges(table.Files, rules)
+		if err != nil {
+			return nil, errors.Annotatef(err, "table %s", tp.Name)
+		}
+		tp.Ranges = len(ranges)
+		for _, f := range table.Files {
+			tp.Size += fileSize(f)
+			tp.KVs += f.TotalKvs
+		}
+		tp.Regions = estimateRegions(tp.Ranges, tp.Size)
+
+		plan.Tables = append(plan.Tables, tp)
+		plan.Files += tp.Files
+		plan.Ranges += tp.Ranges
+		plan.Size += tp.Size
+		plan.KVs += tp.KVs
+		plan.Regions += tp.Regions
+	}
+	return plan, nil
+}
+
+// fileSize returns the size of the file in the storage, or the size of its
+// KV pairs if it's backed up by an old TiKV not reporting the size.
+func fileSize(f *kvproto.File) uint64 {
+	if f.Size_ != 0 {
+		return f.Size_
+	}
+	return f.TotalBytes
+}
+
+// estimateRegions estimates the regions of the restored data, every range
+// is split into a region at least.
+func estimateRegions(ranges int, size uint64) int {
+	regions := int((size + planRegionSize - 1) / planRegionSize)
+	if regions < ranges {
+		return ranges
+	}
+	return regions
+}
+
+// runRestorePlan validates the backup and prints the plan of restoring the
+// tables, without creating anything or writing any data.
+func runRestorePlan(
+	ctx context.Context,
+	dom *domain.Domain,
+	store kv.Storage,
+	u *kvproto.StorageBackend,
+	s storage.ExternalStorage,
+	reader *metautil.MetaReader,
+	tables []*utils.Table,
+) error {
+	// The files of a local storage are spread over the TiKV nodes.
+	if u.GetLocal() == nil && u.GetNoop() == nil {
+		summary.SetPhase(phaseVerifyFiles)
+		if err := backup.CheckStorageFiles(ctx, s, reader); err != nil {
+			return err
+		}
+	}
+
+	infoSchema := dom.InfoSchema()
+	plan, err := buildRestorePlan(func(db, table model.CIStr) *model.TableInfo {
+		t, err := infoSchema.TableByName(db, table)
+		if err != nil {
+			return nil
+		}
+		return t.Meta()
+	}, tables)
+	if err != nil {
+		return err
+	}
+	nonEmpty, err := findNonEmptyTables(dom, store, tables)
+	if err != nil {
+		return err
+	}
+
+	for _, tp := range plan.Tables {
+		log.Info("restore plan of table", zap.String("table", tp.Name), zap.Bool("exists", tp.Exists),
+			zap.Int64("old id", tp.OldID), zap.Int64("new id", tp.NewID), zap.Int("files", tp.Files),
+			zap.Int("ranges", tp.Ranges), zap.Uint64("size", tp.Size), zap.Uint64("kvs", tp.KVs),
+			zap.Int("regions", tp.Regions))
+	}
+	for _, table := range nonEmpty {
+		log.Warn("the table to restore already contains data", zap.Stringer("db", table.DB.Name),
+			zap.Stringer("table", table.Info.Name))
+	}
+	summary.CollectInt("tables", len(plan.Tables))
+	summary.CollectInt("non-empty tables", len(nonEmpty))
+	summary.CollectInt("files", plan.Files)
+	summary.CollectInt("split ranges", plan.Ranges)
+	summary.CollectInt("estimated regions", plan.Regions)
+	summary.CollectUint("ingest size", plan.Size)
+	summary.CollectUint("ingest kvs", plan.KVs)
+	summary.SetSuccessStatus(true)
+	return nil
+}
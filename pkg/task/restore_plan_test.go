@@ -0,0 +1,66 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb/tablecodec"
+)
+
+type testRestorePlanSuite struct{}
+
+var _ = Suite(&testRestorePlanSuite{})
+
+func mockTableFile(name string, tableID int64, size uint64) *backup.File {
+	return &backup.File{
+		Name:     name,
+		StartKey: tablecodec.EncodeRowKey(tableID, []byte("a")),
+		EndKey:   tablecodec.EncodeRowKey(tableID, []byte("z")),
+		Size_:    size,
+		TotalKvs: 10,
+	}
+}
+
+func (s *testRestorePlanSuite) TestEstimateRegions(c *C) {
+	c.Assert(estimateRegions(0, 0), Equals, 0)
+	c.Assert(estimateRegions(3, 1), Equals, 3)
+	c.Assert(estimateRegions(1, planRegionSize), Equals, 1)
+	c.Assert(estimateRegions(1, planRegionSize+1), Equals, 2)
+}
+
+func (s *testRestorePlanSuite) TestBuildRestorePlan(c *C) {
+	_, tables := mockDatabase("test", "t1", "t2")
+	tables[0].Info.ID = 10
+	tables[0].Files = []*backup.File{
+		mockTableFile("1_write.sst", 10, planRegionSize),
+		mockTableFile("1_default.sst", 10, planRegionSize),
+	}
+	tables[1].Info.ID = 20
+	tables[1].Files = []*backup.File{
+		mockTableFile("2_write.sst", 20, 0),
+	}
+	tables[1].Files[0].TotalBytes = 100
+
+	existing := map[string]*model.TableInfo{"t2": {ID: 30, Name: model.NewCIStr("t2")}}
+	plan, err := buildRestorePlan(func(_, table model.CIStr) *model.TableInfo {
+		return existing[table.L]
+	}, tables)
+	c.Assert(err, IsNil)
+	c.Assert(plan.Tables, DeepEquals, []tablePlan{
+		{Name: "`test`.`t1`", OldID: 10, Files: 2, Ranges: 1, Size: 2 * planRegionSize, KVs: 20, Regions: 2},
+		{Name: "`test`.`t2`", Exists: true, OldID: 20, NewID: 30, Files: 1, Ranges: 1, Size: 100, KVs: 10, Regions: 1},
+	})
+	c.Assert(plan.Files, Equals, 3)
+	c.Assert(plan.Ranges, Equals, 2)
+	c.Assert(plan.Size, Equals, uint64(2*planRegionSize+100))
+	c.Assert(plan.Regions, Equals, 3)
+
+	// The file doesn't belong to the table.
+	tables[1].Files = append(tables[1].Files, mockTableFile("3_write.sst", 40, 0))
+	_, err = buildRestorePlan(func(_, table model.CIStr) *model.TableInfo {
+		return existing[table.L]
+	}, tables)
+	c.Assert(err, ErrorMatches, ".*cannot find rewrite rule.*")
+}
@@ -3,16 +3,21 @@
 package task
 
 import (
+	"bytes"
 	"context"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/kv"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"go.uber.org/zap"
 
 	berrors "github.com/pingcap/br/pkg/errors"
 	"github.com/pingcap/br/pkg/glue"
+	"github.com/pingcap/br/pkg/logutil"
 	"github.com/pingcap/br/pkg/restore"
+	"github.com/pingcap/br/pkg/rtree"
 	"github.com/pingcap/br/pkg/summary"
 	"github.com/pingcap/br/pkg/utils"
 )
@@ -22,6 +27,11 @@ type RestoreRawConfig struct {
 	RawKvConfig
 
 	Online bool `json:"online" toml:"online"`
+	// AllowSameCluster allows restoring a backup into the cluster it was taken from.
+	AllowSameCluster bool `json:"allow-same-cluster" toml:"allow-same-cluster"`
+	// RateLimitAfterRestore is the download speed limit of the stores set
+	// after the restore limited by RateLimit, zero means unlimited.
+	RateLimitAfterRestore uint64 `json:"ratelimit-after-restore" toml:"ratelimit-after-restore"`
 }
 
 // DefineRawRestoreFlags defines common flags for the backup command.
@@ -43,6 +53,13 @@ func (cfg *RestoreRawConfig) ParseFromFlags(flags *pflag.FlagSet) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	cfg.AllowSameCluster, err = flags.GetBool(flagAllowSameCluster)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.RateLimitAfterRestore, err = parseRateLimitAfterRestore(flags); err != nil {
+		return errors.Trace(err)
+	}
 	return cfg.RawKvConfig.ParseFromFlags(flags)
 }
 
@@ -59,14 +76,22 @@ func RunRestoreRaw(c context.Context, g glue.Glue, cmdName string, cfg *RestoreR
 	cfg.adjust()
 
 	defer summary.Summary(cmdName)
+	summary.SetPhase(phasePrepare)
 	ctx, cancel := context.WithCancel(c)
 	defer cancel()
 
-	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements)
+	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements,
+		cfg.GRPCDialOptions...)
 	if err != nil {
 		return err
 	}
 	defer mgr.Close()
+	cfg.keepDiscoveringPD(ctx, mgr)
+	unregister, err := registerTask(ctx, g, cfg.PD, mgr.GetTLSConfig(), cmdName, cfg.ForceConcurrent)
+	if err != nil {
+		return err
+	}
+	defer unregister()
 
 	keepaliveCfg := GetKeepalive(&cfg.Config)
 	// sometimes we have pooled the connections.
@@ -77,6 +102,7 @@ func RunRestoreRaw(c context.Context, g glue.Glue, cmdName string, cfg *RestoreR
 		return err
 	}
 	defer client.Close()
+	client.SetDialOptions(mgr.GetDialOptions())
 	client.SetRateLimit(cfg.RateLimit)
 	client.SetConcurrency(uint(cfg.Concurrency))
 	if cfg.Online {
@@ -84,18 +110,31 @@ func RunRestoreRaw(c context.Context, g glue.Glue, cmdName string, cfg *RestoreR
 	}
 	client.SetSwitchModeInterval(cfg.SwitchModeInterval)
 
-	u, _, backupMeta, err := ReadBackupMeta(ctx, utils.MetaFile, &cfg.Config)
+	u, _, reader, err := OpenBackupMeta(ctx, utils.MetaFile, &cfg.Config)
 	if err != nil {
 		return err
 	}
-	g.Record("Size", utils.ArchiveSize(backupMeta))
-	if err = client.InitBackupMeta(backupMeta, u); err != nil {
+	archiveSize, err := reader.ArchiveSize(ctx)
+	if err != nil {
+		return err
+	}
+	g.Record("Size", archiveSize)
+	// Restoring through SQL (BRIE) is explicit enough, only check it in binary.
+	if g.OwnsStorage() && !cfg.AllowSameCluster {
+		if err = checkSameCluster(ctx, mgr.GetPDClient(), reader.Meta()); err != nil {
+			return err
+		}
+	}
+	if err = client.InitBackupMetaReader(ctx, reader, u); err != nil {
 		return err
 	}
 
 	if !client.IsRawKvMode() {
 		return errors.Annotate(berrors.ErrRestoreModeMismatch, "cannot do raw restore from transactional data")
 	}
+	if err = checkRawKVCompatible(mgr.GetTiKV(), cfg.StartKey, cfg.EndKey); err != nil {
+		return err
+	}
 
 	files, err := client.GetFilesInRawRange(cfg.StartKey, cfg.EndKey, cfg.CF)
 	if err != nil {
@@ -122,6 +161,7 @@ func RunRestoreRaw(c context.Context, g glue.Glue, cmdName string, cfg *RestoreR
 		int64(len(ranges)+len(files)),
 		!cfg.LogProgress)
 
+	summary.SetPhase(phaseRestoreFiles)
 	err = restore.SplitRanges(ctx, client, ranges, nil, updateCh)
 	if err != nil {
 		return errors.Trace(err)
@@ -131,7 +171,7 @@ func RunRestoreRaw(c context.Context, g glue.Glue, cmdName string, cfg *RestoreR
 	if err != nil {
 		return errors.Trace(err)
 	}
-	defer restorePostWork(ctx, client, restoreSchedulers)
+	defer restorePostWork(ctx, client, restoreSchedulers, cfg.RateLimitAfterRestore)
 
 	err = client.RestoreRaw(ctx, cfg.StartKey, cfg.EndKey, files, updateCh)
 	if err != nil {
@@ -145,3 +185,56 @@ func RunRestoreRaw(c context.Context, g glue.Glue, cmdName string, cfg *RestoreR
 	summary.SetSuccessStatus(true)
 	return nil
 }
+
+// tidbKeySpaces are the key spaces of TiDB, i.e. its meta and tables.
+var tidbKeySpaces = []rtree.Range{
+	{StartKey: []byte("m"), EndKey: []byte("n")},
+	{StartKey: []byte("t"), EndKey: []byte("u")},
+}
+
+// overlapTiDBKeySpace returns the key space of TiDB the raw range overlaps,
+// or nil if there is none.
+func overlapTiDBKeySpace(startKey, endKey []byte) *rtree.Range {
+	for i := range tidbKeySpaces {
+		space := &tidbKeySpaces[i]
+		if bytes.Compare(startKey, space.EndKey) < 0 &&
+			(len(endKey) == 0 || bytes.Compare(endKey, space.StartKey) > 0) {
+			return space
+		}
+	}
+	return nil
+}
+
+// checkRawKVCompatible checks the cluster can take the raw kv pairs of the
+// range. The raw kv pairs are ingested into the same column families as the
+// data of TiDB, so the range must not overlap its key spaces if the cluster
+// is used by TiDB.
+func checkRawKVCompatible(store kv.Storage, startKey, endKey []byte) error {
+	space := overlapTiDBKeySpace(startKey, endKey)
+	if space == nil {
+		return nil
+	}
+	txn, err := store.Begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer func() {
+		_ = txn.Rollback()
+	}()
+	// TiDB saves its meta under the prefix "m".
+	it, err := txn.Iter(kv.Key("m"), kv.Key("n"))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer it.Close()
+	if !it.Valid() {
+		log.Info("no TiDB meta found, the cluster is used by raw kv only")
+		return nil
+	}
+	log.Error("the raw range overlaps the key space of TiDB",
+		zap.Stringer("startKey", logutil.WrapKey(startKey)), zap.Stringer("endKey", logutil.WrapKey(endKey)))
+	return errors.Annotatef(berrors.ErrRestoreModeMismatch,
+		"the cluster is used by TiDB, the raw range [%s, %s) overlaps its key space [%s, %s)",
+		logutil.WrapKey(startKey), logutil.WrapKey(endKey),
+		logutil.WrapKey(space.StartKey), logutil.WrapKey(space.EndKey))
+}
@@ -0,0 +1,23 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	. "github.com/pingcap/check"
+)
+
+type testRestoreRawSuite struct{}
+
+var _ = Suite(&testRestoreRawSuite{})
+
+func (s *testRestoreRawSuite) TestOverlapTiDBKeySpace(c *C) {
+	c.Assert(overlapTiDBKeySpace([]byte("a"), []byte("b")), IsNil)
+	c.Assert(overlapTiDBKeySpace([]byte("n"), []byte("t")), IsNil)
+	c.Assert(overlapTiDBKeySpace([]byte("u"), []byte("")), IsNil)
+	space := overlapTiDBKeySpace([]byte("a"), []byte("m\x00"))
+	c.Assert(space, NotNil)
+	c.Assert(space.StartKey, DeepEquals, []byte("m"))
+	space = overlapTiDBKeySpace([]byte("t\xff"), []byte(""))
+	c.Assert(space, NotNil)
+	c.Assert(space.StartKey, DeepEquals, []byte("t"))
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/restore"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+type tableName struct {
+	db    string
+	table string
+}
+
+// renameRules are the rules of --rename, the keys are the old names in
+// lower case.
+type renameRules struct {
+	dbs    map[string]model.CIStr
+	tables map[tableName]tableName
+}
+
+// parseRenameRules parses the rules in the form of `olddb:newdb` or
+// `olddb.oldtable:newdb.newtable`.
+func parseRenameRules(rules []string) (*renameRules, error) {
+	r := &renameRules{
+		dbs:    make(map[string]model.CIStr),
+		tables: make(map[tableName]tableName),
+	}
+	for _, rule := range rules {
+		parts := strings.Split(rule, ":")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"invalid --%s %s, must be old:new", flagRename, rule)
+		}
+		from, to := strings.SplitN(parts[0], ".", 2), strings.SplitN(parts[1], ".", 2)
+		if len(from) != len(to) || from[0] == "" || to[0] == "" {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"invalid --%s %s, must be olddb:newdb or olddb.oldtable:newdb.newtable", flagRename, rule)
+		}
+		if utils.IsSysDB(strings.ToLower(from[0])) || utils.IsSysDB(strings.ToLower(to[0])) {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"invalid --%s %s, the system tables can't be renamed", flagRename, rule)
+		}
+		if len(to[0]) > mysql.MaxDatabaseNameLength {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument, "the database name %s is too long", to[0])
+		}
+		if len(from) == 1 {
+			r.dbs[strings.ToLower(from[0])] = model.NewCIStr(to[0])
+			continue
+		}
+		if from[1] == "" || to[1] == "" {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument, "invalid --%s %s, empty table name", flagRename, rule)
+		}
+		if len(to[1]) > mysql.MaxTableNameLength {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument, "the table name %s is too long", to[1])
+		}
+		r.tables[tableName{db: strings.ToLower(from[0]), table: strings.ToLower(from[1])}] =
+			tableName{db: to[0], table: to[1]}
+	}
+	return r, nil
+}
+
+// apply renames the databases and tables to restore, the rules of tables
+// override the ones of their databases. The databases the tables are moved
+// to are added, and the ones all tables are moved out of are removed.
+func (r *renameRules) apply(dbs []*utils.Database, tables []*utils.Table) ([]*utils.Database, error) {
+	// The rules refer to the old names, so find the tables to rename first.
+	movedTables := make(map[*utils.Table]tableName)
+	for _, table := range tables {
+		key := tableName{db: table.DB.Name.L, table: table.Info.Name.L}
+		if to, ok := r.tables[key]; ok {
+			movedTables[table] = to
+			delete(r.tables, key)
+		}
+	}
+	for from := range r.tables {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+			"table %s.%s of --%s isn't restored", from.db, from.table, flagRename)
+	}
+	for _, db := range dbs {
+		if name, ok := r.dbs[db.Info.Name.L]; ok {
+			restore.RenameDatabase(db, name)
+		}
+	}
+
+	dbByName := make(map[string]*utils.Database, len(dbs))
+	for _, db := range dbs {
+		if _, ok := dbByName[db.Info.Name.L]; ok {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"multiple databases are renamed to %s", db.Info.Name)
+		}
+		dbByName[db.Info.Name.L] = db
+	}
+	for table, to := range movedTables {
+		db, ok := dbByName[strings.ToLower(to.db)]
+		if !ok {
+			info := table.DB.Clone()
+			info.Name = model.NewCIStr(to.db)
+			info.Tables = nil
+			db = &utils.Database{Info: info}
+			dbByName[info.Name.L] = db
+			dbs = append(dbs, db)
+		}
+		restore.RenameTable(table, db.Info, model.NewCIStr(to.table))
+	}
+
+	// Remove the databases without any table left, unless they are empty in
+	// the backup.
+	names := make(map[tableName]struct{}, len(tables))
+	used := make(map[string]struct{}, len(dbs))
+	for _, table := range tables {
+		name := tableName{db: table.DB.Name.L, table: table.Info.Name.L}
+		if _, ok := names[name]; ok {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"multiple tables are renamed to %s.%s", table.DB.Name, table.Info.Name)
+		}
+		names[name] = struct{}{}
+		used[name.db] = struct{}{}
+	}
+	kept := dbs[:0]
+	for _, db := range dbs {
+		if _, ok := used[db.Info.Name.L]; ok || len(db.Tables) == 0 {
+			kept = append(kept, db)
+		}
+	}
+	return kept, nil
+}
+
+// renameRestoredDatabases restores the system databases into the temporary
+// databases, and adds the prefix and the suffix to the names of the others.
+func renameRestoredDatabases(dbs []*utils.Database, prefix, suffix string) error {
+	for _, db := range dbs {
+		if utils.IsSysDB(db.Info.Name.L) {
+			restore.RedirectSysDB(db)
+			continue
+		}
+		if prefix == "" && suffix == "" {
+			continue
+		}
+		name := model.NewCIStr(prefix + db.Info.Name.O + suffix)
+		// The length of the names is limited in characters, not bytes.
+		if utf8.RuneCountInString(name.O) > mysql.MaxDatabaseNameLength {
+			return errors.Annotatef(berrors.ErrInvalidArgument,
+				"the name of the restored database %s is too long", name)
+		}
+		restore.RenameDatabase(db, name)
+	}
+	return nil
+}
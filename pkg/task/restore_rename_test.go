@@ -0,0 +1,110 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"strings"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/statistics/handle"
+
+	"github.com/pingcap/br/pkg/restore"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+type testRenameSuite struct{}
+
+var _ = Suite(&testRenameSuite{})
+
+func mockDatabase(name string, tables ...string) (*utils.Database, []*utils.Table) {
+	db := &utils.Database{Info: &model.DBInfo{Name: model.NewCIStr(name)}}
+	for _, t := range tables {
+		db.Tables = append(db.Tables, &utils.Table{
+			DB:    &model.DBInfo{Name: model.NewCIStr(name)},
+			Info:  &model.TableInfo{Name: model.NewCIStr(t)},
+			Stats: &handle.JSONTable{DatabaseName: name, TableName: t},
+		})
+	}
+	return db, db.Tables
+}
+
+func (s *testRenameSuite) TestParseRenameRules(c *C) {
+	rules, err := parseRenameRules([]string{"prod:staging", "Prod.Users:staging.users_old"})
+	c.Assert(err, IsNil)
+	c.Assert(rules.dbs["prod"].O, Equals, "staging")
+	c.Assert(rules.tables[tableName{db: "prod", table: "users"}], Equals, tableName{db: "staging", table: "users_old"})
+
+	for _, rule := range []string{"prod", "prod:", "prod.t:staging", "prod.:staging.", "mysql:mysql2"} {
+		_, err = parseRenameRules([]string{rule})
+		c.Assert(err, ErrorMatches, ".*invalid.*", Commentf("%s", rule))
+	}
+}
+
+func (s *testRenameSuite) TestApplyRenameRules(c *C) {
+	prod, prodTables := mockDatabase("prod", "users", "orders")
+	logs, logTables := mockDatabase("logs", "access")
+	dbs := []*utils.Database{prod, logs}
+	tables := append(prodTables, logTables...)
+
+	rules, err := parseRenameRules([]string{"prod:staging", "prod.users:archive.users_old", "logs.access:staging.access"})
+	c.Assert(err, IsNil)
+	dbs, err = rules.apply(dbs, tables)
+	c.Assert(err, IsNil)
+	// logs has no table left.
+	c.Assert(dbs, HasLen, 2)
+	c.Assert(dbs[0].Info.Name.O, Equals, "staging")
+	c.Assert(dbs[1].Info.Name.O, Equals, "archive")
+
+	c.Assert(tables[0].DB.Name.O, Equals, "archive")
+	c.Assert(tables[0].Info.Name.O, Equals, "users_old")
+	c.Assert(tables[0].Stats.DatabaseName, Equals, "archive")
+	c.Assert(tables[0].Stats.TableName, Equals, "users_old")
+	c.Assert(tables[1].DB.Name.O, Equals, "staging")
+	c.Assert(tables[1].Stats.DatabaseName, Equals, "staging")
+	c.Assert(tables[2].DB.Name.O, Equals, "staging")
+	c.Assert(tables[2].Info.Name.O, Equals, "access")
+
+	prod, prodTables = mockDatabase("prod", "users")
+	rules, err = parseRenameRules([]string{"prod.orders:staging.orders"})
+	c.Assert(err, IsNil)
+	_, err = rules.apply([]*utils.Database{prod}, prodTables)
+	c.Assert(err, ErrorMatches, ".*table prod.orders of --rename isn't restored.*")
+}
+
+func (s *testRenameSuite) TestFindMissingDatabases(c *C) {
+	prod, _ := mockDatabase("prod", "users")
+	staging, _ := mockDatabase("staging", "users")
+	sys, _ := mockDatabase(mysql.SystemDB, "user")
+	restore.RedirectSysDB(sys)
+	existing := map[string]bool{"prod": true}
+	missing := findMissingDatabases(func(name model.CIStr) bool {
+		return existing[name.L]
+	}, []*utils.Database{prod, staging, sys})
+	c.Assert(missing, DeepEquals, []*utils.Database{staging})
+}
+
+func (s *testRenameSuite) TestRenameRestoredDatabases(c *C) {
+	prod, prodTables := mockDatabase("prod", "users")
+	sys, _ := mockDatabase(mysql.SystemDB, "user")
+	c.Assert(renameRestoredDatabases([]*utils.Database{prod, sys}, "dr_", "_restored"), IsNil)
+	c.Assert(prod.Info.Name.O, Equals, "dr_prod_restored")
+	c.Assert(prodTables[0].DB.Name.O, Equals, "dr_prod_restored")
+	c.Assert(prodTables[0].Stats.DatabaseName, Equals, "dr_prod_restored")
+	// The system databases are restored into the temporary databases.
+	c.Assert(sys.Info.Name, Equals, utils.TemporaryDBName(mysql.SystemDB))
+
+	// The names aren't changed without the prefix and the suffix.
+	prod, _ = mockDatabase("prod", "users")
+	c.Assert(renameRestoredDatabases([]*utils.Database{prod}, "", ""), IsNil)
+	c.Assert(prod.Info.Name.O, Equals, "prod")
+
+	// The length of the names is counted in characters.
+	name := strings.Repeat("数", mysql.MaxDatabaseNameLength-2)
+	db, _ := mockDatabase(name, "t")
+	c.Assert(renameRestoredDatabases([]*utils.Database{db}, "", "_r"), IsNil)
+	c.Assert(db.Info.Name.O, Equals, name+"_r")
+	db, _ = mockDatabase(name, "t")
+	c.Assert(renameRestoredDatabases([]*utils.Database{db}, "", "_rr"), ErrorMatches, ".*is too long.*")
+}
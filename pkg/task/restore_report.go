@@ -0,0 +1,104 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/restore"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/summary"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const flagSaveReport = "save-report"
+
+// tableReport is the data restored of a table.
+type tableReport struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Size  uint64 `json:"size"`
+	KVs   uint64 `json:"kvs"`
+}
+
+// restoreReport is the summary of a restore to diagnose the slow restores,
+// the durations of the steps are in milliseconds.
+type restoreReport struct {
+	Tables         []tableReport                `json:"tables"`
+	Steps          map[string]restore.StepStats `json:"steps"`
+	SlowestRegions []restore.TimelineEvent      `json:"slowest-regions"`
+}
+
+func buildRestoreReport(tables []*utils.Table, timeline *restore.RegionTimeline) *restoreReport {
+	report := &restoreReport{
+		Tables:         make([]tableReport, 0, len(tables)),
+		Steps:          timeline.Steps(),
+		SlowestRegions: timeline.Slowest(),
+	}
+	for _, table := range tables {
+		t := tableReport{
+			Name:  utils.EncloseName(table.DB.Name.O) + "." + utils.EncloseName(table.Info.Name.O),
+			Files: len(table.Files),
+		}
+		for _, file := range table.Files {
+			t.Size += fileSize(file)
+			t.KVs += file.GetTotalKvs()
+		}
+		report.Tables = append(report.Tables, t)
+	}
+	// The biggest tables first.
+	sort.SliceStable(report.Tables, func(i, j int) bool {
+		return report.Tables[i].Size > report.Tables[j].Size
+	})
+	return report
+}
+
+// print adds the steps to the summary and logs the tables and the slowest
+// regions.
+func (r *restoreReport) print() {
+	steps := make([]string, 0, len(r.Steps))
+	for step := range r.Steps {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	for _, step := range steps {
+		stats := r.Steps[step]
+		summary.CollectInt("restore "+step+" count", stats.Count)
+		summary.CollectDuration("restore "+step+" max", time.Duration(stats.MaxDuration)*time.Millisecond)
+		log.Info("restore step", zap.String("step", step), zap.Int("count", stats.Count),
+			zap.Int("retries", stats.Retries), zap.Int("errors", stats.Errors),
+			zap.Duration("total", time.Duration(stats.Duration)*time.Millisecond),
+			zap.Duration("max", time.Duration(stats.MaxDuration)*time.Millisecond))
+	}
+	for _, table := range r.Tables {
+		log.Info("restored table", zap.String("table", table.Name), zap.Int("files", table.Files),
+			zap.Uint64("size", table.Size), zap.Uint64("kvs", table.KVs))
+	}
+	for _, ev := range r.SlowestRegions {
+		log.Info("slow region", zap.Uint64("region", ev.RegionID), zap.Uint64("store", ev.StoreID),
+			zap.String("step", ev.Step), zap.String("file", ev.File), zap.Time("start", ev.Start),
+			zap.Duration("take", time.Duration(ev.Duration)*time.Millisecond), zap.Int("retries", ev.Retries),
+			zap.String("error", ev.Error))
+	}
+}
+
+// saveRestoreReport writes the report into the storage. It's saved for the
+// failed restores too, whose own error mustn't be replaced by the failure of
+// saving the report, so the failure is only logged.
+func saveRestoreReport(ctx context.Context, s storage.ExternalStorage, report *restoreReport) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = s.Write(ctx, utils.RestoreReportFile, data)
+	}
+	if err != nil {
+		log.Warn("failed to save the restore report", zap.Error(err))
+		return
+	}
+	log.Info("restore report saved", zap.String("file", utils.RestoreReportFile))
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+
+	"github.com/pingcap/br/pkg/restore"
+)
+
+type testRestoreReportSuite struct{}
+
+var _ = Suite(&testRestoreReportSuite{})
+
+func (s *testRestoreReportSuite) TestBuildRestoreReport(c *C) {
+	_, tables := mockDatabase("test", "t1", "t2")
+	tables[0].Files = []*backup.File{mockTableFile("1_write.sst", 10, 100)}
+	tables[1].Files = []*backup.File{
+		mockTableFile("2_write.sst", 20, 100),
+		mockTableFile("2_default.sst", 20, 200),
+	}
+	timeline := restore.NewRegionTimelineStats()
+	timeline.Record(restore.TimelineEvent{RegionID: 1, Step: restore.TimelineStepIngest}, time.Now(), nil)
+
+	report := buildRestoreReport(tables, timeline)
+	c.Assert(report.Tables, DeepEquals, []tableReport{
+		{Name: "`test`.`t2`", Files: 2, Size: 300, KVs: 20},
+		{Name: "`test`.`t1`", Files: 1, Size: 100, KVs: 10},
+	})
+	c.Assert(report.Steps[restore.TimelineStepIngest].Count, Equals, 1)
+	c.Assert(report.SlowestRegions, HasLen, 1)
+	c.Assert(report.SlowestRegions[0].RegionID, Equals, uint64(1))
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/summary"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const (
+	flagStagingStorage = "staging-storage"
+
+	defaultStageConcurrency = 8
+)
+
+// parseStagingStorage parses the storage the files are staged in, TiKV
+// downloads the files from it instead of the local paths of the backup
+// cluster, so the stores of the target cluster don't need the same files.
+func parseStagingStorage(cfg *RestoreConfig, u *kvproto.StorageBackend) (*kvproto.StorageBackend, error) {
+	if cfg.StagingStorage == "" {
+		return u, nil
+	}
+	if u.GetLocal() == nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s is only for the local storage, the files in %s are read by TiKV directly",
+			flagStagingStorage, cfg.Storage)
+	}
+	staging, err := storage.ParseBackend(cfg.StagingStorage, &cfg.BackendOptions)
+	if err != nil {
+		return nil, err
+	}
+	if staging.GetNoop() != nil {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "--%s can't be noop", flagStagingStorage)
+	}
+	if local := staging.GetLocal(); local != nil && local.GetPath() == u.GetLocal().GetPath() {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s must be different from --%s", flagStagingStorage, flagStorage)
+	}
+	return staging, nil
+}
+
+// stageBackupFiles copies the files to restore from the local storage of BR
+// into the staging storage. The files of all stores of the backup cluster
+// must be gathered into the local storage first. The files already staged
+// are skipped, so it's cheap to restore again.
+func stageBackupFiles(
+	ctx context.Context,
+	from, to storage.ExternalStorage,
+	files []*kvproto.File,
+) error {
+	start := time.Now()
+	var (
+		mu     sync.Mutex
+		staged int
+		size   int
+	)
+	workers := utils.NewWorkerPool(defaultStageConcurrency, "stage files")
+	eg, ectx := errgroup.WithContext(ctx)
+	for _, file := range files {
+		name := file.GetName()
+		workers.ApplyOnErrorGroup(eg, func() error {
+			exists, err := to.FileExists(ectx, name)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if exists {
+				return nil
+			}
+			data, err := from.Read(ectx, name)
+			if err != nil {
+				return errors.Annotatef(berrors.ErrBackupFilesIncomplete,
+					"failed to read %s from %s, the files of all stores of the backup cluster "+
+						"must be copied into it: %v", name, from.URI(), err)
+			}
+			if err = to.Write(ectx, name, data); err != nil {
+				return errors.Trace(err)
+			}
+			mu.Lock()
+			staged++
+			size += len(data)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	summary.CollectDuration("stage backup files", elapsed)
+	log.Info("backup files staged", zap.String("staging", to.URI()), zap.Int("files", len(files)),
+		zap.Int("staged", staged), zap.Int("size", size), zap.Duration("take", elapsed))
+	return nil
+}
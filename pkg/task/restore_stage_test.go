@@ -0,0 +1,65 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+
+	"github.com/pingcap/br/pkg/storage"
+)
+
+type testStageSuite struct{}
+
+var _ = Suite(&testStageSuite{})
+
+func (s *testStageSuite) TestParseStagingStorage(c *C) {
+	local, err := storage.ParseBackend("local:///tmp/backup", nil)
+	c.Assert(err, IsNil)
+	cfg := &RestoreConfig{}
+	backend, err := parseStagingStorage(cfg, local)
+	c.Assert(err, IsNil)
+	c.Assert(backend, Equals, local)
+
+	cfg.StagingStorage = "s3://bucket/staging"
+	backend, err = parseStagingStorage(cfg, local)
+	c.Assert(err, IsNil)
+	c.Assert(backend.GetS3().GetBucket(), Equals, "bucket")
+
+	for _, staging := range []string{"noop://", "local:///tmp/backup"} {
+		cfg.StagingStorage = staging
+		_, err = parseStagingStorage(cfg, local)
+		c.Assert(err, ErrorMatches, ".*staging-storage.*", Commentf("%s", staging))
+	}
+
+	s3, err := storage.ParseBackend("s3://bucket/backup", nil)
+	c.Assert(err, IsNil)
+	cfg.StagingStorage = "s3://bucket/staging"
+	_, err = parseStagingStorage(cfg, s3)
+	c.Assert(err, ErrorMatches, ".*only for the local storage.*")
+}
+
+func (s *testStageSuite) TestStageBackupFiles(c *C) {
+	ctx := context.Background()
+	fromDir, toDir := c.MkDir(), c.MkDir()
+	from, err := storage.NewLocalStorage(fromDir)
+	c.Assert(err, IsNil)
+	to, err := storage.NewLocalStorage(toDir)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(fromDir, "1.sst"), []byte("new"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(toDir, "2.sst"), []byte("staged"), 0644), IsNil)
+
+	files := []*backup.File{{Name: "1.sst"}, {Name: "2.sst"}}
+	c.Assert(stageBackupFiles(ctx, from, to, files), IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(toDir, "1.sst"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "new")
+
+	files = append(files, &backup.File{Name: "3.sst"})
+	err = stageBackupFiles(ctx, from, to, files)
+	c.Assert(err, ErrorMatches, ".*failed to read 3.sst.*")
+}
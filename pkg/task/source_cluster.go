@@ -0,0 +1,228 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/domain/infosync"
+	"github.com/pingcap/tidb/util/collate"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/conn"
+	berrors "github.com/pingcap/br/pkg/errors"
+	"github.com/pingcap/br/pkg/glue"
+	"github.com/pingcap/br/pkg/metautil"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+const redacted = "******"
+
+// secretPattern matches the flags and the URL parameters holding secrets,
+// e.g. the access keys of S3.
+var secretPattern = regexp.MustCompile(`(?i)(secret|password|passwd|access-key|token)`)
+
+// newCollationsEnabled returns whether the new collation framework is enabled
+// in the connected cluster, it's loaded when bootstrapping the domain.
+func newCollationsEnabled() *bool {
+	enabled := collate.NewCollationEnabled()
+	return &enabled
+}
+
+// newSourceCluster collects the settings and the versions of the connected
+// cluster. A version which can't be got is left empty, the restore doesn't
+// compare it. The args are nil if BR runs in TiDB.
+func newSourceCluster(
+	ctx context.Context, mgr *conn.Mgr, args []string, startTime time.Time,
+) metautil.SourceCluster {
+	var source metautil.SourceCluster
+	source.BRVersion = utils.BRReleaseVersion
+	source.BRGitHash = utils.BRGitHash
+	source.Args = redactArgs(args)
+	source.StartTime = startTime
+
+	source.ClusterID = mgr.GetPDClient().GetClusterID(ctx)
+	var err error
+	if source.ClusterVersion, err = mgr.GetClusterVersion(ctx); err != nil {
+		log.Warn("failed to get the cluster version", zap.Error(err))
+	}
+	stores, err := conn.GetAllTiKVStores(ctx, mgr.GetPDClient(), conn.SkipTiFlash)
+	if err != nil {
+		log.Warn("failed to get the versions of TiKV", zap.Error(err))
+	}
+	tikvVersions := make([]string, 0, len(stores))
+	for _, store := range stores {
+		tikvVersions = append(tikvVersions, store.GetVersion())
+	}
+	source.TiKVVersions = uniqueSorted(tikvVersions)
+	servers, err := infosync.GetAllServerInfo(ctx)
+	if err != nil {
+		log.Warn("failed to get the versions of TiDB", zap.Error(err))
+	}
+	tidbVersions := make([]string, 0, len(servers))
+	for _, server := range servers {
+		tidbVersions = append(tidbVersions, server.Version)
+	}
+	source.TiDBVersions = uniqueSorted(tidbVersions)
+	return source
+}
+
+// commandArgs returns the args of the command, the args of TiDB aren't the
+// ones of the backup when BR runs in TiDB.
+func commandArgs(g glue.Glue) []string {
+	if !g.OwnsStorage() {
+		return nil
+	}
+	return os.Args
+}
+
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	unique := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// redactArgs replaces the values of the flags holding secrets, and the
+// secret parameters and passwords of the URLs, e.g. the storage.
+func redactArgs(args []string) []string {
+	if args == nil {
+		return nil
+	}
+	result := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			result = append(result, redactURL(arg))
+			continue
+		}
+		name, value := arg, ""
+		eq := strings.IndexByte(arg, '=')
+		if eq >= 0 {
+			name, value = arg[:eq], arg[eq+1:]
+		}
+		switch {
+		case !secretPattern.MatchString(name):
+			if eq >= 0 {
+				arg = name + "=" + redactURL(value)
+			}
+			result = append(result, arg)
+		case eq >= 0:
+			result = append(result, name+"="+redacted)
+		default:
+			result = append(result, arg)
+			// The value is the next argument.
+			if i+1 < len(args) {
+				result = append(result, redacted)
+				i++
+			}
+		}
+	}
+	return result
+}
+
+func redactURL(arg string) string {
+	if !strings.Contains(arg, "://") {
+		return arg
+	}
+	u, err := url.Parse(arg)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+	}
+	query := u.Query()
+	for key := range query {
+		if secretPattern.MatchString(key) {
+			query.Set(key, redacted)
+		}
+	}
+	u.RawQuery = query.Encode()
+	// Keep the mask readable.
+	return strings.ReplaceAll(u.String(), url.QueryEscape(redacted), redacted)
+}
+
+// finishSourceCluster returns the settings of the cluster to record in the
+// backupmeta, the backup ends now.
+func finishSourceCluster(source metautil.SourceCluster) *metautil.SourceCluster {
+	source.EndTime = time.Now()
+	return &source
+}
+
+// checkSourceCluster logs how the backup was taken, and warns on the version
+// skew between the backup and the restore.
+func checkSourceCluster(ctx context.Context, mgr *conn.Mgr, source *metautil.SourceCluster) {
+	// Backups taken by older BR don't record the settings.
+	if source == nil {
+		log.Warn("the backup doesn't record the settings of its cluster, skip checking the versions")
+		return
+	}
+	log.Info("the backup is taken by", zap.String("br-version", source.BRVersion),
+		zap.Strings("args", source.Args), zap.Uint64("cluster-id", source.ClusterID),
+		zap.String("cluster-version", source.ClusterVersion), zap.Time("start-time", source.StartTime),
+		zap.Time("end-time", source.EndTime))
+	clusterVersion, err := mgr.GetClusterVersion(ctx)
+	if err != nil {
+		log.Warn("failed to get the cluster version, skip checking the version skew", zap.Error(err))
+	}
+	for _, skew := range versionSkews(*source, utils.BRReleaseVersion, clusterVersion) {
+		log.Warn(skew)
+	}
+}
+
+// versionSkews returns the warnings of the version skew between the backup
+// and the restore, the versions unknown aren't compared.
+func versionSkews(source metautil.SourceCluster, brVersion, clusterVersion string) []string {
+	skews := make([]string, 0, 2)
+	if source.BRVersion != "" && utils.VersionSkewed(source.BRVersion, brVersion) {
+		skews = append(skews, "the backup is taken by BR "+source.BRVersion+
+			" but restored by BR "+brVersion+", the data may be restored incompatibly")
+	}
+	if source.ClusterVersion != "" && clusterVersion != "" &&
+		utils.VersionSkewed(source.ClusterVersion, clusterVersion) {
+		skews = append(skews, "the backup is taken from a cluster of version "+source.ClusterVersion+
+			" but restored into a cluster of version "+clusterVersion+", the data may be restored incompatibly")
+	}
+	return skews
+}
+
+// checkNewCollations refuses to restore the backup into a cluster whose new
+// collation setting differs from the one recorded in the backupmeta, the
+// backups taken by older BR don't record it.
+func checkNewCollations(backup *bool, target bool) error {
+	if backup == nil {
+		log.Warn("the backup doesn't record the new collations setting, skip checking it")
+		return nil
+	}
+	if *backup != target {
+		log.Error("the new collations setting mismatches", zap.Bool("backup", *backup), zap.Bool("target", target))
+		return errors.Annotatef(berrors.ErrRestoreCollationMismatch,
+			"the new collations are %s in the backup but %s in the target cluster, "+
+				"the restored indices of the strings would be corrupted, "+
+				"use --%s=false if you really want to do this",
+			enabledString(*backup), enabledString(target), flagCheckRequirement)
+	}
+	return nil
+}
+
+func enabledString(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
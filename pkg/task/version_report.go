@@ -0,0 +1,127 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	pd "github.com/tikv/pd/client"
+	"go.etcd.io/etcd/clientv3"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/br/pkg/glue"
+	"github.com/pingcap/br/pkg/utils"
+)
+
+// tidbTopologyPrefix is the prefix of the keys in the etcd of PD, every TiDB
+// server puts its info under the prefix, and keeps a TTL key alive.
+const tidbTopologyPrefix = "/topology/tidb/"
+
+// VersionConfig is the configuration specific for version tasks.
+type VersionConfig struct {
+	Config
+
+	// CheckCluster reports the versions of the components of the cluster,
+	// it's set if the PD is given.
+	CheckCluster bool `json:"check-cluster" toml:"check-cluster"`
+}
+
+// ParseFromFlags parses the version-related flags from the flag set.
+func (cfg *VersionConfig) ParseFromFlags(flags *pflag.FlagSet) error {
+	cfg.CheckCluster = flags.Changed(flagPD)
+	return cfg.Config.ParseFromFlags(flags)
+}
+
+// RunVersionReport checks whether BR works with every component of the
+// cluster, the components are sorted by the component and the address.
+func RunVersionReport(ctx context.Context, g glue.Glue, cfg *VersionConfig) ([]utils.ComponentVersion, error) {
+	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), false, cfg.GRPCDialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	defer mgr.Close()
+
+	report := make([]utils.ComponentVersion, 0)
+	clusterVersion, err := mgr.GetClusterVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report = append(report, utils.CheckComponentVersion(utils.ComponentPD, strings.Join(cfg.PD, ","), clusterVersion))
+	stores, err := mgr.GetPDClient().GetAllStores(ctx, pd.WithExcludeTombstone())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, store := range stores {
+		component := utils.ComponentTiKV
+		if utils.IsTiFlash(store) {
+			component = utils.ComponentTiFlash
+		}
+		report = append(report, utils.CheckComponentVersion(component, store.GetAddress(), store.GetVersion()))
+	}
+	// The TiDB servers are for reference only, BR doesn't depend on them.
+	servers, err := getTiDBVersions(ctx, cfg.PD, mgr.GetTLSConfig())
+	if err != nil {
+		log.Warn("failed to get the versions of TiDB", zap.Error(err))
+	}
+	for addr, version := range servers {
+		report = append(report, utils.CheckComponentVersion(utils.ComponentTiDB, addr, version))
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Component != report[j].Component {
+			return report[i].Component < report[j].Component
+		}
+		return report[i].Address < report[j].Address
+	})
+	return report, nil
+}
+
+// getTiDBVersions returns the versions of the alive TiDB servers by their
+// addresses, the version of the server e.g. 5.7.25-TiDB-v4.0.8 is trimmed
+// to v4.0.8.
+func getTiDBVersions(ctx context.Context, pds []string, tlsConf *tls.Config) (map[string]string, error) {
+	cli, err := newEtcdClient(ctx, pds, tlsConf)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	resp, err := cli.Get(ctx, tidbTopologyPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	versions := make(map[string]string)
+	alive := make(map[string]bool)
+	for _, kv := range resp.Kvs {
+		key := strings.TrimPrefix(string(kv.Key), tidbTopologyPrefix)
+		switch {
+		case strings.HasSuffix(key, "/ttl"):
+			alive[strings.TrimSuffix(key, "/ttl")] = true
+		case strings.HasSuffix(key, "/info"):
+			info := struct {
+				Version string `json:"version"`
+			}{}
+			if err = json.Unmarshal(kv.Value, &info); err != nil {
+				log.Warn("invalid TiDB topology", zap.String("key", string(kv.Key)), zap.Error(err))
+				continue
+			}
+			version := info.Version
+			if i := strings.LastIndex(version, "-TiDB-"); i >= 0 {
+				version = version[i+len("-TiDB-"):]
+			}
+			versions[strings.TrimSuffix(key, "/info")] = version
+		}
+	}
+	// The info is kept after the server exits, only its TTL key expires.
+	for addr := range versions {
+		if !alive[addr] {
+			delete(versions, addr)
+		}
+	}
+	return versions, nil
+}
@@ -21,8 +21,35 @@ import (
 var (
 	startedPProf = ""
 	mu           sync.Mutex
+
+	statusHandlers   = make(map[string]http.Handler)
+	statusHandlersMu sync.Mutex
 )
 
+// SetStatusHandler sets the handler of the path on the status server,
+// it replaces the previous one, and a nil handler unsets the path.
+func SetStatusHandler(path string, handler http.Handler) {
+	statusHandlersMu.Lock()
+	defer statusHandlersMu.Unlock()
+	_, registered := statusHandlers[path]
+	statusHandlers[path] = handler
+	if registered {
+		return
+	}
+	// The default mux doesn't allow registering a path twice,
+	// so dispatch to the current handler instead.
+	http.HandleFunc(path, func(w http.ResponseWriter, req *http.Request) {
+		statusHandlersMu.Lock()
+		h := statusHandlers[path]
+		statusHandlersMu.Unlock()
+		if h == nil {
+			http.NotFound(w, req)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
 // StartPProfListener forks a new goroutine listening on specified port and provide pprof info.
 func StartPProfListener(statusAddr string) {
 	mu.Lock()
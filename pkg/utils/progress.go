@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"os"
 	"sync/atomic"
 	"time"
 
@@ -52,6 +53,16 @@ func (pp *ProgressPrinter) Close() {
 	pp.cancel()
 }
 
+// isTerminal returns whether the file is a terminal, the progress bar refreshed
+// in place is unreadable if the output is redirected to a file or a pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
 // goPrintProgress starts a gorouinte and prints progress.
 func (pp *ProgressPrinter) goPrintProgress(
 	ctx context.Context,
@@ -61,6 +72,11 @@ func (pp *ProgressPrinter) goPrintProgress(
 	cctx, cancel := context.WithCancel(ctx)
 	pp.cancel = cancel
 	bar := pb.New64(pp.total)
+	// The bar is printed to stderr, print the periodic log lines instead if
+	// it isn't a terminal.
+	if !pp.redirectLog && testWriter == nil && !isTerminal(os.Stderr) {
+		pp.redirectLog = true
+	}
 	if pp.redirectLog || testWriter != nil {
 		tmpl := `{"P":"{{percent .}}","C":"{{counters . }}","E":"{{etime .}}","R":"{{rtime .}}","S":"{{speed .}}"}`
 		bar.SetTemplateString(tmpl)
@@ -75,7 +91,8 @@ func (pp *ProgressPrinter) goPrintProgress(
 		}
 		bar.SetWriter(&wrappedWriter{name: pp.name, log: logFuncImpl})
 	} else {
-		tmpl := `{{string . "barName" | green}} {{ bar . "<" "-" (cycle . "-" "\\" "|" "/" ) "." ">"}} {{percent .}}`
+		tmpl := `{{string . "barName" | green}} {{ bar . "<" "-" (cycle . "-" "\\" "|" "/" ) "." ">"}} {{percent .}}` +
+			` {{counters .}} {{speed . "%s/s"}} {{rtime . "ETA %s"}}`
 		bar.SetTemplateString(tmpl)
 		bar.Set("barName", pp.name)
 	}
@@ -4,6 +4,9 @@ package utils
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"time"
 
 	. "github.com/pingcap/check"
@@ -75,3 +78,12 @@ func (r *testProgressSuite) TestProgress(c *C) {
 	p = <-pCh8
 	c.Assert(p, Matches, `.*"P":"25\.00%".*`)
 }
+
+func (r *testProgressSuite) TestIsTerminal(c *C) {
+	path := filepath.Join(c.MkDir(), "progress")
+	c.Assert(ioutil.WriteFile(path, nil, 0644), IsNil)
+	f, err := os.Open(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	c.Assert(isTerminal(f), IsFalse)
+}
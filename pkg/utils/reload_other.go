@@ -0,0 +1,9 @@
+// +build !linux,!darwin,!freebsd,!unix
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+// StartConfigReloader calls reload whenever `reloadConfigSignal` is received.
+func StartConfigReloader(reload func()) {
+	// nothing to do on no posix signal supporting systems.
+}
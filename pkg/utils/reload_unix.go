@@ -0,0 +1,29 @@
+// +build linux darwin freebsd unix
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+const (
+	reloadConfigSignal = syscall.SIGHUP
+)
+
+// StartConfigReloader calls reload whenever `reloadConfigSignal` is received.
+func StartConfigReloader(reload func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, reloadConfigSignal)
+	go func() {
+		for sig := range signals {
+			log.Info("signal received, reloading config...", zap.Stringer("signal", sig))
+			reload()
+		}
+	}()
+}
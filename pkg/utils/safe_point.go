@@ -69,7 +69,9 @@ func CheckGCSafePoint(ctx context.Context, pdClient pd.Client, ts uint64) error
 		return nil
 	}
 	if ts <= safePoint {
-		return errors.Annotatef(berrors.ErrBackupGCSafepointExceeded, "GC safepoint %d exceed TS %d", safePoint, ts)
+		return errors.Annotatef(berrors.ErrBackupGCSafepointExceeded,
+			"GC safepoint %d exceed TS %d, the snapshot is already GCed, the earliest valid TS is %d",
+			safePoint, ts, safePoint+1)
 	}
 	return nil
 }
@@ -90,6 +92,15 @@ func UpdateServiceSafePoint(ctx context.Context, pdClient pd.Client, sp BRServic
 	return err
 }
 
+// RemoveServiceSafePoint removes the service safe point registered by BR,
+// PD removes the service safe point whose TTL isn't positive.
+func RemoveServiceSafePoint(ctx context.Context, pdClient pd.Client, sp BRServiceSafePoint) error {
+	log.Debug("remove PD safePoint limit",
+		zap.Object("safePoint", sp))
+	_, err := pdClient.UpdateServiceGCSafePoint(ctx, sp.ID, 0, sp.BackupTS-1)
+	return errors.Trace(err)
+}
+
 // StartServiceSafePointKeeper will run UpdateServiceSafePoint periodicity
 // hence keeping service safepoint won't lose.
 func StartServiceSafePointKeeper(
@@ -41,13 +41,43 @@ func (s *testSafePointSuite) TestCheckGCSafepoint(c *C) {
 	{
 		err := utils.CheckGCSafePoint(ctx, pdClient, 0)
 		c.Assert(err, ErrorMatches, ".*GC safepoint 2333 exceed TS 0.*")
+		c.Assert(err, ErrorMatches, ".*the earliest valid TS is 2334.*")
 	}
 }
 
+func (s *testSafePointSuite) TestRemoveServiceSafePoint(c *C) {
+	ctx := context.Background()
+	pdClient := &mockSafePoint{safepoint: 2333, services: make(map[string]uint64)}
+	sp := utils.BRServiceSafePoint{
+		ID:       utils.MakeSafePointID(),
+		TTL:      utils.DefaultBRGCSafePointTTL,
+		BackupTS: 2333 + 10,
+	}
+	c.Assert(utils.UpdateServiceSafePoint(ctx, pdClient, sp), IsNil)
+	c.Assert(pdClient.services, HasKey, sp.ID)
+	c.Assert(utils.RemoveServiceSafePoint(ctx, pdClient, sp), IsNil)
+	c.Assert(pdClient.services, Not(HasKey), sp.ID)
+}
+
 type mockSafePoint struct {
 	sync.Mutex
 	pd.Client
 	safepoint uint64
+	services  map[string]uint64
+}
+
+func (m *mockSafePoint) UpdateServiceGCSafePoint(
+	ctx context.Context, serviceID string, ttl int64, safePoint uint64,
+) (uint64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if ttl <= 0 {
+		delete(m.services, serviceID)
+	} else {
+		m.services[serviceID] = safePoint
+	}
+	return m.safepoint, nil
 }
 
 func (m *mockSafePoint) UpdateGCSafePoint(ctx context.Context, safePoint uint64) (uint64, error) {
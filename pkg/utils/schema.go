@@ -9,9 +9,12 @@ import (
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
 	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb/statistics/handle"
 	"github.com/pingcap/tidb/tablecodec"
+	"go.uber.org/zap"
 )
 
 const (
@@ -23,8 +26,41 @@ const (
 	MetaJSONFile = "backupmeta.json"
 	// SavedMetaFile represents saved meta file name for recovering later
 	SavedMetaFile = "backupmeta.bak"
+	// CheckpointFile represents the file name of the backup checkpoint
+	CheckpointFile = "backup.checkpoint"
+	// RestoreCheckpointFile represents the prefix of the file names of the
+	// restore checkpoints, which are saved in the checkpoint storage
+	RestoreCheckpointFile = "restore.checkpoint"
+	// PartialStateFile represents the file name of the state of a stopped backup
+	PartialStateFile = "backup.partial"
+	// JobResultFile represents the file name of the result of the backup job
+	JobResultFile = "backup.result.json"
+	// JobLogFile represents the file name of the log of the backup job
+	JobLogFile = "backup.log"
+	// SummaryFile represents the file name of the JSON summary of the task
+	SummaryFile = "br.summary.json"
+	// RestoreReportFile represents the file name of the report of the restore
+	RestoreReportFile = "restore.report.json"
+	// CatalogFile represents the file name of the catalog of the backups under a storage prefix,
+	// which is written by the old BR
+	CatalogFile = "backup.catalog.json"
+	// CatalogDir represents the directory of the catalog entries, a file per backup
+	CatalogDir = "backup.catalog"
+
+	temporaryDBNamePrefix = "__TiDB_BR_Temporary_"
 )
 
+// IsSysDB tests whether the database is the system database, i.e. mysql.
+func IsSysDB(dbLowerName string) bool {
+	return dbLowerName == mysql.SystemDB
+}
+
+// TemporaryDBName makes the name of the database where the tables of db are
+// restored before they are moved into db.
+func TemporaryDBName(db string) model.CIStr {
+	return model.NewCIStr(temporaryDBNamePrefix + db)
+}
+
 // Table wraps the schema and files of a table.
 type Table struct {
 	DB              *model.DBInfo
@@ -67,72 +103,132 @@ func (db *Database) GetTable(name string) *Table {
 
 // LoadBackupTables loads schemas from BackupMeta.
 func LoadBackupTables(meta *backup.BackupMeta) (map[string]*Database, error) {
-	databases := make(map[string]*Database)
+	loader := NewBackupTablesLoader()
+	loader.AddFiles(meta.Files...)
 	for _, schema := range meta.Schemas {
-		// Parse the database schema.
-		dbInfo := &model.DBInfo{}
-		err := json.Unmarshal(schema.Db, dbInfo)
-		if err != nil {
-			return nil, errors.Trace(err)
-		}
-		// If the database do not ever added into the map, initialize a database object in the map.
-		db, ok := databases[dbInfo.Name.String()]
-		if !ok {
-			db = &Database{
-				Info:   dbInfo,
-				Tables: make([]*Table, 0),
-			}
-			databases[dbInfo.Name.String()] = db
-		}
-		// Parse the table schema.
-		tableInfo := &model.TableInfo{}
-		err = json.Unmarshal(schema.Table, tableInfo)
-		if err != nil {
-			return nil, errors.Trace(err)
+		if err := loader.AddSchema(schema); err != nil {
+			return nil, err
 		}
-		// stats maybe nil from old backup file.
-		stats := &handle.JSONTable{}
-		if schema.Stats != nil {
-			// Parse the stats table.
-			err = json.Unmarshal(schema.Stats, stats)
-			if err != nil {
-				return nil, errors.Trace(err)
-			}
+	}
+	loader.WarnUnknownFields()
+	return loader.Databases(), nil
+}
+
+// BackupTablesLoader loads the databases and tables of a backup from its files
+// and schemas, which can be added one shard of the backupmeta at a time. The
+// files must be added before the schemas.
+type BackupTablesLoader struct {
+	databases map[string]*Database
+	// files are the files of the tables by the table ID of their start keys.
+	files map[int64][]*backup.File
+	// unknownDBFields and unknownTableFields count the tables whose schemas
+	// have the fields unknown to this BR.
+	unknownDBFields    unknownFields
+	unknownTableFields unknownFields
+}
+
+// NewBackupTablesLoader creates a BackupTablesLoader.
+func NewBackupTablesLoader() *BackupTablesLoader {
+	return &BackupTablesLoader{
+		databases:          make(map[string]*Database),
+		files:              make(map[int64][]*backup.File),
+		unknownDBFields:    make(unknownFields),
+		unknownTableFields: make(unknownFields),
+	}
+}
+
+// AddFiles adds the files of the backup.
+func (l *BackupTablesLoader) AddFiles(files ...*backup.File) {
+	for _, file := range files {
+		// If the file do not contains any table data, skip it.
+		if !bytes.HasPrefix(file.GetStartKey(), tablecodec.TablePrefix()) &&
+			!bytes.HasPrefix(file.GetEndKey(), tablecodec.TablePrefix()) {
+			continue
 		}
-		partitions := make(map[int64]bool)
-		if tableInfo.Partition != nil {
-			for _, p := range tableInfo.Partition.Definitions {
-				partitions[p.ID] = true
-			}
+		tableID := tablecodec.DecodeTableID(file.GetStartKey())
+		l.files[tableID] = append(l.files[tableID], file)
+	}
+}
+
+// AddSchema adds the schema of a table, the files added of the table and its
+// partitions are the files of the table.
+func (l *BackupTablesLoader) AddSchema(schema *backup.Schema) error {
+	// Parse the database schema.
+	dbInfo := &model.DBInfo{}
+	err := json.Unmarshal(schema.Db, dbInfo)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// If the database do not ever added into the map, initialize a database object in the map.
+	db, ok := l.databases[dbInfo.Name.String()]
+	if !ok {
+		db = &Database{
+			Info:   dbInfo,
+			Tables: make([]*Table, 0),
 		}
-		// Find the files belong to the table
-		tableFiles := make([]*backup.File, 0)
-		for _, file := range meta.Files {
-			// If the file do not contains any table data, skip it.
-			if !bytes.HasPrefix(file.GetStartKey(), tablecodec.TablePrefix()) &&
-				!bytes.HasPrefix(file.GetEndKey(), tablecodec.TablePrefix()) {
-				continue
-			}
-			startTableID := tablecodec.DecodeTableID(file.GetStartKey())
-			// If the file contains a part of the data of the table, append it to the slice.
-			if ok := partitions[startTableID]; ok || startTableID == tableInfo.ID {
-				tableFiles = append(tableFiles, file)
-			}
+		l.databases[dbInfo.Name.String()] = db
+	}
+	// Parse the table schema.
+	tableInfo := &model.TableInfo{}
+	err = json.Unmarshal(schema.Table, tableInfo)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	unknownDBFields, unknownTableFields, err := checkTableCompatible(schema.Db, schema.Table, dbInfo, tableInfo)
+	if err != nil {
+		return err
+	}
+	l.unknownDBFields.add(unknownDBFields)
+	l.unknownTableFields.add(unknownTableFields)
+	// stats maybe nil from old backup file.
+	stats := &handle.JSONTable{}
+	if schema.Stats != nil {
+		// Parse the stats table.
+		err = json.Unmarshal(schema.Stats, stats)
+		if err != nil {
+			return errors.Trace(err)
 		}
-		table := &Table{
-			DB:              dbInfo,
-			Info:            tableInfo,
-			Crc64Xor:        schema.Crc64Xor,
-			TotalKvs:        schema.TotalKvs,
-			TotalBytes:      schema.TotalBytes,
-			Files:           tableFiles,
-			TiFlashReplicas: int(schema.TiflashReplicas),
-			Stats:           stats,
+	}
+	// Find the files belong to the table and its partitions.
+	tableFiles := append(make([]*backup.File, 0), l.files[tableInfo.ID]...)
+	if tableInfo.Partition != nil {
+		for _, p := range tableInfo.Partition.Definitions {
+			tableFiles = append(tableFiles, l.files[p.ID]...)
 		}
-		db.Tables = append(db.Tables, table)
 	}
+	// The old backups only record the replicas in the table info.
+	tiflashReplicas := int(schema.TiflashReplicas)
+	if tiflashReplicas == 0 && tableInfo.TiFlashReplica != nil {
+		tiflashReplicas = int(tableInfo.TiFlashReplica.Count)
+	}
+	table := &Table{
+		DB:              dbInfo,
+		Info:            tableInfo,
+		Crc64Xor:        schema.Crc64Xor,
+		TotalKvs:        schema.TotalKvs,
+		TotalBytes:      schema.TotalBytes,
+		Files:           tableFiles,
+		TiFlashReplicas: tiflashReplicas,
+		Stats:           stats,
+	}
+	db.Tables = append(db.Tables, table)
+	return nil
+}
+
+// WarnUnknownFields warns about the fields of the schemas loaded which are
+// unknown to this BR, they are dropped when the tables are created.
+func (l *BackupTablesLoader) WarnUnknownFields() {
+	if len(l.unknownDBFields) == 0 && len(l.unknownTableFields) == 0 {
+		return
+	}
+	log.Warn("the schemas have the fields unknown to this BR, they are dropped when restoring",
+		zap.Object("tables of database fields", l.unknownDBFields),
+		zap.Object("tables of table fields", l.unknownTableFields))
+}
 
-	return databases, nil
+// Databases returns the databases loaded.
+func (l *BackupTablesLoader) Databases() map[string]*Database {
+	return l.databases
 }
 
 // ArchiveSize returns the total size of the backup archive.
@@ -79,3 +79,66 @@ func (r *testSchemaSuite) TestLoadBackupMeta(c *C) {
 	c.Assert(tbl.Files, HasLen, 1)
 	c.Assert(tbl.Files[0].Name, Equals, "1.sst")
 }
+
+func (r *testSchemaSuite) TestLoadTiFlashReplicas(c *C) {
+	dbBytes, err := json.Marshal(model.DBInfo{ID: 1, Name: model.NewCIStr("test")})
+	c.Assert(err, IsNil)
+	mockTable := func(id int64, name string, replica *model.TiFlashReplicaInfo) []byte {
+		tblBytes, err := json.Marshal(&model.TableInfo{ID: id, Name: model.NewCIStr(name), TiFlashReplica: replica})
+		c.Assert(err, IsNil)
+		return tblBytes
+	}
+	meta := mockBackupMeta([]*backup.Schema{
+		{Db: dbBytes, Table: mockTable(1, "t1", nil), TiflashReplicas: 2},
+		// The old backups only record the replicas in the table info.
+		{Db: dbBytes, Table: mockTable(2, "t2", &model.TiFlashReplicaInfo{Count: 1})},
+		{Db: dbBytes, Table: mockTable(3, "t3", nil)},
+	}, nil)
+	dbs, err := LoadBackupTables(meta)
+	c.Assert(err, IsNil)
+	c.Assert(dbs["test"].GetTable("t1").TiFlashReplicas, Equals, 2)
+	c.Assert(dbs["test"].GetTable("t2").TiFlashReplicas, Equals, 1)
+	c.Assert(dbs["test"].GetTable("t3").TiFlashReplicas, Equals, 0)
+}
+
+func (r *testSchemaSuite) TestLoadSchemaCompatibility(c *C) {
+	dbBytes, err := json.Marshal(model.DBInfo{ID: 1, Name: model.NewCIStr("test")})
+	c.Assert(err, IsNil)
+	tblBytes, err := json.Marshal(&model.TableInfo{ID: 123, Name: model.NewCIStr("t1")})
+	c.Assert(err, IsNil)
+
+	// The fields added by a newer TiDB are ignored.
+	future := append(tblBytes[:len(tblBytes)-1:len(tblBytes)-1], []byte(`,"future_field":1}`)...)
+	unknown, err := unknownJSONFields(future, tableInfoFields)
+	c.Assert(err, IsNil)
+	c.Assert(unknown, DeepEquals, []string{"future_field"})
+	unknown, err = unknownJSONFields(tblBytes, tableInfoFields)
+	c.Assert(err, IsNil)
+	c.Assert(unknown, HasLen, 0)
+	meta := mockBackupMeta([]*backup.Schema{{Db: dbBytes, Table: future}}, nil)
+	dbs, err := LoadBackupTables(meta)
+	c.Assert(err, IsNil)
+	c.Assert(dbs["test"].GetTable("t1").Info.ID, Equals, int64(123))
+
+	// The unknown fields are counted across the tables.
+	future2Bytes, err := json.Marshal(&model.TableInfo{ID: 124, Name: model.NewCIStr("t2")})
+	c.Assert(err, IsNil)
+	future2 := append(future2Bytes[:len(future2Bytes)-1:len(future2Bytes)-1], []byte(`,"future_field":2}`)...)
+	loader := NewBackupTablesLoader()
+	c.Assert(loader.AddSchema(&backup.Schema{Db: dbBytes, Table: future}), IsNil)
+	c.Assert(loader.AddSchema(&backup.Schema{Db: dbBytes, Table: future2}), IsNil)
+	c.Assert(loader.unknownTableFields, DeepEquals, unknownFields{"future_field": 2})
+	c.Assert(loader.unknownDBFields, HasLen, 0)
+
+	tblBytes, err = json.Marshal(&model.TableInfo{
+		ID: 123, Name: model.NewCIStr("t1"), Version: model.CurrLatestTableInfoVersion + 1,
+	})
+	c.Assert(err, IsNil)
+	meta = mockBackupMeta([]*backup.Schema{{Db: dbBytes, Table: tblBytes}}, nil)
+	_, err = LoadBackupTables(meta)
+	c.Assert(err, ErrorMatches, ".*table `test`.`t1` is of table info version.*")
+
+	c.Assert(CheckSchemaVersion(0), IsNil)
+	c.Assert(CheckSchemaVersion(SchemaVersion), IsNil)
+	c.Assert(CheckSchemaVersion(SchemaVersion+1), ErrorMatches, ".*please restore by a newer BR.*")
+}
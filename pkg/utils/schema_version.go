@@ -0,0 +1,129 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"go.uber.org/zap/zapcore"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+)
+
+// SchemaVersion is the version of the serialization of the schemas in the
+// backupmeta, the database, the table and the stats are serialized in JSON
+// by version 1. It's increased when the serialization changes incompatibly,
+// so the older BR refuses to restore the schemas it can't read.
+const SchemaVersion = 1
+
+var (
+	dbInfoFields    = jsonFieldNames(reflect.TypeOf(model.DBInfo{}))
+	tableInfoFields = jsonFieldNames(reflect.TypeOf(model.TableInfo{}))
+)
+
+// CheckSchemaVersion fails if the schemas are serialized by a newer version
+// than this BR supports. The version is 0 if the backup doesn't record it,
+// which is serialized as version 1.
+func CheckSchemaVersion(version int) error {
+	if version > SchemaVersion {
+		return errors.Annotatef(berrors.ErrRestoreSchemaIncompatible,
+			"the schemas are serialized by version %d, but this BR only reads up to version %d, "+
+				"please restore by a newer BR", version, SchemaVersion)
+	}
+	return nil
+}
+
+// checkTableCompatible fails if the table is of a newer table info version
+// than the TiDB this BR depends on. It returns the fields of the database and
+// the table unknown to this BR, which are added by a newer TiDB and dropped
+// when the table is created.
+func checkTableCompatible(
+	dbData, tableData []byte, dbInfo *model.DBInfo, tableInfo *model.TableInfo,
+) (unknownDBFields, unknownTableFields []string, err error) {
+	if tableInfo.Version > model.CurrLatestTableInfoVersion {
+		name := EncloseName(dbInfo.Name.O) + "." + EncloseName(tableInfo.Name.O)
+		return nil, nil, errors.Annotatef(berrors.ErrRestoreSchemaIncompatible,
+			"table %s is of table info version %d, but this BR only supports up to version %d, "+
+				"please restore by a newer BR", name, tableInfo.Version, model.CurrLatestTableInfoVersion)
+	}
+	unknownDBFields, err = unknownJSONFields(dbData, dbInfoFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	unknownTableFields, err = unknownJSONFields(tableData, tableInfoFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return unknownDBFields, unknownTableFields, nil
+}
+
+// unknownFields counts the tables having each field unknown to this BR, so
+// the fields are warned about once rather than table by table.
+type unknownFields map[string]int
+
+func (u unknownFields) add(fields []string) {
+	for _, field := range fields {
+		u[field]++
+	}
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler.
+func (u unknownFields) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	fields := make([]string, 0, len(u))
+	for field := range u {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		enc.AddInt(field, u[field])
+	}
+	return nil
+}
+
+// unknownJSONFields returns the sorted fields of the JSON object which are
+// not in the known fields. The fields are compared case-insensitively as
+// encoding/json does.
+func unknownJSONFields(data []byte, known map[string]bool) ([]string, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.Trace(err)
+	}
+	unknown := make([]string, 0)
+	for field := range fields {
+		if !known[strings.ToLower(field)] {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+// jsonFieldNames returns the lower cased JSON names of the fields of the
+// struct, including the fields of the embedded structs.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embedded := range jsonFieldNames(field.Type) {
+				names[embedded] = true
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	return names
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// TokenBucket paces a stream of work by its size, e.g. bytes ingested,
+// so the throughput is smooth instead of bursting then idling.
+// The rate can be changed at runtime, zero rate means unlimited.
+type TokenBucket struct {
+	mu sync.Mutex
+	// rate is the number of tokens refilled per second.
+	rate uint64
+	// burst is the max number of tokens can be accumulated.
+	burst uint64
+	// tokens may be negative, that is the debt of the consumed tokens.
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a token bucket with the given rate(per second),
+// the burst is a second of tokens.
+func NewTokenBucket(rate uint64) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  rate,
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// Rate returns the current rate of the bucket.
+func (b *TokenBucket) Rate() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate
+}
+
+// SetRate changes the rate of the bucket.
+func (b *TokenBucket) SetRate(rate uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	b.rate = rate
+	b.burst = rate
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	log.Info("token bucket rate changed", zap.Uint64("rate", rate))
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	b.last = now
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens += elapsed.Seconds() * float64(b.rate)
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+}
+
+// reserve takes n tokens and returns how long should the caller wait.
+func (b *TokenBucket) reserve(n uint64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate == 0 {
+		return 0
+	}
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+}
+
+// Wait takes n tokens from the bucket, blocks until the tokens are paid off.
+func (b *TokenBucket) Wait(ctx context.Context, n uint64) error {
+	wait := b.reserve(n)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// ServeHTTP implements http.Handler, `GET` returns the current rate,
+// and `POST` with the `rate` query changes the rate.
+func (b *TokenBucket) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		rate, err := strconv.ParseUint(req.URL.Query().Get("rate"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid rate: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		b.SetRate(rate)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]uint64{"rate": b.Rate()})
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type testTokenBucketSuite struct{}
+
+var _ = Suite(&testTokenBucketSuite{})
+
+func (*testTokenBucketSuite) TestUnlimited(c *C) {
+	b := NewTokenBucket(0)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		c.Assert(b.Wait(context.Background(), 1<<30), IsNil)
+	}
+	c.Assert(time.Since(start), Less, time.Second)
+}
+
+func (*testTokenBucketSuite) TestPacing(c *C) {
+	b := NewTokenBucket(1000)
+	// The initial burst is free.
+	c.Assert(b.reserve(1000), Equals, time.Duration(0))
+	// Then we owe the bucket.
+	wait := b.reserve(500)
+	c.Assert(wait > 400*time.Millisecond && wait <= 500*time.Millisecond, IsTrue, Commentf("%s", wait))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(b.Wait(ctx, 1000), Equals, context.Canceled)
+}
+
+func (*testTokenBucketSuite) TestSetRate(c *C) {
+	b := NewTokenBucket(1000)
+	b.SetRate(0)
+	c.Assert(b.reserve(1<<30), Equals, time.Duration(0))
+	b.SetRate(10)
+	c.Assert(b.Rate(), Equals, uint64(10))
+
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/?rate=42", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(b.Rate(), Equals, uint64(42))
+
+	w = httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/?rate=abc", nil))
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	c.Assert(b.Rate(), Equals, uint64(42))
+}
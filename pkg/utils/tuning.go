@@ -0,0 +1,135 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// LogLevelPath is the path of the status server to change the log level.
+	LogLevelPath = "/log-level"
+)
+
+// TunableUint64 is an uint64 parameter that can be changed while the task runs.
+type TunableUint64 struct {
+	name  string
+	value uint64
+	// onChange is called after the value is changed.
+	onChange func()
+}
+
+// NewTunableUint64 creates a tunable parameter with the initial value.
+func NewTunableUint64(name string, value uint64) *TunableUint64 {
+	return &TunableUint64{name: name, value: value}
+}
+
+// Load returns the current value.
+func (t *TunableUint64) Load() uint64 {
+	return atomic.LoadUint64(&t.value)
+}
+
+// Store changes the value.
+func (t *TunableUint64) Store(value uint64) {
+	old := atomic.SwapUint64(&t.value, value)
+	log.Info("parameter changed", zap.String("name", t.name),
+		zap.Uint64("old", old), zap.Uint64("new", value))
+	if t.onChange != nil {
+		t.onChange()
+	}
+}
+
+// OnChange sets the function called after the value is changed, it's set
+// before the parameter is shared.
+func (t *TunableUint64) OnChange(f func()) {
+	t.onChange = f
+}
+
+// ServeHTTP implements http.Handler, `GET` returns the current value,
+// and `POST` with the `value` query changes the value.
+func (t *TunableUint64) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		value, err := strconv.ParseUint(req.URL.Query().Get("value"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		t.Store(value)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]uint64{t.name: t.Load()})
+}
+
+// LogLevelHandler changes the level of the global logger,
+// `GET` returns the current level, and `POST` with the `level` query changes it.
+func LogLevelHandler(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		if err := SetLogLevel(req.URL.Query().Get("level")); err != nil {
+			http.Error(w, "invalid level: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"level": log.GetLevel().String()})
+}
+
+// SetLogLevel changes the level of the global logger.
+func SetLogLevel(text string) error {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(text)); err != nil {
+		return errors.Trace(err)
+	}
+	log.SetLevel(level)
+	log.Info("log level changed", zap.Stringer("level", level))
+	return nil
+}
+
+var (
+	tunablesMu sync.Mutex
+	tunables   = make(map[string]func(uint64))
+)
+
+// SetTunable sets the function changing the parameter of the flag when the
+// config is reloaded, it replaces the previous one, and a nil function unsets
+// the flag.
+func SetTunable(flag string, set func(value uint64)) {
+	tunablesMu.Lock()
+	defer tunablesMu.Unlock()
+	if set == nil {
+		delete(tunables, flag)
+		return
+	}
+	tunables[flag] = set
+}
+
+// Tune changes the parameter of the flag, it returns false if the parameter
+// isn't tunable.
+func Tune(flag string, value uint64) bool {
+	tunablesMu.Lock()
+	set := tunables[flag]
+	tunablesMu.Unlock()
+	if set == nil {
+		return false
+	}
+	set(value)
+	return true
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/pingcap/check"
+)
+
+type testTuningSuite struct{}
+
+var _ = Suite(&testTuningSuite{})
+
+func (*testTuningSuite) TestTunableUint64(c *C) {
+	t := NewTunableUint64("ratelimit", 10)
+	c.Assert(t.Load(), Equals, uint64(10))
+
+	w := httptest.NewRecorder()
+	t.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/?value=20", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(t.Load(), Equals, uint64(20))
+
+	w = httptest.NewRecorder()
+	t.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/", nil))
+	c.Assert(w.Code, Equals, http.StatusMethodNotAllowed)
+	c.Assert(t.Load(), Equals, uint64(20))
+}
+
+func (*testTuningSuite) TestTunableOnChange(c *C) {
+	t := NewTunableUint64("concurrency", 4)
+	changed := 0
+	t.OnChange(func() { changed++ })
+	t.Store(8)
+	c.Assert(changed, Equals, 1)
+	c.Assert(t.Load(), Equals, uint64(8))
+}
+
+func (*testTuningSuite) TestTune(c *C) {
+	var value uint64
+	c.Assert(Tune("ratelimit", 10), IsFalse)
+
+	SetTunable("ratelimit", func(v uint64) { value = v })
+	c.Assert(Tune("ratelimit", 10), IsTrue)
+	c.Assert(value, Equals, uint64(10))
+	c.Assert(Tune("concurrency", 20), IsFalse)
+
+	SetTunable("ratelimit", nil)
+	c.Assert(Tune("ratelimit", 30), IsFalse)
+	c.Assert(value, Equals, uint64(10))
+}
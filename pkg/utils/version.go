@@ -67,6 +67,20 @@ func removeVAndHash(v string) string {
 	return strings.TrimPrefix(v, "v")
 }
 
+// VersionSkewed checks whether the major or minor versions of the components
+// are different, the versions that can't be parsed aren't considered skewed.
+func VersionSkewed(a, b string) bool {
+	va, err := semver.NewVersion(removeVAndHash(a))
+	if err != nil {
+		return false
+	}
+	vb, err := semver.NewVersion(removeVAndHash(b))
+	if err != nil {
+		return false
+	}
+	return va.Major != vb.Major || va.Minor != vb.Minor
+}
+
 func checkTiFlashVersion(store *metapb.Store) error {
 	flash, err := semver.NewVersion(removeVAndHash(store.Version))
 	if err != nil {
@@ -87,6 +101,44 @@ func checkTiFlashVersion(store *metapb.Store) error {
 	return nil
 }
 
+// checkTiKVVersion checks whether the version of the store works with BR,
+// the version of the store is returned.
+func checkTiKVVersion(s *metapb.Store, brVersion *semver.Version) (*semver.Version, error) {
+	tikvVersionString := removeVAndHash(s.Version)
+	tikvVersion, err := semver.NewVersion(tikvVersionString)
+	if err != nil {
+		return nil, errors.Annotatef(berrors.ErrVersionMismatch, "%s: TiKV node %s version %s is invalid", err, s.Address, tikvVersionString)
+	}
+
+	if tikvVersion.Compare(*minTiKVVersion) < 0 {
+		return nil, errors.Annotatef(berrors.ErrVersionMismatch, "TiKV node %s version %s don't support BR, please upgrade cluster to %s",
+			s.Address, tikvVersionString, BRReleaseVersion)
+	}
+
+	if tikvVersion.Major != brVersion.Major {
+		return nil, errors.Annotatef(berrors.ErrVersionMismatch, "TiKV node %s version %s and BR %s major version mismatch, please use the same version of BR",
+			s.Address, tikvVersionString, BRReleaseVersion)
+	}
+
+	// BR(https://github.com/pingcap/br/pull/233) and TiKV(https://github.com/tikv/tikv/pull/7241) have breaking changes
+	// if BR include #233 and TiKV not include #7241, BR will panic TiKV during restore
+	// These incompatible version is 3.1.0 and 4.0.0-rc.1
+	if tikvVersion.Major == 3 {
+		if tikvVersion.Compare(*incompatibleTiKVMajor3) < 0 && brVersion.Compare(*incompatibleTiKVMajor3) >= 0 {
+			return nil, errors.Annotatef(berrors.ErrVersionMismatch, "TiKV node %s version %s and BR %s version mismatch, please use the same version of BR",
+				s.Address, tikvVersionString, BRReleaseVersion)
+		}
+	}
+
+	if tikvVersion.Major == 4 {
+		if tikvVersion.Compare(*incompatibleTiKVMajor4) < 0 && brVersion.Compare(*incompatibleTiKVMajor4) >= 0 {
+			return nil, errors.Annotatef(berrors.ErrVersionMismatch, "TiKV node %s version %s and BR %s version mismatch, please use the same version of BR",
+				s.Address, tikvVersionString, BRReleaseVersion)
+		}
+	}
+	return tikvVersion, nil
+}
+
 // CheckClusterVersion check TiKV version.
 func CheckClusterVersion(ctx context.Context, client pd.Client) error {
 	BRVersion, err := semver.NewVersion(removeVAndHash(BRReleaseVersion))
@@ -97,6 +149,10 @@ func CheckClusterVersion(ctx context.Context, client pd.Client) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	// The first TiKV store, to find out the stores of mixed versions.
+	var firstTiKV *metapb.Store
+	var firstTiKVVersion *semver.Version
+	warned := false
 	for _, s := range stores {
 		isTiFlash := IsTiFlash(s)
 		log.Debug("checking compatibility of store in cluster",
@@ -112,43 +168,99 @@ func CheckClusterVersion(ctx context.Context, client pd.Client) error {
 		}
 
 		tikvVersionString := removeVAndHash(s.Version)
-		tikvVersion, err := semver.NewVersion(tikvVersionString)
+		tikvVersion, err := checkTiKVVersion(s, BRVersion)
 		if err != nil {
-			return errors.Annotatef(berrors.ErrVersionMismatch, "%s: TiKV node %s version %s is invalid", err, s.Address, tikvVersionString)
-		}
-
-		if tikvVersion.Compare(*minTiKVVersion) < 0 {
-			return errors.Annotatef(berrors.ErrVersionMismatch, "TiKV node %s version %s don't support BR, please upgrade cluster to %s",
-				s.Address, tikvVersionString, BRReleaseVersion)
+			return err
 		}
 
-		if tikvVersion.Major != BRVersion.Major {
-			return errors.Annotatef(berrors.ErrVersionMismatch, "TiKV node %s version %s and BR %s major version mismatch, please use the same version of BR",
-				s.Address, tikvVersionString, BRReleaseVersion)
-		}
-
-		// BR(https://github.com/pingcap/br/pull/233) and TiKV(https://github.com/tikv/tikv/pull/7241) have breaking changes
-		// if BR include #233 and TiKV not include #7241, BR will panic TiKV during restore
-		// These incompatible version is 3.1.0 and 4.0.0-rc.1
-		if tikvVersion.Major == 3 {
-			if tikvVersion.Compare(*incompatibleTiKVMajor3) < 0 && BRVersion.Compare(*incompatibleTiKVMajor3) >= 0 {
-				return errors.Annotatef(berrors.ErrVersionMismatch, "TiKV node %s version %s and BR %s version mismatch, please use the same version of BR",
-					s.Address, tikvVersionString, BRReleaseVersion)
-			}
-		}
-
-		if tikvVersion.Major == 4 {
-			if tikvVersion.Compare(*incompatibleTiKVMajor4) < 0 && BRVersion.Compare(*incompatibleTiKVMajor4) >= 0 {
-				return errors.Annotatef(berrors.ErrVersionMismatch, "TiKV node %s version %s and BR %s version mismatch, please use the same version of BR",
-					s.Address, tikvVersionString, BRReleaseVersion)
+		// The stores of different minor versions may handle the requests
+		// differently, it usually means the cluster is being upgraded.
+		if !isTiFlash {
+			if firstTiKV == nil {
+				firstTiKV, firstTiKVVersion = s, tikvVersion
+			} else if tikvVersion.Major != firstTiKVVersion.Major || tikvVersion.Minor != firstTiKVVersion.Minor {
+				return errors.Annotatef(berrors.ErrVersionMismatch, "TiKV node %s version %s and node %s version %s mismatch, "+
+					"the cluster may be upgrading, please retry after all nodes are upgraded",
+					s.Address, tikvVersionString, firstTiKV.Address, removeVAndHash(firstTiKV.Version))
 			}
 		}
 
 		// don't warn if we are the master build, which always have the version v4.0.0-beta.2-*
-		if BRGitBranch != "master" && tikvVersion.Compare(*BRVersion) > 0 {
+		if !warned && BRGitBranch != "master" && tikvVersion.Compare(*BRVersion) > 0 {
 			log.Warn(fmt.Sprintf("BR version is outdated, please consider use version %s of BR", tikvVersionString))
-			break
+			warned = true
 		}
 	}
 	return nil
 }
+
+// The verdicts of the compatibility of the components with BR.
+const (
+	VersionSupported   = "supported"
+	VersionDegraded    = "degraded"
+	VersionUnsupported = "unsupported"
+)
+
+// The components of the cluster, the version of PD is the cluster version.
+const (
+	ComponentPD      = "pd"
+	ComponentTiKV    = "tikv"
+	ComponentTiFlash = "tiflash"
+	ComponentTiDB    = "tidb"
+)
+
+// ComponentVersion is the version of a component and whether BR works with it.
+type ComponentVersion struct {
+	Component string `json:"component"`
+	Address   string `json:"address"`
+	Version   string `json:"version"`
+	Verdict   string `json:"verdict"`
+	// Reason explains the verdict if the component isn't supported.
+	Reason string `json:"reason,omitempty"`
+}
+
+// CheckComponentVersion checks whether BR works with the component. The
+// stores refused by CheckClusterVersion and the components of another major
+// version are unsupported, the components of another minor version are
+// degraded, since the features of BR may be unavailable or behave
+// differently with them.
+func CheckComponentVersion(component, address, version string) ComponentVersion {
+	cv := ComponentVersion{Component: component, Address: address, Version: version, Verdict: VersionSupported}
+	brVersion, err := semver.NewVersion(removeVAndHash(BRReleaseVersion))
+	if err != nil {
+		cv.Verdict, cv.Reason = VersionDegraded, "BR isn't built from a release, the compatibility is unknown"
+		return cv
+	}
+	switch component {
+	case ComponentTiKV, ComponentTiFlash:
+		store := &metapb.Store{Address: address, PeerAddress: address, Version: version}
+		if component == ComponentTiFlash {
+			err = checkTiFlashVersion(store)
+		}
+		if err == nil {
+			_, err = checkTiKVVersion(store, brVersion)
+		}
+		if err != nil {
+			cv.Verdict, cv.Reason = VersionUnsupported, err.Error()
+			return cv
+		}
+	default:
+		v, parseErr := semver.NewVersion(removeVAndHash(version))
+		if parseErr != nil {
+			cv.Verdict, cv.Reason = VersionDegraded, "the version is invalid, the compatibility is unknown"
+			return cv
+		}
+		if v.Major != brVersion.Major {
+			cv.Verdict = VersionUnsupported
+			cv.Reason = fmt.Sprintf("the major version is different from BR %s, please use the same version of BR",
+				BRReleaseVersion)
+			return cv
+		}
+	}
+	if VersionSkewed(version, BRReleaseVersion) {
+		cv.Verdict = VersionDegraded
+		cv.Reason = fmt.Sprintf("the minor version is different from BR %s, some features may be unavailable"+
+			" or behave differently", BRReleaseVersion)
+	}
+	return cv
+}
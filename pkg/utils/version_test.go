@@ -131,6 +131,26 @@ func (s *versionSuite) TestCheckClusterVersion(c *check.C) {
 		err := CheckClusterVersion(context.Background(), &mock)
 		c.Assert(err, check.IsNil)
 	}
+
+	{
+		BRReleaseVersion = "v4.0.8"
+		mock.getAllStores = func() []*metapb.Store {
+			// TiKV v4.0.7 and v4.0.8 in the same cluster is ok
+			return []*metapb.Store{{Version: "v4.0.7"}, {Version: "v4.0.8"}}
+		}
+		err := CheckClusterVersion(context.Background(), &mock)
+		c.Assert(err, check.IsNil)
+	}
+
+	{
+		BRReleaseVersion = "v4.0.8"
+		mock.getAllStores = func() []*metapb.Store {
+			// TiKV v4.0.8 and v4.1.0 in the same cluster is upgrading
+			return []*metapb.Store{{Version: "v4.0.8"}, {Version: "v4.1.0"}}
+		}
+		err := CheckClusterVersion(context.Background(), &mock)
+		c.Assert(err, check.ErrorMatches, "TiKV .* mismatch, the cluster may be upgrading.*")
+	}
 }
 
 func (s *versionSuite) TestCompareVersion(c *check.C) {
@@ -149,3 +169,37 @@ func (s *versionSuite) TestCompareVersion(c *check.C) {
 	c.Assert(semver.New(removeVAndHash("v2.1.0-rc.1-7-g38c939f-dirty")).
 		Compare(*semver.New("2.1.0-rc.1")), check.Equals, 0)
 }
+
+func (s *versionSuite) TestVersionSkewed(c *check.C) {
+	c.Assert(VersionSkewed("v4.0.8", "v4.0.9-5-g1234567"), check.IsFalse)
+	c.Assert(VersionSkewed("v4.0.8", "v5.0.0-rc"), check.IsTrue)
+	c.Assert(VersionSkewed("v4.0.8", "v4.1.0"), check.IsTrue)
+	c.Assert(VersionSkewed("None", "v4.0.8"), check.IsFalse)
+}
+
+func (s *versionSuite) TestCheckComponentVersion(c *check.C) {
+	BRReleaseVersion = "v4.0.8"
+	cv := CheckComponentVersion(ComponentTiKV, "127.0.0.1:20160", "v4.0.8")
+	c.Assert(cv.Verdict, check.Equals, VersionSupported)
+	c.Assert(cv.Reason, check.Equals, "")
+	cv = CheckComponentVersion(ComponentTiDB, "127.0.0.1:4000", "v4.0.6")
+	c.Assert(cv.Verdict, check.Equals, VersionSupported)
+
+	cv = CheckComponentVersion(ComponentPD, "127.0.0.1:2379", "v4.1.0")
+	c.Assert(cv.Verdict, check.Equals, VersionDegraded)
+	c.Assert(cv.Reason, check.Matches, "the minor version is different.*")
+	cv = CheckComponentVersion(ComponentTiDB, "127.0.0.1:4000", "None")
+	c.Assert(cv.Verdict, check.Equals, VersionDegraded)
+
+	cv = CheckComponentVersion(ComponentTiKV, "127.0.0.1:20160", "v3.0.14")
+	c.Assert(cv.Verdict, check.Equals, VersionUnsupported)
+	cv = CheckComponentVersion(ComponentTiFlash, "127.0.0.1:3930", "v4.0.0-rc.1")
+	c.Assert(cv.Verdict, check.Equals, VersionUnsupported)
+	c.Assert(cv.Reason, check.Matches, "incompatible.*")
+	cv = CheckComponentVersion(ComponentPD, "127.0.0.1:2379", "v5.0.0")
+	c.Assert(cv.Verdict, check.Equals, VersionUnsupported)
+
+	BRReleaseVersion = "None"
+	cv = CheckComponentVersion(ComponentTiKV, "127.0.0.1:20160", "v4.0.8")
+	c.Assert(cv.Verdict, check.Equals, VersionDegraded)
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	berrors "github.com/pingcap/br/pkg/errors"
+)
+
+const windowClockLayout = "15:04"
+
+// TimeWindow is a daily window of the local clock like "22:00-06:00",
+// the end may be earlier than the start, that means the window crosses midnight.
+// The window follows the wall clock, so it's shorter or longer on the days the
+// daylight saving time begins or ends.
+type TimeWindow struct {
+	// start and end are the wall clock offsets since midnight.
+	start time.Duration
+	end   time.Duration
+}
+
+// ParseTimeWindow parses a window in the format of "HH:MM-HH:MM".
+func ParseTimeWindow(s string) (TimeWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return TimeWindow{}, errors.Annotatef(berrors.ErrInvalidArgument,
+			"invalid time window '%s', it should be like '22:00-06:00'", s)
+	}
+	var offsets [2]time.Duration
+	for i, part := range parts {
+		t, err := time.Parse(windowClockLayout, strings.TrimSpace(part))
+		if err != nil {
+			return TimeWindow{}, errors.Annotatef(berrors.ErrInvalidArgument,
+				"invalid time window '%s': %v", s, err)
+		}
+		offsets[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if offsets[0] == offsets[1] {
+		return TimeWindow{}, errors.Annotatef(berrors.ErrInvalidArgument,
+			"invalid time window '%s', the start and the end are the same", s)
+	}
+	return TimeWindow{start: offsets[0], end: offsets[1]}, nil
+}
+
+// clockOffset returns the offset of the wall clock of t since midnight.
+func clockOffset(t time.Time) time.Duration {
+	hour, min, sec := t.Clock()
+	return time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute +
+		time.Duration(sec)*time.Second + time.Duration(t.Nanosecond())
+}
+
+// atClock returns the time of the wall clock offset on the day of t plus days.
+func atClock(t time.Time, days int, offset time.Duration) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day+days,
+		int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, t.Location())
+}
+
+func (w TimeWindow) crossesMidnight() bool {
+	return w.end < w.start
+}
+
+// Contains returns whether t is in the window.
+func (w TimeWindow) Contains(t time.Time) bool {
+	offset := clockOffset(t)
+	if w.crossesMidnight() {
+		return offset >= w.start || offset < w.end
+	}
+	return offset >= w.start && offset < w.end
+}
+
+// NextStart returns t if it's in the window, or the start of the next window.
+func (w TimeWindow) NextStart(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	if clockOffset(t) < w.start {
+		return atClock(t, 0, w.start)
+	}
+	return atClock(t, 1, w.start)
+}
+
+// End returns the end of the window which t is in, or the end of the next window.
+func (w TimeWindow) End(t time.Time) time.Time {
+	start := w.NextStart(t)
+	if w.crossesMidnight() && clockOffset(start) >= w.start {
+		return atClock(start, 1, w.end)
+	}
+	return atClock(start, 0, w.end)
+}
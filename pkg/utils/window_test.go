@@ -0,0 +1,89 @@
+// Copyright 2020 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type testWindowSuite struct{}
+
+var _ = Suite(&testWindowSuite{})
+
+func at(day, hour, min int) time.Time {
+	return time.Date(2020, 12, day, hour, min, 0, 0, time.Local)
+}
+
+func (*testWindowSuite) TestParseTimeWindow(c *C) {
+	_, err := ParseTimeWindow("22:00")
+	c.Assert(err, ErrorMatches, ".*invalid time window.*")
+	_, err = ParseTimeWindow("22:00-25:00")
+	c.Assert(err, ErrorMatches, ".*invalid time window.*")
+	_, err = ParseTimeWindow("22:00-22:00")
+	c.Assert(err, ErrorMatches, ".*the start and the end are the same.*")
+	w, err := ParseTimeWindow("22:00 - 06:30")
+	c.Assert(err, IsNil)
+	c.Assert(w, Equals, TimeWindow{start: 22 * time.Hour, end: 6*time.Hour + 30*time.Minute})
+}
+
+func (*testWindowSuite) TestWindowCrossesMidnight(c *C) {
+	w, err := ParseTimeWindow("22:00-06:00")
+	c.Assert(err, IsNil)
+
+	c.Assert(w.Contains(at(1, 23, 0)), IsTrue)
+	c.Assert(w.Contains(at(2, 5, 59)), IsTrue)
+	c.Assert(w.Contains(at(2, 6, 0)), IsFalse)
+	c.Assert(w.Contains(at(2, 12, 0)), IsFalse)
+
+	c.Assert(w.NextStart(at(2, 12, 0)).Equal(at(2, 22, 0)), IsTrue)
+	c.Assert(w.NextStart(at(2, 1, 0)).Equal(at(2, 1, 0)), IsTrue)
+	c.Assert(w.End(at(1, 23, 0)).Equal(at(2, 6, 0)), IsTrue)
+	c.Assert(w.End(at(2, 1, 0)).Equal(at(2, 6, 0)), IsTrue)
+	c.Assert(w.End(at(2, 12, 0)).Equal(at(3, 6, 0)), IsTrue)
+}
+
+func (*testWindowSuite) TestWindowInDay(c *C) {
+	w, err := ParseTimeWindow("01:00-05:00")
+	c.Assert(err, IsNil)
+
+	c.Assert(w.Contains(at(1, 0, 30)), IsFalse)
+	c.Assert(w.Contains(at(1, 3, 0)), IsTrue)
+	c.Assert(w.Contains(at(1, 5, 0)), IsFalse)
+
+	c.Assert(w.NextStart(at(1, 0, 30)).Equal(at(1, 1, 0)), IsTrue)
+	c.Assert(w.NextStart(at(1, 6, 0)).Equal(at(2, 1, 0)), IsTrue)
+	c.Assert(w.End(at(1, 3, 0)).Equal(at(1, 5, 0)), IsTrue)
+	c.Assert(w.End(at(1, 6, 0)).Equal(at(2, 5, 0)), IsTrue)
+}
+
+func (*testWindowSuite) TestWindowDaylightSaving(c *C) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		c.Skip("no time zone database")
+	}
+	w, err := ParseTimeWindow("01:00-05:00")
+	c.Assert(err, IsNil)
+
+	// The clocks skip from 02:00 to 03:00 on 2020-03-08, and go back from
+	// 02:00 to 01:00 on 2020-11-01.
+	for _, day := range []int{8, 1} {
+		month := time.March
+		if day == 1 {
+			month = time.November
+		}
+		t := time.Date(2020, month, day, 1, 30, 0, 0, loc)
+		c.Assert(w.Contains(t), IsTrue)
+		end := w.End(t)
+		c.Assert(end.Hour(), Equals, 5)
+		c.Assert(end.Minute(), Equals, 0)
+		c.Assert(end.Day(), Equals, day)
+		start := w.NextStart(end)
+		c.Assert(start.Hour(), Equals, 1)
+		c.Assert(start.Day(), Equals, day+1)
+	}
+	t := time.Date(2020, time.March, 8, 4, 30, 0, 0, loc)
+	c.Assert(w.Contains(t), IsTrue)
+	c.Assert(w.Contains(t.Add(time.Hour)), IsFalse)
+}
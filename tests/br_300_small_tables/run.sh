@@ -42,6 +42,6 @@ done
 # restore db
 # (FIXME: shouldn't need --no-schema to be fast, currently the alter-auto-id DDL slows things down)
 echo "restore start..."
-run_br restore db --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR --no-schema
+run_br restore db --allow-same-cluster --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR --no-schema
 
 run_sql "DROP DATABASE $DB;"
@@ -26,7 +26,7 @@ fi
 
 # restore empty.
 echo "restore start..."
-run_br restore full -s "local://$TEST_DIR/empty_db" --pd $PD_ADDR --ratelimit 1024
+run_br restore full --allow-same-cluster -s "local://$TEST_DIR/empty_db" --pd $PD_ADDR --ratelimit 1024
 if [ $? -ne 0 ]; then
     echo "TEST: [$TEST_NAME] failed on restore empty cluster!"
     exit 1
@@ -45,7 +45,7 @@ run_br --pd $PD_ADDR backup full -s "local://$TEST_DIR/empty_table" --ratelimit
 
 run_sql "DROP DATABASE $DB;"
 echo "restore start..."
-run_br --pd $PD_ADDR restore full -s "local://$TEST_DIR/empty_table" --ratelimit 5 --concurrency 4
+run_br --pd $PD_ADDR restore full --allow-same-cluster -s "local://$TEST_DIR/empty_table" --ratelimit 5 --concurrency 4
 
 # insert one row to make sure table is restored.
 run_sql "INSERT INTO $DB.usertable1 VALUES (\"a\", \"b\");"
@@ -35,7 +35,7 @@ run_sql "DROP DATABASE $DB;"
 
 # restore table with upper name success
 echo "restore start..."
-run_br --pd $PD_ADDR restore table --db "$DB" --table "USERTABLE1" -s "local://$TEST_DIR/$DB"
+run_br --pd $PD_ADDR restore table --allow-same-cluster --db "$DB" --table "USERTABLE1" -s "local://$TEST_DIR/$DB"
 
 table_count=$(run_sql "use $DB; show tables;" | grep "Tables_in" | wc -l)
 if [ "$table_count" -ne "1" ];then
@@ -43,7 +43,7 @@ run_sql "DROP DATABASE $DB;"
 
 # restore db
 echo "restore start..."
-run_br restore db --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
+run_br restore db --allow-same-cluster --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
 
 table_count=$(run_sql "use $DB; show tables;" | grep "Tables_in" | wc -l)
 if [ "$table_count" -ne "2" ];then
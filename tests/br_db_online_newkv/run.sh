@@ -64,7 +64,7 @@ sleep 5
 
 # restore db
 echo "restore start..."
-run_br restore db --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR --online
+run_br restore db --allow-same-cluster --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR --online
 
 # TODO we should check whether the restore RPCs are send to the new TiKV.
 table_count=$(run_sql "use $DB; show tables;" | grep "Tables_in" | wc -l)
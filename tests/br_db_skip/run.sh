@@ -37,7 +37,7 @@ run_sql "CREATE DATABASE $DB;"
 # restore db with skip-create-sql must failed
 echo "restore start but must failed"
 fail=false
-run_br restore db --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR --no-schema=true || fail=true
+run_br restore db --allow-same-cluster --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR --no-schema=true || fail=true
 if $fail; then
     # Error: [schema:1146]Table 'br_db_skip.usertable1' doesn't exist
     echo "TEST: [$TEST_NAME] restore $DB with no-schema must failed"
@@ -55,7 +55,7 @@ run_sql "CREATE TABLE $DB.usertable1 ( \
 
 echo "restore start must succeed"
 fail=false
-run_br restore db --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR --no-schema=true || fail=true
+run_br restore db --allow-same-cluster --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR --no-schema=true || fail=true
 if $fail; then
     echo "TEST: [$TEST_NAME] restore $DB with no-schema failed"
     exit 1
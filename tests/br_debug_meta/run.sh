@@ -56,10 +56,20 @@ fi
 
 # replace backupmeta
 mv "$TEST_DIR/$DB/backupmeta_from_json" "$TEST_DIR/$DB/backupmeta"
+mv "$TEST_DIR/$DB/backupmeta_from_json.envelope" "$TEST_DIR/$DB/backupmeta.envelope"
+
+# Test the aliases, encode-backupmeta writes backupmeta if it doesn't exist
+run_br debug decode-backupmeta -s "local://$TEST_DIR/$DB"
+rm "$TEST_DIR/$DB/backupmeta" "$TEST_DIR/$DB/backupmeta.envelope"
+run_br debug encode-backupmeta -s "local://$TEST_DIR/$DB"
+if [ ! -f "$TEST_DIR/$DB/backupmeta" ] || [ ! -f "$TEST_DIR/$DB/backupmeta.envelope" ]; then
+    echo "TEST: [$TEST_NAME] encode-backupmeta failed!"
+    exit 1
+fi
 
 # restore table
 echo "restore start..."
-run_br --pd $PD_ADDR restore table --db $DB --table usertable1 -s "local://$TEST_DIR/$DB"
+run_br --pd $PD_ADDR restore table --allow-same-cluster --db $DB --table usertable1 -s "local://$TEST_DIR/$DB"
 
 row_count_new=$(run_sql "SELECT COUNT(*) FROM $DB.$TABLE;" | awk '/COUNT/{print $2}')
 
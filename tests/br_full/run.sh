@@ -55,7 +55,7 @@ for ct in limit lz4 zstd; do
 
   # restore full
   echo "restore with $ct backup start..."
-  run_br restore full -s "local://$TEST_DIR/$DB-$ct" --pd $PD_ADDR --ratelimit 1024
+  run_br restore full --allow-same-cluster -s "local://$TEST_DIR/$DB-$ct" --pd $PD_ADDR --ratelimit 1024
 
   for i in $(seq $DB_COUNT); do
       row_count_new[${i}]=$(run_sql "SELECT COUNT(*) FROM $DB${i}.$TABLE;" | awk '/COUNT/{print $2}')
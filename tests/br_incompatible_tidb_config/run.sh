@@ -52,9 +52,9 @@ run_br --pd $PD_ADDR backup db --db "$DB" -s "local://$TEST_DIR/$DB$INCREMENTAL_
 # restore
 run_sql "drop schema $DB;"
 
-run_br --pd $PD_ADDR restore db --db "$DB" -s "local://$TEST_DIR/$DB$TABLE"
+run_br --pd $PD_ADDR restore db --allow-same-cluster --db "$DB" -s "local://$TEST_DIR/$DB$TABLE"
 
-run_br --pd $PD_ADDR restore db --db "$DB" -s "local://$TEST_DIR/$DB$INCREMENTAL_TABLE"
+run_br --pd $PD_ADDR restore db --allow-same-cluster --db "$DB" -s "local://$TEST_DIR/$DB$INCREMENTAL_TABLE"
 
 run_sql "drop schema $DB;"
 run_sql "create schema $DB;"
@@ -69,7 +69,7 @@ run_br --pd $PD_ADDR backup db --db "$DB" -s "local://$TEST_DIR/$DB$TABLE"
 
 # restore
 run_sql "drop schema $DB;"
-run_br --pd $PD_ADDR restore db --db "$DB" -s "local://$TEST_DIR/$DB$TABLE"
+run_br --pd $PD_ADDR restore db --allow-same-cluster --db "$DB" -s "local://$TEST_DIR/$DB$TABLE"
 
 run_sql "drop schema $DB;"
 
@@ -105,9 +105,9 @@ run_br --pd $PD_ADDR backup db --db "$DB" -s "local://$TEST_DIR/$DB$INCREMENTAL_
 run_sql "drop schema $DB;"
 
 # full restore
-run_br --pd $PD_ADDR restore db --db "$DB" -s "local://$TEST_DIR/$DB$TABLE"
+run_br --pd $PD_ADDR restore db --allow-same-cluster --db "$DB" -s "local://$TEST_DIR/$DB$TABLE"
 # incremental restore
-run_br --pd $PD_ADDR restore db --db "$DB" -s "local://$TEST_DIR/$DB$INCREMENTAL_TABLE"
+run_br --pd $PD_ADDR restore db --allow-same-cluster --db "$DB" -s "local://$TEST_DIR/$DB$INCREMENTAL_TABLE"
 
 run_sql "drop schema $DB;"
 
@@ -122,7 +122,7 @@ run_br --pd $PD_ADDR backup table --db "$DB" --table "$TABLE" -s "local://$TEST_
 run_sql "drop schema $DB;"
 
 # Table restore, restore normally without Duplicate entry
-run_br --pd $PD_ADDR restore table --db "$DB" --table "$TABLE" -s "local://$TEST_DIR/$DB$TABLE"
+run_br --pd $PD_ADDR restore table --allow-same-cluster --db "$DB" --table "$TABLE" -s "local://$TEST_DIR/$DB$TABLE"
 
 # run insert after restore
 run_sql "insert into $DB.$TABLE values (),(),(),(),();"
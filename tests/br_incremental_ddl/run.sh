@@ -53,7 +53,7 @@ run_br --pd $PD_ADDR backup table -s "local://$TEST_DIR/$DB/inc" --db $DB -t $TA
 run_sql "DROP DATABASE $DB;"
 # full restore
 echo "full restore start..."
-run_br restore table --db $DB --table $TABLE -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
+run_br restore table --allow-same-cluster --db $DB --table $TABLE -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
 row_count_full=$(run_sql "SELECT COUNT(*) FROM $DB.$TABLE;" | awk '/COUNT/{print $2}')
 # check full restore
 if [ "${row_count_full}" != "${ROW_COUNT}" ];then
@@ -62,7 +62,7 @@ if [ "${row_count_full}" != "${ROW_COUNT}" ];then
 fi
 # incremental restore
 echo "incremental restore start..."
-run_br restore table --db $DB --table $TABLE -s "local://$TEST_DIR/$DB/inc" --pd $PD_ADDR
+run_br restore table --allow-same-cluster --db $DB --table $TABLE -s "local://$TEST_DIR/$DB/inc" --pd $PD_ADDR
 row_count_inc=$(run_sql "SELECT COUNT(*) FROM $DB.$TABLE;" | awk '/COUNT/{print $2}')
 # check full restore
 if [ "${row_count_inc}" != "${ROW_COUNT}" ];then
@@ -51,7 +51,7 @@ run_sql "DROP DATABASE $DB;"
 
 # full restore
 echo "full restore start..."
-run_br restore table --db $DB --table $TABLE -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
+run_br restore table --allow-same-cluster --db $DB --table $TABLE -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
 row_count_full=$(run_sql "SELECT COUNT(*) FROM $DB.$TABLE;" | awk '/COUNT/{print $2}')
 # check full restore
 if [ "${row_count_full}" != "${ROW_COUNT}" ];then
@@ -61,7 +61,7 @@ fi
 # incremental restore
 echo "incremental restore start..."
 fail=false
-run_br restore table --db $DB --table $TABLE -s "local://$TEST_DIR/$DB/inc" --pd $PD_ADDR || fail=true
+run_br restore table --allow-same-cluster --db $DB --table $TABLE -s "local://$TEST_DIR/$DB/inc" --pd $PD_ADDR || fail=true
 if $fail; then
     echo "TEST: [$TEST_NAME] incremental restore fail on database $DB"
     exit 1
@@ -61,7 +61,7 @@ done
 
 # full restore
 echo "full restore start..."
-run_br restore full -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
+run_br restore full --allow-same-cluster -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
 row_count_full=$(run_sql "SELECT COUNT(*) FROM $DB.$TABLE;" | awk '/COUNT/{print $2}')
 # check full restore
 if [ "${row_count_full}" != "${ROW_COUNT}" ];then
@@ -71,7 +71,7 @@ fi
 
 # incremental restore only DB2.Table
 echo "incremental restore start..."
-run_br restore table --db ${DB}2 --table $TABLE -s "local://$TEST_DIR/$DB/inc" --pd $PD_ADDR
+run_br restore table --allow-same-cluster --db ${DB}2 --table $TABLE -s "local://$TEST_DIR/$DB/inc" --pd $PD_ADDR
 row_count_inc=$(run_sql "SELECT COUNT(*) FROM ${DB}2.$TABLE;" | awk '/COUNT/{print $2}')
 # check full restore
 if [ "${row_count_inc}" != "${ROW_COUNT}" ];then
@@ -35,7 +35,7 @@ run_sql "DROP TABLE $DB.$TABLE;"
 
 # restore table
 echo "restore start..."
-run_br restore table --db $DB --table $TABLE -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
+run_br restore table --allow-same-cluster --db $DB --table $TABLE -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
 
 row_count_new=$(run_sql "SELECT COUNT(*) FROM $DB.$TABLE;" | awk '/COUNT/{print $2}')
 
@@ -34,7 +34,7 @@ mv $TEST_DIR/$DB $TEST_DIR/another$DB
 
 # restore table with old path
 echo "restore with old path start..."
-run_br restore table --db $DB --table $TABLE -s "local://$TEST_DIR/$DB" --pd $PD_ADDR || restore_old_fail=1
+run_br restore table --allow-same-cluster --db $DB --table $TABLE -s "local://$TEST_DIR/$DB" --pd $PD_ADDR || restore_old_fail=1
 
 if [ "$restore_old_fail" -ne "1" ];then
     echo "TEST: [$TEST_NAME] test restore with old path failed!"
@@ -43,7 +43,7 @@ fi
 
 # restore table
 echo "restore start..."
-run_br restore table --db $DB --table $TABLE -s "local://$TEST_DIR/another$DB" --pd $PD_ADDR
+run_br restore table --allow-same-cluster --db $DB --table $TABLE -s "local://$TEST_DIR/another$DB" --pd $PD_ADDR
 
 row_count_new=$(run_sql "SELECT COUNT(*) FROM $DB.$TABLE;" | awk '/COUNT/{print $2}')
 
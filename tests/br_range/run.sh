@@ -34,6 +34,6 @@ run_sql "drop schema $DB;"
 
 # restore db
 echo "restore start..."
-run_br restore db --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
+run_br restore db --allow-same-cluster --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
 
 run_sql "drop schema $DB;"
\ No newline at end of file
@@ -58,7 +58,7 @@ fi
 
 # restore rawkv
 echo "restore start..."
-run_br --pd $PD_ADDR restore raw -s "local://$TEST_DIR/$BACKUP_DIR" --start 31 --end 3130303030303030 --format hex
+run_br --pd $PD_ADDR restore raw --allow-same-cluster -s "local://$TEST_DIR/$BACKUP_DIR" --start 31 --end 3130303030303030 --format hex
 
 checksum_new=$(checksum 31 3130303030303030)
 
@@ -79,7 +79,7 @@ if [ "$checksum_new" != "$checksum_empty" ];then
 fi
 
 echo "partial restore start..."
-run_br --pd $PD_ADDR restore raw -s "local://$TEST_DIR/$BACKUP_DIR" --start 311111 --end 311122 --format hex --concurrency 4
+run_br --pd $PD_ADDR restore raw --allow-same-cluster -s "local://$TEST_DIR/$BACKUP_DIR" --start 311111 --end 311122 --format hex --concurrency 4
 bin/rawkv --pd $PD_ADDR --mode scan --start-key 311121 --end-key 33
 
 checksum_new=$(checksum 31 3130303030303030)
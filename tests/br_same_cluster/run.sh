@@ -0,0 +1,58 @@
+#!/bin/sh
+#
+# Copyright 2020 PingCAP, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -eu
+DB="$TEST_NAME"
+LOG="$TEST_DIR/$DB.log"
+
+run_sql "CREATE DATABASE $DB;"
+run_sql "CREATE TABLE $DB.usertable1 (id int PRIMARY KEY, v varchar(16));"
+run_sql "INSERT INTO $DB.usertable1 VALUES (1, 'a'), (2, 'b');"
+
+echo "backup start..."
+run_br --pd $PD_ADDR backup db --db "$DB" -s "local://$TEST_DIR/$DB"
+
+run_sql "DROP DATABASE $DB;"
+
+# The backup is refused to be restored into the cluster it was taken from.
+echo "restore without --allow-same-cluster start..."
+unset BR_LOG_TO_TERM
+fail=false
+run_br restore db --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR --log-file $LOG || fail=true
+export BR_LOG_TO_TERM=1
+if ! $fail; then
+    echo "TEST: [$TEST_NAME] restore into the source cluster must fail without --allow-same-cluster"
+    exit 1
+fi
+if ! grep -q "ErrRestoreSameCluster" $LOG; then
+    echo "TEST: [$TEST_NAME] restore failed for another reason"
+    cat $LOG
+    exit 1
+fi
+if run_sql "use $DB;"; then
+    echo "TEST: [$TEST_NAME] the refused restore created the database"
+    exit 1
+fi
+
+echo "restore with --allow-same-cluster start..."
+run_br restore db --allow-same-cluster --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
+
+row_count=$(run_sql "SELECT COUNT(*) FROM $DB.usertable1;" | awk '/COUNT/{print $2}')
+if [ "$row_count" -ne "2" ]; then
+    echo "TEST: [$TEST_NAME] failed, restored $row_count rows"
+    exit 1
+fi
+
+run_sql "DROP DATABASE $DB;"
@@ -35,7 +35,7 @@ run_sql "DROP TABLE $DB.$TABLE;"
 
 # restore with shuffle leader
 echo "restore start..."
-run_br restore table --db $DB --table $TABLE -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
+run_br restore table --allow-same-cluster --db $DB --table $TABLE -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
 
 # remove shuffle leader scheduler
 echo "-u $PD_ADDR -d sched remove shuffle-leader-scheduler" | pd-ctl
@@ -35,7 +35,7 @@ run_sql "DROP TABLE $DB.$TABLE;"
 
 # restore with shuffle region
 echo "restore start..."
-run_br restore table --db $DB --table $TABLE -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
+run_br restore table --allow-same-cluster --db $DB --table $TABLE -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
 
 # remove shuffle region scheduler
 echo "-u $PD_ADDR -d sched remove shuffle-region-scheduler" | pd-ctl
@@ -68,7 +68,7 @@ run_sql "drop database $DB"
 
 echo "restore start..."
 GO_FAILPOINTS="github.com/pingcap/br/pkg/task/small-batch-size=return(2)" \
-run_br restore full -s "local://$backup_dir" --pd $PD_ADDR --ratelimit 1024
+run_br restore full --allow-same-cluster -s "local://$backup_dir" --pd $PD_ADDR --ratelimit 1024
 
 for i in $record_counts; do
     check_size "t$i" $i
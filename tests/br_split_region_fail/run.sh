@@ -46,7 +46,7 @@ echo "restore start..."
 unset BR_LOG_TO_TERM
 GO_FAILPOINTS="github.com/pingcap/br/pkg/restore/not-leader-error=1*return(true)->1*return(false);\
 github.com/pingcap/br/pkg/restore/somewhat-retryable-error=3*return(true)" \
-run_br restore full -s "local://$TEST_DIR/$DB" --pd $PD_ADDR --ratelimit 1024 --log-file $LOG || true
+run_br restore full --allow-same-cluster -s "local://$TEST_DIR/$DB" --pd $PD_ADDR --ratelimit 1024 --log-file $LOG || true
 BR_LOG_TO_TERM=1
 
 grep "a error occurs on split region" $LOG && \
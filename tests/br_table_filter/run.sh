@@ -38,7 +38,7 @@ echo 'Simple check'
 
 run_br backup full -f "$DB.*" -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
 run_sql "drop schema $DB;"
-run_br restore full -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
+run_br restore full --allow-same-cluster -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
 
 run_sql "select c from $DB.one;"
 run_sql "select c from $DB.two;"
@@ -52,7 +52,7 @@ echo 'Filtered backup check'
 
 run_br backup full -f "$DB.t*" -s "local://$TEST_DIR/$DB/t" --pd $PD_ADDR
 run_sql "drop schema $DB;"
-run_br restore full -s "local://$TEST_DIR/$DB/t" --pd $PD_ADDR
+run_br restore full --allow-same-cluster -s "local://$TEST_DIR/$DB/t" --pd $PD_ADDR
 
 ! run_sql "select c from $DB.one;"
 run_sql "select c from $DB.two;"
@@ -65,7 +65,7 @@ run_sql 'select c from '"$DB"'.`the,special,table`;'
 echo 'Filtered restore check'
 
 run_sql "drop schema $DB;"
-run_br restore full -f "*.f*" -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
+run_br restore full --allow-same-cluster -f "*.f*" -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
 
 ! run_sql "select c from $DB.one;"
 ! run_sql "select c from $DB.two;"
@@ -78,7 +78,7 @@ run_sql "select c from $DB.FIVE;"
 echo 'Multiple filters check'
 
 run_sql "drop schema $DB;"
-run_br restore full -f '*.*' -f '!*.five' -f '!*.`the,special,table`' -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
+run_br restore full --allow-same-cluster -f '*.*' -f '!*.five' -f '!*.`the,special,table`' -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
 
 run_sql "select c from $DB.one;"
 run_sql "select c from $DB.two;"
@@ -91,7 +91,7 @@ run_sql "select c from $DB.TEN;"
 echo 'Case sensitive restore check'
 
 run_sql "drop schema $DB;"
-run_br restore full --case-sensitive -f '*.t*' -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
+run_br restore full --allow-same-cluster --case-sensitive -f '*.t*' -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
 
 ! run_sql "select c from $DB.one;"
 run_sql "select c from $DB.two;"
@@ -104,10 +104,10 @@ run_sql 'select c from '"$DB"'.`the,special,table`;'
 echo 'Case sensitive backup check'
 
 run_sql "drop schema $DB;"
-run_br restore full --case-sensitive -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
+run_br restore full --allow-same-cluster --case-sensitive -s "local://$TEST_DIR/$DB/full" --pd $PD_ADDR
 run_br backup full --case-sensitive -f "$DB.[oF]*" -s "local://$TEST_DIR/$DB/of" --pd $PD_ADDR
 run_sql "drop schema $DB;"
-run_br restore full --case-sensitive -s "local://$TEST_DIR/$DB/of" --pd $PD_ADDR
+run_br restore full --allow-same-cluster --case-sensitive -s "local://$TEST_DIR/$DB/of" --pd $PD_ADDR
 
 run_sql "select c from $DB.one;"
 ! run_sql "select c from $DB.two;"
@@ -35,7 +35,7 @@ run_br backup db --db "$DB" -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
 run_sql "drop schema $DB;"
 
 echo "restore start..."
-run_br restore db --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
+run_br restore db --allow-same-cluster --db $DB -s "local://$TEST_DIR/$DB" --pd $PD_ADDR
 
 set -x
 